@@ -2,8 +2,15 @@ package assembly
 
 import (
 	"context"
+	"io"
 	"storage-service/conf"
+	"storage-service/service/antivirus"
+	"storage-service/service/expiration"
 	"storage-service/service/pending"
+	"storage-service/service/publisher"
+	"storage-service/service/reference"
+	"storage-service/service/trash"
+	"storage-service/service/webhook"
 
 	"github.com/Falokut/go-kit/cluster"
 	"github.com/Falokut/go-kit/dbx"
@@ -25,6 +32,7 @@ type Assembly struct {
 	minioCli *miniox.Client
 	server   *http.Server
 	logger   *log.Adapter
+	closers  []io.Closer
 }
 
 func New(boot *bootstrap.Bootstrap) (*Assembly, error) {
@@ -69,13 +77,37 @@ func (a *Assembly) ReceiveConfig(shortCtx context.Context, remoteConfig []byte)
 	if err != nil {
 		a.boot.Fatal(errors.WithMessage(err, "enqueu pending job"))
 	}
+	err = trash.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue trash job"))
+	}
+	err = expiration.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue expiration job"))
+	}
+	err = reference.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue references job"))
+	}
+	err = webhook.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue webhooks job"))
+	}
+	err = publisher.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue storage events job"))
+	}
+	err = antivirus.EnqueueSeedJob(shortCtx, bgjobCli)
+	if err != nil {
+		a.boot.Fatal(errors.WithMessage(err, "enqueue file scans job"))
+	}
 
 	minioCli, err := a.minioCli.Client()
 	if err != nil {
 		a.boot.Fatal(errors.WithMessage(err, "get minio client"))
 	}
 
-	locator := NewLocator(a.db, bgjobCli, minioCli, a.logger)
+	locator := NewLocator(a.db, pgDb.DB.DB, bgjobCli, minioCli, a.logger)
 	cfg, err := locator.LocatorConfig(shortCtx, newCfg)
 	if err != nil {
 		a.boot.Fatal(errors.WithMessage(err, "locator config"))
@@ -86,6 +118,9 @@ func (a *Assembly) ReceiveConfig(shortCtx context.Context, remoteConfig []byte)
 	}
 
 	a.server.Upgrade(cfg.HttpRouter)
+
+	a.closeAll()
+	a.closers = cfg.Closers
 	return nil
 }
 
@@ -121,5 +156,15 @@ func (a *Assembly) Closers() []app.Closer {
 		app.CloserFunc(func(ctx context.Context) error {
 			return a.server.Shutdown(ctx)
 		}),
+		app.CloserFunc(func(_ context.Context) error {
+			a.closeAll()
+			return nil
+		}),
+	}
+}
+
+func (a *Assembly) closeAll() {
+	for _, closer := range a.closers {
+		_ = closer.Close()
 	}
 }
@@ -2,14 +2,35 @@ package assembly
 
 import (
 	"context"
+	"database/sql"
+	"io"
 	"time"
 
 	"storage-service/conf"
 	"storage-service/controller"
+	"storage-service/entity"
 	"storage-service/repository"
 	"storage-service/routes"
 	"storage-service/service"
+	"storage-service/service/antivirus"
+	"storage-service/service/apikey"
+	"storage-service/service/audit"
+	"storage-service/service/auth"
+	"storage-service/service/bulk"
+	"storage-service/service/category"
+	"storage-service/service/expiration"
+	"storage-service/service/lock"
 	"storage-service/service/pending"
+	"storage-service/service/publisher"
+	"storage-service/service/quota"
+	"storage-service/service/ratelimit"
+	"storage-service/service/reference"
+	"storage-service/service/stream"
+	"storage-service/service/transform"
+	"storage-service/service/trash"
+	"storage-service/service/validation"
+	"storage-service/service/versioning"
+	"storage-service/service/webhook"
 	"storage-service/transaction"
 
 	"github.com/Falokut/go-kit/db"
@@ -19,6 +40,7 @@ import (
 	"github.com/Falokut/go-kit/http/router"
 	"github.com/Falokut/go-kit/log"
 	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
 	"github.com/txix-open/bgjob"
 )
 
@@ -35,18 +57,21 @@ type DB interface {
 type Locator struct {
 	logger   *log.Adapter
 	db       DB
+	sqlDb    *sql.DB
 	bgJobCli *bgjob.Client
 	minioCli *minio.Client
 }
 
 func NewLocator(
 	db DB,
+	sqlDb *sql.DB,
 	bgJobCli *bgjob.Client,
 	minioCli *minio.Client,
 	logger *log.Adapter,
 ) Locator {
 	return Locator{
 		db:       db,
+		sqlDb:    sqlDb,
 		bgJobCli: bgJobCli,
 		minioCli: minioCli,
 		logger:   logger,
@@ -56,37 +81,219 @@ func NewLocator(
 type Config struct {
 	HttpRouter *router.Router
 	Workers    []*bgjob.Worker
+	// Closers закрываются при получении новой конфигурации
+	Closers []io.Closer
 }
 
 func (l Locator) LocatorConfig(ctx context.Context, cfg conf.Remote) (*Config, error) {
 	txRunner := transaction.NewManager(l.db)
-	filesStorage := repository.NewMinioStorage(l.logger, l.minioCli)
+	usageRepo := repository.NewUsage(l.db)
+	filesStorage := repository.NewQuarantineStorage(
+		repository.NewMeteredStorage(repository.NewMinioStorage(l.logger, l.minioCli), usageRepo, l.logger),
+		repository.NewScan(l.db),
+		l.logger,
+	)
+	quotaService := quota.NewQuotas(txRunner, usageRepo, quota.Config{
+		Categories:     quotaLimits(cfg.Quotas.Categories),
+		Clients:        quotaLimits(cfg.Quotas.Clients),
+		DefaultClient:  entity.QuotaLimit(cfg.Quotas.DefaultClient),
+		ReservationTtl: time.Duration(cfg.Quotas.ReservationTtlInSec) * time.Second,
+	})
 
+	lockRepo := repository.NewLock(l.db)
+	categories := category.NewCategory(
+		txRunner,
+		repository.NewCategory(l.db),
+		filesStorage,
+		lockRepo,
+		l.bgJobCli,
+		category.Config{
+			Defaults:             categorySettings(cfg.Categories),
+			ConfirmationTokenTtl: time.Duration(cfg.CategoryDelete.ConfirmationTokenTtlInMin) * time.Minute,
+			PageSize:             cfg.CategoryDelete.PageSize,
+		},
+	)
+	lockService := lock.NewLocks(txRunner, filesStorage, lockRepo, categories)
+	eventRepo := repository.NewEvent(l.db)
+	eventPublisher, closers, err := l.eventPublisher(cfg.Events)
+	if err != nil {
+		return nil, errors.WithMessage(err, "event publisher")
+	}
+	outbox := publisher.NewOutbox(
+		eventRepo,
+		eventPublisher,
+		publisher.OutboxConfig{
+			BatchSize: cfg.Events.BatchSize,
+		},
+	)
 	pendingRepo := repository.NewPending(l.db)
-	pendingFileLifetime := time.Duration(cfg.Pending.FileLifetimeInMin) * time.Minute
 	pendingService := pending.NewPending(
 		txRunner,
 		filesStorage,
 		pendingRepo,
-		pendingFileLifetime,
-		cfg.Pending.MaxFilesToDelete,
+		pending.Config{
+			FileLifetime:       time.Duration(cfg.Pending.FileLifetimeInMin) * time.Minute,
+			MaxFileLifetime:    time.Duration(cfg.Pending.MaxFileLifetimeInMin) * time.Minute,
+			HistoryLifetime:    time.Duration(cfg.Pending.HistoryLifetimeInHours) * time.Hour,
+			MaxDeletedFiles:    cfg.Pending.MaxFilesToDelete,
+			MaxCleanupAttempts: cfg.Pending.MaxCleanupAttempts,
+			CleanupConcurrency: cfg.Pending.CleanupConcurrency,
+		},
+	)
+	err = pendingService.FillMissingExpirations(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "fill missing pending expirations")
+	}
+	trashRepo := repository.NewTrash(l.db)
+	trashService := trash.NewTrash(
+		txRunner,
+		filesStorage,
+		trashRepo,
+		categories,
+		time.Duration(cfg.Trash.DefaultRetentionInHours)*time.Hour,
+		cfg.Trash.MaxFilesToPurge,
+	)
+	expirationService := expiration.NewExpiration(
+		txRunner,
+		trashService,
+		repository.NewExpiration(l.db),
+		lockService,
+		cfg.Expiration.MaxFilesToDelete,
+	)
+	versionsService := versioning.NewVersions(
+		txRunner,
+		filesStorage,
+		repository.NewVersion(l.db),
+		categories,
+		lockService,
+	)
+	referenceService := reference.NewReferences(
+		txRunner,
+		filesStorage,
+		repository.NewReference(l.db),
+		trashService,
+		lockService,
+		reference.Config{
+			GracePeriod:     time.Duration(cfg.References.GracePeriodInHours) * time.Hour,
+			MaxDeletedFiles: cfg.References.MaxFilesToDelete,
+		},
+	)
+	antivirusService := antivirus.NewAntivirus(
+		l.scanner(cfg.Antivirus),
+		repository.NewScan(l.db),
+		filesStorage,
+		categories,
+		eventRepo,
+		l.logger,
+		antivirus.Config{
+			ScanTimeout: time.Duration(cfg.Antivirus.ScanTimeoutInSec) * time.Second,
+			RetryDelay:  time.Duration(cfg.Antivirus.RetryDelayInSec) * time.Second,
+			BatchSize:   cfg.Antivirus.BatchSize,
+		},
 	)
 	filesService := service.NewFiles(
 		filesStorage,
-		cfg.SupportedFileTypes,
+		validation.NewPipelines([]validation.Validator{validation.NewContentType(cfg.SupportedFileTypes)}),
 		pendingService,
+		trashService,
+		expirationService,
+		categories,
+		transform.NewImageMetadata(),
+		versionsService,
+		lockService,
+		txRunner,
+		quotaService,
+		antivirusService,
+		l.logger,
 	)
-	files := controller.NewFiles(filesService)
+	bulkService := bulk.NewBulk(
+		filesStorage,
+		trashService,
+		repository.NewBulkDelete(l.db),
+		lockService,
+		l.bgJobCli,
+		bulk.Config{
+			MaxFilenames:    cfg.BulkDelete.MaxFilenames,
+			SyncPrefixLimit: cfg.BulkDelete.SyncPrefixLimit,
+			PageSize:        cfg.BulkDelete.PageSize,
+		},
+	)
+	webhookService := webhook.NewWebhooks(
+		txRunner,
+		repository.NewWebhook(l.db),
+		webhook.Config{
+			BatchSize:      cfg.Webhooks.BatchSize,
+			Concurrency:    cfg.Webhooks.Concurrency,
+			MaxAttempts:    cfg.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Webhooks.InitialBackoffInSec) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Webhooks.MaxBackoffInSec) * time.Second,
+			Timeout:        time.Duration(cfg.Webhooks.TimeoutInSec) * time.Second,
+			EventRetention: time.Duration(cfg.Webhooks.EventRetentionInHours) * time.Hour,
+			Subscriptions:  webhookSubscriptions(cfg.Webhooks.Subscriptions),
+		},
+	)
+	err = webhookService.SyncSubscriptions(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "sync webhook subscriptions")
+	}
+
+	eventHub := stream.NewHub(repository.NewNotifications(l.sqlDb), eventRepo, l.logger)
+	closers = append(closers, eventHub)
+
+	adminAuth := controller.NewAdminAuth(cfg.AdminToken, cfg.Auth.Enabled)
+	clientIps, err := controller.NewClientIps(cfg.TrustedProxies)
+	if err != nil {
+		return nil, errors.WithMessage(err, "client ips")
+	}
+	apiKeyService := apikey.NewApiKeys(repository.NewApiKey(l.db))
+	authController, err := l.auth(cfg.Auth, apiKeyService, clientIps)
+	if err != nil {
+		return nil, errors.WithMessage(err, "auth")
+	}
+	files := controller.NewFiles(filesService, adminAuth)
+	rateLimiter := ratelimit.NewLimiter(ratelimit.Config{
+		Client:             rateLimit(cfg.RateLimits.Client),
+		Clients:            rateLimits(cfg.RateLimits.Clients),
+		Routes:             rateLimits(cfg.RateLimits.Routes),
+		MaxClientTransfers: cfg.RateLimits.MaxConcurrentTransfersPerClient,
+		MaxTransfers:       cfg.RateLimits.MaxConcurrentTransfers,
+		Ip:                 rateLimit(cfg.RateLimits.Ip),
+	})
+	rateLimits := controller.NewRateLimits(rateLimiter, clientIps)
 	c := routes.Router{
-		Files: files,
+		Files:    files,
+		Trash:    controller.NewTrash(trashService),
+		Bulk:     controller.NewBulk(bulkService, adminAuth),
+		Category: controller.NewCategory(categories),
+		Versions: controller.NewVersions(versionsService, adminAuth),
+		Locks:    controller.NewLocks(lockService, adminAuth),
+		Groups:   controller.NewPendingGroups(filesService, adminAuth),
+		Pending:  controller.NewPendingAdmin(filesService, adminAuth),
+		Refs:     controller.NewReferences(referenceService, adminAuth),
+		Webhooks: controller.NewWebhooks(webhookService, adminAuth),
+		Events:   controller.NewEventStream(eventHub, adminAuth),
+		Audit:    controller.NewAudit(audit.NewAudit(repository.NewAudit(l.db)), adminAuth, clientIps, l.logger),
+		Auth:     authController,
+		ApiKeys:  controller.NewApiKeys(apiKeyService, adminAuth),
+		Quotas:   controller.NewQuotas(quotaService, adminAuth),
+		Limits:   rateLimits,
 	}
 
-	defaultWrapper := newWrapper(l.logger, cfg.MaxFileSizeMb*mb)
+	defaultWrapper := newWrapper(l.logger, cfg.MaxFileSizeMb*mb, rateLimits)
 	mux := c.Handler(defaultWrapper)
 	observer := service.NewObserver(l.logger)
 
 	pendingFileController := controller.NewPendingWorker(pendingService)
+	trashController := controller.NewTrashWorker(trashService)
+	expirationController := controller.NewExpirationWorker(expirationService)
+	bulkDeleteController := controller.NewBulkDeleteWorker(bulkService)
+	categoryDeleteController := controller.NewCategoryDeleteWorker(categories)
+	referenceController := controller.NewReferenceWorker(referenceService)
+	webhookController := controller.NewWebhookWorker(webhookService)
+	eventRelayController := controller.NewEventRelayWorker(outbox)
+	scanController := controller.NewScanWorker(antivirusService)
 
+	eventHub.Run()
 	return &Config{
 		HttpRouter: mux,
 		Workers: []*bgjob.Worker{
@@ -97,11 +304,122 @@ func (l Locator) LocatorConfig(ctx context.Context, cfg conf.Remote) (*Config, e
 				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
 				bgjob.WithObserver(observer),
 			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				trash.WorkerQueueName,
+				trashController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				expiration.WorkerQueueName,
+				expirationController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				bulk.WorkerQueueName,
+				bulkDeleteController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				category.WorkerQueueName,
+				categoryDeleteController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				reference.WorkerQueueName,
+				referenceController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				webhook.WorkerQueueName,
+				webhookController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				publisher.WorkerQueueName,
+				eventRelayController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
+			bgjob.NewWorker(
+				l.bgJobCli,
+				antivirus.WorkerQueueName,
+				scanController,
+				bgjob.WithPollInterval(5*time.Second), // nolint:mnd
+				bgjob.WithObserver(observer),
+			),
 		},
+		Closers: closers,
 	}, nil
 }
 
-func newWrapper(logger log.Logger, maxRequestBody int64) endpoint.Wrapper {
+func (l Locator) eventPublisher(cfg conf.Events) (publisher.EventPublisher, []io.Closer, error) {
+	switch cfg.Publisher {
+	case publisher.TypeLog:
+		return publisher.NewLog(l.logger), nil, nil
+	case publisher.TypeAmqp:
+		if cfg.Amqp.Url == "" {
+			return nil, nil, errors.New("events.amqp.url is required for amqp publisher")
+		}
+		amqpPublisher := publisher.NewAmqp(publisher.AmqpConfig{
+			Url:              cfg.Amqp.Url,
+			Exchange:         cfg.Amqp.Exchange,
+			RoutingKeyPrefix: cfg.Amqp.RoutingKeyPrefix,
+			ConfirmTimeout:   time.Duration(cfg.Amqp.ConfirmTimeoutInSec) * time.Second,
+		})
+		return amqpPublisher, []io.Closer{amqpPublisher}, nil
+	default:
+		return publisher.NewNoop(), nil, nil
+	}
+}
+
+// scanner без адреса clamd файлы категорий с проверкой остаются на карантине
+func (l Locator) scanner(cfg conf.Antivirus) antivirus.Scanner {
+	if cfg.Address == "" {
+		return nil
+	}
+	return antivirus.NewClamd(antivirus.ClamdConfig{
+		Network: cfg.Network,
+		Address: cfg.Address,
+		Timeout: time.Duration(cfg.TimeoutInSec) * time.Second,
+	})
+}
+
+// auth API ключи принимаются всегда, bearer токены только при включённой проверке и указанном алгоритме
+func (l Locator) auth(cfg conf.Auth, apiKeys controller.ApiKeyResolver, clientIps controller.ClientIps) (controller.Auth, error) {
+	if !cfg.Enabled || cfg.Algorithm == "" {
+		return controller.NewAuth(nil, apiKeys, clientIps, cfg.Enabled), nil
+	}
+	verifier, err := auth.NewVerifier(auth.Config{
+		Algorithm:        cfg.Algorithm,
+		HmacSecret:       cfg.HmacSecret,
+		PublicKeys:       cfg.PublicKeys,
+		JwksFile:         cfg.JwksFile,
+		Issuer:           cfg.Issuer,
+		Audience:         cfg.Audience,
+		PermissionsClaim: cfg.PermissionsClaim,
+		Leeway:           time.Duration(cfg.LeewayInSec) * time.Second,
+	})
+	if err != nil {
+		return controller.Auth{}, errors.WithMessage(err, "new token verifier")
+	}
+	return controller.NewAuth(verifier, apiKeys, clientIps, cfg.Enabled), nil
+}
+
+// newWrapper ограничение частоты запросов по IP адресу выполняется для всех маршрутов до проверки учётных данных
+func newWrapper(logger log.Logger, maxRequestBody int64, rateLimits controller.RateLimits) endpoint.Wrapper {
 	wrapper := endpoint.DefaultWrapper(logger, nil)
 	wrapper.Middlewares = []http2.Middleware{
 		endpoint.MaxRequestBodySize(maxRequestBody),
@@ -109,6 +427,69 @@ func newWrapper(logger log.Logger, maxRequestBody int64) endpoint.Wrapper {
 		http2.Middleware(hlog.Log(logger, false)),
 		endpoint.ErrorHandler(logger),
 		endpoint.Recovery(),
+		rateLimits.IpMiddleware(),
 	}
 	return wrapper
 }
+
+func quotaLimits(limits map[string]conf.QuotaLimit) map[string]entity.QuotaLimit {
+	result := make(map[string]entity.QuotaLimit, len(limits))
+	for name, limit := range limits {
+		result[name] = entity.QuotaLimit(limit)
+	}
+	return result
+}
+
+func rateLimit(limit conf.RateLimit) ratelimit.Limit {
+	return ratelimit.Limit{
+		Rate:  limit.RequestsPerSec,
+		Burst: limit.Burst,
+	}
+}
+
+func rateLimits(limits map[string]conf.RateLimit) map[string]ratelimit.Limit {
+	result := make(map[string]ratelimit.Limit, len(limits))
+	for key, limit := range limits {
+		result[key] = rateLimit(limit)
+	}
+	return result
+}
+
+func categorySettings(categories map[string]conf.Category) map[string]entity.CategorySettings {
+	settings := make(map[string]entity.CategorySettings, len(categories))
+	for name, category := range categories {
+		settings[name] = entity.CategorySettings{
+			StripImageMetadata: category.StripImageMetadata,
+			TrashRetention:     time.Duration(category.TrashRetentionInHours) * time.Hour,
+			Versioning:         category.Versioning,
+			MaxVersions:        category.MaxVersions,
+			RetentionMode:      category.RetentionMode,
+			RetentionPeriod:    time.Duration(category.RetentionPeriodInDays) * entity.Day,
+			LegalHold:          category.LegalHold,
+			DefaultVisibility:  category.DefaultVisibility,
+			ScanMode:           category.ScanMode,
+			InfectedAction:     category.InfectedAction,
+			Validation: entity.CategoryValidation{
+				Image: entity.ImageValidation(category.Validation.Image),
+				Zip:   entity.ZipValidation(category.Validation.Zip),
+				Pdf:   entity.PdfValidation(category.Validation.Pdf),
+				Text:  entity.TextValidation(category.Validation.Text),
+			},
+		}
+	}
+	return settings
+}
+
+func webhookSubscriptions(subscriptions map[string]conf.WebhookSubscription) []entity.WebhookSubscription {
+	result := make([]entity.WebhookSubscription, 0, len(subscriptions))
+	for name, subscription := range subscriptions {
+		result = append(result, entity.WebhookSubscription{
+			Name:       name,
+			Url:        subscription.Url,
+			Secret:     subscription.Secret,
+			Categories: subscription.Categories,
+			EventTypes: subscription.EventTypes,
+		})
+	}
+	return result
+}
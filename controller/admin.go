@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+// AdminAuth проверяет привилегированный доступ по разрешению admin проверенного API ключа или bearer токена,
+// общий токен из заголовка domain.AdminTokenHeader принимается только при выключенной проверке учётных данных
+type AdminAuth struct {
+	token       string
+	authEnabled bool
+}
+
+func NewAdminAuth(token string, authEnabled bool) AdminAuth {
+	return AdminAuth{
+		token:       token,
+		authEnabled: authEnabled,
+	}
+}
+
+func (a AdminAuth) IsAdmin(r *http.Request) bool {
+	principal, ok := principalFromContext(r.Context())
+	if ok {
+		return principal.Allowed(entity.PermissionAdmin)
+	}
+	if a.authEnabled || a.token == "" {
+		return false
+	}
+	token := r.Header.Get(domain.AdminTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type ApiKeyService interface {
+	Create(ctx context.Context, key entity.ApiKey) (*entity.ApiKey, string, error)
+	List(ctx context.Context, includeRevoked bool) ([]entity.ApiKey, error)
+	Rotate(ctx context.Context, id string, gracePeriod time.Duration) (*entity.ApiKey, string, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type ApiKeys struct {
+	service ApiKeyService
+	admin   AdminAuth
+}
+
+func NewApiKeys(service ApiKeyService, admin AdminAuth) ApiKeys {
+	return ApiKeys{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// Create
+//
+//	@Tags			api-key-admin
+//	@Summary		Create api key
+//	@Description	Выпустить API ключ клиента сервиса с ограничением категорий, операций и адресов, требуется X-Admin-Token.
+//	@Description	Значение ключа возвращается только в ответе и передаётся клиентом в заголовке X-Api-Key
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			body			body		domain.CreateApiKeyRequest	true	"Параметры ключа"
+//	@Param			X-Admin-Token	header		string						true	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	domain.ApiKeySecret
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		409				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/api-keys [POST]
+func (c ApiKeys) Create(ctx context.Context, r *http.Request, req domain.CreateApiKeyRequest) (*domain.ApiKeySecret, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	key, secret, err := c.service.Create(ctx, entity.ApiKey{
+		Name:       req.Name,
+		Categories: req.Categories,
+		Operations: req.Operations,
+		AllowedIps: req.AllowedIps,
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return &domain.ApiKeySecret{
+		ApiKey: toDomainApiKey(*key),
+		Key:    secret,
+	}, nil
+}
+
+// List
+//
+//	@Tags			api-key-admin
+//	@Summary		List api keys
+//	@Description	Получить API ключи от новых к старым без значений секретов, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			includeRevoked	query		bool	false	"Включить отозванные ключи"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.ApiKey
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/api-keys [GET]
+func (c ApiKeys) List(ctx context.Context, r *http.Request, req domain.ApiKeyListRequest) ([]domain.ApiKey, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	keys, err := c.service.List(ctx, req.IncludeRevoked)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := make([]domain.ApiKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, toDomainApiKey(key))
+	}
+	return result, nil
+}
+
+// Rotate
+//
+//	@Tags			api-key-admin
+//	@Summary		Rotate api key
+//	@Description	Выпустить новый секрет API ключа, предыдущий секрет принимается ещё gracePeriodInSec секунд,
+//	@Description	требуется X-Admin-Token
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			id				path		string						true	"Идентификатор ключа"
+//	@Param			body			body		domain.RotateApiKeyRequest	true	"Параметры ротации"
+//	@Param			X-Admin-Token	header		string						true	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	domain.ApiKeySecret
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		404				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/api-keys/{id}/rotate [POST]
+func (c ApiKeys) Rotate(ctx context.Context, r *http.Request, req domain.RotateApiKeyRequest) (*domain.ApiKeySecret, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	key, secret, err := c.service.Rotate(ctx, req.Id, time.Duration(req.GracePeriodInSec)*time.Second)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return &domain.ApiKeySecret{
+		ApiKey: toDomainApiKey(*key),
+		Key:    secret,
+	}, nil
+}
+
+// Revoke
+//
+//	@Tags			api-key-admin
+//	@Summary		Revoke api key
+//	@Description	Отозвать API ключ, запросы с ним сразу отклоняются, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			id				path		string	true	"Идентификатор ключа"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	any
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		404				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/api-keys/{id} [DELETE]
+func (c ApiKeys) Revoke(ctx context.Context, r *http.Request, req domain.ApiKeyIdRequest) error {
+	if !c.admin.IsAdmin(r) {
+		return handleError(domain.ErrForbidden)
+	}
+	return handleError(c.service.Revoke(ctx, req.Id))
+}
+
+func toDomainApiKey(key entity.ApiKey) domain.ApiKey {
+	return domain.ApiKey{
+		Id:                key.Id,
+		Name:              key.Name,
+		Categories:        key.Categories,
+		Operations:        key.Operations,
+		AllowedIps:        key.AllowedIps,
+		ExpiresAt:         key.ExpiresAt,
+		PreviousExpiresAt: key.PreviousExpiresAt,
+		CreatedAt:         key.CreatedAt,
+		RotatedAt:         key.RotatedAt,
+		RevokedAt:         key.RevokedAt,
+	}
+}
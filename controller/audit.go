@@ -0,0 +1,430 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	http2 "github.com/Falokut/go-kit/http"
+	"github.com/Falokut/go-kit/log"
+	"github.com/Falokut/go-kit/requestid"
+	"github.com/pkg/errors"
+)
+
+const (
+	auditFormatJsonl   = "jsonl"
+	auditRecordTimeout = 5 * time.Second
+)
+
+var auditCsvHeader = []string{
+	"id", "createdAt", "action", "outcome", "statusCode", "actor", "clientIp", "requestId",
+	"category", "filename", "bytesReceived", "bytesSent", "error",
+}
+
+type AuditService interface {
+	Record(ctx context.Context, record entity.AuditRecord) error
+	List(ctx context.Context, filter entity.AuditFilter) ([]entity.AuditRecord, error)
+	Export(ctx context.Context, filter entity.AuditFilter, write func(record entity.AuditRecord) error) error
+}
+
+type Audit struct {
+	service   AuditService
+	admin     AdminAuth
+	clientIps ClientIps
+	logger    log.Logger
+}
+
+func NewAudit(service AuditService, admin AdminAuth, clientIps ClientIps, logger log.Logger) Audit {
+	return Audit{
+		service:   service,
+		admin:     admin,
+		clientIps: clientIps,
+		logger:    logger,
+	}
+}
+
+// List
+//
+//	@Tags			audit
+//	@Summary		List audit records
+//	@Description	Получить записи журнала аудита от новых к старым, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			action			query		string	false	"Действие, например file.upload"
+//	@Param			actor			query		string	false	"Субъект API ключа, bearer токена или admin-token"
+//	@Param			category		query		string	false	"Категория файла"
+//	@Param			filename		query		string	false	"Идентификатор файла"
+//	@Param			outcome			query		string	false	"Результат: success, denied, failure"
+//	@Param			requestId		query		string	false	"Идентификатор запроса"
+//	@Param			from			query		string	false	"Запрос выполнен не раньше, в формате RFC3339"
+//	@Param			to				query		string	false	"Запрос выполнен не позже, в формате RFC3339"
+//	@Param			limit			query		int		false	"Максимальное количество записей, по умолчанию 100"
+//	@Param			offset			query		int		false	"Смещение"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.AuditRecord
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/audit [GET]
+func (c Audit) List(ctx context.Context, r *http.Request, req domain.AuditListRequest) ([]domain.AuditRecord, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	filter, err := toAuditFilter(req)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	filter.Limit = req.Limit
+	filter.Offset = req.Offset
+
+	records, err := c.service.List(ctx, *filter)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := make([]domain.AuditRecord, 0, len(records))
+	for _, record := range records {
+		result = append(result, toDomainAuditRecord(record))
+	}
+	return result, nil
+}
+
+// Export
+//
+//	@Tags			audit
+//	@Summary		Export audit records
+//	@Description	Выгрузить все записи журнала аудита, подходящие под фильтр, от старых к новым, требуется X-Admin-Token.
+//	@Description	Записи передаются потоком по мере чтения из базы
+//	@Produce		text/csv
+//	@Produce		application/x-ndjson
+//
+//	@Param			format			query		string	false	"Формат: csv или jsonl, по умолчанию csv"
+//	@Param			action			query		string	false	"Действие, например file.upload"
+//	@Param			actor			query		string	false	"Субъект API ключа, bearer токена или admin-token"
+//	@Param			category		query		string	false	"Категория файла"
+//	@Param			filename		query		string	false	"Идентификатор файла"
+//	@Param			outcome			query		string	false	"Результат: success, denied, failure"
+//	@Param			requestId		query		string	false	"Идентификатор запроса"
+//	@Param			from			query		string	false	"Запрос выполнен не раньше, в формате RFC3339"
+//	@Param			to				query		string	false	"Запрос выполнен не позже, в формате RFC3339"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		byte
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/audit/export [GET]
+func (c Audit) Export(ctx context.Context, w http.ResponseWriter, r *http.Request, req domain.AuditExportRequest) error {
+	if !c.admin.IsAdmin(r) {
+		return handleError(domain.ErrForbidden)
+	}
+
+	filter, err := toAuditFilter(domain.AuditListRequest{
+		Action:    req.Action,
+		Actor:     req.Actor,
+		Category:  req.Category,
+		Filename:  req.Filename,
+		Outcome:   req.Outcome,
+		RequestId: req.RequestId,
+		From:      req.From,
+		To:        req.To,
+	})
+	if err != nil {
+		return handleError(err)
+	}
+
+	export := &auditExport{w: w, jsonl: req.Format == auditFormatJsonl}
+	err = c.service.Export(ctx, *filter, export.write)
+	if err == nil {
+		err = export.finish()
+	}
+	if err != nil && export.started {
+		// часть выгрузки уже отправлена с кодом 200, ошибку нельзя передать кодом ответа,
+		// поэтому соединение разрывается, чтобы клиент не принял неполную выгрузку за полную
+		abortResponse(w)
+	}
+	return err
+}
+
+// auditExport начинает ответ при первой записи, поэтому ошибка чтения первой страницы журнала
+// возвращается клиенту обычным кодом ответа
+type auditExport struct {
+	w       http.ResponseWriter
+	jsonl   bool
+	started bool
+	encoder *json.Encoder
+	csv     *csv.Writer
+}
+
+func (e *auditExport) start() error {
+	e.started = true
+	if e.jsonl {
+		e.w.Header().Set("Content-Type", "application/x-ndjson")
+		e.w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		e.encoder = json.NewEncoder(e.w)
+		return nil
+	}
+	e.w.Header().Set("Content-Type", "text/csv")
+	e.w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+	e.csv = csv.NewWriter(e.w)
+	return errors.WithMessage(e.csv.Write(auditCsvHeader), "write csv header")
+}
+
+func (e *auditExport) write(record entity.AuditRecord) error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+	if e.jsonl {
+		return e.encoder.Encode(toDomainAuditRecord(record))
+	}
+	return e.csv.Write(auditCsvRow(record))
+}
+
+func (e *auditExport) finish() error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+	if e.jsonl {
+		return nil
+	}
+	e.csv.Flush()
+	return errors.WithMessage(e.csv.Error(), "flush csv")
+}
+
+// abortResponse разрывает соединение вместо завершения ответа,
+// клиент получает ошибку чтения, а не ответ, похожий на полный
+func abortResponse(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+}
+
+// Middleware записывает в журнал аудита запрос к маршруту path,
+// категория и имя файла берутся из параметров маршрута
+func (c Audit) Middleware(action string, path string) http2.Middleware {
+	return func(next http2.HandlerFunc) http2.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			createdAt := time.Now().UTC()
+			params := pathParams(path, r.URL.Path)
+			target := &auditTarget{
+				actor:    actor(r, c.admin),
+				category: params["category"],
+				filename: params["filename"],
+			}
+			if target.category == "" {
+				target.category = params["name"]
+			}
+			ctx = context.WithValue(ctx, auditTargetKey{}, target)
+			body := &countingReader{ReadCloser: r.Body}
+			r.Body = body
+			writer := &auditResponseWriter{ResponseWriter: w}
+
+			err := next(ctx, writer, r)
+
+			record := entity.AuditRecord{
+				Action:        action,
+				Actor:         target.actor,
+				ClientIp:      c.clientIps.Of(r),
+				RequestId:     requestid.FromContext(ctx),
+				Category:      target.category,
+				Filename:      target.filename,
+				BytesReceived: body.count,
+				BytesSent:     writer.count,
+				StatusCode:    auditStatusCode(writer.status, err),
+				CreatedAt:     createdAt,
+			}
+			record.Outcome = auditOutcome(record.StatusCode)
+			if err != nil {
+				record.Error = err.Error()
+			}
+
+			recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditRecordTimeout)
+			defer cancel()
+			recordErr := c.service.Record(recordCtx, record)
+			if recordErr != nil {
+				c.logger.Error(ctx, "audit: record request", log.String("action", action), log.Any("error", recordErr))
+			}
+			return err
+		}
+	}
+}
+
+type auditTargetKey struct{}
+
+// auditTarget инициатор и файл запроса, обработчик может уточнить их,
+// если имя файла не передано в маршруте или инициатор подтверждён токеном
+type auditTarget struct {
+	actor    string
+	category string
+	filename string
+}
+
+func setAuditActor(ctx context.Context, actor string) {
+	target, ok := ctx.Value(auditTargetKey{}).(*auditTarget)
+	if ok {
+		target.actor = actor
+	}
+}
+
+func setAuditFilename(ctx context.Context, filename string) {
+	target, ok := ctx.Value(auditTargetKey{}).(*auditTarget)
+	if ok {
+		target.filename = filename
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	count  int64
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+// Unwrap нужен http.ResponseController, например для потока событий
+func (w *auditResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func auditStatusCode(written int, err error) int {
+	if err == nil {
+		if written == 0 {
+			return http.StatusOK
+		}
+		return written
+	}
+	var httpErr interface{ HttpStatusCode() int }
+	if errors.As(err, &httpErr) && httpErr.HttpStatusCode() != 0 {
+		return httpErr.HttpStatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+func auditOutcome(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return entity.AuditOutcomeDenied
+	case statusCode >= http.StatusBadRequest:
+		return entity.AuditOutcomeFailure
+	default:
+		return entity.AuditOutcomeSuccess
+	}
+}
+
+// pathParams сопоставляет сегменты пути запроса с параметрами маршрута вида :name
+func pathParams(pattern string, path string) map[string]string {
+	params := make(map[string]string)
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return params
+	}
+	for i, segment := range patternSegments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if ok {
+			params[name] = pathSegments[i]
+		}
+	}
+	return params
+}
+
+func toAuditFilter(req domain.AuditListRequest) (*entity.AuditFilter, error) {
+	filter := entity.AuditFilter{
+		Action:    req.Action,
+		Actor:     req.Actor,
+		Category:  req.Category,
+		Filename:  req.Filename,
+		Outcome:   req.Outcome,
+		RequestId: req.RequestId,
+	}
+	var err error
+	filter.CreatedAfter, err = parseOptionalTime(req.From, "from", domain.ErrCodeInvalidAuditFilter)
+	if err != nil {
+		return nil, err
+	}
+	filter.CreatedBefore, err = parseOptionalTime(req.To, "to", domain.ErrCodeInvalidAuditFilter)
+	if err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func toDomainAuditRecord(record entity.AuditRecord) domain.AuditRecord {
+	return domain.AuditRecord{
+		Id:            record.Id,
+		Action:        record.Action,
+		Actor:         record.Actor,
+		ClientIp:      record.ClientIp,
+		RequestId:     record.RequestId,
+		Category:      record.Category,
+		Filename:      record.Filename,
+		BytesReceived: record.BytesReceived,
+		BytesSent:     record.BytesSent,
+		StatusCode:    record.StatusCode,
+		Outcome:       record.Outcome,
+		Error:         record.Error,
+		CreatedAt:     record.CreatedAt,
+	}
+}
+
+func auditCsvRow(record entity.AuditRecord) []string {
+	return []string{
+		strconv.FormatInt(record.Id, 10),
+		record.CreatedAt.Format(time.RFC3339Nano),
+		record.Action,
+		record.Outcome,
+		strconv.Itoa(record.StatusCode),
+		record.Actor,
+		record.ClientIp,
+		record.RequestId,
+		record.Category,
+		record.Filename,
+		strconv.FormatInt(record.BytesReceived, 10),
+		strconv.FormatInt(record.BytesSent, 10),
+		record.Error,
+	}
+}
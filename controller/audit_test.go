@@ -0,0 +1,181 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"storage-service/controller"
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/log"
+)
+
+// auditService сохраняет записанные запросы и отдаёт записи выгрузки,
+// после records возвращает failAfter, если он задан
+type auditService struct {
+	recorded  []entity.AuditRecord
+	records   []entity.AuditRecord
+	failAfter error
+}
+
+func (s *auditService) Record(_ context.Context, record entity.AuditRecord) error {
+	s.recorded = append(s.recorded, record)
+	return nil
+}
+
+func (s *auditService) List(context.Context, entity.AuditFilter) ([]entity.AuditRecord, error) {
+	return s.records, nil
+}
+
+func (s *auditService) Export(_ context.Context, _ entity.AuditFilter, write func(record entity.AuditRecord) error) error {
+	for _, record := range s.records {
+		err := write(record)
+		if err != nil {
+			return err
+		}
+	}
+	return s.failAfter
+}
+
+func newAudit(t *testing.T, service *auditService) controller.Audit {
+	t.Helper()
+	clientIps, err := controller.NewClientIps([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("new client ips: %v", err)
+	}
+	var logger log.Logger
+	return controller.NewAudit(service, controller.NewAdminAuth("token", false), clientIps, logger)
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		path     string
+		handler  func(w http.ResponseWriter, r *http.Request) error
+		status   int
+		outcome  string
+		category string
+		filename string
+	}{
+		{
+			name: "success",
+			path: "/file/docs/a.txt",
+			handler: func(w http.ResponseWriter, r *http.Request) error {
+				_, _ = io.Copy(io.Discard, r.Body)
+				_, err := w.Write([]byte("hello"))
+				return err
+			},
+			status:   http.StatusOK,
+			outcome:  entity.AuditOutcomeSuccess,
+			category: "docs",
+			filename: "a.txt",
+		},
+		{
+			name: "denied",
+			path: "/file/docs/a.txt",
+			handler: func(w http.ResponseWriter, _ *http.Request) error {
+				w.WriteHeader(http.StatusForbidden)
+				return nil
+			},
+			status:   http.StatusForbidden,
+			outcome:  entity.AuditOutcomeDenied,
+			category: "docs",
+			filename: "a.txt",
+		},
+		{
+			name: "failure",
+			path: "/file/docs/a.txt",
+			handler: func(http.ResponseWriter, *http.Request) error {
+				return errors.New("storage is unavailable")
+			},
+			status:   http.StatusInternalServerError,
+			outcome:  entity.AuditOutcomeFailure,
+			category: "docs",
+			filename: "a.txt",
+		},
+		{
+			name: "path does not match route",
+			path: "/file/docs",
+			handler: func(http.ResponseWriter, *http.Request) error {
+				return nil
+			},
+			status:  http.StatusOK,
+			outcome: entity.AuditOutcomeSuccess,
+		},
+	}
+	for _, c := range cases {
+		service := &auditService{}
+		middleware := newAudit(t, service).Middleware(entity.AuditFileUpload, "/file/:category/:filename")
+		handler := middleware(func(_ context.Context, w http.ResponseWriter, r *http.Request) error {
+			return c.handler(w, r)
+		})
+
+		r := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader("body"))
+		r.RemoteAddr = "10.0.0.2:1234"
+		r.Header.Set("X-Forwarded-For", "1.1.1.1, 198.51.100.1")
+		r.Header.Set(domain.AdminTokenHeader, "token")
+		_ = handler(t.Context(), httptest.NewRecorder(), r)
+
+		if len(service.recorded) != 1 {
+			t.Fatalf("%s: expected one record, got %d", c.name, len(service.recorded))
+		}
+		record := service.recorded[0]
+		if record.StatusCode != c.status || record.Outcome != c.outcome {
+			t.Errorf("%s: expected %d %s, got %d %s", c.name, c.status, c.outcome, record.StatusCode, record.Outcome)
+		}
+		if record.Category != c.category || record.Filename != c.filename {
+			t.Errorf("%s: expected %s/%s, got %s/%s", c.name, c.category, c.filename, record.Category, record.Filename)
+		}
+		if record.Actor != entity.AdminTokenSubject {
+			t.Errorf("%s: expected admin token actor, got %q", c.name, record.Actor)
+		}
+		if record.ClientIp != "198.51.100.1" {
+			t.Errorf("%s: expected client behind trusted proxy, got %s", c.name, record.ClientIp)
+		}
+	}
+}
+
+func TestAuditExport(t *testing.T) {
+	t.Parallel()
+
+	records := []entity.AuditRecord{{Id: 1, Action: entity.AuditFileUpload}, {Id: 2, Action: entity.AuditFileDelete}}
+	export := func(service *auditService, format string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodGet, "/admin/audit/export", nil)
+		r.Header.Set(domain.AdminTokenHeader, "token")
+		w := httptest.NewRecorder()
+		err := newAudit(t, service).Export(t.Context(), w, r, domain.AuditExportRequest{Format: format})
+		return w, err
+	}
+
+	w, err := export(&auditService{records: records}, "")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,") || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected csv header and two records, got %q", w.Body.String())
+	}
+
+	// ошибка до первой записи возвращается без начала ответа
+	w, err = export(&auditService{failAfter: errors.New("db is unavailable")}, "jsonl")
+	if err == nil {
+		t.Fatal("expected export error")
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatalf("response must not be started, got %q", w.Body.String())
+	}
+
+	// ошибка после начала ответа не скрывается
+	_, err = export(&auditService{records: records, failAfter: errors.New("db is unavailable")}, "jsonl")
+	if err == nil {
+		t.Fatal("partial export must fail")
+	}
+}
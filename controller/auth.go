@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	http2 "github.com/Falokut/go-kit/http"
+)
+
+type TokenVerifier interface {
+	Verify(rawToken string) (*entity.Principal, error)
+}
+
+type ApiKeyResolver interface {
+	Resolve(ctx context.Context, rawKey string, remoteIp string) (*entity.Principal, error)
+}
+
+// Auth определяет субъекта запроса по API ключу или bearer токену и проверяет разрешения маршрута
+type Auth struct {
+	verifier  TokenVerifier
+	apiKeys   ApiKeyResolver
+	clientIps ClientIps
+	required  bool
+}
+
+// NewAuth при verifier == nil bearer токены не принимаются,
+// при required == false запросы без учётных данных проходят без проверки разрешений
+func NewAuth(verifier TokenVerifier, apiKeys ApiKeyResolver, clientIps ClientIps, required bool) Auth {
+	return Auth{
+		verifier:  verifier,
+		apiKeys:   apiKeys,
+		clientIps: clientIps,
+		required:  required,
+	}
+}
+
+// Middleware проверяет разрешение permission маршрута path, параметры маршрута в фигурных скобках,
+// например files:read:{category}, подставляются из пути запроса.
+// При anonymous запрос без учётных данных или без разрешения маршрута передаётся дальше как анонимный,
+// доступ к файлу в этом случае определяется его видимостью
+func (a Auth) Middleware(permission string, path string, anonymous bool) http2.Middleware {
+	return func(next http2.HandlerFunc) http2.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			principal, err := a.principal(ctx, r)
+			if err != nil {
+				return handleError(err)
+			}
+			if principal == nil {
+				switch {
+				case anonymous && a.required:
+					return next(asAnonymous(ctx, w, r))
+				case a.required:
+					return handleError(domain.ErrUnauthorized)
+				default:
+					return next(ctx, w, r)
+				}
+			}
+			setAuditActor(ctx, principal.Subject)
+
+			required := expandPermission(permission, pathParams(path, r.URL.Path))
+			if !principal.Allowed(required) && !principal.Allowed(entity.PermissionAdmin) {
+				if anonymous {
+					return next(asAnonymous(ctx, w, r))
+				}
+				return handleError(domain.ErrForbidden)
+			}
+
+			ctx = context.WithValue(ctx, principalKey{}, principal)
+			return next(ctx, w, r.WithContext(ctx))
+		}
+	}
+}
+
+// principal возвращает nil, если запрос не содержит учётных данных
+func (a Auth) principal(ctx context.Context, r *http.Request) (*entity.Principal, error) {
+	rawKey := r.Header.Get(domain.ApiKeyHeader)
+	if rawKey != "" {
+		return a.apiKeys.Resolve(ctx, rawKey, a.clientIps.Of(r))
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" || a.verifier == nil {
+		return nil, nil // nolint:nilnil
+	}
+	rawToken, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || rawToken == "" {
+		return nil, domain.ErrUnauthorized
+	}
+	return a.verifier.Verify(rawToken)
+}
+
+type principalKey struct{}
+
+type anonymousKey struct{}
+
+func asAnonymous(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, http.ResponseWriter, *http.Request) {
+	ctx = context.WithValue(ctx, anonymousKey{}, true)
+	return ctx, w, r.WithContext(ctx)
+}
+
+func principalFromContext(ctx context.Context) (*entity.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*entity.Principal)
+	return principal, ok
+}
+
+// accessor субъект операции с файлом: без учётных данных при выключенной проверке доступ не ограничивается,
+// как до появления владельцев файлов
+func accessor(r *http.Request, admin AdminAuth) entity.Accessor {
+	if admin.IsAdmin(r) {
+		return entity.Accessor{Unrestricted: true}
+	}
+	principal, ok := principalFromContext(r.Context())
+	if ok {
+		return entity.Accessor{Subject: principal.Subject, Permissions: principal.Permissions}
+	}
+	anonymous, _ := r.Context().Value(anonymousKey{}).(bool)
+	return entity.Accessor{Unrestricted: !anonymous}
+}
+
+// actor инициатор операции: субъект проверенных учётных данных или токена X-Admin-Token,
+// у запроса без учётных данных инициатора нет
+func actor(r *http.Request, admin AdminAuth) string {
+	principal, ok := principalFromContext(r.Context())
+	if ok {
+		return principal.Subject
+	}
+	if admin.IsAdmin(r) {
+		return entity.AdminTokenSubject
+	}
+	return ""
+}
+
+func expandPermission(permission string, params map[string]string) string {
+	for name, value := range params {
+		permission = strings.ReplaceAll(permission, "{"+name+"}", value)
+	}
+	return permission
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const (
+	bulkDeleteMaxAttempts = 10
+	bulkDeleteRetryTime   = time.Minute
+)
+
+type BulkService interface {
+	Delete(ctx context.Context, req entity.BulkDeleteRequest, accessor entity.Accessor) (*entity.BulkDeleteResult, error)
+	GetJob(ctx context.Context, category string, id string) (*entity.BulkDeleteJob, error)
+}
+
+type Bulk struct {
+	service BulkService
+	admin   AdminAuth
+}
+
+func NewBulk(service BulkService, admin AdminAuth) Bulk {
+	return Bulk{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// Delete
+//
+//	@Tags			bulk
+//	@Summary		Bulk delete files
+//	@Description	Удалить файлы категории по списку имён или по префиксу.
+//	@Description	Если по префиксу найдено больше файлов, чем можно удалить синхронно, удаление выполняется в фоне и возвращается задача.
+//	@Description	Файлы других владельцев не удаляются и возвращаются со статусом forbidden
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string						true	"Категория файла"
+//	@Param			body		body		domain.BulkDeleteRequest	true	"Список имён файлов или префикс"
+//
+//	@Success		200			{object}	domain.BulkDeleteResponse
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		401			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/bulk-delete/{category} [POST]
+func (c Bulk) Delete(ctx context.Context, r *http.Request, req domain.BulkDeleteRequest) (*domain.BulkDeleteResponse, error) {
+	result, err := c.service.Delete(ctx, entity.BulkDeleteRequest{
+		Category:  req.Category,
+		Filenames: req.Filenames,
+		Prefix:    req.Prefix,
+		DeletedBy: actor(r, c.admin),
+	}, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	files := make([]domain.BulkDeleteFileResult, 0, len(result.Files))
+	for _, file := range result.Files {
+		files = append(files, domain.BulkDeleteFileResult{
+			Filename: file.Filename,
+			Status:   file.Status,
+			Error:    file.Error,
+		})
+	}
+	response := &domain.BulkDeleteResponse{Files: files}
+	if result.Job != nil {
+		job := toDomainBulkDeleteJob(*result.Job)
+		response.Job = &job
+	}
+	return response, nil
+}
+
+// GetJob
+//
+//	@Tags			bulk
+//	@Summary		Bulk delete job status
+//	@Description	Получить состояние фонового удаления файлов по префиксу
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			jobId		path		string	true	"Идентификатор задачи"
+//
+//	@Success		200			{object}	domain.BulkDeleteJob
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/bulk-delete/{category}/{jobId} [GET]
+func (c Bulk) GetJob(ctx context.Context, req domain.BulkDeleteJobRequest) (*domain.BulkDeleteJob, error) {
+	job, err := c.service.GetJob(ctx, req.Category, req.JobId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainBulkDeleteJob(*job)
+	return &result, nil
+}
+
+func toDomainBulkDeleteJob(job entity.BulkDeleteJob) domain.BulkDeleteJob {
+	return domain.BulkDeleteJob{
+		Id:        job.Id,
+		Category:  job.Category,
+		Prefix:    job.Prefix,
+		Status:    job.Status,
+		Deleted:   job.Deleted,
+		Failed:    job.Failed,
+		LastError: job.LastError,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+type BulkDeleteJobService interface {
+	ProcessJob(ctx context.Context, id string) (bool, error)
+	FailJob(ctx context.Context, id string, reason error) error
+}
+
+type BulkDeleteWorker struct {
+	service BulkDeleteJobService
+}
+
+func NewBulkDeleteWorker(service BulkDeleteJobService) BulkDeleteWorker {
+	return BulkDeleteWorker{
+		service: service,
+	}
+}
+
+func (c BulkDeleteWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	jobId := string(job.Arg)
+	done, err := c.service.ProcessJob(ctx, jobId)
+	switch {
+	case err != nil && job.Attempt >= bulkDeleteMaxAttempts:
+		failErr := c.service.FailJob(ctx, jobId, err)
+		if failErr != nil {
+			return bgjob.Retry(bulkDeleteRetryTime, errors.WithMessage(failErr, "fail job"))
+		}
+		return bgjob.MoveToDlq(err)
+	case err != nil:
+		return bgjob.Retry(bulkDeleteRetryTime, err)
+	case done:
+		return bgjob.Complete()
+	default:
+		return bgjob.Reschedule(0)
+	}
+}
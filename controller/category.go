@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const (
+	categoryDeleteMaxAttempts = 10
+	categoryDeleteRetryTime   = time.Minute
+)
+
+type CategoryService interface {
+	List(ctx context.Context) ([]entity.CategoryInfo, error)
+	Get(ctx context.Context, name string) (*entity.CategoryInfo, error)
+	Create(ctx context.Context, name string, settings entity.CategorySettings) (*entity.Category, error)
+	Delete(ctx context.Context, name string) error
+	RequestForceDelete(ctx context.Context, name string) (*entity.CategoryDeleteToken, error)
+	ForceDelete(ctx context.Context, name string, token string) (*entity.CategoryDeleteJob, error)
+	GetDeleteJob(ctx context.Context, name string, id string) (*entity.CategoryDeleteJob, error)
+}
+
+type Category struct {
+	service CategoryService
+}
+
+func NewCategory(service CategoryService) Category {
+	return Category{
+		service: service,
+	}
+}
+
+// List
+//
+//	@Tags			category
+//	@Summary		List categories
+//	@Description	Получить список категорий с количеством и суммарным размером файлов, статистика обновляется не чаще раза в минуту
+//	@Produce		json
+//
+//	@Success		200	{array}		domain.Category
+//	@Failure		500	{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category [GET]
+func (c Category) List(ctx context.Context) ([]domain.Category, error) {
+	categories, err := c.service.List(ctx)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := make([]domain.Category, 0, len(categories))
+	for _, category := range categories {
+		result = append(result, toDomainCategory(category))
+	}
+	return result, nil
+}
+
+// Get
+//
+//	@Tags			category
+//	@Summary		Get category
+//	@Description	Получить настройки и статистику категории
+//	@Produce		json
+//
+//	@Param			name	path		string	true	"Название категории"
+//
+//	@Success		200		{object}	domain.Category
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		404		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category/{name} [GET]
+func (c Category) Get(ctx context.Context, req domain.CategoryRequest) (*domain.Category, error) {
+	category, err := c.service.Get(ctx, req.Name)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainCategory(*category)
+	return &result, nil
+}
+
+// Create
+//
+//	@Tags			category
+//	@Summary		Create category
+//	@Description	Создать категорию с настройками
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			body	body		domain.CreateCategoryRequest	true	"Категория"
+//
+//	@Success		200		{object}	domain.Category
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		409		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category [POST]
+func (c Category) Create(ctx context.Context, req domain.CreateCategoryRequest) (*domain.Category, error) {
+	category, err := c.service.Create(ctx, req.Name, fromDomainCategorySettings(req.Settings))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return &domain.Category{
+		Name:      category.Name,
+		Managed:   true,
+		Status:    category.Status,
+		Settings:  toDomainCategorySettings(category.Settings),
+		CreatedAt: &category.CreatedAt,
+	}, nil
+}
+
+// Delete
+//
+//	@Tags			category
+//	@Summary		Delete category
+//	@Description	Удалить категорию без файлов
+//	@Produce		json
+//
+//	@Param			name	path		string	true	"Название категории"
+//
+//	@Success		200		{object}	any
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		404		{object}	apierrors.Error
+//	@Failure		409		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category/{name} [DELETE]
+func (c Category) Delete(ctx context.Context, req domain.CategoryRequest) error {
+	return handleError(c.service.Delete(ctx, req.Name))
+}
+
+// RequestForceDelete
+//
+//	@Tags			category
+//	@Summary		Request force delete
+//	@Description	Получить токен подтверждения удаления категории вместе со всеми файлами
+//	@Produce		json
+//
+//	@Param			name	path		string	true	"Название категории"
+//
+//	@Success		200		{object}	domain.ConfirmationTokenResponse
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		404		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category/{name}/force-delete [POST]
+func (c Category) RequestForceDelete(ctx context.Context, req domain.CategoryRequest) (*domain.ConfirmationTokenResponse, error) {
+	token, err := c.service.RequestForceDelete(ctx, req.Name)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return &domain.ConfirmationTokenResponse{
+		ConfirmationToken: token.Token,
+		ExpiresAt:         token.ExpiresAt,
+	}, nil
+}
+
+// ForceDelete
+//
+//	@Tags			category
+//	@Summary		Force delete
+//	@Description	Запустить фоновое удаление категории вместе со всеми файлами
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			name	path		string								true	"Название категории"
+//	@Param			body	body		domain.ForceDeleteCategoryRequest	true	"Токен подтверждения"
+//
+//	@Success		200		{object}	domain.CategoryDeleteJob
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category/{name}/force-delete/confirm [POST]
+func (c Category) ForceDelete(ctx context.Context, req domain.ForceDeleteCategoryRequest) (*domain.CategoryDeleteJob, error) {
+	job, err := c.service.ForceDelete(ctx, req.Name, req.ConfirmationToken)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainCategoryDeleteJob(*job)
+	return &result, nil
+}
+
+// GetDeleteJob
+//
+//	@Tags			category
+//	@Summary		Force delete job status
+//	@Description	Получить состояние фонового удаления категории
+//	@Produce		json
+//
+//	@Param			name	path		string	true	"Название категории"
+//	@Param			jobId	path		string	true	"Идентификатор задачи"
+//
+//	@Success		200		{object}	domain.CategoryDeleteJob
+//	@Failure		400		{object}	apierrors.Error
+//	@Failure		404		{object}	apierrors.Error
+//	@Failure		500		{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/category/{name}/force-delete/{jobId} [GET]
+func (c Category) GetDeleteJob(ctx context.Context, req domain.CategoryDeleteJobRequest) (*domain.CategoryDeleteJob, error) {
+	job, err := c.service.GetDeleteJob(ctx, req.Name, req.JobId)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainCategoryDeleteJob(*job)
+	return &result, nil
+}
+
+func toDomainCategory(category entity.CategoryInfo) domain.Category {
+	return domain.Category{
+		Name:        category.Name,
+		Managed:     category.Managed,
+		Status:      category.Status,
+		Settings:    toDomainCategorySettings(category.Settings),
+		ObjectCount: category.Stats.ObjectCount,
+		TotalSize:   category.Stats.TotalSize,
+		CreatedAt:   category.CreatedAt,
+	}
+}
+
+func toDomainCategorySettings(settings entity.CategorySettings) domain.CategorySettings {
+	return domain.CategorySettings{
+		StripImageMetadata:    settings.StripImageMetadata,
+		TrashRetentionInHours: int(settings.TrashRetention / time.Hour),
+		Versioning:            settings.Versioning,
+		MaxVersions:           settings.MaxVersions,
+		RetentionMode:         settings.RetentionMode,
+		RetentionPeriodInDays: int(settings.RetentionPeriod / entity.Day),
+		LegalHold:             settings.LegalHold,
+		DefaultVisibility:     settings.DefaultVisibility,
+		ScanMode:              settings.ScanMode,
+		InfectedAction:        settings.InfectedAction,
+		Validation: domain.CategoryValidation{
+			Image: domain.ImageValidation(settings.Validation.Image),
+			Zip:   domain.ZipValidation(settings.Validation.Zip),
+			Pdf:   domain.PdfValidation(settings.Validation.Pdf),
+			Text:  domain.TextValidation(settings.Validation.Text),
+		},
+	}
+}
+
+func fromDomainCategorySettings(settings domain.CategorySettings) entity.CategorySettings {
+	return entity.CategorySettings{
+		StripImageMetadata: settings.StripImageMetadata,
+		TrashRetention:     time.Duration(settings.TrashRetentionInHours) * time.Hour,
+		Versioning:         settings.Versioning,
+		MaxVersions:        settings.MaxVersions,
+		RetentionMode:      settings.RetentionMode,
+		RetentionPeriod:    time.Duration(settings.RetentionPeriodInDays) * entity.Day,
+		LegalHold:          settings.LegalHold,
+		DefaultVisibility:  settings.DefaultVisibility,
+		ScanMode:           settings.ScanMode,
+		InfectedAction:     settings.InfectedAction,
+		Validation: entity.CategoryValidation{
+			Image: entity.ImageValidation(settings.Validation.Image),
+			Zip:   entity.ZipValidation(settings.Validation.Zip),
+			Pdf:   entity.PdfValidation(settings.Validation.Pdf),
+			Text:  entity.TextValidation(settings.Validation.Text),
+		},
+	}
+}
+
+func toDomainCategoryDeleteJob(job entity.CategoryDeleteJob) domain.CategoryDeleteJob {
+	return domain.CategoryDeleteJob{
+		Id:        job.Id,
+		Category:  job.Category,
+		Status:    job.Status,
+		Deleted:   job.Deleted,
+		LastError: job.LastError,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+}
+
+type CategoryDeleteJobService interface {
+	ProcessDeleteJob(ctx context.Context, id string) (bool, error)
+	FailDeleteJob(ctx context.Context, id string, reason error) error
+}
+
+type CategoryDeleteWorker struct {
+	service CategoryDeleteJobService
+}
+
+func NewCategoryDeleteWorker(service CategoryDeleteJobService) CategoryDeleteWorker {
+	return CategoryDeleteWorker{
+		service: service,
+	}
+}
+
+func (c CategoryDeleteWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	jobId := string(job.Arg)
+	done, err := c.service.ProcessDeleteJob(ctx, jobId)
+	switch {
+	case err != nil && job.Attempt >= categoryDeleteMaxAttempts:
+		failErr := c.service.FailDeleteJob(ctx, jobId, err)
+		if failErr != nil {
+			return bgjob.Retry(categoryDeleteRetryTime, errors.WithMessage(failErr, "fail job"))
+		}
+		return bgjob.MoveToDlq(err)
+	case err != nil:
+		return bgjob.Retry(categoryDeleteRetryTime, err)
+	case done:
+		return bgjob.Complete()
+	default:
+		return bgjob.Reschedule(0)
+	}
+}
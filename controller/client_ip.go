@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ClientIps определяет адрес клиента для журнала аудита, ограничений частоты запросов и разрешённых адресов API ключей.
+// Заголовок X-Forwarded-For учитывается, только если соединение установлено доверенным прокси,
+// адресом клиента считается последний адрес цепочки, не принадлежащий доверенным прокси
+type ClientIps struct {
+	trustedProxies []netip.Prefix
+}
+
+// NewClientIps trustedProxies адреса или подсети в формате CIDR,
+// если пустой, адресом клиента всегда считается адрес соединения
+func NewClientIps(trustedProxies []string) (ClientIps, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return ClientIps{}, errors.WithMessagef(err, "parse trusted proxy %s", proxy)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return ClientIps{
+		trustedProxies: prefixes,
+	}, nil
+}
+
+func (c ClientIps) Of(r *http.Request) string {
+	host := remoteHost(r)
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !c.trusted(addr) {
+		return host
+	}
+	addr = addr.Unmap()
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// адрес до некорректного звена цепочки подделан или не проверен
+			return addr.String()
+		}
+		addr = hop.Unmap()
+		if !c.trusted(addr) {
+			return addr.String()
+		}
+	}
+	return addr.String()
+}
+
+func (c ClientIps) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost адрес соединения
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
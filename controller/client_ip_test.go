@@ -0,0 +1,48 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"storage-service/controller"
+)
+
+func TestClientIps(t *testing.T) {
+	t.Parallel()
+
+	clientIps, err := controller.NewClientIps([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("new client ips: %v", err)
+	}
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted proxy", "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed first address", "10.0.0.2:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:1234", []string{"198.51.100.1, 192.168.1.1", "10.0.0.3"}, "198.51.100.1"},
+		{"trusted proxy without header", "192.168.1.1:1234", nil, "192.168.1.1"},
+		{"invalid address", "10.0.0.2:1234", []string{"1.1.1.1, unknown, 10.0.0.3"}, "10.0.0.3"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		for _, value := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		ip := clientIps.Of(r)
+		if ip != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, ip)
+		}
+	}
+
+	_, err = controller.NewClientIps([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Fatal("invalid trusted proxy must be rejected")
+	}
+}
@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"storage-service/domain"
+
+	"github.com/Falokut/go-kit/http/apierrors"
+)
+
+func handleError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	invalidArgError := domain.InvalidArgumentError{}
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeFileNotFound,
+			domain.ErrFileNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrTrashFileNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeTrashFileNotFound,
+			domain.ErrTrashFileNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrFileAlreadyExist):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeFileAlreadyExist,
+			domain.ErrFileAlreadyExist.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrBulkDeleteJobNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeBulkJobNotFound,
+			domain.ErrBulkDeleteJobNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCategoryNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeCategoryNotFound,
+			domain.ErrCategoryNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCategoryAlreadyExist):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeCategoryExist,
+			domain.ErrCategoryAlreadyExist.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCategoryNotEmpty):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeCategoryNotEmpty,
+			domain.ErrCategoryNotEmpty.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCategoryIsDeleting):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeCategoryIsDeleting,
+			domain.ErrCategoryIsDeleting.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrInvalidConfirmationToken):
+		return apierrors.NewBusinessError(
+			domain.ErrCodeInvalidConfirmation,
+			domain.ErrInvalidConfirmationToken.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCategoryDeleteJobNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeCategoryJobNotFound,
+			domain.ErrCategoryDeleteJobNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrVersionNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeVersionNotFound,
+			domain.ErrVersionNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrCannotDeleteCurrent):
+		return apierrors.NewBusinessError(
+			domain.ErrCodeDeleteCurrent,
+			domain.ErrCannotDeleteCurrent.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrFileLocked):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeFileLocked,
+			domain.ErrFileLocked.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrForbidden):
+		return apierrors.New(
+			http.StatusForbidden,
+			domain.ErrCodeForbidden,
+			domain.ErrForbidden.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrUnauthorized):
+		return apierrors.New(
+			http.StatusUnauthorized,
+			domain.ErrCodeUnauthorized,
+			domain.ErrUnauthorized.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodePendingNotFound,
+			domain.ErrPendingFileNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileExpired):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingExpired,
+			domain.ErrPendingFileExpired.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileCommitted):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingCommitted,
+			domain.ErrPendingFileCommitted.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileRolledBack):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingRolledBack,
+			domain.ErrPendingFileRolledBack.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileNotReady):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingNotReady,
+			domain.ErrPendingFileNotReady.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileInGroup):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingInGroup,
+			domain.ErrPendingFileInGroup.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileCommitting):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingCommitting,
+			domain.ErrPendingFileCommitting.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingFileConflict):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodePendingConflict,
+			domain.ErrPendingFileConflict.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingGroupNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeGroupNotFound,
+			domain.ErrPendingGroupNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingGroupExpired):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeGroupExpired,
+			domain.ErrPendingGroupExpired.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingGroupCommitted):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeGroupCommitted,
+			domain.ErrPendingGroupCommitted.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrPendingGroupRolledBack):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeGroupRolledBack,
+			domain.ErrPendingGroupRolledBack.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrReferenceNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeReferenceNotFound,
+			domain.ErrReferenceNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrWebhookDeliveryNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeDeliveryNotFound,
+			domain.ErrWebhookDeliveryNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrEventStreamUnavailable):
+		return apierrors.New(
+			http.StatusServiceUnavailable,
+			domain.ErrCodeStreamUnavailable,
+			domain.ErrEventStreamUnavailable.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrApiKeyNotFound):
+		return apierrors.New(
+			http.StatusNotFound,
+			domain.ErrCodeApiKeyNotFound,
+			domain.ErrApiKeyNotFound.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrApiKeyAlreadyExist):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeApiKeyExist,
+			domain.ErrApiKeyAlreadyExist.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return apierrors.New(
+			http.StatusInsufficientStorage,
+			domain.ErrCodeQuotaExceeded,
+			domain.ErrQuotaExceeded.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrRateLimited):
+		return apierrors.New(
+			http.StatusTooManyRequests,
+			domain.ErrCodeRateLimited,
+			domain.ErrRateLimited.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrFileQuarantined):
+		return apierrors.New(
+			http.StatusConflict,
+			domain.ErrCodeFileQuarantined,
+			domain.ErrFileQuarantined.Error(),
+			err,
+		)
+	case errors.Is(err, domain.ErrFileInfected):
+		return apierrors.New(
+			http.StatusUnprocessableEntity,
+			domain.ErrCodeFileInfected,
+			domain.ErrFileInfected.Error(),
+			err,
+		)
+	case errors.As(err, &invalidArgError):
+		return apierrors.NewBusinessError(invalidArgError.ErrCode, invalidArgError.Reason, err)
+	default:
+		return apierrors.NewInternalServiceError(err)
+	}
+}
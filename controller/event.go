@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/txix-open/bgjob"
+)
+
+const (
+	// eventPollInterval события публикуются и доставляются чаще остальных фоновых задач
+	eventPollInterval = 10 * time.Second
+)
+
+type EventRelayService interface {
+	Relay(ctx context.Context) error
+}
+
+type EventRelayWorker struct {
+	service EventRelayService
+}
+
+func NewEventRelayWorker(service EventRelayService) EventRelayWorker {
+	return EventRelayWorker{
+		service: service,
+	}
+}
+
+func (c EventRelayWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	err := c.service.Relay(ctx)
+	if err != nil {
+		return bgjob.Retry(eventPollInterval, err)
+	}
+	return bgjob.Reschedule(eventPollInterval)
+}
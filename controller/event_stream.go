@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/stream"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	lastEventIdHeader = "Last-Event-ID"
+	streamPage        = 100
+	streamHeartbeat   = 15 * time.Second
+	// streamPollInterval события читаются и без уведомления: событие транзакции, которую ждало чтение,
+	// и события, уведомления о которых потеряны, отправляются не позже этого срока
+	streamPollInterval = 5 * time.Second
+)
+
+var streamEventTypes = []string{
+	entity.EventUploaded,
+	entity.EventOverwritten,
+	entity.EventCommitted,
+	entity.EventRolledBack,
+	entity.EventExpired,
+	entity.EventDeleted,
+	entity.EventScanned,
+	entity.EventInfected,
+}
+
+type EventStreamService interface {
+	Subscribe() (*stream.Subscription, error)
+	Unsubscribe(subscription *stream.Subscription)
+	Cursor(ctx context.Context, lastEventId int64) (entity.EventCursor, error)
+	EventsAfter(
+		ctx context.Context,
+		cursor entity.EventCursor,
+		filter entity.EventFilter,
+		limit int,
+	) ([]entity.StorageEvent, entity.EventCursor, bool, error)
+}
+
+type EventStream struct {
+	service EventStreamService
+	admin   AdminAuth
+}
+
+func NewEventStream(service EventStreamService, admin AdminAuth) EventStream {
+	return EventStream{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// Stream
+//
+//	@Tags			event
+//	@Summary		Stream storage events
+//	@Description	Поток событий хранилища в формате Server-Sent Events, требуется X-Admin-Token.
+//	@Description	Каждое событие передаётся с id, по которому поток возобновляется через заголовок Last-Event-ID
+//	@Description	или параметр lastEventId, пропущенные события отправляются до новых.
+//	@Description	События отправляются в порядке фиксации транзакций, поэтому их идентификаторы могут идти не по возрастанию.
+//	@Description	При остановке сервиса поток закрывается, клиент должен переподключиться
+//	@Produce		text/event-stream
+//
+//	@Param			categories		query		string	false	"Категории через запятую, по умолчанию все"
+//	@Param			eventTypes		query		string	false	"Типы событий через запятую: uploaded, overwritten, committed, rolled_back, expired, deleted, scanned, infected, по умолчанию все"
+//	@Param			lastEventId		query		int		false	"Идентификатор последнего полученного события"
+//	@Param			Last-Event-ID	header		int		false	"Идентификатор последнего полученного события, приоритетнее lastEventId"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	domain.StorageEvent
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Failure		503				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/events/stream [GET]
+func (c EventStream) Stream(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	req domain.EventStreamRequest,
+) error {
+	if !c.admin.IsAdmin(r) {
+		return handleError(domain.ErrForbidden)
+	}
+	filter, err := toEventFilter(req)
+	if err != nil {
+		return handleError(err)
+	}
+	lastEventId, err := parseLastEventId(r, req.LastEventId)
+	if err != nil {
+		return handleError(err)
+	}
+
+	// подписка до определения позиции, чтобы не пропустить уведомления между чтением и подпиской
+	subscription, err := c.service.Subscribe()
+	if err != nil {
+		return handleError(err)
+	}
+	defer c.service.Unsubscribe(subscription)
+	cursor, err := c.service.Cursor(ctx, lastEventId)
+	if err != nil {
+		return handleError(err)
+	}
+
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	err = controller.Flush()
+	if err != nil {
+		return errors.WithMessage(err, "flush")
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	for {
+		cursor, err = c.writeEventsAfter(ctx, w, controller, cursor, filter)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+			if err != nil {
+				return errors.WithMessage(err, "write ping")
+			}
+			err = controller.Flush()
+			if err != nil {
+				return errors.WithMessage(err, "flush")
+			}
+		case <-poll.C:
+		case _, ok := <-subscription.Wake:
+			if !ok {
+				return nil
+			}
+		}
+	}
+}
+
+// writeEventsAfter отправляет все события после cursor постранично и возвращает позицию после отправленных
+func (c EventStream) writeEventsAfter(
+	ctx context.Context,
+	w http.ResponseWriter,
+	controller *http.ResponseController,
+	cursor entity.EventCursor,
+	filter entity.EventFilter,
+) (entity.EventCursor, error) {
+	for {
+		events, next, more, err := c.service.EventsAfter(ctx, cursor, filter, streamPage)
+		if err != nil {
+			return cursor, errors.WithMessage(err, "read events")
+		}
+		for _, event := range events {
+			err = writeStreamEvent(w, event)
+			if err != nil {
+				return cursor, err
+			}
+		}
+		if len(events) > 0 {
+			err = controller.Flush()
+			if err != nil {
+				return cursor, errors.WithMessage(err, "flush")
+			}
+		}
+		cursor = next
+		if !more {
+			return cursor, nil
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event entity.StorageEvent) error {
+	data, err := json.Marshal(toDomainStorageEvent(event))
+	if err != nil {
+		return errors.WithMessage(err, "marshal event")
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	if err != nil {
+		return errors.WithMessage(err, "write event")
+	}
+	return nil
+}
+
+func toDomainStorageEvent(event entity.StorageEvent) domain.StorageEvent {
+	return domain.StorageEvent{
+		Id:        event.Id,
+		Type:      event.Type,
+		Category:  event.Category,
+		Filename:  event.Filename,
+		Actor:     event.Actor,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+func toEventFilter(req domain.EventStreamRequest) (entity.EventFilter, error) {
+	filter := entity.EventFilter{
+		Categories: splitList(req.Categories),
+		EventTypes: splitList(req.EventTypes),
+	}
+	for _, eventType := range filter.EventTypes {
+		if !slices.Contains(streamEventTypes, eventType) {
+			return entity.EventFilter{}, domain.NewInvalidArgumentError(
+				"unknown event type "+eventType,
+				domain.ErrCodeInvalidEventFilter,
+			)
+		}
+	}
+	return filter, nil
+}
+
+func parseLastEventId(r *http.Request, fallback int64) (int64, error) {
+	header := r.Header.Get(lastEventIdHeader)
+	if header == "" {
+		return fallback, nil
+	}
+	id, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || id < 0 {
+		return 0, domain.NewInvalidArgumentError(
+			lastEventIdHeader+" must be a non-negative integer",
+			domain.ErrCodeInvalidEventFilter,
+		)
+	}
+	return id, nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,136 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"storage-service/controller"
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/stream"
+)
+
+// eventService отдаёт события после позиции и завершает поток после первого чтения
+type eventService struct {
+	events      []entity.StorageEvent
+	lastEventId int64
+	subscribed  bool
+	cancel      context.CancelFunc
+}
+
+func (s *eventService) Subscribe() (*stream.Subscription, error) {
+	s.subscribed = true
+	return &stream.Subscription{Wake: make(chan struct{})}, nil
+}
+
+func (s *eventService) Unsubscribe(*stream.Subscription) {
+}
+
+func (s *eventService) Cursor(_ context.Context, lastEventId int64) (entity.EventCursor, error) {
+	s.lastEventId = lastEventId
+	return entity.EventCursor{Id: lastEventId}, nil
+}
+
+func (s *eventService) EventsAfter(
+	_ context.Context,
+	cursor entity.EventCursor,
+	filter entity.EventFilter,
+	_ int,
+) ([]entity.StorageEvent, entity.EventCursor, bool, error) {
+	defer s.cancel()
+	events := make([]entity.StorageEvent, 0)
+	for _, event := range s.events {
+		if event.Id > cursor.Id && filter.Match(event) {
+			events = append(events, event)
+			cursor = entity.NewEventCursor(event)
+		}
+	}
+	return events, cursor, false, nil
+}
+
+func streamEvent(id int64, eventType string) entity.StorageEvent {
+	event := entity.NewStorageEvent(eventType, "a.txt", "docs", "")
+	event.Id = id
+	return event
+}
+
+func runStream(
+	t *testing.T,
+	service *eventService,
+	header string,
+	req domain.EventStreamRequest,
+) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	service.cancel = cancel
+
+	r := httptest.NewRequestWithContext(ctx, http.MethodGet, "/events/stream", nil)
+	r.Header.Set(domain.AdminTokenHeader, "token")
+	if header != "" {
+		r.Header.Set("Last-Event-ID", header)
+	}
+	w := httptest.NewRecorder()
+	err := controller.NewEventStream(service, controller.NewAdminAuth("token", false)).Stream(ctx, w, r, req)
+	return w, err
+}
+
+func TestStreamResumesAfterLastEventId(t *testing.T) {
+	t.Parallel()
+
+	service := &eventService{events: []entity.StorageEvent{
+		streamEvent(1, entity.EventUploaded),
+		streamEvent(2, entity.EventDeleted),
+		streamEvent(3, entity.EventUploaded),
+	}}
+	w, err := runStream(t, service, "1", domain.EventStreamRequest{LastEventId: 2, EventTypes: "uploaded"})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if service.lastEventId != 1 {
+		t.Fatalf("Last-Event-ID header must take precedence, got %d", service.lastEventId)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "id: 3\nevent: uploaded\n") || strings.Contains(body, "id: 2\n") {
+		t.Fatalf("expected only event 3, got %q", body)
+	}
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+
+	service = &eventService{events: service.events}
+	_, err = runStream(t, service, "", domain.EventStreamRequest{LastEventId: 2})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if service.lastEventId != 2 {
+		t.Fatalf("expected lastEventId parameter without header, got %d", service.lastEventId)
+	}
+}
+
+func TestStreamRejectsInvalidRequest(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		header string
+		req    domain.EventStreamRequest
+	}{
+		{"not a number", "abc", domain.EventStreamRequest{}},
+		{"negative", "-1", domain.EventStreamRequest{}},
+		{"unknown event type", "", domain.EventStreamRequest{EventTypes: "uploaded, renamed"}},
+	}
+	for _, c := range cases {
+		service := &eventService{}
+		_, err := runStream(t, service, c.header, c.req)
+		if err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+		if service.subscribed {
+			t.Errorf("%s: invalid request must not subscribe", c.name)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/txix-open/bgjob"
+)
+
+type ExpirationService interface {
+	DeleteExpiredFiles(ctx context.Context) error
+}
+
+type ExpirationWorker struct {
+	service ExpirationService
+}
+
+func NewExpirationWorker(service ExpirationService) ExpirationWorker {
+	return ExpirationWorker{
+		service: service,
+	}
+}
+
+func (c ExpirationWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	err := c.service.DeleteExpiredFiles(ctx)
+	if err != nil {
+		return bgjob.Retry(defaultRetryTime, err)
+	}
+	return bgjob.Reschedule(defaultRetryTime)
+}
@@ -4,33 +4,41 @@ import (
 	"context"
 	"io"
 	"net/http"
-
-	"github.com/pkg/errors"
+	"time"
 
 	"storage-service/domain"
 	"storage-service/entity"
 
-	"github.com/Falokut/go-kit/http/apierrors"
 	"github.com/Falokut/go-kit/http/types"
 )
 
 //go:generate mockgen -source=service.go -destination=mocks/service.go
 type StorageService interface {
-	UploadFile(ctx context.Context, req entity.UploadFileRequest) (string, error)
-	GetFile(ctx context.Context, req domain.FileRequest, opt *types.RangeOption) (*entity.Metadata, io.ReadSeekCloser, error)
-	IsFileExist(ctx context.Context, req domain.FileRequest) (bool, error)
-	DeleteFile(ctx context.Context, req domain.FileRequest) error
-	Rollback(ctx context.Context, req domain.FileRequest) error
-	Commit(ctx context.Context, req domain.FileRequest) error
+	UploadFile(ctx context.Context, req entity.UploadFileRequest) (*entity.UploadedFile, error)
+	GetFile(
+		ctx context.Context,
+		req domain.GetFileRequest,
+		opt *types.RangeOption,
+		accessor entity.Accessor,
+	) (*entity.Metadata, io.ReadSeekCloser, error)
+	IsFileExist(ctx context.Context, req domain.FileExistRequest, accessor entity.Accessor) (bool, error)
+	DeleteFile(ctx context.Context, req domain.FileRequest, deletedBy string, accessor entity.Accessor) error
+	SetExpiration(ctx context.Context, req domain.SetExpirationRequest, accessor entity.Accessor) (*time.Time, error)
+	Rollback(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) error
+	Commit(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) error
+	GetPending(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) (*entity.PendingFile, error)
+	ExtendPending(ctx context.Context, req domain.ExtendPendingRequest, accessor entity.Accessor) (*entity.PendingFile, error)
 }
 
 type Files struct {
 	service StorageService
+	admin   AdminAuth
 }
 
-func NewFiles(service StorageService) Files {
+func NewFiles(service StorageService, admin AdminAuth) Files {
 	return Files{
 		service: service,
+		admin:   admin,
 	}
 }
 
@@ -38,53 +46,119 @@ func NewFiles(service StorageService) Files {
 //
 //	@Tags			file
 //	@Summary		Upload file
-//	@Description	Загрузить файл в хранилище
+//	@Description	Загрузить файл в хранилище, загрузивший субъект становится владельцем файла,
+//	@Description	перезаписать файл с владельцем может только владелец или администратор.
+//	@Description	В категории с проверкой антивирусом заражённый файл отклоняется при синхронной проверке,
+//	@Description	непроверенный файл возвращается с quarantined=true и не выдаётся до завершения проверки
 //	@Accept			*/*
 //	@Produce		*/*
 //
 //	@Param			category	path		string	true	"Категория файла"
 //	@Param			filename	path		string	false	"имя файла в файловом хранилище"
 //	@Param			pending		query		bool	false	"пометить как pending"
+//	@Param			pendingTtl	query		int		false	"Срок подтверждения pending файла, в секундах, не больше pending.maxFileLifetimeInMin"
+//	@Param			groupId		query		string	false	"Группа pending загрузок, подтверждаемых вместе, требует pending=true"
 //	@Param			prettyName	query		string	false	"'красивое' имя файла"
+//	@Param			expiresAt	query		string	false	"Момент удаления файла в формате RFC3339"
+//	@Param			ttl			query		int		false	"Время жизни файла, в секундах"
+//	@Param			visibility	query		string	false	"Видимость файла: private, internal или public, по умолчанию задаётся категорией"
 //
 //	@Param			body		body		[]byte	true	"содержимое файла"
 //
 //	@Success		200			{object}	domain.UploadFileResponse
 //	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		422			{object}	apierrors.Error
 //	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category} [POST]
 func (c Files) UploadFile(ctx context.Context, r *http.Request, req domain.UploadFileRequest) (*domain.UploadFileResponse, error) {
-	filename, err := c.service.UploadFile(ctx,
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return nil, handleError(domain.NewInvalidArgumentError(
+				"expiresAt must be in RFC3339 format",
+				domain.ErrCodeInvalidExpiration,
+			))
+		}
+		expiresAt = &parsed
+	}
+
+	file, err := c.service.UploadFile(ctx,
 		entity.UploadFileRequest{
 			Filename:      req.Filename,
 			PrettyName:    req.PrettyName,
 			Category:      req.Category,
+			Pending:       req.Pending,
+			PendingTtl:    time.Duration(req.PendingTtl) * time.Second,
+			GroupId:       req.GroupId,
+			UploadedBy:    actor(r, c.admin),
+			Accessor:      accessor(r, c.admin),
+			Visibility:    req.Visibility,
+			ExpiresAt:     expiresAt,
+			Ttl:           time.Duration(req.Ttl) * time.Second,
+			Size:          r.ContentLength,
 			ContentReader: r.Body,
 		})
 	if err != nil {
-		return nil, c.handleError(err)
+		return nil, handleError(err)
 	}
-	return &domain.UploadFileResponse{Filename: filename}, nil
+	setAuditFilename(ctx, file.Filename)
+	return &domain.UploadFileResponse{
+		Filename:         file.Filename,
+		Size:             file.Size,
+		Checksum:         file.Checksum,
+		VersionId:        file.VersionId,
+		ExpiresAt:        file.ExpiresAt,
+		PendingExpiresAt: file.PendingExpiresAt,
+		Owner:            file.Owner,
+		Visibility:       file.Visibility,
+		Quarantined:      file.Quarantined,
+	}, nil
 }
 
 // GetFile
 //
 //	@Tags			file
 //	@Summary		Get file
-//	@Description	Получить файл из хранилища
+//	@Description	Получить файл из хранилища, для файлов с ограниченным сроком жизни возвращается заголовок Expires.
+//	@Description	Приватный файл доступен только владельцу и администратору, публичный - и без учётных данных.
+//	@Description	Файл на карантине до завершения проверки антивирусом не выдаётся
 //
 //	@Param			category	path		string	true	"Категория файла"
 //	@Param			filename	path		string	true	"Идентификатор файла"
+//	@Param			versionId		query		string	false	"Идентификатор версии файла, по умолчанию текущая"
+//	@Param			includePending	query		bool	false	"Вернуть незакоммиченный файл, требуется X-Admin-Token"
+//	@Param			X-Admin-Token	header		string	false	"Токен привилегированного доступа"
 //
-//	@Success		200			{array}		byte
-//	@Failure		400			{object}	apierrors.Error
-//	@Failure		404			{object}	apierrors.Error
-//	@Failure		500			{object}	apierrors.Error
+//	@Success		200				{array}		byte
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		401				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		404				{object}	apierrors.Error
+//	@Failure		409				{object}	apierrors.Error
+//	@Failure		422				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category}/{filename} [GET]
-func (c Files) GetFile(ctx context.Context, rangeOpt *types.RangeOption, req domain.FileRequest) (*types.FileData, error) {
-	metadata, reader, err := c.service.GetFile(ctx, req, rangeOpt)
+func (c Files) GetFile(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	rangeOpt *types.RangeOption,
+	req domain.GetFileRequest,
+) (*types.FileData, error) {
+	if req.IncludePending && !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	metadata, reader, err := c.service.GetFile(ctx, req, rangeOpt, accessor(r, c.admin))
 	if err != nil {
-		return nil, c.handleError(err)
+		return nil, handleError(err)
+	}
+	if metadata.ExpiresAt != nil {
+		w.Header().Set("Expires", metadata.ExpiresAt.UTC().Format(http.TimeFormat))
 	}
 
 	partialDataInfo := c.buildPartialDataInfo(rangeOpt)
@@ -107,60 +181,180 @@ func (c Files) buildPartialDataInfo(rangeOpt *types.RangeOption) *types.PartialD
 	}
 }
 
+// SetExpiration
+//
+//	@Tags			file
+//	@Summary		Set file expiration
+//	@Description	Установить или снять срок жизни файла, если не указаны expiresAt и ttl, файл хранится бессрочно,
+//	@Description	изменить срок жизни файла с владельцем может только владелец или администратор
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string						true	"Категория файла"
+//	@Param			filename	path		string						true	"Идентификатор файла"
+//	@Param			body		body		domain.SetExpirationRequest	true	"Срок жизни файла"
+//
+//	@Success		200			{object}	domain.ExpirationResponse
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/expiration [POST]
+func (c Files) SetExpiration(
+	ctx context.Context,
+	r *http.Request,
+	req domain.SetExpirationRequest,
+) (*domain.ExpirationResponse, error) {
+	expiresAt, err := c.service.SetExpiration(ctx, req, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return &domain.ExpirationResponse{ExpiresAt: expiresAt}, nil
+}
+
 // Commit
 //
 //	@Tags			file
 //	@Summary		Commit
-//	@Description	Подтвердить загрузку файла в хранилище
+//	@Description	Подтвердить загрузку файла в хранилище, до подтверждения файл недоступен под своим именем,
+//	@Description	подтвердить загрузку с владельцем может только владелец или администратор
 //
 //	@Param			category	path		string	true	"Категория файла"
 //	@Param			filename	path		string	true	"Идентификатор файла"
 //
 //	@Success		200			{array}		byte
 //	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
 //	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category}/{filename}/commit [POST]
-func (c Files) Commit(ctx context.Context, req domain.FileRequest) error {
-	return c.service.Commit(ctx, req)
+func (c Files) Commit(ctx context.Context, r *http.Request, req domain.FileRequest) error {
+	return handleError(c.service.Commit(ctx, req, accessor(r, c.admin)))
 }
 
 // Rollback
 //
 //	@Tags			file
 //	@Summary		Rollback file
-//	@Description	Отменить загрузку файла в хранилище
+//	@Description	Отменить загрузку файла в хранилище, отменить загрузку с владельцем может только владелец или администратор
 //
 //	@Param			category	path		string	true	"Категория файла"
 //	@Param			filename	path		string	true	"Идентификатор файла"
 //
 //	@Success		200			{array}		byte
 //	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
 //	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category}/{filename}/rollback [POST]
-func (c Files) Rollback(ctx context.Context, req domain.FileRequest) error {
-	return c.service.Rollback(ctx, req)
+func (c Files) Rollback(ctx context.Context, r *http.Request, req domain.FileRequest) error {
+	return handleError(c.service.Rollback(ctx, req, accessor(r, c.admin)))
 }
 
-// IsFileExist
+// GetPending
 //
 //	@Tags			file
-//	@Summary		Is file exist
-//	@Description	Проверить наличие файла в хранилище
-//	@Accept			json
+//	@Summary		Get pending status
+//	@Description	Получить состояние загрузки с pending=true: uploading, pending, committed, rolled_back, expired или failed
 //	@Produce		json
 //
 //	@Param			category	path		string	true	"Категория файла"
 //	@Param			filename	path		string	true	"Идентификатор файла"
 //
-//	@Success		200			{object}	domain.FileExistResponse
+//	@Success		200			{object}	domain.PendingFile
 //	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
 //	@Failure		404			{object}	apierrors.Error
 //	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/pending [GET]
+func (c Files) GetPending(ctx context.Context, r *http.Request, req domain.FileRequest) (*domain.PendingFile, error) {
+	file, err := c.service.GetPending(ctx, req, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainPendingFile(*file)
+	return &result, nil
+}
+
+// ExtendPending
+//
+//	@Tags			file
+//	@Summary		Extend pending lease
+//	@Description	Продлить срок подтверждения загрузки с pending=true на ttl секунд от текущего момента,
+//	@Description	если ttl не указан, используется pending.fileLifetimeInMin, продлить загрузку может только её владелец или администратор
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string						true	"Категория файла"
+//	@Param			filename	path		string						true	"Идентификатор файла"
+//	@Param			body		body		domain.ExtendPendingRequest	true	"Срок продления"
+//
+//	@Success		200			{object}	domain.PendingFile
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/extend [POST]
+func (c Files) ExtendPending(ctx context.Context, r *http.Request, req domain.ExtendPendingRequest) (*domain.PendingFile, error) {
+	file, err := c.service.ExtendPending(ctx, req, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainPendingFile(*file)
+	return &result, nil
+}
+
+func toDomainPendingFile(file entity.PendingFile) domain.PendingFile {
+	return domain.PendingFile{
+		Filename:   file.Filename,
+		Category:   file.Category,
+		GroupId:    file.GroupId,
+		UploadedBy: file.UploadedBy,
+		Status:     file.Status,
+		Error:      file.Error,
+		CreatedAt:  file.CreatedAt,
+		UpdatedAt:  file.UpdatedAt,
+		ExpiresAt:  file.ExpiresAt,
+		Attempts:   file.Attempts,
+		LastError:  file.LastError,
+	}
+}
+
+// IsFileExist
+//
+//	@Tags			file
+//	@Summary		Is file exist
+//	@Description	Проверить наличие файла в хранилище
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category		path		string	true	"Категория файла"
+//	@Param			filename		path		string	true	"Идентификатор файла"
+//	@Param			includePending	query		bool	false	"Учитывать незакоммиченные файлы, требуется X-Admin-Token"
+//	@Param			X-Admin-Token	header		string	false	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	domain.FileExistResponse
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		404				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category}/{filename}/exist [GET]
-func (c Files) IsFileExist(ctx context.Context, req domain.FileRequest) (*domain.FileExistResponse, error) {
-	imageExist, err := c.service.IsFileExist(ctx, req)
+func (c Files) IsFileExist(ctx context.Context, r *http.Request, req domain.FileExistRequest) (*domain.FileExistResponse, error) {
+	if req.IncludePending && !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	imageExist, err := c.service.IsFileExist(ctx, req, accessor(r, c.admin))
 	if err != nil {
-		return nil, c.handleError(err)
+		return nil, handleError(err)
 	}
 	return &domain.FileExistResponse{FileExist: imageExist}, nil
 }
@@ -169,7 +363,8 @@ func (c Files) IsFileExist(ctx context.Context, req domain.FileRequest) (*domain
 //
 //	@Tags			file
 //	@Summary		Delete file
-//	@Description	Удалить файл из хранилища
+//	@Description	Переместить файл в корзину, до истечения срока хранения корзины файл можно восстановить,
+//	@Description	удалить файл с владельцем может только владелец или администратор
 //	@Accept			json
 //	@Produce		json
 //
@@ -178,30 +373,11 @@ func (c Files) IsFileExist(ctx context.Context, req domain.FileRequest) (*domain
 //
 //	@Success		200			{object}	any
 //	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
 //	@Failure		404			{object}	apierrors.Error
 //	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
 //	@Router			/file/{category}/{filename} [DELETE]
-func (c Files) DeleteFile(ctx context.Context, req domain.FileRequest) error {
-	return c.handleError(c.service.DeleteFile(ctx, req))
-}
-
-func (c Files) handleError(err error) error {
-	if err == nil {
-		return nil
-	}
-
-	invalidArgError := domain.InvalidArgumentError{}
-	switch {
-	case errors.Is(err, domain.ErrFileNotFound):
-		return apierrors.New(
-			http.StatusNotFound,
-			domain.ErrCodeFileNotFound,
-			domain.ErrFileNotFound.Error(),
-			err,
-		)
-	case errors.As(err, &invalidArgError):
-		return apierrors.NewBusinessError(invalidArgError.ErrCode, invalidArgError.Reason, err)
-	default:
-		return apierrors.NewInternalServiceError(err)
-	}
+func (c Files) DeleteFile(ctx context.Context, r *http.Request, req domain.FileRequest) error {
+	return handleError(c.service.DeleteFile(ctx, req, actor(r, c.admin), accessor(r, c.admin)))
 }
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type LockService interface {
+	Get(ctx context.Context, filename string, category string) (*entity.FileLock, error)
+	SetRetention(
+		ctx context.Context,
+		filename string,
+		category string,
+		mode string,
+		retainUntil *time.Time,
+		accessor entity.Accessor,
+	) (*entity.FileLock, error)
+	SetLegalHold(
+		ctx context.Context,
+		filename string,
+		category string,
+		enabled bool,
+		accessor entity.Accessor,
+	) (*entity.FileLock, error)
+}
+
+type Locks struct {
+	service LockService
+	admin   AdminAuth
+}
+
+func NewLocks(service LockService, admin AdminAuth) Locks {
+	return Locks{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// Get
+//
+//	@Tags			lock
+//	@Summary		Get file lock
+//	@Description	Получить срок блокировки и удержание файла
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//
+//	@Success		200			{object}	domain.FileLock
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/lock [GET]
+func (c Locks) Get(ctx context.Context, req domain.FileRequest) (*domain.FileLock, error) {
+	lock, err := c.service.Get(ctx, req.Filename, req.Category)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainFileLock(*lock)
+	return &result, nil
+}
+
+// SetRetention
+//
+//	@Tags			lock
+//	@Summary		Set file retention
+//	@Description	Установить срок, до которого файл нельзя удалить или перезаписать.
+//	@Description	В режиме governance срок можно сократить или снять, в режиме compliance - только продлить.
+//	@Description	Если не указаны mode и retainUntil, срок блокировки снимается.
+//	@Description	Блокировку файла с владельцем может менять только владелец или администратор
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string						true	"Категория файла"
+//	@Param			filename	path		string						true	"Идентификатор файла"
+//	@Param			body		body		domain.SetRetentionRequest	true	"Срок блокировки"
+//
+//	@Success		200			{object}	domain.FileLock
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/retention [POST]
+func (c Locks) SetRetention(ctx context.Context, r *http.Request, req domain.SetRetentionRequest) (*domain.FileLock, error) {
+	lock, err := c.service.SetRetention(ctx, req.Filename, req.Category, req.Mode, req.RetainUntil, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainFileLock(*lock)
+	return &result, nil
+}
+
+// SetLegalHold
+//
+//	@Tags			lock
+//	@Summary		Set file legal hold
+//	@Description	Установить или снять бессрочное удержание файла
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string						true	"Категория файла"
+//	@Param			filename	path		string						true	"Идентификатор файла"
+//	@Param			body		body		domain.SetLegalHoldRequest	true	"Удержание"
+//
+//	@Success		200			{object}	domain.FileLock
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/legal-hold [POST]
+func (c Locks) SetLegalHold(ctx context.Context, r *http.Request, req domain.SetLegalHoldRequest) (*domain.FileLock, error) {
+	lock, err := c.service.SetLegalHold(ctx, req.Filename, req.Category, req.Enabled, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainFileLock(*lock)
+	return &result, nil
+}
+
+func toDomainFileLock(lock entity.FileLock) domain.FileLock {
+	return domain.FileLock{
+		RetentionMode: lock.RetentionMode,
+		RetainUntil:   lock.RetainUntil,
+		LegalHold:     lock.LegalHold,
+		Locked:        lock.IsLocked(time.Now().UTC()),
+	}
+}
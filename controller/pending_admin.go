@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type PendingAdminService interface {
+	ListPending(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error)
+	PendingStats(ctx context.Context) ([]entity.PendingCategoryStats, error)
+	ListPendingDeadLetters(ctx context.Context, req domain.PendingDeadLetterListRequest) ([]entity.PendingDeadLetter, error)
+	ForceExpirePending(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult
+	ForceCommitPending(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult
+}
+
+type PendingAdmin struct {
+	service PendingAdminService
+	admin   AdminAuth
+}
+
+func NewPendingAdmin(service PendingAdminService, admin AdminAuth) PendingAdmin {
+	return PendingAdmin{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// List
+//
+//	@Tags			pending-admin
+//	@Summary		List pending uploads
+//	@Description	Получить список загрузок с pending=true, от старых к новым, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			category		query		string	false	"Категория файла"
+//	@Param			status			query		string	false	"Состояние загрузки"
+//	@Param			groupId			query		string	false	"Группа загрузок"
+//	@Param			uploadedBy		query		string	false	"Инициатор загрузки: субъект API ключа, bearer токена или admin-token"
+//	@Param			minAge			query		int		false	"Загрузка начата не менее minAge секунд назад"
+//	@Param			maxAge			query		int		false	"Загрузка начата не более maxAge секунд назад"
+//	@Param			expiresBefore	query		string	false	"Срок подтверждения истекает не позже, в формате RFC3339"
+//	@Param			expiresAfter	query		string	false	"Срок подтверждения истекает не раньше, в формате RFC3339"
+//	@Param			limit			query		int		false	"Максимальное количество записей, по умолчанию 100"
+//	@Param			offset			query		int		false	"Смещение"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.PendingFile
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/pending [GET]
+func (c PendingAdmin) List(ctx context.Context, r *http.Request, req domain.PendingListRequest) ([]domain.PendingFile, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	filter, err := toPendingFilter(req, time.Now().UTC())
+	if err != nil {
+		return nil, handleError(err)
+	}
+	files, err := c.service.ListPending(ctx, *filter)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.PendingFile, 0, len(files))
+	for _, file := range files {
+		result = append(result, toDomainPendingFile(file))
+	}
+	return result, nil
+}
+
+// Stats
+//
+//	@Tags			pending-admin
+//	@Summary		Pending upload stats
+//	@Description	Получить количество загрузок по категориям и состояниям, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.PendingCategoryStats
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/pending/stats [GET]
+func (c PendingAdmin) Stats(ctx context.Context, r *http.Request) ([]domain.PendingCategoryStats, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	stats, err := c.service.PendingStats(ctx)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.PendingCategoryStats, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, domain.PendingCategoryStats{
+			Category:        stat.Category,
+			Uploading:       stat.Uploading,
+			Pending:         stat.Pending,
+			Committed:       stat.Committed,
+			RolledBack:      stat.RolledBack,
+			Expired:         stat.Expired,
+			Failed:          stat.Failed,
+			OldestCreatedAt: stat.OldestCreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// DeadLetters
+//
+//	@Tags			pending-admin
+//	@Summary		List pending dead letters
+//	@Description	Получить загрузки, файлы которых не удалось удалить из области pending за pending.maxCleanupAttempts попыток,
+//	@Description	от новых к старым, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			category		query		string	false	"Категория файла"
+//	@Param			limit			query		int		false	"Максимальное количество записей, по умолчанию 100"
+//	@Param			offset			query		int		false	"Смещение"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.PendingDeadLetter
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/pending/dead-letters [GET]
+func (c PendingAdmin) DeadLetters(
+	ctx context.Context,
+	r *http.Request,
+	req domain.PendingDeadLetterListRequest,
+) ([]domain.PendingDeadLetter, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	deadLetters, err := c.service.ListPendingDeadLetters(ctx, req)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.PendingDeadLetter, 0, len(deadLetters))
+	for _, deadLetter := range deadLetters {
+		result = append(result, domain.PendingDeadLetter{
+			Id:         deadLetter.Id,
+			Filename:   deadLetter.Filename,
+			Category:   deadLetter.Category,
+			GroupId:    deadLetter.GroupId,
+			UploadedBy: deadLetter.UploadedBy,
+			Attempts:   deadLetter.Attempts,
+			LastError:  deadLetter.LastError,
+			CreatedAt:  deadLetter.CreatedAt,
+			DeadAt:     deadLetter.DeadAt,
+		})
+	}
+	return result, nil
+}
+
+// Expire
+//
+//	@Tags			pending-admin
+//	@Summary		Force expire pending uploads
+//	@Description	Досрочно завершить загрузки, как по истечении срока подтверждения, требуется X-Admin-Token.
+//	@Description	Результат возвращается для каждой загрузки: expired, not_found или error
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			body			body		domain.PendingActionRequest	true	"Загрузки"
+//	@Param			X-Admin-Token	header		string						true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.PendingActionResult
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/pending/expire [POST]
+func (c PendingAdmin) Expire(ctx context.Context, r *http.Request, req domain.PendingActionRequest) ([]domain.PendingActionResult, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+	return toDomainPendingActionResults(c.service.ForceExpirePending(ctx, toFilesToDelete(req.Files))), nil
+}
+
+// Commit
+//
+//	@Tags			pending-admin
+//	@Summary		Force commit pending uploads
+//	@Description	Подтвердить загрузки без учёта срока подтверждения, пока файл не удалён воркером, требуется X-Admin-Token.
+//	@Description	Файлы группы подтверждаются только через группу. Результат возвращается для каждой загрузки: committed, not_found или error
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			body			body		domain.PendingActionRequest	true	"Загрузки"
+//	@Param			X-Admin-Token	header		string						true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.PendingActionResult
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/pending/commit [POST]
+func (c PendingAdmin) Commit(ctx context.Context, r *http.Request, req domain.PendingActionRequest) ([]domain.PendingActionResult, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+	return toDomainPendingActionResults(c.service.ForceCommitPending(ctx, toFilesToDelete(req.Files))), nil
+}
+
+func toPendingFilter(req domain.PendingListRequest, now time.Time) (*entity.PendingFilter, error) {
+	filter := entity.PendingFilter{
+		Category:   req.Category,
+		Status:     req.Status,
+		GroupId:    req.GroupId,
+		UploadedBy: req.UploadedBy,
+		Limit:      req.Limit,
+		Offset:     req.Offset,
+	}
+	if req.MinAge > 0 {
+		createdBefore := now.Add(-time.Duration(req.MinAge) * time.Second)
+		filter.CreatedBefore = &createdBefore
+	}
+	if req.MaxAge > 0 {
+		createdAfter := now.Add(-time.Duration(req.MaxAge) * time.Second)
+		filter.CreatedAfter = &createdAfter
+	}
+
+	var err error
+	filter.ExpiresBefore, err = parseOptionalTime(req.ExpiresBefore, "expiresBefore", domain.ErrCodeInvalidPendingFilter)
+	if err != nil {
+		return nil, err
+	}
+	filter.ExpiresAfter, err = parseOptionalTime(req.ExpiresAfter, "expiresAfter", domain.ErrCodeInvalidPendingFilter)
+	if err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func parseOptionalTime(value string, name string, errCode int) (*time.Time, error) {
+	if value == "" {
+		return nil, nil // nolint:nilnil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, domain.NewInvalidArgumentError(
+			name+" must be in RFC3339 format",
+			errCode,
+		)
+	}
+	parsed = parsed.UTC()
+	return &parsed, nil
+}
+
+func toFilesToDelete(refs []domain.PendingFileRef) []entity.FileToDelete {
+	files := make([]entity.FileToDelete, 0, len(refs))
+	for _, ref := range refs {
+		files = append(files, entity.FileToDelete{
+			Filename: ref.Filename,
+			Category: ref.Category,
+		})
+	}
+	return files
+}
+
+func toDomainPendingActionResults(results []entity.PendingActionResult) []domain.PendingActionResult {
+	domainResults := make([]domain.PendingActionResult, 0, len(results))
+	for _, result := range results {
+		domainResults = append(domainResults, domain.PendingActionResult{
+			Filename: result.Filename,
+			Category: result.Category,
+			Status:   result.Status,
+			Error:    result.Error,
+		})
+	}
+	return domainResults
+}
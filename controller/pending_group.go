@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type PendingGroupService interface {
+	GetPendingGroup(ctx context.Context, req domain.PendingGroupRequest, accessor entity.Accessor) (*entity.PendingGroup, error)
+	ExtendPendingGroup(
+		ctx context.Context,
+		req domain.ExtendPendingGroupRequest,
+		accessor entity.Accessor,
+	) (*entity.PendingGroup, error)
+	CommitGroup(ctx context.Context, req domain.PendingGroupRequest, accessor entity.Accessor) error
+	RollbackGroup(ctx context.Context, req domain.PendingGroupRequest, accessor entity.Accessor) error
+}
+
+// PendingGroups маршруты группы не содержат категорию,
+// разрешение на операцию проверяется сервисом для категории каждого файла группы
+type PendingGroups struct {
+	service PendingGroupService
+	admin   AdminAuth
+}
+
+func NewPendingGroups(service PendingGroupService, admin AdminAuth) PendingGroups {
+	return PendingGroups{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// Get
+//
+//	@Tags			pending-group
+//	@Summary		Get pending group
+//	@Description	Получить состояние группы pending загрузок и её файлов, требуется право чтения категорий всех файлов группы
+//	@Produce		json
+//
+//	@Param			groupId		path		string	true	"Идентификатор группы"
+//
+//	@Success		200			{object}	domain.PendingGroup
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/pending-group/{groupId} [GET]
+func (c PendingGroups) Get(ctx context.Context, r *http.Request, req domain.PendingGroupRequest) (*domain.PendingGroup, error) {
+	group, err := c.service.GetPendingGroup(ctx, req, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainPendingGroup(*group)
+	return &result, nil
+}
+
+// Commit
+//
+//	@Tags			pending-group
+//	@Summary		Commit pending group
+//	@Description	Подтвердить все файлы группы, файлы становятся доступны только все вместе.
+//	@Description	Все файлы группы должны быть загружены, требуется право подтверждения категорий всех файлов группы
+//	@Produce		json
+//
+//	@Param			groupId		path		string	true	"Идентификатор группы"
+//
+//	@Success		200			{object}	any
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/pending-group/{groupId}/commit [POST]
+func (c PendingGroups) Commit(ctx context.Context, r *http.Request, req domain.PendingGroupRequest) error {
+	return handleError(c.service.CommitGroup(ctx, req, accessor(r, c.admin)))
+}
+
+// Rollback
+//
+//	@Tags			pending-group
+//	@Summary		Rollback pending group
+//	@Description	Отменить загрузку всех файлов группы, требуется право подтверждения категорий всех файлов группы
+//	@Produce		json
+//
+//	@Param			groupId		path		string	true	"Идентификатор группы"
+//
+//	@Success		200			{object}	any
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/pending-group/{groupId}/rollback [POST]
+func (c PendingGroups) Rollback(ctx context.Context, r *http.Request, req domain.PendingGroupRequest) error {
+	return handleError(c.service.RollbackGroup(ctx, req, accessor(r, c.admin)))
+}
+
+// Extend
+//
+//	@Tags			pending-group
+//	@Summary		Extend pending group lease
+//	@Description	Продлить срок подтверждения группы и всех её файлов на ttl секунд от текущего момента,
+//	@Description	если ttl не указан, используется pending.fileLifetimeInMin, требуется право записи в категории всех файлов группы
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			groupId		path		string								true	"Идентификатор группы"
+//	@Param			body		body		domain.ExtendPendingGroupRequest	true	"Срок продления"
+//
+//	@Success		200			{object}	domain.PendingGroup
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/pending-group/{groupId}/extend [POST]
+func (c PendingGroups) Extend(
+	ctx context.Context,
+	r *http.Request,
+	req domain.ExtendPendingGroupRequest,
+) (*domain.PendingGroup, error) {
+	group, err := c.service.ExtendPendingGroup(ctx, req, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainPendingGroup(*group)
+	return &result, nil
+}
+
+func toDomainPendingGroup(group entity.PendingGroup) domain.PendingGroup {
+	files := make([]domain.PendingFile, 0, len(group.Files))
+	for _, file := range group.Files {
+		files = append(files, toDomainPendingFile(file))
+	}
+	return domain.PendingGroup{
+		Id:        group.Id,
+		Status:    group.Status,
+		CreatedAt: group.CreatedAt,
+		UpdatedAt: group.UpdatedAt,
+		ExpiresAt: group.ExpiresAt,
+		Files:     files,
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type QuotaService interface {
+	Status(ctx context.Context, scope string, name string) (*entity.QuotaStatus, error)
+	List(ctx context.Context, scope string) ([]entity.QuotaStatus, error)
+}
+
+type Quotas struct {
+	service QuotaService
+	admin   AdminAuth
+}
+
+func NewQuotas(service QuotaService, admin AdminAuth) Quotas {
+	return Quotas{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// List
+//
+//	@Tags			quota-admin
+//	@Summary		List quota usage
+//	@Description	Получить занятое место, количество объектов и лимиты категорий и клиентов, требуется X-Admin-Token.
+//	@Description	Учитываются все объекты, включая корзину, предыдущие версии и незавершённые загрузки
+//	@Produce		json
+//
+//	@Param			scope			query		string	false	"Ограничить выборку категориями или клиентами"	Enums(category, client)
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.QuotaStatus
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/quotas [GET]
+func (c Quotas) List(ctx context.Context, r *http.Request, req domain.QuotaListRequest) ([]domain.QuotaStatus, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	statuses, err := c.service.List(ctx, req.Scope)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := make([]domain.QuotaStatus, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, toDomainQuotaStatus(status))
+	}
+	return result, nil
+}
+
+// Get
+//
+//	@Tags			quota
+//	@Summary		Get quota usage
+//	@Description	Получить занятое место и лимиты категории и клиента, выполняющего запрос.
+//	@Description	Квота клиента возвращается, только если запрос подписан API ключом или bearer токеном
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория"
+//
+//	@Success		200			{object}	domain.QuotaResponse
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		401			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/quota/{category} [GET]
+func (c Quotas) Get(ctx context.Context, r *http.Request, req domain.QuotaRequest) (*domain.QuotaResponse, error) {
+	category, err := c.service.Status(ctx, entity.QuotaScopeCategory, req.Category)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	response := &domain.QuotaResponse{
+		Category: toDomainQuotaStatus(*category),
+	}
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		return response, nil
+	}
+	client, err := c.service.Status(ctx, entity.QuotaScopeClient, principal.Subject)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	clientStatus := toDomainQuotaStatus(*client)
+	response.Client = &clientStatus
+	return response, nil
+}
+
+func toDomainQuotaStatus(status entity.QuotaStatus) domain.QuotaStatus {
+	return domain.QuotaStatus{
+		Scope:           status.Usage.Scope,
+		Name:            status.Usage.Name,
+		Bytes:           status.Usage.Bytes,
+		Objects:         status.Usage.Objects,
+		ReservedBytes:   status.Usage.ReservedBytes,
+		ReservedObjects: status.Usage.ReservedObjects,
+		MaxBytes:        status.Limit.MaxBytes,
+		MaxObjects:      status.Limit.MaxObjects,
+		RemainingBytes:  status.RemainingBytes(),
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"storage-service/domain"
+
+	http2 "github.com/Falokut/go-kit/http"
+)
+
+// transferRetryAfter через сколько повторить запрос, отклонённый из-за одновременных передач
+const transferRetryAfter = time.Second
+
+type RateLimiter interface {
+	Allow(client string, route string) (time.Duration, bool)
+	AllowIp(ip string) (time.Duration, bool)
+	AcquireTransfer(client string) (func(), bool)
+}
+
+type RateLimits struct {
+	limiter   RateLimiter
+	clientIps ClientIps
+}
+
+func NewRateLimits(limiter RateLimiter, clientIps ClientIps) RateLimits {
+	return RateLimits{
+		limiter:   limiter,
+		clientIps: clientIps,
+	}
+}
+
+// Middleware ограничивает частоту запросов клиента к маршруту route (метод и путь),
+// при transfer также количество одновременных загрузок и скачиваний.
+// Клиент определяется по субъекту API ключа или bearer токена, поэтому middleware выполняется после проверки прав,
+// запросы без учётных данных учитываются по IP адресу
+func (l RateLimits) Middleware(route string, transfer bool) http2.Middleware {
+	return func(next http2.HandlerFunc) http2.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			client := l.client(r)
+			wait, ok := l.limiter.Allow(client, route)
+			if !ok {
+				return rateLimited(w, wait)
+			}
+			if !transfer {
+				return next(ctx, w, r)
+			}
+
+			release, ok := l.limiter.AcquireTransfer(client)
+			if !ok {
+				return rateLimited(w, transferRetryAfter)
+			}
+			defer release()
+			return next(ctx, w, r)
+		}
+	}
+}
+
+// IpMiddleware ограничивает частоту запросов с IP адреса клиента для всех маршрутов.
+// Выполняется до проверки учётных данных, поэтому учитываются и запросы, отклонённые с 401
+func (l RateLimits) IpMiddleware() http2.Middleware {
+	return func(next http2.HandlerFunc) http2.HandlerFunc {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			wait, ok := l.limiter.AllowIp(l.clientIps.Of(r))
+			if !ok {
+				return rateLimited(w, wait)
+			}
+			return next(ctx, w, r)
+		}
+	}
+}
+
+func (l RateLimits) client(r *http.Request) string {
+	principal, ok := principalFromContext(r.Context())
+	if ok {
+		return principal.Subject
+	}
+	return "ip:" + l.clientIps.Of(r)
+}
+
+func rateLimited(w http.ResponseWriter, wait time.Duration) error {
+	seconds := max(int(math.Ceil(wait.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return handleError(domain.ErrRateLimited)
+}
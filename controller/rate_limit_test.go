@@ -0,0 +1,54 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"storage-service/controller"
+	"storage-service/service/ratelimit"
+)
+
+func TestIpMiddlewareLimitsRequestsWithoutCredentials(t *testing.T) {
+	t.Parallel()
+
+	clientIps, err := controller.NewClientIps([]string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("client ips: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Ip: ratelimit.Limit{Rate: 1, Burst: 1}})
+	calls := 0
+	handler := controller.NewRateLimits(limiter, clientIps).IpMiddleware()(
+		func(context.Context, http.ResponseWriter, *http.Request) error {
+			calls++
+			return nil
+		},
+	)
+
+	request := func(forwardedFor string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/file/docs/a.txt", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		r.Header.Set("X-Api-Key", "invalid")
+		w := httptest.NewRecorder()
+		return w, handler(r.Context(), w, r)
+	}
+
+	_, err = request("203.0.113.1")
+	if err != nil || calls != 1 {
+		t.Fatalf("expected first request to pass, got %v and %d calls", err, calls)
+	}
+	w, err := request("203.0.113.1")
+	if err == nil || calls != 1 {
+		t.Fatalf("expected second request to be limited before authentication, got %v and %d calls", err, calls)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+	// клиенты за доверенным прокси учитываются отдельно
+	_, err = request("203.0.113.2")
+	if err != nil || calls != 2 {
+		t.Fatalf("expected request from another client to pass, got %v and %d calls", err, calls)
+	}
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/txix-open/bgjob"
+)
+
+type ReferenceService interface {
+	Attach(ctx context.Context, ref entity.FileReference) (*entity.FileReference, error)
+	Detach(ctx context.Context, ref entity.FileReference) error
+	FileReferences(ctx context.Context, filename string, category string) ([]entity.FileReference, error)
+	OwnerReferences(ctx context.Context, ownerType string, ownerId string, accessor entity.Accessor) ([]entity.FileReference, error)
+}
+
+type References struct {
+	service ReferenceService
+	admin   AdminAuth
+}
+
+func NewReferences(service ReferenceService, admin AdminAuth) References {
+	return References{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// FileReferences
+//
+//	@Tags			reference
+//	@Summary		List file references
+//	@Description	Получить ссылки доменных сущностей на файл
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//
+//	@Success		200			{array}		domain.FileReference
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/references [GET]
+func (c References) FileReferences(ctx context.Context, req domain.FileRequest) ([]domain.FileReference, error) {
+	refs, err := c.service.FileReferences(ctx, req.Filename, req.Category)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return toDomainFileReferences(refs), nil
+}
+
+// OwnerReferences
+//
+//	@Tags			reference
+//	@Summary		List owner references
+//	@Description	Получить ссылки доменной сущности на файлы категорий, которые субъект может читать
+//	@Produce		json
+//
+//	@Param			ownerType	path		string	true	"Тип сущности"
+//	@Param			ownerId		path		string	true	"Идентификатор сущности"
+//
+//	@Success		200			{array}		domain.FileReference
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/reference/{ownerType}/{ownerId} [GET]
+func (c References) OwnerReferences(
+	ctx context.Context,
+	r *http.Request,
+	req domain.OwnerReferencesRequest,
+) ([]domain.FileReference, error) {
+	refs, err := c.service.OwnerReferences(ctx, req.OwnerType, req.OwnerId, accessor(r, c.admin))
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return toDomainFileReferences(refs), nil
+}
+
+// Attach
+//
+//	@Tags			reference
+//	@Summary		Attach file
+//	@Description	Добавить ссылку сущности на файл, повторное добавление не считается ошибкой.
+//	@Description	Файл с ссылками не удаляется воркером
+//	@Accept			json
+//	@Produce		json
+//
+//	@Param			category	path		string							true	"Категория файла"
+//	@Param			filename	path		string							true	"Идентификатор файла"
+//	@Param			body		body		domain.AttachReferenceRequest	true	"Сущность"
+//
+//	@Success		200			{object}	domain.FileReference
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/references [POST]
+func (c References) Attach(ctx context.Context, req domain.AttachReferenceRequest) (*domain.FileReference, error) {
+	ref, err := c.service.Attach(ctx, entity.FileReference{
+		Filename:  req.Filename,
+		Category:  req.Category,
+		OwnerType: req.OwnerType,
+		OwnerId:   req.OwnerId,
+	})
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainFileReference(*ref)
+	return &result, nil
+}
+
+// Detach
+//
+//	@Tags			reference
+//	@Summary		Detach file
+//	@Description	Удалить ссылку сущности на файл, файл без ссылок удаляется по истечении references.gracePeriodInHours
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//	@Param			ownerType	path		string	true	"Тип сущности"
+//	@Param			ownerId		path		string	true	"Идентификатор сущности"
+//
+//	@Success		200			{object}	any
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/references/{ownerType}/{ownerId} [DELETE]
+func (c References) Detach(ctx context.Context, req domain.FileReferenceRequest) error {
+	return handleError(c.service.Detach(ctx, entity.FileReference{
+		Filename:  req.Filename,
+		Category:  req.Category,
+		OwnerType: req.OwnerType,
+		OwnerId:   req.OwnerId,
+	}))
+}
+
+func toDomainFileReferences(refs []entity.FileReference) []domain.FileReference {
+	result := make([]domain.FileReference, 0, len(refs))
+	for _, ref := range refs {
+		result = append(result, toDomainFileReference(ref))
+	}
+	return result
+}
+
+func toDomainFileReference(ref entity.FileReference) domain.FileReference {
+	return domain.FileReference{
+		Filename:  ref.Filename,
+		Category:  ref.Category,
+		OwnerType: ref.OwnerType,
+		OwnerId:   ref.OwnerId,
+		CreatedAt: ref.CreatedAt,
+	}
+}
+
+type UnreferencedFilesService interface {
+	DeleteUnreferencedFiles(ctx context.Context) error
+}
+
+type ReferenceWorker struct {
+	service UnreferencedFilesService
+}
+
+func NewReferenceWorker(service UnreferencedFilesService) ReferenceWorker {
+	return ReferenceWorker{
+		service: service,
+	}
+}
+
+func (c ReferenceWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	err := c.service.DeleteUnreferencedFiles(ctx)
+	if err != nil {
+		return bgjob.Retry(defaultRetryTime, err)
+	}
+	return bgjob.Reschedule(defaultRetryTime)
+}
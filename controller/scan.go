@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/txix-open/bgjob"
+)
+
+const scanPollInterval = 10 * time.Second
+
+type ScanService interface {
+	ProcessScans(ctx context.Context) (bool, error)
+}
+
+type ScanWorker struct {
+	service ScanService
+}
+
+func NewScanWorker(service ScanService) ScanWorker {
+	return ScanWorker{
+		service: service,
+	}
+}
+
+func (c ScanWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	more, err := c.service.ProcessScans(ctx)
+	switch {
+	case err != nil:
+		return bgjob.Retry(scanPollInterval, err)
+	case more:
+		return bgjob.Reschedule(0)
+	default:
+		return bgjob.Reschedule(scanPollInterval)
+	}
+}
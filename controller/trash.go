@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/txix-open/bgjob"
+)
+
+type TrashService interface {
+	List(ctx context.Context, category string, limit int, offset int) ([]entity.TrashFile, error)
+	Restore(ctx context.Context, id string, category string) (*entity.TrashFile, error)
+}
+
+type Trash struct {
+	service TrashService
+}
+
+func NewTrash(service TrashService) Trash {
+	return Trash{
+		service: service,
+	}
+}
+
+// List
+//
+//	@Tags			trash
+//	@Summary		List trash
+//	@Description	Получить список удалённых файлов категории
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			limit		query		int		false	"Максимальное количество записей, по умолчанию 100"
+//	@Param			offset		query		int		false	"Смещение"
+//
+//	@Success		200			{array}		domain.TrashFile
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/trash/{category} [GET]
+func (c Trash) List(ctx context.Context, req domain.TrashListRequest) ([]domain.TrashFile, error) {
+	files, err := c.service.List(ctx, req.Category, req.Limit, req.Offset)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.TrashFile, 0, len(files))
+	for _, file := range files {
+		result = append(result, toDomainTrashFile(file))
+	}
+	return result, nil
+}
+
+// Restore
+//
+//	@Tags			trash
+//	@Summary		Restore file
+//	@Description	Восстановить файл из корзины под исходным именем
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			id			path		string	true	"Идентификатор файла в корзине"
+//
+//	@Success		200			{object}	domain.TrashFile
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		409			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/trash/{category}/{id}/restore [POST]
+func (c Trash) Restore(ctx context.Context, req domain.TrashFileRequest) (*domain.TrashFile, error) {
+	file, err := c.service.Restore(ctx, req.Id, req.Category)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	result := toDomainTrashFile(*file)
+	return &result, nil
+}
+
+func toDomainTrashFile(file entity.TrashFile) domain.TrashFile {
+	return domain.TrashFile{
+		Id:        file.Id,
+		Filename:  file.Filename,
+		Category:  file.Category,
+		DeletedAt: file.DeletedAt,
+		DeletedBy: file.DeletedBy,
+		PurgeAt:   file.PurgeAt,
+	}
+}
+
+type TrashPurgeService interface {
+	PurgeExpiredFiles(ctx context.Context) error
+}
+
+type TrashWorker struct {
+	service TrashPurgeService
+}
+
+func NewTrashWorker(service TrashPurgeService) TrashWorker {
+	return TrashWorker{
+		service: service,
+	}
+}
+
+func (c TrashWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	err := c.service.PurgeExpiredFiles(ctx)
+	if err != nil {
+		return bgjob.Retry(defaultRetryTime, err)
+	}
+	return bgjob.Reschedule(defaultRetryTime)
+}
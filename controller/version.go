@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+type VersionService interface {
+	List(ctx context.Context, filename string, category string) ([]entity.FileVersion, error)
+	Restore(ctx context.Context, filename string, category string, versionId string, accessor entity.Accessor) error
+	Delete(ctx context.Context, filename string, category string, versionId string, accessor entity.Accessor) error
+}
+
+type Versions struct {
+	service VersionService
+	admin   AdminAuth
+}
+
+func NewVersions(service VersionService, admin AdminAuth) Versions {
+	return Versions{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// List
+//
+//	@Tags			version
+//	@Summary		List file versions
+//	@Description	Получить текущую и предыдущие версии файла, от новых к старым
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//
+//	@Success		200			{array}		domain.FileVersion
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/versions [GET]
+func (c Versions) List(ctx context.Context, req domain.FileRequest) ([]domain.FileVersion, error) {
+	versions, err := c.service.List(ctx, req.Filename, req.Category)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.FileVersion, 0, len(versions))
+	for _, version := range versions {
+		result = append(result, toDomainFileVersion(version))
+	}
+	return result, nil
+}
+
+// Restore
+//
+//	@Tags			version
+//	@Summary		Restore file version
+//	@Description	Сделать предыдущую версию файла текущей, текущее содержимое сохраняется как версия
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//	@Param			versionId	path		string	true	"Идентификатор версии"
+//
+//	@Success		200			{object}	any
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/versions/{versionId}/restore [POST]
+func (c Versions) Restore(ctx context.Context, r *http.Request, req domain.FileVersionRequest) error {
+	return handleError(c.service.Restore(ctx, req.Filename, req.Category, req.VersionId, accessor(r, c.admin)))
+}
+
+// Delete
+//
+//	@Tags			version
+//	@Summary		Delete file version
+//	@Description	Удалить предыдущую версию файла, текущую версию удалить нельзя.
+//	@Description	Удалить версию файла с владельцем может только владелец или администратор
+//	@Produce		json
+//
+//	@Param			category	path		string	true	"Категория файла"
+//	@Param			filename	path		string	true	"Идентификатор файла"
+//	@Param			versionId	path		string	true	"Идентификатор версии"
+//
+//	@Success		200			{object}	any
+//	@Failure		400			{object}	apierrors.Error
+//	@Failure		403			{object}	apierrors.Error
+//	@Failure		404			{object}	apierrors.Error
+//	@Failure		500			{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/file/{category}/{filename}/versions/{versionId} [DELETE]
+func (c Versions) Delete(ctx context.Context, r *http.Request, req domain.FileVersionRequest) error {
+	return handleError(c.service.Delete(ctx, req.Filename, req.Category, req.VersionId, accessor(r, c.admin)))
+}
+
+func toDomainFileVersion(version entity.FileVersion) domain.FileVersion {
+	return domain.FileVersion{
+		VersionId:   version.VersionId,
+		Size:        version.Size,
+		ContentType: version.ContentType,
+		CreatedAt:   version.CreatedAt,
+		ArchivedAt:  version.ArchivedAt,
+		Current:     version.Current,
+	}
+}
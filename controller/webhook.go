@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/txix-open/bgjob"
+)
+
+type WebhookService interface {
+	ListDeadLetters(ctx context.Context, subscription string, limit int, offset int) ([]entity.WebhookDelivery, error)
+	RetryDeadLetter(ctx context.Context, id int64) error
+}
+
+type Webhooks struct {
+	service WebhookService
+	admin   AdminAuth
+}
+
+func NewWebhooks(service WebhookService, admin AdminAuth) Webhooks {
+	return Webhooks{
+		service: service,
+		admin:   admin,
+	}
+}
+
+// DeadLetters
+//
+//	@Tags			webhook-admin
+//	@Summary		List webhook dead letters
+//	@Description	Получить события, которые не удалось доставить подписке за webhooks.maxAttempts попыток,
+//	@Description	от новых к старым, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			subscription	query		string	false	"Имя подписки"
+//	@Param			limit			query		int		false	"Максимальное количество записей, по умолчанию 100"
+//	@Param			offset			query		int		false	"Смещение"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{array}		domain.WebhookDeadLetter
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/webhooks/dead-letters [GET]
+func (c Webhooks) DeadLetters(
+	ctx context.Context,
+	r *http.Request,
+	req domain.WebhookDeadLetterListRequest,
+) ([]domain.WebhookDeadLetter, error) {
+	if !c.admin.IsAdmin(r) {
+		return nil, handleError(domain.ErrForbidden)
+	}
+
+	deliveries, err := c.service.ListDeadLetters(ctx, req.Subscription, req.Limit, req.Offset)
+	if err != nil {
+		return nil, handleError(err)
+	}
+
+	result := make([]domain.WebhookDeadLetter, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		result = append(result, domain.WebhookDeadLetter{
+			Id:           delivery.Id,
+			Subscription: delivery.Subscription,
+			Attempts:     delivery.Attempts,
+			LastError:    delivery.LastError,
+			DeadAt:       delivery.UpdatedAt,
+			Event: domain.StorageEvent{
+				Id:        delivery.EventId,
+				Type:      delivery.EventType,
+				Category:  delivery.Category,
+				Filename:  delivery.Filename,
+				Actor:     delivery.Actor,
+				CreatedAt: delivery.EventCreatedAt,
+			},
+		})
+	}
+	return result, nil
+}
+
+// Retry
+//
+//	@Tags			webhook-admin
+//	@Summary		Retry webhook dead letter
+//	@Description	Вернуть недоставленное событие в очередь доставки со сброшенным счётчиком попыток, требуется X-Admin-Token
+//	@Produce		json
+//
+//	@Param			id				path		int		true	"Идентификатор доставки"
+//	@Param			X-Admin-Token	header		string	true	"Токен привилегированного доступа"
+//
+//	@Success		200				{object}	any
+//	@Failure		400				{object}	apierrors.Error
+//	@Failure		403				{object}	apierrors.Error
+//	@Failure		404				{object}	apierrors.Error
+//	@Failure		500				{object}	apierrors.Error
+//	@Security		Bearer
+//	@Router			/admin/webhooks/dead-letters/{id}/retry [POST]
+func (c Webhooks) Retry(ctx context.Context, r *http.Request, req domain.RetryWebhookDeliveryRequest) error {
+	if !c.admin.IsAdmin(r) {
+		return handleError(domain.ErrForbidden)
+	}
+	return handleError(c.service.RetryDeadLetter(ctx, req.Id))
+}
+
+type WebhookDeliveryService interface {
+	Deliver(ctx context.Context) error
+}
+
+type WebhookWorker struct {
+	service WebhookDeliveryService
+}
+
+func NewWebhookWorker(service WebhookDeliveryService) WebhookWorker {
+	return WebhookWorker{
+		service: service,
+	}
+}
+
+func (c WebhookWorker) Handle(ctx context.Context, job bgjob.Job) bgjob.Result {
+	err := c.service.Deliver(ctx)
+	if err != nil {
+		return bgjob.Retry(eventPollInterval, err)
+	}
+	return bgjob.Reschedule(eventPollInterval)
+}
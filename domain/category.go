@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"time"
+)
+
+type CategoryRequest struct {
+	Name string `validate:"required"`
+}
+
+type CategorySettings struct {
+	StripImageMetadata    bool
+	TrashRetentionInHours int `validate:"gte=0"`
+	Versioning            bool
+	MaxVersions           int    `validate:"gte=0"`
+	RetentionMode         string `validate:"omitempty,oneof=governance compliance"`
+	RetentionPeriodInDays int    `validate:"gte=0"`
+	LegalHold             bool
+	// DefaultVisibility видимость новых файлов: private, internal или public, по умолчанию internal
+	DefaultVisibility string `validate:"omitempty,oneof=private internal public"`
+	// ScanMode проверка новых файлов антивирусом: sync - во время загрузки, async - после загрузки, пустая - без проверки
+	ScanMode string `validate:"omitempty,oneof=sync async"`
+	// InfectedAction что делать с заражённым файлом: delete - удалить, isolate - изолировать, по умолчанию delete
+	InfectedAction string `validate:"omitempty,oneof=delete isolate"`
+	// Validation проверки содержимого загружаемых файлов, файл с недопустимым содержимым отклоняется
+	Validation CategoryValidation
+}
+
+type CategoryValidation struct {
+	Image ImageValidation
+	Zip   ZipValidation
+	Pdf   PdfValidation
+	Text  TextValidation
+}
+
+// ImageValidation ограничения размеров JPEG, PNG и GIF изображений, 0 - без ограничения
+type ImageValidation struct {
+	Enabled   bool
+	MaxWidth  int   `validate:"gte=0"`
+	MaxHeight int   `validate:"gte=0"`
+	MaxPixels int64 `validate:"gte=0"`
+}
+
+// ZipValidation ограничения zip архивов и форматов на их основе, 0 - без ограничения
+type ZipValidation struct {
+	Enabled             bool
+	MaxEntries          int   `validate:"gte=0"`
+	MaxCompressionRatio int64 `validate:"gte=0"`
+	MaxUncompressedMb   int64 `validate:"gte=0"`
+}
+
+type PdfValidation struct {
+	Enabled bool
+}
+
+type TextValidation struct {
+	Enabled bool
+}
+
+type CreateCategoryRequest struct {
+	Name     string `validate:"required"`
+	Settings CategorySettings
+}
+
+type Category struct {
+	Name        string
+	Managed     bool
+	Status      string
+	Settings    CategorySettings
+	ObjectCount int64
+	TotalSize   int64
+	CreatedAt   *time.Time
+}
+
+type ConfirmationTokenResponse struct {
+	ConfirmationToken string
+	ExpiresAt         time.Time
+}
+
+type ForceDeleteCategoryRequest struct {
+	Name              string `validate:"required"`
+	ConfirmationToken string `validate:"required"`
+}
+
+type CategoryDeleteJobRequest struct {
+	Name  string `validate:"required"`
+	JobId string `validate:"required"`
+}
+
+type CategoryDeleteJob struct {
+	Id        string
+	Category  string
+	Status    string
+	Deleted   int64
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -5,14 +5,108 @@ import (
 )
 
 var (
-	ErrFileNotFound = errors.New("file not found")
+	ErrFileNotFound      = errors.New("file not found")
+	ErrTrashFileNotFound = errors.New("trash file not found")
+	ErrFileAlreadyExist  = errors.New("file already exist")
+
+	ErrBulkDeleteJobNotFound = errors.New("bulk delete job not found")
+
+	ErrCategoryNotFound          = errors.New("category not found")
+	ErrCategoryAlreadyExist      = errors.New("category already exist")
+	ErrCategoryNotEmpty          = errors.New("category is not empty")
+	ErrCategoryIsDeleting        = errors.New("category is being deleted")
+	ErrInvalidConfirmationToken  = errors.New("invalid or expired confirmation token")
+	ErrCategoryDeleteJobNotFound = errors.New("category delete job not found")
+
+	ErrVersionNotFound     = errors.New("file version not found")
+	ErrCannotDeleteCurrent = errors.New("current file version can't be deleted, delete the file instead")
+
+	ErrFileLocked = errors.New("file is locked by retention or legal hold")
+
+	ErrForbidden    = errors.New("operation is not permitted")
+	ErrUnauthorized = errors.New("missing or invalid credentials")
+
+	ErrPendingFileNotFound   = errors.New("pending file not found")
+	ErrPendingFileExpired    = errors.New("pending file is expired")
+	ErrPendingFileCommitted  = errors.New("pending file is already committed")
+	ErrPendingFileRolledBack = errors.New("pending file is rolled back")
+	ErrPendingFileNotReady   = errors.New("pending file upload is not completed")
+	ErrPendingFileInGroup    = errors.New("pending file belongs to a group, use group endpoints")
+	ErrPendingFileCommitting = errors.New("pending file is being committed")
+	ErrPendingFileConflict   = errors.New("pending file status has changed")
+
+	ErrPendingGroupNotFound   = errors.New("pending group not found")
+	ErrPendingGroupExpired    = errors.New("pending group is expired")
+	ErrPendingGroupCommitted  = errors.New("pending group is already committed")
+	ErrPendingGroupRolledBack = errors.New("pending group is rolled back")
+
+	ErrReferenceNotFound = errors.New("file reference not found")
+
+	ErrWebhookDeliveryNotFound = errors.New("dead webhook delivery not found")
+
+	ErrStorageEventNotFound   = errors.New("storage event not found")
+	ErrEventStreamUnavailable = errors.New("event stream is temporarily unavailable")
+
+	ErrApiKeyNotFound     = errors.New("api key not found")
+	ErrApiKeyAlreadyExist = errors.New("active api key with the same name already exist")
+
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrRateLimited   = errors.New("too many requests")
+
+	ErrFileQuarantined = errors.New("file is quarantined until antivirus scan completes")
+	ErrFileInfected    = errors.New("file is infected")
 )
 
 const (
-	ErrCodeFileNotFound        = 600
-	ErrCodeFileHasZeroSize     = 602
-	ErrCodeUnsupportedFileType = 603
-	ErrCodeInvalidRange        = 604
+	ErrCodeFileNotFound         = 600
+	ErrCodeFileHasZeroSize      = 602
+	ErrCodeUnsupportedFileType  = 603
+	ErrCodeInvalidRange         = 604
+	ErrCodeInvalidImage         = 605
+	ErrCodeTrashFileNotFound    = 606
+	ErrCodeFileAlreadyExist     = 607
+	ErrCodeInvalidExpiration    = 608
+	ErrCodeInvalidBulkDelete    = 609
+	ErrCodeBulkJobNotFound      = 610
+	ErrCodeCategoryNotFound     = 611
+	ErrCodeCategoryExist        = 612
+	ErrCodeCategoryNotEmpty     = 613
+	ErrCodeCategoryIsDeleting   = 614
+	ErrCodeInvalidConfirmation  = 615
+	ErrCodeCategoryJobNotFound  = 616
+	ErrCodeInvalidCategoryName  = 617
+	ErrCodeVersionNotFound      = 618
+	ErrCodeDeleteCurrent        = 619
+	ErrCodeFileLocked           = 620
+	ErrCodeInvalidLock          = 621
+	ErrCodeForbidden            = 622
+	ErrCodePendingNotFound      = 623
+	ErrCodePendingExpired       = 624
+	ErrCodePendingCommitted     = 625
+	ErrCodePendingRolledBack    = 626
+	ErrCodePendingNotReady      = 627
+	ErrCodePendingInGroup       = 628
+	ErrCodeGroupNotFound        = 629
+	ErrCodeGroupExpired         = 630
+	ErrCodeGroupCommitted       = 631
+	ErrCodeGroupRolledBack      = 632
+	ErrCodeInvalidPendingFilter = 633
+	ErrCodeReferenceNotFound    = 634
+	ErrCodeDeliveryNotFound     = 635
+	ErrCodeStreamUnavailable    = 636
+	ErrCodeInvalidEventFilter   = 637
+	ErrCodeInvalidAuditFilter   = 638
+	ErrCodeUnauthorized         = 639
+	ErrCodeApiKeyNotFound       = 640
+	ErrCodeApiKeyExist          = 641
+	ErrCodeInvalidApiKey        = 642
+	ErrCodeQuotaExceeded        = 643
+	ErrCodeRateLimited          = 644
+	ErrCodeFileQuarantined      = 645
+	ErrCodeFileInfected         = 646
+	ErrCodeInvalidFileContent   = 647
+	ErrCodePendingCommitting    = 648
+	ErrCodePendingConflict      = 649
 )
 
 type InvalidArgumentError struct {
@@ -27,3 +121,11 @@ func NewInvalidArgumentError(reason string, errCode int) InvalidArgumentError {
 func (e InvalidArgumentError) Error() string {
 	return e.Reason
 }
+
+// AccessDenied ошибка отказа в доступе: ErrUnauthorized для запроса без учётных данных, иначе ErrForbidden
+func AccessDenied(anonymous bool) error {
+	if anonymous {
+		return ErrUnauthorized
+	}
+	return ErrForbidden
+}
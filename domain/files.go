@@ -1,14 +1,51 @@
 package domain
 
+import (
+	"time"
+)
+
+// AdminTokenHeader заголовок с токеном привилегированного доступа
+const AdminTokenHeader = "X-Admin-Token"
+
+// ApiKeyHeader заголовок с API ключом клиента сервиса
+const ApiKeyHeader = "X-Api-Key"
+
 type UploadFileRequest struct {
 	Category   string `validate:"required"`
 	Filename   string
 	Pending    bool
+	PendingTtl int64 `validate:"gte=0"`
+	GroupId    string
 	PrettyName string
+	ExpiresAt  string
+	Ttl        int64 `validate:"gte=0"`
+	// Visibility видимость файла, по умолчанию задаётся настройками категории
+	Visibility string `validate:"omitempty,oneof=private internal public"`
 }
 
 type UploadFileResponse struct {
-	Filename string
+	Filename  string
+	Size      int64
+	Checksum  string
+	VersionId string
+	ExpiresAt *time.Time
+	// PendingExpiresAt срок подтверждения загрузки с pending=true
+	PendingExpiresAt *time.Time
+	Owner            string
+	Visibility       string
+	// Quarantined файл ожидает проверки антивирусом и не выдаётся до её завершения
+	Quarantined bool
+}
+
+type SetExpirationRequest struct {
+	Filename  string `validate:"required"`
+	Category  string `validate:"required"`
+	ExpiresAt *time.Time
+	Ttl       int64 `validate:"gte=0"`
+}
+
+type ExpirationResponse struct {
+	ExpiresAt *time.Time
 }
 
 type FileRequest struct {
@@ -16,6 +53,383 @@ type FileRequest struct {
 	Category string `validate:"required"`
 }
 
+type GetFileRequest struct {
+	Filename       string `validate:"required"`
+	Category       string `validate:"required"`
+	VersionId      string
+	IncludePending bool
+}
+
+type FileExistRequest struct {
+	Filename       string `validate:"required"`
+	Category       string `validate:"required"`
+	IncludePending bool
+}
+
 type FileExistResponse struct {
 	FileExist bool
 }
+
+type TrashListRequest struct {
+	Category string `validate:"required"`
+	Limit    int    `validate:"gte=0,lte=1000"`
+	Offset   int    `validate:"gte=0"`
+}
+
+type TrashFileRequest struct {
+	Category string `validate:"required"`
+	Id       string `validate:"required"`
+}
+
+type TrashFile struct {
+	Id        string
+	Filename  string
+	Category  string
+	DeletedAt time.Time
+	DeletedBy string
+	PurgeAt   time.Time
+}
+
+type BulkDeleteRequest struct {
+	Category  string   `validate:"required"`
+	Filenames []string `validate:"dive,required"`
+	Prefix    string
+}
+
+type BulkDeleteFileResult struct {
+	Filename string
+	Status   string
+	Error    string
+}
+
+type BulkDeleteResponse struct {
+	Files []BulkDeleteFileResult
+	Job   *BulkDeleteJob
+}
+
+type BulkDeleteJobRequest struct {
+	Category string `validate:"required"`
+	JobId    string `validate:"required"`
+}
+
+type BulkDeleteJob struct {
+	Id        string
+	Category  string
+	Prefix    string
+	Status    string
+	Deleted   int64
+	Failed    int64
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type FileVersionRequest struct {
+	Filename  string `validate:"required"`
+	Category  string `validate:"required"`
+	VersionId string `validate:"required"`
+}
+
+type FileVersion struct {
+	VersionId   string
+	Size        int64
+	ContentType string
+	CreatedAt   time.Time
+	ArchivedAt  *time.Time
+	Current     bool
+}
+
+type SetRetentionRequest struct {
+	Filename    string `validate:"required"`
+	Category    string `validate:"required"`
+	Mode        string `validate:"omitempty,oneof=governance compliance"`
+	RetainUntil *time.Time
+}
+
+type SetLegalHoldRequest struct {
+	Filename string `validate:"required"`
+	Category string `validate:"required"`
+	Enabled  bool
+}
+
+type FileLock struct {
+	RetentionMode string
+	RetainUntil   *time.Time
+	LegalHold     bool
+	Locked        bool
+}
+
+type ExtendPendingRequest struct {
+	Filename string `validate:"required"`
+	Category string `validate:"required"`
+	Ttl      int64  `validate:"gte=0"`
+}
+
+type PendingFile struct {
+	Filename   string
+	Category   string
+	GroupId    string
+	UploadedBy string
+	Status     string
+	Error      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ExpiresAt  time.Time
+	Attempts   int
+	LastError  string
+}
+
+type PendingDeadLetterListRequest struct {
+	Category string
+	Limit    int `validate:"gte=0,lte=1000"`
+	Offset   int `validate:"gte=0"`
+}
+
+type PendingDeadLetter struct {
+	Id         string
+	Filename   string
+	Category   string
+	GroupId    string
+	UploadedBy string
+	Attempts   int
+	LastError  string
+	CreatedAt  time.Time
+	DeadAt     time.Time
+}
+
+type PendingListRequest struct {
+	Category   string
+	Status     string `validate:"omitempty,oneof=uploading pending committed rolled_back expired failed"`
+	GroupId    string
+	UploadedBy string
+	// MinAge и MaxAge ограничивают время с начала загрузки, в секундах
+	MinAge        int64 `validate:"gte=0"`
+	MaxAge        int64 `validate:"gte=0"`
+	ExpiresBefore string
+	ExpiresAfter  string
+	Limit         int `validate:"gte=0,lte=1000"`
+	Offset        int `validate:"gte=0"`
+}
+
+type PendingFileRef struct {
+	Filename string `validate:"required"`
+	Category string `validate:"required"`
+}
+
+type PendingActionRequest struct {
+	Files []PendingFileRef `validate:"required,min=1,max=1000,dive"`
+}
+
+type PendingActionResult struct {
+	Filename string
+	Category string
+	Status   string
+	Error    string
+}
+
+type PendingCategoryStats struct {
+	Category        string
+	Uploading       int64
+	Pending         int64
+	Committed       int64
+	RolledBack      int64
+	Expired         int64
+	Failed          int64
+	OldestCreatedAt *time.Time
+}
+
+type PendingGroupRequest struct {
+	GroupId string `validate:"required"`
+}
+
+type ExtendPendingGroupRequest struct {
+	GroupId string `validate:"required"`
+	Ttl     int64  `validate:"gte=0"`
+}
+
+type PendingGroup struct {
+	Id        string
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+	Files     []PendingFile
+}
+
+type AttachReferenceRequest struct {
+	Filename  string `validate:"required"`
+	Category  string `validate:"required"`
+	OwnerType string `validate:"required"`
+	OwnerId   string `validate:"required"`
+}
+
+type FileReferenceRequest struct {
+	Filename  string `validate:"required"`
+	Category  string `validate:"required"`
+	OwnerType string `validate:"required"`
+	OwnerId   string `validate:"required"`
+}
+
+type OwnerReferencesRequest struct {
+	OwnerType string `validate:"required"`
+	OwnerId   string `validate:"required"`
+}
+
+type FileReference struct {
+	Filename  string
+	Category  string
+	OwnerType string
+	OwnerId   string
+	CreatedAt time.Time
+}
+
+type WebhookDeadLetterListRequest struct {
+	Subscription string
+	Limit        int `validate:"gte=0,lte=1000"`
+	Offset       int `validate:"gte=0"`
+}
+
+type RetryWebhookDeliveryRequest struct {
+	Id int64 `validate:"required"`
+}
+
+// StorageEvent теги указаны явно, так как событие сериализуется и вне http обработчиков (поток SSE)
+type StorageEvent struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Category  string    `json:"category"`
+	Filename  string    `json:"filename"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type EventStreamRequest struct {
+	// Categories и EventTypes перечисляются через запятую
+	Categories  string
+	EventTypes  string
+	LastEventId int64 `validate:"gte=0"`
+}
+
+type WebhookDeadLetter struct {
+	Id           int64
+	Subscription string
+	Attempts     int
+	LastError    string
+	DeadAt       time.Time
+	Event        StorageEvent
+}
+
+type AuditListRequest struct {
+	Action    string
+	Actor     string
+	Category  string
+	Filename  string
+	Outcome   string `validate:"omitempty,oneof=success denied failure"`
+	RequestId string
+	// From и To ограничивают время запроса, в формате RFC3339
+	From   string
+	To     string
+	Limit  int `validate:"gte=0,lte=1000"`
+	Offset int `validate:"gte=0"`
+}
+
+type AuditExportRequest struct {
+	Action    string
+	Actor     string
+	Category  string
+	Filename  string
+	Outcome   string `validate:"omitempty,oneof=success denied failure"`
+	RequestId string
+	From      string
+	To        string
+	Format    string `validate:"omitempty,oneof=csv jsonl"`
+}
+
+// AuditRecord теги указаны явно, так как запись сериализуется и вне http обработчиков (выгрузка jsonl)
+type AuditRecord struct {
+	Id            int64     `json:"id"`
+	Action        string    `json:"action"`
+	Actor         string    `json:"actor"`
+	ClientIp      string    `json:"clientIp"`
+	RequestId     string    `json:"requestId"`
+	Category      string    `json:"category"`
+	Filename      string    `json:"filename"`
+	BytesReceived int64     `json:"bytesReceived"`
+	BytesSent     int64     `json:"bytesSent"`
+	StatusCode    int       `json:"statusCode"`
+	Outcome       string    `json:"outcome"`
+	Error         string    `json:"error"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type CreateApiKeyRequest struct {
+	Name       string   `validate:"required,max=255"`
+	Categories []string `validate:"dive,required"`
+	Operations []string `validate:"required,min=1,dive,oneof=read write delete commit admin"`
+	// AllowedIps адреса и подсети в нотации CIDR, если пустой, адрес клиента не ограничивается
+	AllowedIps []string
+	// ExpiresAt время окончания действия ключа, если не указано, ключ бессрочный
+	ExpiresAt *time.Time
+}
+
+type ApiKeyIdRequest struct {
+	Id string `validate:"required"`
+}
+
+type RotateApiKeyRequest struct {
+	Id string `validate:"required"`
+	// GracePeriodInSec сколько ещё принимается предыдущий секрет
+	GracePeriodInSec int64 `validate:"gte=0"`
+}
+
+type ApiKeyListRequest struct {
+	IncludeRevoked bool
+}
+
+type ApiKey struct {
+	Id                string
+	Name              string
+	Categories        []string
+	Operations        []string
+	AllowedIps        []string
+	ExpiresAt         *time.Time
+	PreviousExpiresAt *time.Time
+	CreatedAt         time.Time
+	RotatedAt         *time.Time
+	RevokedAt         *time.Time
+}
+
+type ApiKeySecret struct {
+	ApiKey
+	// Key значение для заголовка X-Api-Key, возвращается только при создании и ротации
+	Key string
+}
+
+type QuotaListRequest struct {
+	Scope string `validate:"omitempty,oneof=category client"`
+}
+
+type QuotaRequest struct {
+	Category string `validate:"required"`
+}
+
+type QuotaStatus struct {
+	Scope   string
+	Name    string
+	Bytes   int64
+	Objects int64
+	// ReservedBytes и ReservedObjects зарезервированы выполняющимися загрузками
+	ReservedBytes   int64
+	ReservedObjects int64
+	// MaxBytes и MaxObjects лимиты, 0 - без ограничения
+	MaxBytes   int64
+	MaxObjects int64
+	// RemainingBytes сколько байт ещё можно записать с учётом резервов, -1 если место не ограничено
+	RemainingBytes int64
+}
+
+type QuotaResponse struct {
+	Category QuotaStatus
+	// Client квота клиента, выполняющего запрос, отсутствует для запросов без учётных данных
+	Client *QuotaStatus
+}
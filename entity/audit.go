@@ -0,0 +1,96 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	AuditFileUpload         = "file.upload"
+	AuditFileDownload       = "file.download"
+	AuditFileExist          = "file.exist"
+	AuditFileDelete         = "file.delete"
+	AuditFileCommit         = "file.commit"
+	AuditFileRollback       = "file.rollback"
+	AuditFilePending        = "file.get_pending"
+	AuditFileExtend         = "file.extend"
+	AuditFileExpiration     = "file.set_expiration"
+	AuditFileRetention      = "file.set_retention"
+	AuditFileLegalHold      = "file.set_legal_hold"
+	AuditFileLock           = "file.get_lock"
+	AuditVersionList        = "version.list"
+	AuditVersionRestore     = "version.restore"
+	AuditVersionDelete      = "version.delete"
+	AuditReferenceList      = "reference.list"
+	AuditReferenceOwner     = "reference.list_owner"
+	AuditReferenceAttach    = "reference.attach"
+	AuditReferenceDetach    = "reference.detach"
+	AuditGroupGet           = "group.get"
+	AuditGroupCommit        = "group.commit"
+	AuditGroupRollback      = "group.rollback"
+	AuditGroupExtend        = "group.extend"
+	AuditTrashList          = "trash.list"
+	AuditTrashRestore       = "trash.restore"
+	AuditBulkDelete         = "bulk.delete"
+	AuditBulkDeleteJob      = "bulk.get_job"
+	AuditCategoryList       = "category.list"
+	AuditCategoryGet        = "category.get"
+	AuditCategoryCreate     = "category.create"
+	AuditCategoryDelete     = "category.delete"
+	AuditCategoryForceStart = "category.force_delete_request"
+	AuditCategoryForce      = "category.force_delete"
+	AuditCategoryForceJob   = "category.get_delete_job"
+	AuditQuotaGet           = "quota.get"
+	AuditQuotaList          = "quota.list"
+	AuditPendingList        = "pending.list"
+	AuditPendingStats       = "pending.stats"
+	AuditPendingDead        = "pending.dead_letters"
+	AuditPendingExpire      = "pending.expire"
+	AuditPendingCommit      = "pending.commit"
+	AuditWebhookDead        = "webhook.dead_letters"
+	AuditWebhookRetry       = "webhook.retry"
+	AuditEventStream        = "events.stream"
+	AuditList               = "audit.list"
+	AuditExport             = "audit.export"
+	AuditApiKeyList         = "apikey.list"
+	AuditApiKeyCreate       = "apikey.create"
+	AuditApiKeyRotate       = "apikey.rotate"
+	AuditApiKeyRevoke       = "apikey.revoke"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	// AuditOutcomeDenied запрос отклонён из-за отсутствия прав
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditRecord запись журнала аудита об одном запросе
+type AuditRecord struct {
+	Id            int64
+	Action        string
+	Actor         string
+	ClientIp      string `db:"client_ip"`
+	RequestId     string `db:"request_id"`
+	Category      string
+	Filename      string
+	BytesReceived int64 `db:"bytes_received"`
+	BytesSent     int64 `db:"bytes_sent"`
+	StatusCode    int   `db:"status_code"`
+	Outcome       string
+	Error         string
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// AuditFilter условия выборки журнала аудита, пустые поля не ограничивают выборку
+type AuditFilter struct {
+	Action        string
+	Actor         string
+	Category      string
+	Filename      string
+	Outcome       string
+	RequestId     string
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	Limit         int
+	Offset        int
+}
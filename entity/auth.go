@@ -0,0 +1,116 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// PermissionAny подходит к любому значению сегмента разрешения
+	PermissionAny = "*"
+	// PermissionAdmin разрешение на административные операции, при включённой проверке учётных данных заменяет X-Admin-Token
+	PermissionAdmin = "admin"
+)
+
+// Principal проверенный субъект запроса и его разрешения вида ресурс:действие[:категория]
+type Principal struct {
+	Subject     string
+	Permissions []string
+}
+
+// Allowed проверяет, что хотя бы одно разрешение покрывает required,
+// сегмент * в разрешении подходит к любому значению
+func (p Principal) Allowed(required string) bool {
+	requiredSegments := strings.Split(required, ":")
+	for _, permission := range p.Permissions {
+		if permissionMatch(strings.Split(permission, ":"), requiredSegments) {
+			return true
+		}
+	}
+	return false
+}
+
+func permissionMatch(granted []string, required []string) bool {
+	if len(granted) != len(required) {
+		return false
+	}
+	for i := range granted {
+		if granted[i] != PermissionAny && granted[i] != required[i] {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	ApiKeyOperationRead   = "read"
+	ApiKeyOperationWrite  = "write"
+	ApiKeyOperationDelete = "delete"
+	ApiKeyOperationCommit = "commit"
+	ApiKeyOperationAdmin  = "admin"
+
+	// ApiKeySubjectPrefix префикс субъекта клиента, подписанного API ключом, отличает его от субъектов токенов
+	ApiKeySubjectPrefix = "api-key:"
+	// AdminTokenSubject субъект запроса, подписанного токеном X-Admin-Token
+	AdminTokenSubject = "admin-token"
+)
+
+// ApiKey ключ доступа сервиса, хранится только хэш секрета,
+// после ротации предыдущий секрет действует до PreviousExpiresAt
+type ApiKey struct {
+	Id                 string
+	Name               string
+	SecretHash         string
+	PreviousSecretHash string
+	PreviousExpiresAt  *time.Time
+	// Categories пустой список не ограничивает категории
+	Categories []string
+	Operations []string
+	// AllowedIps адреса и подсети, пустой список не ограничивает адрес
+	AllowedIps []string
+	ExpiresAt  *time.Time
+	CreatedAt  time.Time
+	RotatedAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// Principal субъект и разрешения маршрутов, соответствующие операциям ключа.
+// Разрешения групп и ссылок не содержат категорию, категория проверяется для каждого файла группы и ссылки,
+// список категорий доступен только ключу без ограничения категорий
+func (k ApiKey) Principal() Principal {
+	categories := k.Categories
+	if len(categories) == 0 {
+		categories = []string{PermissionAny}
+	}
+	permissions := make([]string, 0)
+	categoryScoped := func(prefix string) {
+		for _, category := range categories {
+			permissions = append(permissions, prefix+category)
+		}
+	}
+	for _, operation := range k.Operations {
+		switch operation {
+		case ApiKeyOperationRead:
+			categoryScoped("files:read:")
+			permissions = append(permissions, "groups:read", "references:read")
+			if len(k.Categories) == 0 {
+				permissions = append(permissions, "categories:read")
+			}
+		case ApiKeyOperationWrite:
+			categoryScoped("files:write:")
+			categoryScoped("files:lock:")
+			permissions = append(permissions, "groups:write")
+		case ApiKeyOperationDelete:
+			categoryScoped("files:delete:")
+		case ApiKeyOperationCommit:
+			categoryScoped("files:commit:")
+			permissions = append(permissions, "groups:commit")
+		case ApiKeyOperationAdmin:
+			permissions = append(permissions, PermissionAdmin)
+		}
+	}
+	return Principal{
+		Subject:     ApiKeySubjectPrefix + k.Name,
+		Permissions: permissions,
+	}
+}
@@ -0,0 +1,107 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	CategoryStatusActive   = "active"
+	CategoryStatusDeleting = "deleting"
+
+	CategoryDeleteJobInProgress = "in_progress"
+	CategoryDeleteJobDone       = "done"
+	CategoryDeleteJobFailed     = "failed"
+)
+
+type CategorySettings struct {
+	StripImageMetadata bool
+	TrashRetention     time.Duration
+	Versioning         bool
+	MaxVersions        int
+	RetentionMode      string
+	RetentionPeriod    time.Duration
+	LegalHold          bool
+	// DefaultVisibility видимость новых файлов, если не указана при загрузке, пустая равнозначна internal
+	DefaultVisibility string
+	// ScanMode проверка новых файлов антивирусом: sync или async, пустая - без проверки
+	ScanMode string
+	// InfectedAction что делать с заражённым файлом: delete или isolate, пустое равнозначно delete
+	InfectedAction string
+	// Validation проверки содержимого загружаемых файлов, выполняются после проверки поддерживаемых типов
+	Validation CategoryValidation
+}
+
+type CategoryValidation struct {
+	Image ImageValidation
+	Zip   ZipValidation
+	Pdf   PdfValidation
+	Text  TextValidation
+}
+
+// ImageValidation ограничения размеров JPEG, PNG и GIF изображений, 0 - без ограничения
+type ImageValidation struct {
+	Enabled   bool
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+}
+
+// ZipValidation ограничения zip архивов и форматов на их основе, 0 - без ограничения
+type ZipValidation struct {
+	Enabled             bool
+	MaxEntries          int
+	MaxCompressionRatio int64
+	MaxUncompressedMb   int64
+}
+
+type PdfValidation struct {
+	Enabled bool
+}
+
+type TextValidation struct {
+	Enabled bool
+}
+
+type Category struct {
+	Name      string
+	Settings  CategorySettings
+	Status    string
+	CreatedAt time.Time
+}
+
+type CategoryStats struct {
+	ObjectCount int64
+	TotalSize   int64
+}
+
+type CategoryInfo struct {
+	Name      string
+	Managed   bool
+	Status    string
+	Settings  CategorySettings
+	Stats     CategoryStats
+	CreatedAt *time.Time
+}
+
+type CategoryDeleteToken struct {
+	Token     string
+	Category  string
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+type CategoryDeleteJob struct {
+	Id        string
+	Category  string
+	Status    string
+	Deleted   int64
+	LastError string    `db:"last_error"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// IsInternalObject служебные объекты (корзина и т.п.) хранятся под префиксами с '/',
+// который не может встречаться в имени файла из пути запроса
+func IsInternalObject(name string) bool {
+	return strings.Contains(name, "/")
+}
@@ -1,29 +1,423 @@
 package entity
 
-import "io"
+import (
+	"io"
+	"slices"
+	"time"
+)
 
 const (
 	FilePrettyNameMetadataField      = "PrettyName"
 	FileMinioMetadataPrettyNameField = "X-Amz-Meta-PrettyName"
+	FileVersionIdMetadataField       = "VersionId"
+	FileMinioMetadataVersionIdField  = "X-Amz-Meta-VersionId"
+	FileOwnerMetadataField           = "Owner"
+	FileMinioMetadataOwnerField      = "X-Amz-Meta-Owner"
+	FileVisibilityMetadataField      = "Visibility"
+	FileMinioMetadataVisibilityField = "X-Amz-Meta-Visibility"
+)
+
+const (
+	// VisibilityPrivate файл доступен только владельцу и администратору
+	VisibilityPrivate = "private"
+	// VisibilityInternal файл доступен любому субъекту с разрешением маршрута
+	VisibilityInternal = "internal"
+	// VisibilityPublic файл можно читать без учётных данных
+	VisibilityPublic = "public"
 )
 
+// Accessor субъект, от имени которого выполняется операция с файлом
+type Accessor struct {
+	Subject string
+	// Permissions разрешения субъекта для операций с файлами нескольких категорий, которые не проверяются маршрутом
+	Permissions []string
+	// Unrestricted администратор или запрос без учётных данных при выключенной проверке auth.enabled
+	Unrestricted bool
+}
+
+func (a Accessor) Anonymous() bool {
+	return !a.Unrestricted && a.Subject == ""
+}
+
+// CanAccessCategory разрешение на операцию operation (read, write, commit, delete) с файлами категории
+func (a Accessor) CanAccessCategory(operation string, category string) bool {
+	if a.Unrestricted {
+		return true
+	}
+	return Principal{Permissions: a.Permissions}.Allowed("files:" + operation + ":" + category)
+}
+
 type Metadata struct {
 	Filename    string
 	PrettyName  string
 	Category    string
 	ContentType string
 	Size        int64
+	VersionId   string
+	// Owner субъект, загрузивший файл, пустой для файлов, загруженных без учётных данных
+	Owner string
+	// Visibility пустая для файлов, загруженных до появления видимости, и равнозначна internal
+	Visibility string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+}
+
+// CanRead приватный файл с владельцем читает только владелец, публичный - любой
+func (m Metadata) CanRead(accessor Accessor) bool {
+	switch {
+	case accessor.Unrestricted, m.Visibility == VisibilityPublic:
+		return true
+	case accessor.Anonymous():
+		return false
+	case m.Visibility == VisibilityPrivate:
+		return m.Owner == "" || m.Owner == accessor.Subject
+	default:
+		return true
+	}
+}
+
+// CanModify удалить, подтвердить или откатить файл с владельцем может только владелец,
+// для файла без владельца достаточно разрешения маршрута
+func (m Metadata) CanModify(accessor Accessor) bool {
+	if accessor.Unrestricted {
+		return true
+	}
+	return !accessor.Anonymous() && (m.Owner == "" || m.Owner == accessor.Subject)
 }
 
 type UploadFileRequest struct {
+	Filename   string
+	PrettyName string
+	Category   string
+	Pending    bool
+	PendingTtl time.Duration
+	GroupId    string
+	UploadedBy string
+	// Accessor загрузивший файл субъект становится владельцем файла
+	Accessor Accessor
+	// Visibility если пустая, используется видимость по умолчанию категории
+	Visibility string
+	ExpiresAt  *time.Time
+	Ttl        time.Duration
+	// Size объявленный размер содержимого, -1 если неизвестен
+	Size          int64
+	ContentReader io.Reader
+}
+
+type UploadedFile struct {
+	Filename  string
+	Size      int64
+	Checksum  string
+	VersionId string
+	ExpiresAt *time.Time
+	// PendingExpiresAt срок подтверждения загрузки с pending=true
+	PendingExpiresAt *time.Time
+	Owner            string
+	Visibility       string
+	// Quarantined файл ожидает проверки антивирусом и не выдаётся до её завершения
+	Quarantined bool
+}
+
+const (
+	Day = 24 * time.Hour
+
+	// RetentionModeGovernance срок блокировки можно сократить или снять через API
+	RetentionModeGovernance = "governance"
+	// RetentionModeCompliance срок блокировки можно только продлить
+	RetentionModeCompliance = "compliance"
+)
+
+type FileLock struct {
 	Filename      string
-	PrettyName    string
 	Category      string
-	Pending       bool
-	ContentReader io.Reader
+	RetentionMode string     `db:"retention_mode"`
+	RetainUntil   *time.Time `db:"retain_until"`
+	LegalHold     bool       `db:"legal_hold"`
+}
+
+// IsLocked файл нельзя удалить или перезаписать, пока действует срок блокировки или удержание
+func (l FileLock) IsLocked(now time.Time) bool {
+	return l.LegalHold || l.IsRetained(now)
+}
+
+func (l FileLock) IsRetained(now time.Time) bool {
+	return l.RetainUntil != nil && now.Before(*l.RetainUntil)
+}
+
+const (
+	PendingStatusUploading = "uploading"
+	PendingStatusPending   = "pending"
+	// PendingStatusCommitting файл переносится под своё имя
+	PendingStatusCommitting = "committing"
+	PendingStatusCommitted  = "committed"
+	PendingStatusRolledBack = "rolled_back"
+	PendingStatusExpired    = "expired"
+	PendingStatusFailed     = "failed"
+
+	PendingActionNotFound = "not_found"
+	PendingActionError    = "error"
+)
+
+type PendingFile struct {
+	Filename   string
+	Category   string
+	GroupId    string `db:"group_id"`
+	UploadedBy string `db:"uploaded_by"`
+	Status     string
+	Error      string
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	// Attempts количество неудачных попыток удалить файл из области pending после истечения срока
+	Attempts  int
+	LastError string     `db:"last_error"`
+	CleanedAt *time.Time `db:"cleaned_at"`
+	// FileExpiresAt срок жизни файла, указанный при загрузке, устанавливается при подтверждении
+	FileExpiresAt *time.Time `db:"file_expires_at"`
+}
+
+// PendingDeadLetter загрузка, файл которой не удалось удалить из области pending за отведённое число попыток
+type PendingDeadLetter struct {
+	Id         string
+	Filename   string
+	Category   string
+	GroupId    string `db:"group_id"`
+	UploadedBy string `db:"uploaded_by"`
+	Attempts   int
+	LastError  string    `db:"last_error"`
+	CreatedAt  time.Time `db:"created_at"`
+	DeadAt     time.Time `db:"dead_at"`
+}
+
+// PendingFilter условия выборки загрузок, пустые поля не ограничивают выборку
+type PendingFilter struct {
+	Category      string
+	Status        string
+	GroupId       string
+	UploadedBy    string
+	CreatedBefore *time.Time
+	CreatedAfter  *time.Time
+	ExpiresBefore *time.Time
+	ExpiresAfter  *time.Time
+	Limit         int
+	Offset        int
+}
+
+type PendingCategoryStats struct {
+	Category   string
+	Uploading  int64
+	Pending    int64
+	Committed  int64
+	RolledBack int64 `db:"rolled_back"`
+	Expired    int64
+	Failed     int64
+	// OldestCreatedAt момент начала самой старой незавершённой загрузки
+	OldestCreatedAt *time.Time `db:"oldest_created_at"`
+}
+
+// PendingActionResult результат действия администратора над загрузкой,
+// Status - состояние загрузки после действия, PendingActionNotFound или PendingActionError
+type PendingActionResult struct {
+	Filename string
+	Category string
+	Status   string
+	Error    string
+}
+
+// PendingGroup загрузки группы подтверждаются или отменяются только вместе
+type PendingGroup struct {
+	Id        string
+	Status    string
+	CreatedAt time.Time     `db:"created_at"`
+	UpdatedAt time.Time     `db:"updated_at"`
+	ExpiresAt time.Time     `db:"expires_at"`
+	Files     []PendingFile `db:"-"`
 }
 
 type FileToDelete struct {
 	Filename string
 	Category string
 }
+
+type TrashFile struct {
+	Id        string
+	Filename  string
+	Category  string
+	DeletedAt time.Time `db:"deleted_at"`
+	DeletedBy string    `db:"deleted_by"`
+	PurgeAt   time.Time `db:"purge_at"`
+}
+
+const (
+	BulkDeleteStatusDeleted   = "deleted"
+	BulkDeleteStatusNotFound  = "not_found"
+	BulkDeleteStatusLocked    = "locked"
+	BulkDeleteStatusForbidden = "forbidden"
+	BulkDeleteStatusError     = "error"
+
+	BulkDeleteJobInProgress = "in_progress"
+	BulkDeleteJobDone       = "done"
+	BulkDeleteJobFailed     = "failed"
+)
+
+// BulkDeleteRequest DeletedBy инициатор удаления, записывается в корзину и событие deleted
+type BulkDeleteRequest struct {
+	Category  string
+	Filenames []string
+	Prefix    string
+	DeletedBy string
+}
+
+type BulkDeleteFileResult struct {
+	Filename string
+	Status   string
+	Error    string
+}
+
+type BulkDeleteResult struct {
+	Files []BulkDeleteFileResult
+	Job   *BulkDeleteJob
+}
+
+type BulkDeleteJob struct {
+	Id        string
+	Category  string
+	Prefix    string
+	Owner     string
+	DeletedBy string `db:"deleted_by"`
+	Status    string
+	LastKey   string `db:"last_key"`
+	Deleted   int64
+	Failed    int64
+	LastError string    `db:"last_error"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// Accessor права, с которыми задача удаляет файлы: Owner - субъект, создавший задачу,
+// пустой, если задача удаляет файлы любых владельцев
+func (j BulkDeleteJob) Accessor() Accessor {
+	return Accessor{
+		Unrestricted: j.Owner == "",
+		Subject:      j.Owner,
+	}
+}
+
+type FileVersion struct {
+	VersionId   string `db:"version_id"`
+	Filename    string
+	Category    string
+	Size        int64
+	ContentType string     `db:"content_type"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ArchivedAt  *time.Time `db:"archived_at"`
+	Current     bool       `db:"-"`
+}
+
+type FileReference struct {
+	Filename  string
+	Category  string
+	OwnerType string    `db:"owner_type"`
+	OwnerId   string    `db:"owner_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// FileOrphan файл, у которого не осталось ссылок, удаляется по истечении периода ожидания
+type FileOrphan struct {
+	Filename   string
+	Category   string
+	OrphanedAt time.Time `db:"orphaned_at"`
+	// ClaimedAt момент захвата отметки воркером, nil - отметка не захвачена
+	ClaimedAt *time.Time `db:"claimed_at"`
+}
+
+const (
+	EventUploaded    = "uploaded"
+	EventOverwritten = "overwritten"
+	EventCommitted   = "committed"
+	EventRolledBack  = "rolled_back"
+	EventExpired     = "expired"
+	EventDeleted     = "deleted"
+	// EventScanned файл проверен антивирусом и снят с карантина
+	EventScanned = "scanned"
+	// EventInfected в файле найдена сигнатура, файл удалён или изолирован
+	EventInfected = "infected"
+)
+
+// StorageEvent событие изменения файла, записывается в outbox в одной транзакции с изменением
+type StorageEvent struct {
+	Id        int64
+	Type      string `db:"event_type"`
+	Category  string
+	Filename  string
+	Actor     string
+	CreatedAt time.Time `db:"created_at"`
+	// TxId транзакция, записавшая событие, заполняется только при чтении потока событий
+	TxId int64 `db:"tx_id"`
+}
+
+// EventCursor позиция в потоке событий: события упорядочены по транзакции, записавшей событие, и идентификатору,
+// поэтому событие, зафиксированное позже события с большим идентификатором, не пропускается при возобновлении
+type EventCursor struct {
+	TxId int64 `db:"tx_id"`
+	Id   int64
+}
+
+func NewEventCursor(event StorageEvent) EventCursor {
+	return EventCursor{TxId: event.TxId, Id: event.Id}
+}
+
+func NewStorageEvent(eventType string, filename string, category string, actor string) StorageEvent {
+	return StorageEvent{
+		Type:      eventType,
+		Category:  category,
+		Filename:  filename,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+// EventFilter пустые Categories и EventTypes не ограничивают выборку
+type EventFilter struct {
+	Categories []string
+	EventTypes []string
+}
+
+func (f EventFilter) Match(event StorageEvent) bool {
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, event.Category) {
+		return false
+	}
+	return len(f.EventTypes) == 0 || slices.Contains(f.EventTypes, event.Type)
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookSubscription пустые Categories и EventTypes не ограничивают подписку
+type WebhookSubscription struct {
+	Name       string
+	Url        string
+	Secret     string
+	Categories []string
+	EventTypes []string `db:"event_types"`
+}
+
+// WebhookDelivery доставка события подписке, вместе с данными события
+type WebhookDelivery struct {
+	Id             int64
+	Subscription   string
+	Status         string
+	Attempts       int
+	LastError      string    `db:"last_error"`
+	NextAttemptAt  time.Time `db:"next_attempt_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+	EventId        int64     `db:"event_id"`
+	EventType      string    `db:"event_type"`
+	Category       string
+	Filename       string
+	Actor          string
+	EventCreatedAt time.Time `db:"event_created_at"`
+}
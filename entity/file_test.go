@@ -0,0 +1,65 @@
+package entity_test
+
+import (
+	"testing"
+
+	"storage-service/entity"
+)
+
+func TestMetadataAccess(t *testing.T) {
+	t.Parallel()
+	owner := entity.Accessor{Subject: "owner"}
+	other := entity.Accessor{Subject: "other"}
+	anonymous := entity.Accessor{}
+	admin := entity.Accessor{Unrestricted: true}
+
+	cases := []struct {
+		name      string
+		metadata  entity.Metadata
+		accessor  entity.Accessor
+		canRead   bool
+		canModify bool
+	}{
+		{"private owner", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityPrivate}, owner, true, true},
+		{"private other", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityPrivate}, other, false, false},
+		{"private anonymous", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityPrivate}, anonymous, false, false},
+		{"private admin", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityPrivate}, admin, true, true},
+		{"internal other", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityInternal}, other, true, false},
+		{"internal anonymous", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityInternal}, anonymous, false, false},
+		{"public anonymous", entity.Metadata{Owner: "owner", Visibility: entity.VisibilityPublic}, anonymous, true, false},
+		{"legacy other", entity.Metadata{}, other, true, true},
+		{"legacy anonymous", entity.Metadata{}, anonymous, false, false},
+	}
+	for _, c := range cases {
+		if c.metadata.CanRead(c.accessor) != c.canRead {
+			t.Errorf("%s: expected canRead %v", c.name, c.canRead)
+		}
+		if c.metadata.CanModify(c.accessor) != c.canModify {
+			t.Errorf("%s: expected canModify %v", c.name, c.canModify)
+		}
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	t.Parallel()
+	event := entity.NewStorageEvent(entity.EventUploaded, "a.txt", "docs", "")
+
+	cases := []struct {
+		name   string
+		filter entity.EventFilter
+		match  bool
+	}{
+		{"empty", entity.EventFilter{}, true},
+		{"category", entity.EventFilter{Categories: []string{"images", "docs"}}, true},
+		{"other category", entity.EventFilter{Categories: []string{"images"}}, false},
+		{"event type", entity.EventFilter{EventTypes: []string{entity.EventUploaded}}, true},
+		{"other event type", entity.EventFilter{EventTypes: []string{entity.EventDeleted}}, false},
+		{"both", entity.EventFilter{Categories: []string{"docs"}, EventTypes: []string{entity.EventUploaded}}, true},
+		{"category of other type", entity.EventFilter{Categories: []string{"docs"}, EventTypes: []string{entity.EventDeleted}}, false},
+	}
+	for _, c := range cases {
+		if c.filter.Match(event) != c.match {
+			t.Errorf("%s: expected match %v", c.name, c.match)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	QuotaScopeCategory = "category"
+	QuotaScopeClient   = "client"
+)
+
+// QuotaLimit нулевое значение поля не ограничивает соответствующий ресурс
+type QuotaLimit struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// QuotaUsage занятое место и количество объектов, учитываются все объекты хранилища,
+// включая корзину, предыдущие версии и незавершённые загрузки.
+// ReservedBytes и ReservedObjects зарезервированы выполняющимися загрузками
+type QuotaUsage struct {
+	Scope           string
+	Name            string
+	Bytes           int64
+	Objects         int64
+	ReservedBytes   int64 `db:"reserved_bytes"`
+	ReservedObjects int64 `db:"reserved_objects"`
+}
+
+// QuotaReservation место и объект, занятые загрузкой до записи в хранилище,
+// после записи объект учитывается в QuotaUsage, а резерв удаляется
+type QuotaReservation struct {
+	Id        string
+	Category  string
+	Owner     string
+	Bytes     int64
+	Objects   int64
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+type QuotaStatus struct {
+	Usage QuotaUsage
+	Limit QuotaLimit
+}
+
+// Exceeded проверяет, что добавление bytes байт и objects объектов к занятым и зарезервированным превысит лимит
+func (s QuotaStatus) Exceeded(bytes int64, objects int64) bool {
+	if s.Limit.MaxBytes > 0 && s.Usage.Bytes+s.Usage.ReservedBytes+bytes > s.Limit.MaxBytes {
+		return true
+	}
+	return s.Limit.MaxObjects > 0 && s.Usage.Objects+s.Usage.ReservedObjects+objects > s.Limit.MaxObjects
+}
+
+// RemainingBytes сколько байт ещё можно записать с учётом резервов, -1 если место не ограничено
+func (s QuotaStatus) RemainingBytes() int64 {
+	if s.Limit.MaxBytes <= 0 {
+		return -1
+	}
+	return max(s.Limit.MaxBytes-s.Usage.Bytes-s.Usage.ReservedBytes, 0)
+}
@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// ScanModeSync файл проверяется во время загрузки, заражённый файл отклоняется
+	ScanModeSync = "sync"
+	// ScanModeAsync файл проверяется воркером после загрузки
+	ScanModeAsync = "async"
+
+	InfectedActionDelete  = "delete"
+	InfectedActionIsolate = "isolate"
+
+	// ScanStatusPending файл ожидает проверки и находится на карантине
+	ScanStatusPending = "pending"
+	// ScanStatusInfected заражённый файл изолирован
+	ScanStatusInfected = "infected"
+)
+
+type ScanResult struct {
+	Infected bool
+	// Signature название найденной сигнатуры
+	Signature string
+}
+
+// FileScan проверка объекта антивирусом, объект без проверки в статусе pending
+// не отдаётся до её завершения, проверенный чистый объект записи не имеет
+type FileScan struct {
+	ScanId     string `db:"scan_id"`
+	Category   string
+	ObjectKey  string `db:"object_key"`
+	Filename   string
+	Status     string
+	Signature  string
+	Attempts   int
+	LastError  string    `db:"last_error"`
+	NextScanAt time.Time `db:"next_scan_at"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
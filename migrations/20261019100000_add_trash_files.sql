@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE trash_files (
+    id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    deleted_at TIMESTAMP NOT NULL DEFAULT now(),
+    deleted_by TEXT NOT NULL DEFAULT '',
+    purge_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_trash_files__category_deleted_at ON trash_files (category, deleted_at);
+CREATE INDEX ix_trash_files__purge_at ON trash_files (purge_at);
+
+-- +goose Down
+DROP TABLE trash_files;
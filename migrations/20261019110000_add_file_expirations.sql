@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE file_expirations (
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(filename, category)
+);
+
+CREATE INDEX ix_file_expirations__expires_at ON file_expirations (expires_at);
+
+-- +goose Down
+DROP TABLE file_expirations;
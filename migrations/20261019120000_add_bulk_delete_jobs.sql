@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE bulk_delete_jobs (
+    id TEXT PRIMARY KEY,
+    category TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    status TEXT NOT NULL,
+    last_key TEXT NOT NULL DEFAULT '',
+    deleted INT8 NOT NULL DEFAULT 0,
+    failed INT8 NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE bulk_delete_jobs;
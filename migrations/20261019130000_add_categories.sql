@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE categories (
+    name TEXT PRIMARY KEY,
+    settings JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE category_delete_tokens (
+    token TEXT PRIMARY KEY,
+    category TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE category_delete_jobs (
+    id TEXT PRIMARY KEY,
+    category TEXT NOT NULL,
+    status TEXT NOT NULL,
+    deleted INT8 NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE category_delete_jobs;
+DROP TABLE category_delete_tokens;
+DROP TABLE categories;
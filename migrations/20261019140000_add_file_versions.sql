@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE file_versions (
+    version_id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    size INT8 NOT NULL,
+    content_type TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ix_file_versions__category_filename_archived_at ON file_versions (category, filename, archived_at);
+
+-- +goose Down
+DROP TABLE file_versions;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE file_locks (
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    retention_mode TEXT NOT NULL DEFAULT '',
+    retain_until TIMESTAMP,
+    legal_hold BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY(filename, category)
+);
+
+-- +goose Down
+DROP TABLE file_locks;
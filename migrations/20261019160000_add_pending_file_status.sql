@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE pending_files
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'pending',
+    ADD COLUMN error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX ix_pending_files__status_created_at ON pending_files (status, created_at);
+CREATE INDEX ix_pending_files__updated_at ON pending_files (updated_at);
+
+-- +goose Down
+DROP INDEX ix_pending_files__updated_at;
+DROP INDEX ix_pending_files__status_created_at;
+
+ALTER TABLE pending_files
+    DROP COLUMN updated_at,
+    DROP COLUMN error,
+    DROP COLUMN status;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE pending_files ADD COLUMN expires_at TIMESTAMP;
+
+-- срок начатых ранее загрузок заполняется при получении конфигурации из pending.fileLifetimeInMin
+
+DROP INDEX ix_pending_files__status_created_at;
+CREATE INDEX ix_pending_files__status_expires_at ON pending_files (status, expires_at);
+
+-- +goose Down
+DROP INDEX ix_pending_files__status_expires_at;
+CREATE INDEX ix_pending_files__status_created_at ON pending_files (status, created_at);
+
+ALTER TABLE pending_files DROP COLUMN expires_at;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE pending_groups (
+    id TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_pending_groups__status_expires_at ON pending_groups (status, expires_at);
+CREATE INDEX ix_pending_groups__updated_at ON pending_groups (updated_at);
+
+ALTER TABLE pending_files ADD COLUMN group_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX ix_pending_files__group_id ON pending_files (group_id) WHERE group_id <> '';
+
+-- +goose Down
+DROP INDEX ix_pending_files__group_id;
+
+ALTER TABLE pending_files DROP COLUMN group_id;
+
+DROP TABLE pending_groups;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE pending_files ADD COLUMN uploaded_by TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX ix_pending_files__created_at ON pending_files (created_at);
+
+-- +goose Down
+DROP INDEX ix_pending_files__created_at;
+
+ALTER TABLE pending_files DROP COLUMN uploaded_by;
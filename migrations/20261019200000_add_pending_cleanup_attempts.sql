@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE pending_files
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN last_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN cleaned_at TIMESTAMP NULL;
+
+-- до этой миграции файлы удалялись вместе с переводом в конечный статус
+UPDATE pending_files SET cleaned_at = updated_at WHERE status NOT IN ('uploading', 'pending');
+
+CREATE INDEX ix_pending_files__cleanup ON pending_files (updated_at) WHERE status = 'expired' AND cleaned_at IS NULL;
+
+CREATE TABLE pending_dead_letters (
+    id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    group_id TEXT NOT NULL,
+    uploaded_by TEXT NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    dead_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_pending_dead_letters__category_dead_at ON pending_dead_letters (category, dead_at);
+
+-- +goose Down
+DROP TABLE pending_dead_letters;
+
+DROP INDEX ix_pending_files__cleanup;
+
+ALTER TABLE pending_files
+    DROP COLUMN attempts,
+    DROP COLUMN last_error,
+    DROP COLUMN cleaned_at;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE file_references (
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    owner_type TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (category, filename, owner_type, owner_id)
+);
+
+CREATE INDEX ix_file_references__owner ON file_references (owner_type, owner_id);
+
+CREATE TABLE file_orphans (
+    filename TEXT NOT NULL,
+    category TEXT NOT NULL,
+    orphaned_at TIMESTAMP NOT NULL,
+    claimed_at TIMESTAMP,
+    PRIMARY KEY (category, filename)
+);
+
+CREATE INDEX ix_file_orphans__orphaned_at ON file_orphans (orphaned_at);
+
+-- +goose Down
+DROP TABLE file_orphans;
+
+DROP TABLE file_references;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE storage_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    category TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_storage_events__created_at ON storage_events (created_at);
+
+CREATE TABLE webhook_subscriptions (
+    name TEXT PRIMARY KEY,
+    categories TEXT[] NOT NULL,
+    event_types TEXT[] NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES storage_events (id) ON DELETE CASCADE,
+    -- доставки удалённой подписки сохраняются и переносятся в dead letter
+    subscription TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_webhook_deliveries__status_next_attempt_at ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX ix_webhook_deliveries__event_id ON webhook_deliveries (event_id);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+
+DROP TABLE webhook_subscriptions;
+
+DROP TABLE storage_events;
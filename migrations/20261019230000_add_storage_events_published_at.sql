@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE storage_events ADD COLUMN published_at TIMESTAMP;
+ALTER TABLE storage_events ADD COLUMN claimed_at TIMESTAMP;
+
+UPDATE storage_events SET published_at = created_at;
+
+CREATE INDEX ix_storage_events__unpublished ON storage_events (id) WHERE published_at IS NULL;
+
+-- +goose Down
+DROP INDEX ix_storage_events__unpublished;
+
+ALTER TABLE storage_events DROP COLUMN claimed_at;
+ALTER TABLE storage_events DROP COLUMN published_at;
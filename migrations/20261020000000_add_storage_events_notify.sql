@@ -0,0 +1,29 @@
+-- +goose Up
+-- транзакция, записавшая событие: поток событий читает события только завершённых транзакций
+-- в порядке транзакций, поэтому событие, зафиксированное позже, не оказывается перед позицией клиента
+ALTER TABLE storage_events ADD COLUMN tx_id BIGINT NOT NULL DEFAULT pg_current_xact_id()::TEXT::BIGINT;
+
+CREATE INDEX ix_storage_events__tx_id_id ON storage_events (tx_id, id);
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_storage_event() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('storage_events', NEW.id::TEXT);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER tr_storage_events__notify
+    AFTER INSERT ON storage_events
+    FOR EACH ROW EXECUTE FUNCTION notify_storage_event();
+
+-- +goose Down
+DROP TRIGGER tr_storage_events__notify ON storage_events;
+
+DROP FUNCTION notify_storage_event();
+
+DROP INDEX ix_storage_events__tx_id_id;
+
+ALTER TABLE storage_events DROP COLUMN tx_id;
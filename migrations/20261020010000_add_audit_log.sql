@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    action TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    category TEXT NOT NULL,
+    filename TEXT NOT NULL,
+    bytes_received BIGINT NOT NULL,
+    bytes_sent BIGINT NOT NULL,
+    status_code INT NOT NULL,
+    outcome TEXT NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_audit_log__created_at ON audit_log (created_at);
+CREATE INDEX ix_audit_log__category_filename ON audit_log (category, filename);
+CREATE INDEX ix_audit_log__actor ON audit_log (actor);
+
+-- +goose Down
+DROP TABLE audit_log;
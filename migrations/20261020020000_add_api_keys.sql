@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    previous_secret_hash TEXT,
+    previous_expires_at TIMESTAMP,
+    acl JSONB NOT NULL,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX ux_api_keys__name ON api_keys (name) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,67 @@
+-- +goose Up
+CREATE TABLE file_usage
+(
+    category   TEXT   NOT NULL,
+    object_key TEXT   NOT NULL,
+    owner      TEXT   NOT NULL DEFAULT '',
+    size       BIGINT NOT NULL,
+    PRIMARY KEY (category, object_key)
+);
+
+CREATE TABLE quota_usage
+(
+    scope   TEXT   NOT NULL,
+    name    TEXT   NOT NULL,
+    bytes   BIGINT NOT NULL DEFAULT 0,
+    objects BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, name)
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION apply_quota_usage(p_scope TEXT, p_name TEXT, p_bytes BIGINT, p_objects BIGINT) RETURNS VOID AS
+$$
+BEGIN
+    INSERT INTO quota_usage (scope, name, bytes, objects)
+    VALUES (p_scope, p_name, p_bytes, p_objects)
+    ON CONFLICT (scope, name) DO UPDATE
+        SET bytes   = quota_usage.bytes + EXCLUDED.bytes,
+            objects = quota_usage.objects + EXCLUDED.objects;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION track_file_usage() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM apply_quota_usage('category', OLD.category, -OLD.size, -1);
+        IF OLD.owner <> '' THEN
+            PERFORM apply_quota_usage('client', OLD.owner, -OLD.size, -1);
+        END IF;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM apply_quota_usage('category', NEW.category, NEW.size, 1);
+        IF NEW.owner <> '' THEN
+            PERFORM apply_quota_usage('client', NEW.owner, NEW.size, 1);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER tr_file_usage__track
+    AFTER INSERT OR UPDATE OR DELETE ON file_usage
+    FOR EACH ROW EXECUTE FUNCTION track_file_usage();
+
+-- +goose Down
+DROP TRIGGER tr_file_usage__track ON file_usage;
+
+DROP FUNCTION track_file_usage();
+
+DROP FUNCTION apply_quota_usage(TEXT, TEXT, BIGINT, BIGINT);
+
+DROP TABLE quota_usage;
+
+DROP TABLE file_usage;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE file_scans
+(
+    scan_id      TEXT PRIMARY KEY,
+    category     TEXT      NOT NULL,
+    object_key   TEXT      NOT NULL,
+    filename     TEXT      NOT NULL,
+    status       TEXT      NOT NULL,
+    signature    TEXT      NOT NULL DEFAULT '',
+    attempts     INT       NOT NULL DEFAULT 0,
+    last_error   TEXT      NOT NULL DEFAULT '',
+    next_scan_at TIMESTAMP NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX ux_file_scans__category_object_key ON file_scans (category, object_key);
+
+CREATE INDEX ix_file_scans__status_next_scan_at ON file_scans (status, next_scan_at);
+
+-- +goose Down
+DROP TABLE file_scans;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE pending_files ADD COLUMN file_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE pending_files DROP COLUMN file_expires_at;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE bulk_delete_jobs ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE bulk_delete_jobs DROP COLUMN owner;
@@ -0,0 +1,67 @@
+-- +goose Up
+ALTER TABLE quota_usage
+    ADD COLUMN reserved_bytes   BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN reserved_objects BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE quota_reservations
+(
+    id         TEXT      PRIMARY KEY,
+    category   TEXT      NOT NULL,
+    owner      TEXT      NOT NULL DEFAULT '',
+    bytes      BIGINT    NOT NULL,
+    objects    BIGINT    NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ix_quota_reservations__category_expires_at ON quota_reservations (category, expires_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION apply_quota_reservation(p_scope TEXT, p_name TEXT, p_bytes BIGINT, p_objects BIGINT) RETURNS VOID AS
+$$
+BEGIN
+    INSERT INTO quota_usage (scope, name, reserved_bytes, reserved_objects)
+    VALUES (p_scope, p_name, p_bytes, p_objects)
+    ON CONFLICT (scope, name) DO UPDATE
+        SET reserved_bytes   = quota_usage.reserved_bytes + EXCLUDED.reserved_bytes,
+            reserved_objects = quota_usage.reserved_objects + EXCLUDED.reserved_objects;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION track_quota_reservation() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM apply_quota_reservation('category', OLD.category, -OLD.bytes, -OLD.objects);
+        IF OLD.owner <> '' THEN
+            PERFORM apply_quota_reservation('client', OLD.owner, -OLD.bytes, -OLD.objects);
+        END IF;
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        PERFORM apply_quota_reservation('category', NEW.category, NEW.bytes, NEW.objects);
+        IF NEW.owner <> '' THEN
+            PERFORM apply_quota_reservation('client', NEW.owner, NEW.bytes, NEW.objects);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER tr_quota_reservations__track
+    AFTER INSERT OR DELETE ON quota_reservations
+    FOR EACH ROW EXECUTE FUNCTION track_quota_reservation();
+
+-- +goose Down
+DROP TRIGGER tr_quota_reservations__track ON quota_reservations;
+
+DROP FUNCTION track_quota_reservation();
+
+DROP FUNCTION apply_quota_reservation(TEXT, TEXT, BIGINT, BIGINT);
+
+DROP TABLE quota_reservations;
+
+ALTER TABLE quota_usage
+    DROP COLUMN reserved_bytes,
+    DROP COLUMN reserved_objects;
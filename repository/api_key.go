@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+const apiKeyColumns = `id, name, secret_hash, COALESCE(previous_secret_hash, '') AS previous_secret_hash,
+	previous_expires_at, acl, expires_at, created_at, rotated_at, revoked_at`
+
+type apiKeyRow struct {
+	Id                 string
+	Name               string
+	SecretHash         string     `db:"secret_hash"`
+	PreviousSecretHash string     `db:"previous_secret_hash"`
+	PreviousExpiresAt  *time.Time `db:"previous_expires_at"`
+	Acl                []byte
+	ExpiresAt          *time.Time `db:"expires_at"`
+	CreatedAt          time.Time  `db:"created_at"`
+	RotatedAt          *time.Time `db:"rotated_at"`
+	RevokedAt          *time.Time `db:"revoked_at"`
+}
+
+// apiKeyAcl формат хранения ограничений ключа в jsonb
+type apiKeyAcl struct {
+	Categories []string `json:"categories"`
+	Operations []string `json:"operations"`
+	AllowedIps []string `json:"allowedIps"`
+}
+
+type ApiKey struct {
+	db db.DB
+}
+
+func NewApiKey(db db.DB) ApiKey {
+	return ApiKey{
+		db: db,
+	}
+}
+
+// InsertApiKey возвращает domain.ErrApiKeyAlreadyExist, если есть действующий ключ с тем же именем
+func (r ApiKey) InsertApiKey(ctx context.Context, key entity.ApiKey) error {
+	acl, err := json.Marshal(apiKeyAcl{
+		Categories: key.Categories,
+		Operations: key.Operations,
+		AllowedIps: key.AllowedIps,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "marshal acl")
+	}
+
+	query := `
+		INSERT INTO api_keys (id, name, secret_hash, acl, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) WHERE revoked_at IS NULL DO NOTHING
+	`
+	result, err := r.db.Exec(ctx, query, key.Id, key.Name, key.SecretHash, acl, key.ExpiresAt, key.CreatedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrApiKeyAlreadyExist
+	}
+	return nil
+}
+
+func (r ApiKey) GetApiKey(ctx context.Context, id string) (*entity.ApiKey, error) {
+	row := apiKeyRow{}
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE id = $1
+	`
+	err := r.db.SelectRow(ctx, &row, query, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrApiKeyNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	key, err := fromApiKeyRow(row)
+	if err != nil {
+		return nil, errors.WithMessage(err, "from api key row")
+	}
+	return key, nil
+}
+
+// ListApiKeys возвращает ключи от новых к старым, отозванные только при includeRevoked
+func (r ApiKey) ListApiKeys(ctx context.Context, includeRevoked bool) ([]entity.ApiKey, error) {
+	rows := []apiKeyRow{}
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE $1 OR revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	err := r.db.Select(ctx, &rows, query, includeRevoked)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	keys := make([]entity.ApiKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := fromApiKeyRow(row)
+		if err != nil {
+			return nil, errors.WithMessage(err, "from api key row")
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+// RotateApiKey заменяет секрет действующего ключа, предыдущий секрет действует до previousExpiresAt
+func (r ApiKey) RotateApiKey(
+	ctx context.Context,
+	id string,
+	secretHash string,
+	previousExpiresAt time.Time,
+	now time.Time,
+) error {
+	query := `
+		UPDATE api_keys
+		SET previous_secret_hash = secret_hash,
+			previous_expires_at = $3,
+			secret_hash = $2,
+			rotated_at = $4
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	result, err := r.db.Exec(ctx, query, id, secretHash, previousExpiresAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func (r ApiKey) RevokeApiKey(ctx context.Context, id string, now time.Time) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	result, err := r.db.Exec(ctx, query, id, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrApiKeyNotFound
+	}
+	return nil
+}
+
+func fromApiKeyRow(row apiKeyRow) (*entity.ApiKey, error) {
+	acl := apiKeyAcl{}
+	err := json.Unmarshal(row.Acl, &acl)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unmarshal acl")
+	}
+	return &entity.ApiKey{
+		Id:                 row.Id,
+		Name:               row.Name,
+		SecretHash:         row.SecretHash,
+		PreviousSecretHash: row.PreviousSecretHash,
+		PreviousExpiresAt:  row.PreviousExpiresAt,
+		Categories:         acl.Categories,
+		Operations:         acl.Operations,
+		AllowedIps:         acl.AllowedIps,
+		ExpiresAt:          row.ExpiresAt,
+		CreatedAt:          row.CreatedAt,
+		RotatedAt:          row.RotatedAt,
+		RevokedAt:          row.RevokedAt,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+const auditColumns = `id, action, actor, client_ip, request_id, category, filename,
+	bytes_received, bytes_sent, status_code, outcome, error, created_at`
+
+type Audit struct {
+	db db.DB
+}
+
+func NewAudit(db db.DB) Audit {
+	return Audit{
+		db: db,
+	}
+}
+
+func (r Audit) InsertRecord(ctx context.Context, record entity.AuditRecord) error {
+	query := `
+		INSERT INTO audit_log (action, actor, client_ip, request_id, category, filename,
+			bytes_received, bytes_sent, status_code, outcome, error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := r.db.Exec(ctx, query,
+		record.Action,
+		record.Actor,
+		record.ClientIp,
+		record.RequestId,
+		record.Category,
+		record.Filename,
+		record.BytesReceived,
+		record.BytesSent,
+		record.StatusCode,
+		record.Outcome,
+		record.Error,
+		record.CreatedAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ListRecords возвращает записи от новых к старым
+func (r Audit) ListRecords(ctx context.Context, filter entity.AuditFilter) ([]entity.AuditRecord, error) {
+	conditions, args := auditConditions(filter)
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_log
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	records := []entity.AuditRecord{}
+	err := r.db.Select(ctx, &records, query, args...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return records, nil
+}
+
+// ListRecordsAfter возвращает не более limit записей с идентификатором больше afterId от старых к новым,
+// filter.Limit и filter.Offset не используются
+func (r Audit) ListRecordsAfter(
+	ctx context.Context,
+	afterId int64,
+	filter entity.AuditFilter,
+	limit int,
+) ([]entity.AuditRecord, error) {
+	conditions, args := auditConditions(filter)
+	args = append(args, afterId)
+	conditions = append(conditions, fmt.Sprintf("id > $%d", len(args)))
+	args = append(args, limit)
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_log
+		WHERE ` + strings.Join(conditions, " AND ") + fmt.Sprintf(`
+		ORDER BY id
+		LIMIT $%d
+	`, len(args))
+
+	records := []entity.AuditRecord{}
+	err := r.db.Select(ctx, &records, query, args...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return records, nil
+}
+
+func auditConditions(filter entity.AuditFilter) ([]string, []any) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.Actor != "" {
+		where("actor = $%d", filter.Actor)
+	}
+	if filter.Category != "" {
+		where("category = $%d", filter.Category)
+	}
+	if filter.Filename != "" {
+		where("filename = $%d", filter.Filename)
+	}
+	if filter.Outcome != "" {
+		where("outcome = $%d", filter.Outcome)
+	}
+	if filter.RequestId != "" {
+		where("request_id = $%d", filter.RequestId)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at <= $%d", *filter.CreatedBefore)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	return conditions, args
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type BulkDelete struct {
+	db db.DB
+}
+
+func NewBulkDelete(db db.DB) BulkDelete {
+	return BulkDelete{
+		db: db,
+	}
+}
+
+func (r BulkDelete) InsertJob(ctx context.Context, job entity.BulkDeleteJob) error {
+	query := `
+		INSERT INTO bulk_delete_jobs (id, category, prefix, owner, deleted_by, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+	`
+	_, err := r.db.Exec(ctx, query, job.Id, job.Category, job.Prefix, job.Owner, job.DeletedBy, job.Status, job.CreatedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r BulkDelete) GetJob(ctx context.Context, id string) (*entity.BulkDeleteJob, error) {
+	job := entity.BulkDeleteJob{}
+	query := `
+		SELECT id, category, prefix, owner, deleted_by, status, last_key, deleted, failed, last_error, created_at, updated_at
+		FROM bulk_delete_jobs
+		WHERE id = $1
+	`
+	err := r.db.SelectRow(ctx, &job, query, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrBulkDeleteJobNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &job, nil
+	}
+}
+
+func (r BulkDelete) UpdateJobProgress(
+	ctx context.Context,
+	id string,
+	lastKey string,
+	deleted int,
+	failed int,
+	lastError string,
+	now time.Time,
+) error {
+	query := `
+		UPDATE bulk_delete_jobs
+		SET last_key = $2,
+			deleted = deleted + $3,
+			failed = failed + $4,
+			last_error = CASE WHEN $5 = '' THEN last_error ELSE $5 END,
+			updated_at = $6
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, lastKey, deleted, failed, lastError, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r BulkDelete) UpdateJobStatus(ctx context.Context, id string, status string, lastError string, now time.Time) error {
+	query := `
+		UPDATE bulk_delete_jobs
+		SET status = $2,
+			last_error = CASE WHEN $3 = '' THEN last_error ELSE $3 END,
+			updated_at = $4
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, status, lastError, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type categoryRow struct {
+	Name      string
+	Settings  []byte
+	Status    string
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// categorySettings формат хранения настроек категории в jsonb
+type categorySettings struct {
+	StripImageMetadata    bool               `json:"stripImageMetadata"`
+	TrashRetentionInHours int                `json:"trashRetentionInHours"`
+	Versioning            bool               `json:"versioning"`
+	MaxVersions           int                `json:"maxVersions"`
+	RetentionMode         string             `json:"retentionMode"`
+	RetentionPeriodInDays int                `json:"retentionPeriodInDays"`
+	LegalHold             bool               `json:"legalHold"`
+	DefaultVisibility     string             `json:"defaultVisibility"`
+	ScanMode              string             `json:"scanMode"`
+	InfectedAction        string             `json:"infectedAction"`
+	Validation            categoryValidation `json:"validation"`
+}
+
+type categoryValidation struct {
+	Image imageValidation `json:"image"`
+	Zip   zipValidation   `json:"zip"`
+	Pdf   pdfValidation   `json:"pdf"`
+	Text  textValidation  `json:"text"`
+}
+
+type imageValidation struct {
+	Enabled   bool  `json:"enabled"`
+	MaxWidth  int   `json:"maxWidth"`
+	MaxHeight int   `json:"maxHeight"`
+	MaxPixels int64 `json:"maxPixels"`
+}
+
+type zipValidation struct {
+	Enabled             bool  `json:"enabled"`
+	MaxEntries          int   `json:"maxEntries"`
+	MaxCompressionRatio int64 `json:"maxCompressionRatio"`
+	MaxUncompressedMb   int64 `json:"maxUncompressedMb"`
+}
+
+type pdfValidation struct {
+	Enabled bool `json:"enabled"`
+}
+
+type textValidation struct {
+	Enabled bool `json:"enabled"`
+}
+
+type Category struct {
+	db db.DB
+}
+
+func NewCategory(db db.DB) Category {
+	return Category{
+		db: db,
+	}
+}
+
+func (r Category) InsertCategory(ctx context.Context, category entity.Category) error {
+	settings, err := json.Marshal(toCategorySettings(category.Settings))
+	if err != nil {
+		return errors.WithMessage(err, "marshal settings")
+	}
+
+	query := `
+		INSERT INTO categories (name, settings, status, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO NOTHING
+	`
+	result, err := r.db.Exec(ctx, query, category.Name, settings, category.Status, category.CreatedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrCategoryAlreadyExist
+	}
+	return nil
+}
+
+func (r Category) GetCategory(ctx context.Context, name string) (*entity.Category, error) {
+	row := categoryRow{}
+	query := `
+		SELECT name, settings, status, created_at
+		FROM categories
+		WHERE name = $1
+	`
+	err := r.db.SelectRow(ctx, &row, query, name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrCategoryNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	category, err := fromCategoryRow(row)
+	if err != nil {
+		return nil, errors.WithMessage(err, "from category row")
+	}
+	return category, nil
+}
+
+func (r Category) GetCategories(ctx context.Context) ([]entity.Category, error) {
+	rows := []categoryRow{}
+	query := `
+		SELECT name, settings, status, created_at
+		FROM categories
+		ORDER BY name
+	`
+	err := r.db.Select(ctx, &rows, query)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	categories := make([]entity.Category, 0, len(rows))
+	for _, row := range rows {
+		category, err := fromCategoryRow(row)
+		if err != nil {
+			return nil, errors.WithMessage(err, "from category row")
+		}
+		categories = append(categories, *category)
+	}
+	return categories, nil
+}
+
+// UpsertCategoryStatus меняет статус категории, неявно созданная категория при этом
+// сохраняется с настройками по умолчанию
+func (r Category) UpsertCategoryStatus(ctx context.Context, name string, status string, now time.Time) error {
+	query := `
+		INSERT INTO categories (name, settings, status, created_at)
+		VALUES ($1, '{}', $2, $3)
+		ON CONFLICT (name) DO UPDATE SET status = excluded.status
+	`
+	_, err := r.db.Exec(ctx, query, name, status, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// DeleteCategoryData удаляет все записи, относящиеся к категории
+func (r Category) DeleteCategoryData(ctx context.Context, name string) error {
+	queries := []string{
+		`DELETE FROM pending_files WHERE category = $1`,
+		`DELETE FROM pending_dead_letters WHERE category = $1`,
+		`DELETE FROM file_references WHERE category = $1`,
+		`DELETE FROM file_orphans WHERE category = $1`,
+		`DELETE FROM trash_files WHERE category = $1`,
+		`DELETE FROM file_expirations WHERE category = $1`,
+		`DELETE FROM file_versions WHERE category = $1`,
+		`DELETE FROM file_locks WHERE category = $1`,
+		`DELETE FROM category_delete_tokens WHERE category = $1`,
+		`DELETE FROM categories WHERE name = $1`,
+	}
+	for _, query := range queries {
+		_, err := r.db.Exec(ctx, query, name)
+		if err != nil {
+			return errors.WithMessagef(err, "exec query: %s", query)
+		}
+	}
+	return nil
+}
+
+func (r Category) InsertDeleteToken(ctx context.Context, token entity.CategoryDeleteToken) error {
+	query := `
+		INSERT INTO category_delete_tokens (token, category, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err := r.db.Exec(ctx, query, token.Token, token.Category, token.ExpiresAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ConsumeDeleteToken удаляет действующий токен подтверждения удаления категории
+func (r Category) ConsumeDeleteToken(ctx context.Context, token string, category string, now time.Time) error {
+	query := `
+		DELETE FROM category_delete_tokens
+		WHERE token = $1 AND category = $2 AND expires_at > $3
+	`
+	result, err := r.db.Exec(ctx, query, token, category, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrInvalidConfirmationToken
+	}
+	return nil
+}
+
+func (r Category) InsertDeleteJob(ctx context.Context, job entity.CategoryDeleteJob) error {
+	query := `
+		INSERT INTO category_delete_jobs (id, category, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+	`
+	_, err := r.db.Exec(ctx, query, job.Id, job.Category, job.Status, job.CreatedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Category) GetDeleteJob(ctx context.Context, id string) (*entity.CategoryDeleteJob, error) {
+	job := entity.CategoryDeleteJob{}
+	query := `
+		SELECT id, category, status, deleted, last_error, created_at, updated_at
+		FROM category_delete_jobs
+		WHERE id = $1
+	`
+	err := r.db.SelectRow(ctx, &job, query, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrCategoryDeleteJobNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &job, nil
+	}
+}
+
+func (r Category) UpdateDeleteJob(
+	ctx context.Context,
+	id string,
+	status string,
+	deleted int,
+	lastError string,
+	now time.Time,
+) error {
+	query := `
+		UPDATE category_delete_jobs
+		SET status = $2,
+			deleted = deleted + $3,
+			last_error = CASE WHEN $4 = '' THEN last_error ELSE $4 END,
+			updated_at = $5
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, status, deleted, lastError, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func toCategorySettings(settings entity.CategorySettings) categorySettings {
+	return categorySettings{
+		StripImageMetadata:    settings.StripImageMetadata,
+		TrashRetentionInHours: int(settings.TrashRetention / time.Hour),
+		Versioning:            settings.Versioning,
+		MaxVersions:           settings.MaxVersions,
+		RetentionMode:         settings.RetentionMode,
+		RetentionPeriodInDays: int(settings.RetentionPeriod / entity.Day),
+		LegalHold:             settings.LegalHold,
+		DefaultVisibility:     settings.DefaultVisibility,
+		ScanMode:              settings.ScanMode,
+		InfectedAction:        settings.InfectedAction,
+		Validation: categoryValidation{
+			Image: imageValidation(settings.Validation.Image),
+			Zip:   zipValidation(settings.Validation.Zip),
+			Pdf:   pdfValidation(settings.Validation.Pdf),
+			Text:  textValidation(settings.Validation.Text),
+		},
+	}
+}
+
+func fromCategoryRow(row categoryRow) (*entity.Category, error) {
+	settings := categorySettings{}
+	err := json.Unmarshal(row.Settings, &settings)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unmarshal settings")
+	}
+	return &entity.Category{
+		Name: row.Name,
+		Settings: entity.CategorySettings{
+			StripImageMetadata: settings.StripImageMetadata,
+			TrashRetention:     time.Duration(settings.TrashRetentionInHours) * time.Hour,
+			Versioning:         settings.Versioning,
+			MaxVersions:        settings.MaxVersions,
+			RetentionMode:      settings.RetentionMode,
+			RetentionPeriod:    time.Duration(settings.RetentionPeriodInDays) * entity.Day,
+			LegalHold:          settings.LegalHold,
+			DefaultVisibility:  settings.DefaultVisibility,
+			ScanMode:           settings.ScanMode,
+			InfectedAction:     settings.InfectedAction,
+			Validation: entity.CategoryValidation{
+				Image: entity.ImageValidation(settings.Validation.Image),
+				Zip:   entity.ZipValidation(settings.Validation.Zip),
+				Pdf:   entity.PdfValidation(settings.Validation.Pdf),
+				Text:  entity.TextValidation(settings.Validation.Text),
+			},
+		},
+		Status:    row.Status,
+		CreatedAt: row.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Event struct {
+	db db.DB
+}
+
+func NewEvent(db db.DB) Event {
+	return Event{
+		db: db,
+	}
+}
+
+// InsertEvent записывает событие в outbox и создаёт доставки для подписок, подходящих по категории и типу события,
+// возвращает идентификатор события
+func (r Event) InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error) {
+	query := `
+		WITH e AS (
+			INSERT INTO storage_events (event_type, category, filename, actor, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, event_type, category, created_at
+		), d AS (
+			INSERT INTO webhook_deliveries (event_id, subscription, status, attempts, last_error, next_attempt_at, updated_at)
+			SELECT e.id, s.name, $6, 0, '', e.created_at, e.created_at
+			FROM e
+			JOIN webhook_subscriptions s
+				ON (cardinality(s.categories) = 0 OR e.category = ANY(s.categories))
+				AND (cardinality(s.event_types) = 0 OR e.event_type = ANY(s.event_types))
+		)
+		SELECT id FROM e
+	`
+	var id int64
+	err := r.db.SelectRow(ctx, &id, query,
+		event.Type,
+		event.Category,
+		event.Filename,
+		event.Actor,
+		event.CreatedAt,
+		entity.WebhookDeliveryPending,
+	)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return id, nil
+}
+
+// ClaimUnpublishedEvents захватывает не более limit неопубликованных событий, не захваченных после claimedBefore,
+// запрос выполняется без транзакции, события, захваченные другим экземпляром, пропускаются
+func (r Event) ClaimUnpublishedEvents(
+	ctx context.Context,
+	now time.Time,
+	claimedBefore time.Time,
+	limit int,
+) ([]entity.StorageEvent, error) {
+	events := []entity.StorageEvent{}
+	query := `
+		WITH claimed AS (
+			UPDATE storage_events
+			SET claimed_at = $1
+			WHERE id IN (
+				SELECT id FROM storage_events
+				WHERE published_at IS NULL AND (claimed_at IS NULL OR claimed_at <= $2)
+				ORDER BY id
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, event_type, category, filename, actor, created_at
+		)
+		SELECT * FROM claimed
+		ORDER BY id
+	`
+	err := r.db.Select(ctx, &events, query, now, claimedBefore, limit)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return events, nil
+}
+
+// ReleaseEvents снимает захват с неопубликованных событий
+func (r Event) ReleaseEvents(ctx context.Context, ids []int64) error {
+	query := `
+		UPDATE storage_events
+		SET claimed_at = NULL
+		WHERE id = ANY($1) AND published_at IS NULL
+	`
+	_, err := r.db.Exec(ctx, query, ids)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Event) MarkEventsPublished(ctx context.Context, ids []int64, now time.Time) error {
+	query := `
+		UPDATE storage_events
+		SET published_at = $2
+		WHERE id = ANY($1) AND published_at IS NULL
+	`
+	_, err := r.db.Exec(ctx, query, ids, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// GetEventCursor позиция события afterId в потоке, если событие удалено по сроку хранения,
+// позиция перед самым ранним из оставшихся событий с большим идентификатором
+func (r Event) GetEventCursor(ctx context.Context, afterId int64) (*entity.EventCursor, error) {
+	cursor := entity.EventCursor{}
+	query := `
+		SELECT tx_id, id
+		FROM storage_events
+		WHERE id = $1
+	`
+	err := r.db.SelectRow(ctx, &cursor, query, afterId)
+	switch {
+	case err == nil:
+		return &cursor, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	var txId *int64
+	query = `
+		SELECT MIN(tx_id)
+		FROM storage_events
+		WHERE id > $1
+	`
+	err = r.db.SelectRow(ctx, &txId, query, afterId)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	if txId == nil {
+		return nil, domain.ErrStorageEventNotFound
+	}
+	return &entity.EventCursor{TxId: *txId - 1, Id: math.MaxInt64}, nil
+}
+
+// GetLastEventCursor позиция последнего события завершённых транзакций, нулевая, если событий нет
+func (r Event) GetLastEventCursor(ctx context.Context) (*entity.EventCursor, error) {
+	cursor := entity.EventCursor{}
+	query := `
+		SELECT tx_id, id
+		FROM storage_events
+		WHERE tx_id < pg_snapshot_xmin(pg_current_snapshot())::TEXT::BIGINT
+		ORDER BY tx_id DESC, id DESC
+		LIMIT 1
+	`
+	err := r.db.SelectRow(ctx, &cursor, query)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &cursor, nil
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &cursor, nil
+	}
+}
+
+// GetEventsAfter возвращает не более limit событий после cursor в порядке транзакций.
+// Возвращаются только события транзакций, старше которых нет незавершённых,
+// поэтому после прочитанных событий не появятся события с меньшей позицией
+func (r Event) GetEventsAfter(ctx context.Context, cursor entity.EventCursor, limit int) ([]entity.StorageEvent, error) {
+	events := []entity.StorageEvent{}
+	query := `
+		SELECT id, event_type, category, filename, actor, created_at, tx_id
+		FROM storage_events
+		WHERE (tx_id, id) > ($1, $2)
+			AND tx_id < pg_snapshot_xmin(pg_current_snapshot())::TEXT::BIGINT
+		ORDER BY tx_id, id
+		LIMIT $3
+	`
+	err := r.db.Select(ctx, &events, query, cursor.TxId, cursor.Id, limit)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return events, nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Expiration struct {
+	db db.DB
+}
+
+func NewExpiration(db db.DB) Expiration {
+	return Expiration{
+		db: db,
+	}
+}
+
+func (r Expiration) UpsertExpiration(ctx context.Context, filename string, category string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO file_expirations (filename, category, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (filename, category) DO UPDATE SET expires_at = excluded.expires_at
+	`
+	_, err := r.db.Exec(ctx, query, filename, category, expiresAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Expiration) DeleteExpiration(ctx context.Context, filename string, category string) error {
+	query := `
+		DELETE FROM file_expirations
+		WHERE filename = $1 AND category = $2
+	`
+	_, err := r.db.Exec(ctx, query, filename, category)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// DeleteExpirationsByNames удаляет сроки жизни удалённых файлов
+func (r Expiration) DeleteExpirationsByNames(ctx context.Context, category string, filenames []string) error {
+	query := `
+		DELETE FROM file_expirations
+		WHERE category = $1 AND filename = ANY($2)
+	`
+	_, err := r.db.Exec(ctx, query, category, filenames)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Expiration) GetExpiration(ctx context.Context, filename string, category string) (*time.Time, error) {
+	var expiresAt time.Time
+	query := `
+		SELECT expires_at
+		FROM file_expirations
+		WHERE filename = $1 AND category = $2
+	`
+	err := r.db.SelectRow(ctx, &expiresAt, query, filename, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil // nolint:nilnil
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &expiresAt, nil
+	}
+}
+
+// GetExpiredFiles блокирует до maxFiles файлов с истёкшим сроком жизни до конца транзакции,
+// заблокированные от удаления файлы и файлы, обрабатываемые другой транзакцией, пропускаются
+func (r Expiration) GetExpiredFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.FileToDelete, error) {
+	files := []entity.FileToDelete{}
+	query := `
+		SELECT f.filename, f.category
+		FROM file_expirations f
+		WHERE f.expires_at <= $1
+			AND NOT EXISTS (
+				SELECT 1
+				FROM file_locks l
+				WHERE l.filename = f.filename AND l.category = f.category AND (l.legal_hold OR l.retain_until > $1)
+			)
+		ORDER BY f.expires_at
+		LIMIT $2
+		FOR UPDATE OF f SKIP LOCKED
+	`
+	err := r.db.Select(ctx, &files, query, now, maxFiles)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Lock struct {
+	db db.DB
+}
+
+func NewLock(db db.DB) Lock {
+	return Lock{
+		db: db,
+	}
+}
+
+func (r Lock) GetLock(ctx context.Context, filename string, category string) (*entity.FileLock, error) {
+	lock := entity.FileLock{}
+	query := `
+		SELECT filename, category, retention_mode, retain_until, legal_hold
+		FROM file_locks
+		WHERE filename = $1 AND category = $2
+	`
+	err := r.db.SelectRow(ctx, &lock, query, filename, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil // nolint:nilnil
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &lock, nil
+	}
+}
+
+func (r Lock) UpsertLock(ctx context.Context, lock entity.FileLock, now time.Time) error {
+	query := `
+		INSERT INTO file_locks (filename, category, retention_mode, retain_until, legal_hold, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (filename, category) DO UPDATE SET
+			retention_mode = excluded.retention_mode,
+			retain_until = excluded.retain_until,
+			legal_hold = excluded.legal_hold,
+			updated_at = excluded.updated_at
+	`
+	_, err := r.db.Exec(ctx, query,
+		lock.Filename,
+		lock.Category,
+		lock.RetentionMode,
+		lock.RetainUntil,
+		lock.LegalHold,
+		now,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Lock) DeleteLock(ctx context.Context, filename string, category string) error {
+	query := `
+		DELETE FROM file_locks
+		WHERE filename = $1 AND category = $2
+	`
+	_, err := r.db.Exec(ctx, query, filename, category)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// LockedFiles возвращает заблокированные на момент now файлы из списка
+func (r Lock) LockedFiles(ctx context.Context, category string, filenames []string, now time.Time) ([]string, error) {
+	if len(filenames) == 0 {
+		return []string{}, nil
+	}
+
+	locked := []string{}
+	query := `
+		SELECT filename
+		FROM file_locks
+		WHERE category = $1 AND filename = ANY($2) AND (legal_hold OR retain_until > $3)
+	`
+	err := r.db.Select(ctx, &locked, query, category, filenames, now)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return locked, nil
+}
+
+func (r Lock) HasLockedFiles(ctx context.Context, category string, now time.Time) (bool, error) {
+	var exist bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM file_locks
+			WHERE category = $1 AND (legal_hold OR retain_until > $2)
+		)
+	`
+	err := r.db.SelectRow(ctx, &exist, query, category, now)
+	if err != nil {
+		return false, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return exist, nil
+}
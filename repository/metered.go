@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"io"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// MeteredStorage хранилище, ведущее учёт объектов для квот,
+// все операции записи, переноса и удаления объектов проходят через него.
+// Место под загрузку резервируется до записи сервисом квот, здесь учитывается записанный объект.
+// Если учесть запись или копию не удалось, объект удаляется, а перенос отменяется,
+// чтобы в хранилище не оставалось неучтённых объектов
+type MeteredStorage struct {
+	MinioStorage
+	usage  Usage
+	logger log.Logger
+}
+
+func NewMeteredStorage(storage MinioStorage, usage Usage, logger log.Logger) MeteredStorage {
+	return MeteredStorage{
+		MinioStorage: storage,
+		usage:        usage,
+		logger:       logger,
+	}
+}
+
+func (s MeteredStorage) UploadFile(ctx context.Context, metadata entity.Metadata, reader io.Reader) error {
+	counter := &byteCounter{reader: reader}
+	err := s.MinioStorage.UploadFile(ctx, metadata, counter)
+	if err != nil {
+		return err
+	}
+	err = s.usage.PutObject(ctx, metadata.Category, metadata.Filename, metadata.Owner, counter.n)
+	if err != nil {
+		s.compensate(ctx, metadata.Filename, s.MinioStorage.DeleteFile(ctx, metadata.Filename, metadata.Category))
+		return errors.WithMessage(err, "track uploaded object")
+	}
+	return nil
+}
+
+func (s MeteredStorage) CopyFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	err := s.MinioStorage.CopyFile(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		return err
+	}
+	err = s.usage.CopyObject(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		s.compensate(ctx, dstFilename, s.MinioStorage.DeleteFile(ctx, dstFilename, category))
+		return errors.WithMessage(err, "track copied object")
+	}
+	return nil
+}
+
+func (s MeteredStorage) MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	err := s.MinioStorage.MoveFile(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		return err
+	}
+	err = s.usage.MoveObject(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		s.compensate(ctx, srcFilename, s.MinioStorage.MoveFile(ctx, category, dstFilename, srcFilename))
+		return errors.WithMessage(err, "track moved object")
+	}
+	return nil
+}
+
+// DeleteFile удалённый ранее объект снимается с учёта, поэтому повтор после ошибки учёта исправляет счётчики
+func (s MeteredStorage) DeleteFile(ctx context.Context, filename string, category string) error {
+	err := s.MinioStorage.DeleteFile(ctx, filename, category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return err
+	}
+	trackErr := s.usage.DeleteObjects(ctx, category, []string{filename})
+	if trackErr != nil {
+		return errors.WithMessage(trackErr, "track deleted object")
+	}
+	return err
+}
+
+func (s MeteredStorage) DeleteFiles(ctx context.Context, category string, filenames []string) (map[string]error, error) {
+	failed, err := s.MinioStorage.DeleteFiles(ctx, category, filenames)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return nil, err
+	}
+	deleted := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		_, isFailed := failed[filename]
+		if !isFailed {
+			deleted = append(deleted, filename)
+		}
+	}
+	trackErr := s.usage.DeleteObjects(ctx, category, deleted)
+	if trackErr != nil {
+		return nil, errors.WithMessage(trackErr, "track deleted objects")
+	}
+	return failed, err
+}
+
+// compensate ошибка отмены не должна скрыть ошибку учёта, поэтому только записывается в лог
+func (s MeteredStorage) compensate(ctx context.Context, filename string, err error) {
+	if err != nil {
+		s.logger.Error(ctx, "quota usage: revert untracked object",
+			log.String("filename", filename),
+			log.Any("error", err),
+		)
+	}
+}
+
+type byteCounter struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *byteCounter) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/pkg/errors"
@@ -39,11 +40,21 @@ func (s MinioStorage) UploadFile(ctx context.Context, metadata entity.Metadata,
 		log.String("filePrettyName", metadata.PrettyName),
 	)
 
+	userMetadata := map[string]string{
+		entity.FilePrettyNameMetadataField: metadata.PrettyName,
+	}
+	if metadata.VersionId != "" {
+		userMetadata[entity.FileVersionIdMetadataField] = metadata.VersionId
+	}
+	if metadata.Owner != "" {
+		userMetadata[entity.FileOwnerMetadataField] = metadata.Owner
+	}
+	if metadata.Visibility != "" {
+		userMetadata[entity.FileVisibilityMetadataField] = metadata.Visibility
+	}
 	putOptions := minio.PutObjectOptions{
-		UserMetadata: map[string]string{
-			entity.FilePrettyNameMetadataField: metadata.PrettyName,
-		},
-		ContentType: metadata.ContentType,
+		UserMetadata: userMetadata,
+		ContentType:  metadata.ContentType,
 	}
 	_, err = s.cli.PutObject(ctx, metadata.Category, metadata.Filename, reader, metadata.Size, putOptions)
 	if err != nil {
@@ -79,15 +90,19 @@ func (s MinioStorage) GetFile(
 		return nil, nil, errors.WithMessage(err, "get object info")
 	}
 
-	metadata := &entity.Metadata{
-		Filename:    filename,
-		PrettyName:  objectInfo.Metadata.Get(entity.FileMinioMetadataPrettyNameField),
-		Category:    category,
-		ContentType: objectInfo.ContentType,
-		Size:        objectInfo.Size,
-	}
+	return toMetadata(filename, category, objectInfo), obj, nil
+}
 
-	return metadata, obj, nil
+func (s MinioStorage) StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error) {
+	objectInfo, err := s.cli.StatObject(ctx, category, filename, minio.StatObjectOptions{})
+	switch {
+	case minio.ToErrorResponse(err).StatusCode == http.StatusNotFound:
+		return nil, domain.ErrFileNotFound
+	case err != nil:
+		return nil, errors.WithMessage(err, "stat object")
+	default:
+		return toMetadata(filename, category, objectInfo), nil
+	}
 }
 
 func (s MinioStorage) IsFileExist(ctx context.Context, filename string, category string) (exist bool, err error) {
@@ -115,6 +130,230 @@ func (s MinioStorage) DeleteFile(ctx context.Context, filename string, category
 	}
 }
 
+// CopyFile копирует объект под новым именем, объект с новым именем перезаписывается
+func (s MinioStorage) CopyFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	s.logger.Info(ctx, "copy file",
+		log.String("bucketName", category),
+		log.String("srcFilename", srcFilename),
+		log.String("dstFilename", dstFilename),
+	)
+
+	_, err := s.cli.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: category, Object: dstFilename},
+		minio.CopySrcOptions{Bucket: category, Object: srcFilename},
+	)
+	switch {
+	case minio.ToErrorResponse(err).StatusCode == http.StatusNotFound:
+		return domain.ErrFileNotFound
+	case err != nil:
+		return errors.WithMessage(err, "compose object")
+	default:
+		return nil
+	}
+}
+
+// MoveFile копирует объект под новым именем и удаляет исходный,
+// если исходный объект удалить не удалось, копия удаляется и исходный объект остаётся на месте
+func (s MinioStorage) MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	s.logger.Info(ctx, "move file",
+		log.String("bucketName", category),
+		log.String("srcFilename", srcFilename),
+		log.String("dstFilename", dstFilename),
+	)
+
+	_, err := s.cli.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: category, Object: dstFilename},
+		minio.CopySrcOptions{Bucket: category, Object: srcFilename},
+	)
+	switch {
+	case minio.ToErrorResponse(err).StatusCode == http.StatusNotFound:
+		return domain.ErrFileNotFound
+	case err != nil:
+		return errors.WithMessage(err, "compose object")
+	}
+
+	err = s.cli.RemoveObject(ctx, category, srcFilename, minio.RemoveObjectOptions{})
+	if err != nil {
+		// без отката объект остался бы под обоими именами и учитывался дважды
+		rollbackErr := s.cli.RemoveObject(ctx, category, dstFilename, minio.RemoveObjectOptions{})
+		if rollbackErr != nil {
+			return errors.WithMessagef(err, "remove object, remove copy '%s': %v", dstFilename, rollbackErr)
+		}
+		return errors.WithMessage(err, "remove object")
+	}
+	return nil
+}
+
+// ListFiles возвращает не более limit имён объектов с указанным префиксом,
+// следующих в лексикографическом порядке после startAfter
+func (s MinioStorage) ListFiles(
+	ctx context.Context,
+	category string,
+	prefix string,
+	startAfter string,
+	limit int,
+) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	filenames := make([]string, 0)
+	objects := s.cli.ListObjects(ctx, category, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  true,
+	})
+	for object := range objects {
+		switch {
+		case minio.ToErrorResponse(object.Err).Code == minio.NoSuchBucket:
+			return filenames, nil
+		case object.Err != nil:
+			return nil, errors.WithMessage(object.Err, "list objects")
+		}
+		filenames = append(filenames, object.Key)
+		if len(filenames) >= limit {
+			break
+		}
+	}
+	return filenames, nil
+}
+
+// DeleteFiles удаляет объекты пачкой, возвращает ошибки удаления по именам файлов
+func (s MinioStorage) DeleteFiles(ctx context.Context, category string, filenames []string) (map[string]error, error) {
+	s.logger.Info(ctx, "delete files",
+		log.String("bucketName", category),
+		log.Any("count", len(filenames)),
+	)
+
+	objects := make(chan minio.ObjectInfo, len(filenames))
+	for _, filename := range filenames {
+		objects <- minio.ObjectInfo{Key: filename}
+	}
+	close(objects)
+
+	failed := make(map[string]error)
+	bucketNotFound := false
+	for removeErr := range s.cli.RemoveObjects(ctx, category, objects, minio.RemoveObjectsOptions{}) {
+		if minio.ToErrorResponse(removeErr.Err).Code == minio.NoSuchBucket {
+			bucketNotFound = true
+			continue
+		}
+		failed[removeErr.ObjectName] = removeErr.Err
+	}
+	if bucketNotFound {
+		return nil, domain.ErrFileNotFound
+	}
+	return failed, nil
+}
+
+func (s MinioStorage) ListCategories(ctx context.Context) ([]string, error) {
+	buckets, err := s.cli.ListBuckets(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list buckets")
+	}
+	categories := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		categories = append(categories, bucket.Name)
+	}
+	return categories, nil
+}
+
+func (s MinioStorage) IsCategoryExist(ctx context.Context, category string) (bool, error) {
+	exists, err := s.cli.BucketExists(ctx, category)
+	if err != nil {
+		return false, errors.WithMessage(err, "check is bucket exists")
+	}
+	return exists, nil
+}
+
+// CategoryStats считает количество и суммарный размер пользовательских файлов категории
+func (s MinioStorage) CategoryStats(ctx context.Context, category string) (*entity.CategoryStats, error) {
+	stats := &entity.CategoryStats{}
+	objects := s.cli.ListObjects(ctx, category, minio.ListObjectsOptions{Recursive: true})
+	for object := range objects {
+		switch {
+		case minio.ToErrorResponse(object.Err).Code == minio.NoSuchBucket:
+			return nil, domain.ErrCategoryNotFound
+		case object.Err != nil:
+			return nil, errors.WithMessage(object.Err, "list objects")
+		}
+		if entity.IsInternalObject(object.Key) {
+			continue
+		}
+		stats.ObjectCount++
+		stats.TotalSize += object.Size
+	}
+	return stats, nil
+}
+
+func (s MinioStorage) CreateCategory(ctx context.Context, category string) error {
+	err := s.createBucketIfNotExist(ctx, category)
+	if err != nil {
+		return errors.WithMessage(err, "create bucket if not exist")
+	}
+	return nil
+}
+
+func (s MinioStorage) DeleteCategory(ctx context.Context, category string) error {
+	s.logger.Info(ctx, "removing bucket", log.String("bucketName", category))
+	err := s.cli.RemoveBucket(ctx, category)
+	switch {
+	case minio.ToErrorResponse(err).Code == minio.NoSuchBucket:
+		return nil
+	case minio.ToErrorResponse(err).Code == "BucketNotEmpty":
+		return domain.ErrCategoryNotEmpty
+	case err != nil:
+		return errors.WithMessage(err, "remove bucket")
+	default:
+		return nil
+	}
+}
+
+// SetObjectLock дублирует блокировку файла в хранилище, если для бакета включена блокировка объектов
+func (s MinioStorage) SetObjectLock(ctx context.Context, lock entity.FileLock) error {
+	enabled, err := s.isObjectLockEnabled(ctx, lock.Category)
+	if err != nil {
+		return errors.WithMessage(err, "check object lock")
+	}
+	if !enabled {
+		return nil
+	}
+
+	retentionOpts := minio.PutObjectRetentionOptions{GovernanceBypass: true}
+	if lock.RetentionMode != "" && lock.RetainUntil != nil {
+		mode := minio.RetentionMode(strings.ToUpper(lock.RetentionMode))
+		retentionOpts.Mode = &mode
+		retentionOpts.RetainUntilDate = lock.RetainUntil
+	}
+	err = s.cli.PutObjectRetention(ctx, lock.Category, lock.Filename, retentionOpts)
+	if err != nil {
+		return errors.WithMessage(err, "put object retention")
+	}
+
+	legalHold := minio.LegalHoldDisabled
+	if lock.LegalHold {
+		legalHold = minio.LegalHoldEnabled
+	}
+	err = s.cli.PutObjectLegalHold(ctx, lock.Category, lock.Filename, minio.PutObjectLegalHoldOptions{
+		Status: &legalHold,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "put object legal hold")
+	}
+	return nil
+}
+
+func (s MinioStorage) isObjectLockEnabled(ctx context.Context, bucketName string) (bool, error) {
+	objectLock, _, _, _, err := s.cli.GetObjectLockConfig(ctx, bucketName)
+	switch {
+	case minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError":
+		return false, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "get object lock config")
+	default:
+		return objectLock == "Enabled", nil
+	}
+}
+
 func (s MinioStorage) createBucketIfNotExist(ctx context.Context, bucketName string) error {
 	exists, err := s.cli.BucketExists(ctx, bucketName)
 	if err != nil {
@@ -130,3 +369,17 @@ func (s MinioStorage) createBucketIfNotExist(ctx context.Context, bucketName str
 	}
 	return nil
 }
+
+func toMetadata(filename string, category string, objectInfo minio.ObjectInfo) *entity.Metadata {
+	return &entity.Metadata{
+		Filename:    filename,
+		PrettyName:  objectInfo.Metadata.Get(entity.FileMinioMetadataPrettyNameField),
+		Category:    category,
+		ContentType: objectInfo.ContentType,
+		Size:        objectInfo.Size,
+		VersionId:   objectInfo.Metadata.Get(entity.FileMinioMetadataVersionIdField),
+		Owner:       objectInfo.Metadata.Get(entity.FileMinioMetadataOwnerField),
+		Visibility:  objectInfo.Metadata.Get(entity.FileMinioMetadataVisibilityField),
+		CreatedAt:   objectInfo.LastModified,
+	}
+}
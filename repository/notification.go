@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pkg/errors"
+)
+
+// Notifications LISTEN/NOTIFY postgres, для прослушивания из пула забирается отдельное соединение
+type Notifications struct {
+	db *sql.DB
+}
+
+func NewNotifications(db *sql.DB) Notifications {
+	return Notifications{
+		db: db,
+	}
+}
+
+// Listen подписывается на канал, вызывает ready после подписки и handle на каждое уведомление,
+// возвращает ошибку при потере соединения или отмене ctx
+func (r Notifications) Listen(ctx context.Context, channel string, ready func(), handle func(payload string)) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "get connection")
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pgConn := stdlibConn.Conn()
+
+		query := "LISTEN " + pgx.Identifier{channel}.Sanitize()
+		_, err := pgConn.Exec(ctx, query)
+		if err != nil {
+			return errors.WithMessagef(err, "exec query: %s", query)
+		}
+		defer func() {
+			if !pgConn.IsClosed() {
+				_, _ = pgConn.Exec(context.Background(), "UNLISTEN *")
+			}
+		}()
+		ready()
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return errors.WithMessage(err, "wait for notification")
+			}
+			handle(notification.Payload)
+		}
+	})
+}
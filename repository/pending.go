@@ -2,13 +2,22 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"storage-service/domain"
 	"storage-service/entity"
+	"strings"
 	"time"
 
 	"github.com/Falokut/go-kit/db"
 	"github.com/pkg/errors"
 )
 
+const pendingFileColumns = `
+	filename, category, group_id, uploaded_by, status, error,
+	created_at, updated_at, expires_at, attempts, last_error, cleaned_at, file_expires_at
+`
+
 type Pending struct {
 	db db.DB
 }
@@ -19,31 +28,129 @@ func NewPending(db db.DB) Pending {
 	}
 }
 
-func (r Pending) DeletePendingFiles(ctx context.Context, timeAgo time.Time, maxFiles int) ([]entity.FileToDelete, error) {
+// ExpirePendingFiles переводит в статус expired не более maxFiles незавершённых загрузок с истёкшим сроком,
+// файлы таких загрузок удаляются отдельно, см. GetFilesToCleanup.
+// Загрузки групп истекают вместе с группой, см. ExpirePendingGroups
+func (r Pending) ExpirePendingFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.FileToDelete, error) {
 	files := []entity.FileToDelete{}
-
 	query := `
-		WITH deleted AS (
+		WITH expired AS (
 			SELECT filename, category
 			FROM pending_files
-			WHERE created_at <= $1
-			ORDER BY created_at
-			LIMIT $2
+			WHERE status IN ($1, $2) AND expires_at <= $3 AND group_id = ''
+			ORDER BY expires_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
 		)
-		DELETE FROM pending_files p
-		USING deleted d
-		WHERE p.filename = d.filename AND p.category = d.category
+		UPDATE pending_files p
+		SET status = $5, updated_at = $3
+		FROM expired e
+		WHERE p.filename = e.filename AND p.category = e.category
 		RETURNING p.filename, p.category
 	`
 
-	err := r.db.Select(ctx, &files, query, timeAgo, maxFiles)
+	err := r.db.Select(ctx, &files, query,
+		entity.PendingStatusUploading,
+		entity.PendingStatusPending,
+		now,
+		maxFiles,
+		entity.PendingStatusExpired,
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
+
+// GetStaleCommittingFiles блокирует до конца транзакции не более maxFiles загрузок вне групп,
+// перенос которых начат до before и не завершён
+func (r Pending) GetStaleCommittingFiles(ctx context.Context, before time.Time, maxFiles int) ([]entity.PendingFile, error) {
+	files := []entity.PendingFile{}
+	query := `
+		SELECT ` + pendingFileColumns + `
+		FROM pending_files
+		WHERE status = $1 AND updated_at < $2 AND group_id = ''
+		ORDER BY updated_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+	err := r.db.Select(ctx, &files, query, entity.PendingStatusCommitting, before, maxFiles)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
+
+// GetStaleCommittingGroups блокирует до конца транзакции не более maxGroups групп,
+// перенос файлов которых начат до before и не завершён
+func (r Pending) GetStaleCommittingGroups(ctx context.Context, before time.Time, maxGroups int) ([]entity.PendingGroup, error) {
+	groups := []entity.PendingGroup{}
+	query := `
+		SELECT id, status, created_at, updated_at, expires_at
+		FROM pending_groups
+		WHERE status = $1 AND updated_at < $2
+		ORDER BY updated_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+	err := r.db.Select(ctx, &groups, query, entity.PendingStatusCommitting, before, maxGroups)
 	if err != nil {
 		return nil, errors.WithMessagef(err, "exec query: %s", query)
 	}
+	return groups, nil
+}
 
+// GetFilesToCleanup блокирует до конца транзакции не более maxFiles истёкших, отменённых и неудачных загрузок,
+// файлы которых ещё не удалены из области pending
+func (r Pending) GetFilesToCleanup(ctx context.Context, maxFiles int) ([]entity.PendingFile, error) {
+	files := []entity.PendingFile{}
+	query := `
+		SELECT ` + pendingFileColumns + `
+		FROM pending_files
+		WHERE status IN ($1, $2, $3) AND cleaned_at IS NULL
+		ORDER BY updated_at
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	`
+	err := r.db.Select(ctx, &files, query,
+		entity.PendingStatusExpired,
+		entity.PendingStatusRolledBack,
+		entity.PendingStatusFailed,
+		maxFiles,
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
 	return files, nil
 }
 
+func (r Pending) MarkPendingFileCleaned(ctx context.Context, filename string, category string, now time.Time) error {
+	query := `
+		UPDATE pending_files
+		SET cleaned_at = $3, last_error = ''
+		WHERE filename = $1 AND category = $2
+	`
+	_, err := r.db.Exec(ctx, query, filename, category, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// RecordCleanupFailure увеличивает счётчик неудачных попыток удаления файла
+func (r Pending) RecordCleanupFailure(ctx context.Context, filename string, category string, errText string) error {
+	query := `
+		UPDATE pending_files
+		SET attempts = attempts + 1, last_error = $3
+		WHERE filename = $1 AND category = $2
+	`
+	_, err := r.db.Exec(ctx, query, filename, category, errText)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
 func (r Pending) DeletePendingFile(ctx context.Context, filename string, category string) error {
 	query := `
 		DELETE FROM pending_files
@@ -56,15 +163,467 @@ func (r Pending) DeletePendingFile(ctx context.Context, filename string, categor
 	return nil
 }
 
-func (r Pending) InsertPendingFile(ctx context.Context, filename string, category string, createdAt time.Time) error {
+func (r Pending) InsertPendingDeadLetter(ctx context.Context, deadLetter entity.PendingDeadLetter) error {
+	query := `
+		INSERT INTO pending_dead_letters (
+			id, filename, category, group_id, uploaded_by, attempts, last_error, created_at, dead_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(ctx, query,
+		deadLetter.Id,
+		deadLetter.Filename,
+		deadLetter.Category,
+		deadLetter.GroupId,
+		deadLetter.UploadedBy,
+		deadLetter.Attempts,
+		deadLetter.LastError,
+		deadLetter.CreatedAt,
+		deadLetter.DeadAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ListPendingDeadLetters возвращает записи от новых к старым, пустая категория не ограничивает выборку
+func (r Pending) ListPendingDeadLetters(
+	ctx context.Context,
+	category string,
+	limit int,
+	offset int,
+) ([]entity.PendingDeadLetter, error) {
+	deadLetters := []entity.PendingDeadLetter{}
+	query := `
+		SELECT id, filename, category, group_id, uploaded_by, attempts, last_error, created_at, dead_at
+		FROM pending_dead_letters
+		WHERE $1 = '' OR category = $1
+		ORDER BY dead_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+	err := r.db.Select(ctx, &deadLetters, query, category, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return deadLetters, nil
+}
+
+// DeleteFinishedPendingFiles удаляет записи о завершённых загрузках и группах, не изменявшиеся с before,
+// истёкшие, отменённые и неудачные загрузки, файлы которых ещё не удалены, сохраняются
+func (r Pending) DeleteFinishedPendingFiles(ctx context.Context, before time.Time) error {
+	query := `
+		DELETE FROM pending_files
+		WHERE status NOT IN ($1, $2, $3) AND updated_at <= $4
+			AND (status NOT IN ($5, $6, $7) OR cleaned_at IS NOT NULL)
+	`
+	_, err := r.db.Exec(ctx, query,
+		entity.PendingStatusUploading,
+		entity.PendingStatusPending,
+		entity.PendingStatusCommitting,
+		before,
+		entity.PendingStatusExpired,
+		entity.PendingStatusRolledBack,
+		entity.PendingStatusFailed,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	query = `
+		DELETE FROM pending_groups
+		WHERE status NOT IN ($1, $3) AND updated_at <= $2
+	`
+	_, err = r.db.Exec(ctx, query, entity.PendingStatusPending, before, entity.PendingStatusCommitting)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Pending) GetPendingFile(ctx context.Context, filename string, category string) (*entity.PendingFile, error) {
+	return r.getPendingFile(ctx, filename, category, false)
+}
+
+func (r Pending) GetPendingFileForUpdate(ctx context.Context, filename string, category string) (*entity.PendingFile, error) {
+	return r.getPendingFile(ctx, filename, category, true)
+}
+
+func (r Pending) getPendingFile(
+	ctx context.Context,
+	filename string,
+	category string,
+	forUpdate bool,
+) (*entity.PendingFile, error) {
+	file := entity.PendingFile{}
+	query := `
+		SELECT ` + pendingFileColumns + `
+		FROM pending_files
+		WHERE filename = $1 AND category = $2
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err := r.db.SelectRow(ctx, &file, query, filename, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrPendingFileNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &file, nil
+	}
+}
+
+// ListPendingFiles возвращает загрузки, подходящие под фильтр, от старых к новым
+func (r Pending) ListPendingFiles(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Category != "" {
+		where("category = $%d", filter.Category)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.GroupId != "" {
+		where("group_id = $%d", filter.GroupId)
+	}
+	if filter.UploadedBy != "" {
+		where("uploaded_by = $%d", filter.UploadedBy)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at <= $%d", *filter.CreatedBefore)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.ExpiresBefore != nil {
+		where("expires_at <= $%d", *filter.ExpiresBefore)
+	}
+	if filter.ExpiresAfter != nil {
+		where("expires_at >= $%d", *filter.ExpiresAfter)
+	}
+
+	query := `
+		SELECT ` + pendingFileColumns + `
+		FROM pending_files
+	`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY created_at, category, filename LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	files := []entity.PendingFile{}
+	err := r.db.Select(ctx, &files, query, args...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
+
+func (r Pending) PendingStats(ctx context.Context) ([]entity.PendingCategoryStats, error) {
+	stats := []entity.PendingCategoryStats{}
+	query := `
+		SELECT
+			category,
+			count(*) FILTER (WHERE status = $1) AS uploading,
+			count(*) FILTER (WHERE status = $2) AS pending,
+			count(*) FILTER (WHERE status = $3) AS committed,
+			count(*) FILTER (WHERE status = $4) AS rolled_back,
+			count(*) FILTER (WHERE status = $5) AS expired,
+			count(*) FILTER (WHERE status = $6) AS failed,
+			min(created_at) FILTER (WHERE status IN ($1, $2)) AS oldest_created_at
+		FROM pending_files
+		GROUP BY category
+		ORDER BY category
+	`
+	err := r.db.Select(ctx, &stats, query,
+		entity.PendingStatusUploading,
+		entity.PendingStatusPending,
+		entity.PendingStatusCommitted,
+		entity.PendingStatusRolledBack,
+		entity.PendingStatusExpired,
+		entity.PendingStatusFailed,
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return stats, nil
+}
+
+// UpsertPendingFile начинает новую загрузку, запись о предыдущей загрузке с тем же именем заменяется
+func (r Pending) UpsertPendingFile(ctx context.Context, file entity.PendingFile) error {
+	query := `
+		INSERT INTO pending_files (
+			filename, category, group_id, uploaded_by, status, error, created_at, updated_at, expires_at, file_expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, '', $6, $6, $7, $8)
+		ON CONFLICT (filename, category) DO UPDATE SET
+			group_id = excluded.group_id,
+			uploaded_by = excluded.uploaded_by,
+			status = excluded.status,
+			attempts = 0,
+			last_error = '',
+			cleaned_at = NULL,
+			error = excluded.error,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at,
+			expires_at = excluded.expires_at,
+			file_expires_at = excluded.file_expires_at
+	`
+	_, err := r.db.Exec(ctx, query,
+		file.Filename,
+		file.Category,
+		file.GroupId,
+		file.UploadedBy,
+		entity.PendingStatusUploading,
+		file.CreatedAt,
+		file.ExpiresAt,
+		file.FileExpiresAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// FillMissingExpirations задаёт срок подтверждения загрузкам, начатым до появления колонки expires_at
+func (r Pending) FillMissingExpirations(ctx context.Context, lifetime time.Duration) error {
+	query := `
+		UPDATE pending_files
+		SET expires_at = created_at + make_interval(secs => $1)
+		WHERE expires_at IS NULL
+	`
+	_, err := r.db.Exec(ctx, query, lifetime.Seconds())
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// UpdatePendingFileStatus меняет статус загрузки, только если она в статусе from,
+// иначе возвращает domain.ErrPendingFileConflict
+func (r Pending) UpdatePendingFileStatus(
+	ctx context.Context,
+	filename string,
+	category string,
+	from string,
+	status string,
+	errText string,
+	now time.Time,
+) error {
+	query := `
+		UPDATE pending_files
+		SET status = $4, error = $5, updated_at = $6
+		WHERE filename = $1 AND category = $2 AND status = $3
+	`
+	result, err := r.db.Exec(ctx, query, filename, category, from, status, errText, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	_, err = r.GetPendingFile(ctx, filename, category)
+	if err != nil {
+		return err
+	}
+	return errors.WithMessagef(domain.ErrPendingFileConflict, "expected status '%s'", from)
+}
+
+func (r Pending) UpdatePendingFileExpiration(
+	ctx context.Context,
+	filename string,
+	category string,
+	expiresAt time.Time,
+	now time.Time,
+) error {
+	query := `
+		UPDATE pending_files
+		SET expires_at = $3, updated_at = $4
+		WHERE filename = $1 AND category = $2
+	`
+	_, err := r.db.Exec(ctx, query, filename, category, expiresAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// DeletePendingFilesByNames удаляет записи о закоммиченных файлах, удалённых из хранилища,
+// незавершённые загрузки хранятся отдельно и не затрагиваются
+func (r Pending) DeletePendingFilesByNames(ctx context.Context, category string, filenames []string) error {
+	query := `
+		DELETE FROM pending_files
+		WHERE category = $1 AND filename = ANY($2) AND status = $3
+	`
+	_, err := r.db.Exec(ctx, query, category, filenames, entity.PendingStatusCommitted)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// InsertPendingGroup создаёт группу, если её ещё нет
+func (r Pending) InsertPendingGroup(ctx context.Context, id string, now time.Time, expiresAt time.Time) error {
+	query := `
+		INSERT INTO pending_groups (id, status, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err := r.db.Exec(ctx, query, id, entity.PendingStatusPending, now, expiresAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Pending) GetPendingGroup(ctx context.Context, id string) (*entity.PendingGroup, error) {
+	return r.getPendingGroup(ctx, id, false)
+}
+
+func (r Pending) GetPendingGroupForUpdate(ctx context.Context, id string) (*entity.PendingGroup, error) {
+	return r.getPendingGroup(ctx, id, true)
+}
+
+func (r Pending) getPendingGroup(ctx context.Context, id string, forUpdate bool) (*entity.PendingGroup, error) {
+	group := entity.PendingGroup{}
+	query := `
+		SELECT id, status, created_at, updated_at, expires_at
+		FROM pending_groups
+		WHERE id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err := r.db.SelectRow(ctx, &group, query, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrPendingGroupNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &group, nil
+	}
+}
+
+func (r Pending) GetGroupFiles(ctx context.Context, groupId string) ([]entity.PendingFile, error) {
+	return r.getGroupFiles(ctx, groupId, false)
+}
+
+func (r Pending) GetGroupFilesForUpdate(ctx context.Context, groupId string) ([]entity.PendingFile, error) {
+	return r.getGroupFiles(ctx, groupId, true)
+}
+
+func (r Pending) getGroupFiles(ctx context.Context, groupId string, forUpdate bool) ([]entity.PendingFile, error) {
+	files := []entity.PendingFile{}
+	query := `
+		SELECT ` + pendingFileColumns + `
+		FROM pending_files
+		WHERE group_id = $1
+		ORDER BY created_at, category, filename
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	err := r.db.Select(ctx, &files, query, groupId)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
+
+// UpdatePendingGroupStatus меняет статус группы и всех её загрузок в незавершённом состоянии
+func (r Pending) UpdatePendingGroupStatus(ctx context.Context, id string, status string, now time.Time) error {
 	query := `
-		INSERT INTO pending_files (filename, category, created_at)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (filename, category) DO NOTHING
+		UPDATE pending_groups
+		SET status = $2, updated_at = $3
+		WHERE id = $1
 	`
-	_, err := r.db.Exec(ctx, query, filename, category, createdAt)
+	_, err := r.db.Exec(ctx, query, id, status, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	query = `
+		UPDATE pending_files
+		SET status = $2, updated_at = $3
+		WHERE group_id = $1 AND status IN ($4, $5)
+	`
+	_, err = r.db.Exec(ctx, query, id, status, now, entity.PendingStatusUploading, entity.PendingStatusPending)
 	if err != nil {
 		return errors.WithMessagef(err, "exec query: %s", query)
 	}
 	return nil
 }
+
+// UpdatePendingGroupExpiration продлевает срок группы и всех её загрузок
+func (r Pending) UpdatePendingGroupExpiration(ctx context.Context, id string, expiresAt time.Time, now time.Time) error {
+	query := `
+		UPDATE pending_groups
+		SET expires_at = $2, updated_at = $3
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, expiresAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	query = `
+		UPDATE pending_files
+		SET expires_at = $2, updated_at = $3
+		WHERE group_id = $1
+	`
+	_, err = r.db.Exec(ctx, query, id, expiresAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ExpirePendingGroups переводит в статус expired не более maxGroups групп с истёкшим сроком
+// вместе с их незавершёнными загрузками, возвращает истёкшие загрузки
+func (r Pending) ExpirePendingGroups(ctx context.Context, now time.Time, maxGroups int) ([]entity.FileToDelete, error) {
+	files := []entity.FileToDelete{}
+	query := `
+		WITH expired AS (
+			UPDATE pending_groups g
+			SET status = $1, updated_at = $2
+			WHERE g.id IN (
+				SELECT id
+				FROM pending_groups
+				WHERE status = $3 AND expires_at <= $2
+				ORDER BY expires_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING g.id
+		)
+		UPDATE pending_files p
+		SET status = $1, updated_at = $2
+		FROM expired e
+		WHERE p.group_id = e.id AND p.status IN ($3, $5)
+		RETURNING p.filename, p.category
+	`
+	err := r.db.Select(ctx, &files, query,
+		entity.PendingStatusExpired,
+		now,
+		entity.PendingStatusPending,
+		maxGroups,
+		entity.PendingStatusUploading,
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return files, nil
+}
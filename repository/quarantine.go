@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+
+	"storage-service/domain"
+
+	"github.com/Falokut/go-kit/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// QuarantineStorage переносит и удаляет проверки антивирусом вместе с объектами,
+// чтобы карантин следовал за файлом при подтверждении загрузки, переносе в корзину и сохранении версии
+type QuarantineStorage struct {
+	MeteredStorage
+	scans  Scan
+	logger log.Logger
+}
+
+func NewQuarantineStorage(storage MeteredStorage, scans Scan, logger log.Logger) QuarantineStorage {
+	return QuarantineStorage{
+		MeteredStorage: storage,
+		scans:          scans,
+		logger:         logger,
+	}
+}
+
+// CopyFile копия объекта на карантине остаётся на карантине, без записи о проверке копия удаляется
+func (s QuarantineStorage) CopyFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	err := s.MeteredStorage.CopyFile(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		return err
+	}
+	err = s.scans.CopyObjectScan(ctx, category, srcFilename, dstFilename, uuid.NewString())
+	if err != nil {
+		deleteErr := s.MeteredStorage.DeleteFile(ctx, dstFilename, category)
+		if deleteErr != nil {
+			return errors.WithMessagef(err, "copy object scan, delete copy: %v", deleteErr)
+		}
+		return errors.WithMessage(err, "copy object scan")
+	}
+	return nil
+}
+
+// MoveFile проверка копируется на новое имя до переноса объекта, поэтому перенесённый объект не выдаётся без проверки,
+// даже если запись не удастся перенести после объекта. Если не удался перенос объекта, копия проверки
+// на время повторной проверки оставляет на карантине прежний объект под новым именем
+func (s QuarantineStorage) MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error {
+	err := s.scans.CopyObjectScan(ctx, category, srcFilename, dstFilename, uuid.NewString())
+	if err != nil {
+		return errors.WithMessage(err, "copy object scan")
+	}
+	err = s.MeteredStorage.MoveFile(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		return err
+	}
+	// перенос возвращает исходную проверку и удаляет устаревшую проверку прежнего объекта под новым именем,
+	// при ошибке объект остаётся на карантине до проверки воркером
+	err = s.scans.MoveObjectScan(ctx, category, srcFilename, dstFilename)
+	if err != nil {
+		s.logger.Error(ctx, "antivirus: move object scan", log.String("category", category), log.Any("error", err))
+	}
+	return nil
+}
+
+// DeleteFile при ошибке удаления проверки возвращается ошибка, повторное удаление удаляет проверку отсутствующего объекта
+func (s QuarantineStorage) DeleteFile(ctx context.Context, filename string, category string) error {
+	err := s.MeteredStorage.DeleteFile(ctx, filename, category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return err
+	}
+	scanErr := s.scans.DeleteObjectScans(ctx, category, []string{filename})
+	if scanErr != nil {
+		return errors.WithMessage(scanErr, "delete object scans")
+	}
+	return err
+}
+
+func (s QuarantineStorage) DeleteFiles(ctx context.Context, category string, filenames []string) (map[string]error, error) {
+	failed, err := s.MeteredStorage.DeleteFiles(ctx, category, filenames)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return nil, err
+	}
+	deleted := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		_, isFailed := failed[filename]
+		if !isFailed {
+			deleted = append(deleted, filename)
+		}
+	}
+	scanErr := s.scans.DeleteObjectScans(ctx, category, deleted)
+	if scanErr != nil {
+		return nil, errors.WithMessage(scanErr, "delete object scans")
+	}
+	return failed, err
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Reference struct {
+	db db.DB
+}
+
+func NewReference(db db.DB) Reference {
+	return Reference{
+		db: db,
+	}
+}
+
+// InsertReference добавляет ссылку, повторное добавление той же ссылки не считается ошибкой
+func (r Reference) InsertReference(ctx context.Context, ref entity.FileReference) error {
+	query := `
+		INSERT INTO file_references (filename, category, owner_type, owner_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (category, filename, owner_type, owner_id) DO NOTHING
+	`
+	_, err := r.db.Exec(ctx, query, ref.Filename, ref.Category, ref.OwnerType, ref.OwnerId, ref.CreatedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Reference) DeleteReference(ctx context.Context, ref entity.FileReference) error {
+	query := `
+		DELETE FROM file_references
+		WHERE category = $1 AND filename = $2 AND owner_type = $3 AND owner_id = $4
+	`
+	result, err := r.db.Exec(ctx, query, ref.Category, ref.Filename, ref.OwnerType, ref.OwnerId)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrReferenceNotFound
+	}
+	return nil
+}
+
+func (r Reference) CountReferences(ctx context.Context, filename string, category string) (int, error) {
+	count := 0
+	query := `
+		SELECT count(*)
+		FROM file_references
+		WHERE category = $1 AND filename = $2
+	`
+	err := r.db.SelectRow(ctx, &count, query, category, filename)
+	if err != nil {
+		return 0, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return count, nil
+}
+
+func (r Reference) GetFileReferences(ctx context.Context, filename string, category string) ([]entity.FileReference, error) {
+	refs := []entity.FileReference{}
+	query := `
+		SELECT filename, category, owner_type, owner_id, created_at
+		FROM file_references
+		WHERE category = $1 AND filename = $2
+		ORDER BY created_at, owner_type, owner_id
+	`
+	err := r.db.Select(ctx, &refs, query, category, filename)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return refs, nil
+}
+
+func (r Reference) GetOwnerReferences(ctx context.Context, ownerType string, ownerId string) ([]entity.FileReference, error) {
+	refs := []entity.FileReference{}
+	query := `
+		SELECT filename, category, owner_type, owner_id, created_at
+		FROM file_references
+		WHERE owner_type = $1 AND owner_id = $2
+		ORDER BY created_at, category, filename
+	`
+	err := r.db.Select(ctx, &refs, query, ownerType, ownerId)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return refs, nil
+}
+
+// UpsertOrphan отмечает момент, когда у файла не осталось ссылок
+func (r Reference) UpsertOrphan(ctx context.Context, filename string, category string, now time.Time) error {
+	query := `
+		INSERT INTO file_orphans (filename, category, orphaned_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (category, filename) DO UPDATE SET orphaned_at = excluded.orphaned_at, claimed_at = NULL
+	`
+	_, err := r.db.Exec(ctx, query, filename, category, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Reference) DeleteOrphan(ctx context.Context, filename string, category string) error {
+	query := `
+		DELETE FROM file_orphans
+		WHERE category = $1 AND filename = $2
+	`
+	_, err := r.db.Exec(ctx, query, category, filename)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ClaimCollectableOrphans захватывает на момент now не более maxFiles отметок, сделанных не позже before,
+// у файлов которых так и не появилось ссылок. Отметки, захваченные не позже claimedBefore, захватываются повторно
+func (r Reference) ClaimCollectableOrphans(
+	ctx context.Context,
+	before time.Time,
+	claimedBefore time.Time,
+	now time.Time,
+	maxFiles int,
+) ([]entity.FileOrphan, error) {
+	orphans := []entity.FileOrphan{}
+	query := `
+		UPDATE file_orphans
+		SET claimed_at = $3
+		WHERE (category, filename) IN (
+			SELECT o.category, o.filename
+			FROM file_orphans o
+			WHERE o.orphaned_at <= $1 AND (o.claimed_at IS NULL OR o.claimed_at <= $2) AND NOT EXISTS (
+				SELECT 1 FROM file_references r
+				WHERE r.category = o.category AND r.filename = o.filename
+			)
+			ORDER BY o.orphaned_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING filename, category, orphaned_at, claimed_at
+	`
+	err := r.db.Select(ctx, &orphans, query, before, claimedBefore, now, maxFiles)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return orphans, nil
+}
+
+// DeleteClaimedOrphan удаляет отметку, если она не изменилась с момента захвата
+func (r Reference) DeleteClaimedOrphan(ctx context.Context, orphan entity.FileOrphan) error {
+	query := `
+		DELETE FROM file_orphans
+		WHERE category = $1 AND filename = $2 AND claimed_at = $3
+	`
+	_, err := r.db.Exec(ctx, query, orphan.Category, orphan.Filename, orphan.ClaimedAt)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
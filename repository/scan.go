@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+const fileScanColumns = `scan_id, category, object_key, filename, status, signature, attempts, last_error, next_scan_at, created_at, updated_at`
+
+type Scan struct {
+	db db.DB
+}
+
+func NewScan(db db.DB) Scan {
+	return Scan{
+		db: db,
+	}
+}
+
+// UpsertScan ставит объект на карантин, новая проверка объекта заменяет предыдущую
+func (r Scan) UpsertScan(ctx context.Context, scan entity.FileScan) error {
+	query := `
+		INSERT INTO file_scans (` + fileScanColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET scan_id = EXCLUDED.scan_id,
+			filename = EXCLUDED.filename,
+			status = EXCLUDED.status,
+			signature = EXCLUDED.signature,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			next_scan_at = EXCLUDED.next_scan_at,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.db.Exec(
+		ctx,
+		query,
+		scan.ScanId,
+		scan.Category,
+		scan.ObjectKey,
+		scan.Filename,
+		scan.Status,
+		scan.Signature,
+		scan.Attempts,
+		scan.LastError,
+		scan.NextScanAt,
+		scan.CreatedAt,
+		scan.UpdatedAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Scan) GetScan(ctx context.Context, scanId string) (*entity.FileScan, error) {
+	scan := entity.FileScan{}
+	query := `
+		SELECT ` + fileScanColumns + `
+		FROM file_scans
+		WHERE scan_id = $1
+	`
+	err := r.db.SelectRow(ctx, &scan, query, scanId)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil // nolint:nilnil
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return &scan, nil
+}
+
+// GetScanStatus возвращает пустую строку, если объект не на карантине
+func (r Scan) GetScanStatus(ctx context.Context, category string, objectKey string) (string, error) {
+	status := ""
+	query := `
+		SELECT status
+		FROM file_scans
+		WHERE category = $1 AND object_key = $2
+	`
+	err := r.db.SelectRow(ctx, &status, query, category, objectKey)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "", nil
+	case err != nil:
+		return "", errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return status, nil
+}
+
+// ClaimScans выбирает не более limit проверок, время которых наступило, и откладывает их до leaseUntil,
+// чтобы другие экземпляры сервиса не проверяли тот же объект одновременно
+func (r Scan) ClaimScans(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]entity.FileScan, error) {
+	scans := make([]entity.FileScan, 0)
+	query := `
+		UPDATE file_scans
+		SET next_scan_at = $3
+		WHERE scan_id IN (
+			SELECT scan_id
+			FROM file_scans
+			WHERE status = $1 AND next_scan_at <= $2
+			ORDER BY next_scan_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + fileScanColumns + `
+	`
+	err := r.db.Select(ctx, &scans, query, entity.ScanStatusPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return scans, nil
+}
+
+func (r Scan) RescheduleScan(ctx context.Context, scanId string, nextScanAt time.Time, now time.Time) error {
+	query := `
+		UPDATE file_scans
+		SET next_scan_at = $2, updated_at = $3
+		WHERE scan_id = $1
+	`
+	_, err := r.db.Exec(ctx, query, scanId, nextScanAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// RecordScanFailure увеличивает счётчик неудачных попыток проверки, объект остаётся на карантине
+func (r Scan) RecordScanFailure(ctx context.Context, scanId string, errText string, nextScanAt time.Time, now time.Time) error {
+	query := `
+		UPDATE file_scans
+		SET attempts = attempts + 1, last_error = $2, next_scan_at = $3, updated_at = $4
+		WHERE scan_id = $1
+	`
+	_, err := r.db.Exec(ctx, query, scanId, errText, nextScanAt, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Scan) MarkScanInfected(ctx context.Context, scanId string, signature string, now time.Time) error {
+	query := `
+		UPDATE file_scans
+		SET status = $2, signature = $3, last_error = '', updated_at = $4
+		WHERE scan_id = $1
+	`
+	_, err := r.db.Exec(ctx, query, scanId, entity.ScanStatusInfected, signature, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// DeleteScan снимает объект с карантина, возвращает false, если проверка уже заменена или удалена
+func (r Scan) DeleteScan(ctx context.Context, scanId string) (bool, error) {
+	query := `
+		DELETE FROM file_scans
+		WHERE scan_id = $1
+	`
+	result, err := r.db.Exec(ctx, query, scanId)
+	if err != nil {
+		return false, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.WithMessage(err, "rows affected")
+	}
+	return affected > 0, nil
+}
+
+// MoveObjectScan переносит карантин вместе с объектом одним запросом,
+// если исходный объект не на карантине, проверка объекта с новым именем удаляется
+func (r Scan) MoveObjectScan(ctx context.Context, category string, srcKey string, dstKey string) error {
+	query := `
+		WITH src AS (
+			DELETE FROM file_scans
+			WHERE category = $1 AND object_key = $2
+			RETURNING ` + fileScanColumns + `
+		), dst AS (
+			DELETE FROM file_scans
+			WHERE category = $1 AND object_key = $3 AND NOT EXISTS (SELECT 1 FROM src)
+		)
+		INSERT INTO file_scans (` + fileScanColumns + `)
+		SELECT scan_id, category, $3, filename, status, signature, attempts, last_error, next_scan_at, created_at, updated_at
+		FROM src
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET scan_id = EXCLUDED.scan_id,
+			filename = EXCLUDED.filename,
+			status = EXCLUDED.status,
+			signature = EXCLUDED.signature,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			next_scan_at = EXCLUDED.next_scan_at,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.db.Exec(ctx, query, category, srcKey, dstKey)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// CopyObjectScan ставит копию объекта на карантин, если исходный объект на карантине
+func (r Scan) CopyObjectScan(ctx context.Context, category string, srcKey string, dstKey string, scanId string) error {
+	query := `
+		INSERT INTO file_scans (` + fileScanColumns + `)
+		SELECT $4, category, $3, filename, status, signature, 0, '', next_scan_at, created_at, updated_at
+		FROM file_scans
+		WHERE category = $1 AND object_key = $2
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET scan_id = EXCLUDED.scan_id,
+			filename = EXCLUDED.filename,
+			status = EXCLUDED.status,
+			signature = EXCLUDED.signature,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			next_scan_at = EXCLUDED.next_scan_at,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at
+	`
+	_, err := r.db.Exec(ctx, query, category, srcKey, dstKey, scanId)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Scan) DeleteObjectScans(ctx context.Context, category string, objectKeys []string) error {
+	if len(objectKeys) == 0 {
+		return nil
+	}
+	query := `
+		DELETE FROM file_scans
+		WHERE category = $1 AND object_key = ANY($2)
+	`
+	_, err := r.db.Exec(ctx, query, category, objectKeys)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
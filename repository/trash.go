@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Trash struct {
+	db db.DB
+}
+
+func NewTrash(db db.DB) Trash {
+	return Trash{
+		db: db,
+	}
+}
+
+func (r Trash) InsertTrashFile(ctx context.Context, file entity.TrashFile) error {
+	query := `
+		INSERT INTO trash_files (id, filename, category, deleted_at, deleted_by, purge_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(ctx, query,
+		file.Id,
+		file.Filename,
+		file.Category,
+		file.DeletedAt,
+		file.DeletedBy,
+		file.PurgeAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Trash) DeleteTrashFile(ctx context.Context, id string, category string) (*entity.TrashFile, error) {
+	file := entity.TrashFile{}
+	query := `
+		DELETE FROM trash_files
+		WHERE id = $1 AND category = $2
+		RETURNING id, filename, category, deleted_at, deleted_by, purge_at
+	`
+	err := r.db.SelectRow(ctx, &file, query, id, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrTrashFileNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &file, nil
+	}
+}
+
+func (r Trash) GetTrashFile(ctx context.Context, id string, category string) (*entity.TrashFile, error) {
+	file := entity.TrashFile{}
+	query := `
+		SELECT id, filename, category, deleted_at, deleted_by, purge_at
+		FROM trash_files
+		WHERE id = $1 AND category = $2
+	`
+	err := r.db.SelectRow(ctx, &file, query, id, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrTrashFileNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &file, nil
+	}
+}
+
+func (r Trash) GetExpiredTrashFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.TrashFile, error) {
+	files := []entity.TrashFile{}
+
+	query := `
+		SELECT id, filename, category, deleted_at, deleted_by, purge_at
+		FROM trash_files
+		WHERE purge_at <= $1
+		ORDER BY purge_at
+		LIMIT $2
+	`
+
+	err := r.db.Select(ctx, &files, query, now, maxFiles)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	return files, nil
+}
+
+func (r Trash) GetTrashFiles(ctx context.Context, category string, limit int, offset int) ([]entity.TrashFile, error) {
+	files := []entity.TrashFile{}
+
+	query := `
+		SELECT id, filename, category, deleted_at, deleted_by, purge_at
+		FROM trash_files
+		WHERE category = $1
+		ORDER BY deleted_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	err := r.db.Select(ctx, &files, query, category, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+// Usage учёт объектов хранилища, счётчики quota_usage обновляет триггер на file_usage
+// в той же транзакции, что и изменение объекта
+type Usage struct {
+	db db.DB
+}
+
+func NewUsage(db db.DB) Usage {
+	return Usage{
+		db: db,
+	}
+}
+
+// PutObject учитывает записанный объект, перезаписанный объект заменяет прежний
+func (r Usage) PutObject(ctx context.Context, category string, objectKey string, owner string, size int64) error {
+	query := `
+		INSERT INTO file_usage (category, object_key, owner, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET owner = EXCLUDED.owner, size = EXCLUDED.size
+	`
+	_, err := r.db.Exec(ctx, query, category, objectKey, owner, size)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// CopyObject учитывает копию объекта с тем же владельцем и размером
+func (r Usage) CopyObject(ctx context.Context, category string, srcKey string, dstKey string) error {
+	query := `
+		INSERT INTO file_usage (category, object_key, owner, size)
+		SELECT category, $3, owner, size
+		FROM file_usage
+		WHERE category = $1 AND object_key = $2
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET owner = EXCLUDED.owner, size = EXCLUDED.size
+	`
+	_, err := r.db.Exec(ctx, query, category, srcKey, dstKey)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// MoveObject переносит учёт объекта на новое имя одним запросом, прежний объект с новым именем перестаёт учитываться
+func (r Usage) MoveObject(ctx context.Context, category string, srcKey string, dstKey string) error {
+	query := `
+		WITH src AS (
+			DELETE FROM file_usage
+			WHERE category = $1 AND object_key = $2
+			RETURNING owner, size
+		), dst AS (
+			DELETE FROM file_usage
+			WHERE category = $1 AND object_key = $3 AND NOT EXISTS (SELECT 1 FROM src)
+		)
+		INSERT INTO file_usage (category, object_key, owner, size)
+		SELECT $1, $3, owner, size
+		FROM src
+		ON CONFLICT (category, object_key) DO UPDATE
+		SET owner = EXCLUDED.owner, size = EXCLUDED.size
+	`
+	_, err := r.db.Exec(ctx, query, category, srcKey, dstKey)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Usage) DeleteObjects(ctx context.Context, category string, objectKeys []string) error {
+	if len(objectKeys) == 0 {
+		return nil
+	}
+	query := `
+		DELETE FROM file_usage
+		WHERE category = $1 AND object_key = ANY($2)
+	`
+	_, err := r.db.Exec(ctx, query, category, objectKeys)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// GetUsage возвращает нулевое использование, если объекты ещё не учитывались
+func (r Usage) GetUsage(ctx context.Context, scope string, name string) (*entity.QuotaUsage, error) {
+	usage := entity.QuotaUsage{}
+	query := `
+		SELECT scope, name, bytes, objects, reserved_bytes, reserved_objects
+		FROM quota_usage
+		WHERE scope = $1 AND name = $2
+	`
+	err := r.db.SelectRow(ctx, &usage, query, scope, name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return &entity.QuotaUsage{Scope: scope, Name: name}, nil
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return &usage, nil
+}
+
+func (r Usage) ListUsage(ctx context.Context, scope string) ([]entity.QuotaUsage, error) {
+	usage := make([]entity.QuotaUsage, 0)
+	query := `
+		SELECT scope, name, bytes, objects, reserved_bytes, reserved_objects
+		FROM quota_usage
+		WHERE $1 = '' OR scope = $1
+		ORDER BY scope, name
+	`
+	err := r.db.Select(ctx, &usage, query, scope)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return usage, nil
+}
+
+// LockUsage создаёт недостающий счётчик и блокирует его до конца транзакции
+func (r Usage) LockUsage(ctx context.Context, scope string, name string) (*entity.QuotaUsage, error) {
+	usage := entity.QuotaUsage{}
+	query := `
+		INSERT INTO quota_usage (scope, name)
+		VALUES ($1, $2)
+		ON CONFLICT (scope, name) DO UPDATE
+		SET scope = EXCLUDED.scope
+		RETURNING scope, name, bytes, objects, reserved_bytes, reserved_objects
+	`
+	err := r.db.SelectRow(ctx, &usage, query, scope, name)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return &usage, nil
+}
+
+// InsertReservation счётчики quota_usage обновляет триггер на quota_reservations
+func (r Usage) InsertReservation(ctx context.Context, reservation entity.QuotaReservation) error {
+	query := `
+		INSERT INTO quota_reservations (id, category, owner, bytes, objects, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.Exec(ctx, query,
+		reservation.Id,
+		reservation.Category,
+		reservation.Owner,
+		reservation.Bytes,
+		reservation.Objects,
+		reservation.ExpiresAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Usage) DeleteReservation(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM quota_reservations
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Usage) DeleteExpiredReservations(ctx context.Context, category string, now time.Time) error {
+	query := `
+		DELETE FROM quota_reservations
+		WHERE category = $1 AND expires_at < $2
+	`
+	_, err := r.db.Exec(ctx, query, category, now)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
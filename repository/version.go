@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Version struct {
+	db db.DB
+}
+
+func NewVersion(db db.DB) Version {
+	return Version{
+		db: db,
+	}
+}
+
+func (r Version) InsertVersion(ctx context.Context, version entity.FileVersion) error {
+	query := `
+		INSERT INTO file_versions (version_id, filename, category, size, content_type, created_at, archived_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.Exec(ctx, query,
+		version.VersionId,
+		version.Filename,
+		version.Category,
+		version.Size,
+		version.ContentType,
+		version.CreatedAt,
+		version.ArchivedAt,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Version) GetVersion(ctx context.Context, filename string, category string, versionId string) (*entity.FileVersion, error) {
+	version := entity.FileVersion{}
+	query := `
+		SELECT version_id, filename, category, size, content_type, created_at, archived_at
+		FROM file_versions
+		WHERE version_id = $1 AND filename = $2 AND category = $3
+	`
+	err := r.db.SelectRow(ctx, &version, query, versionId, filename, category)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, domain.ErrVersionNotFound
+	case err != nil:
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	default:
+		return &version, nil
+	}
+}
+
+func (r Version) GetVersions(ctx context.Context, filename string, category string) ([]entity.FileVersion, error) {
+	versions := []entity.FileVersion{}
+	query := `
+		SELECT version_id, filename, category, size, content_type, created_at, archived_at
+		FROM file_versions
+		WHERE filename = $1 AND category = $2
+		ORDER BY archived_at DESC
+	`
+	err := r.db.Select(ctx, &versions, query, filename, category)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return versions, nil
+}
+
+func (r Version) DeleteVersion(ctx context.Context, filename string, category string, versionId string) error {
+	query := `
+		DELETE FROM file_versions
+		WHERE version_id = $1 AND filename = $2 AND category = $3
+	`
+	result, err := r.db.Exec(ctx, query, versionId, filename, category)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrVersionNotFound
+	}
+	return nil
+}
+
+// DeleteOldVersions удаляет записи о версиях файла, не попадающих в keep самых новых
+func (r Version) DeleteOldVersions(ctx context.Context, filename string, category string, keep int) ([]string, error) {
+	versionIds := []string{}
+	query := `
+		WITH old AS (
+			SELECT version_id
+			FROM file_versions
+			WHERE filename = $1 AND category = $2
+			ORDER BY archived_at DESC
+			OFFSET $3
+		)
+		DELETE FROM file_versions v
+		USING old o
+		WHERE v.version_id = o.version_id
+		RETURNING v.version_id
+	`
+	err := r.db.Select(ctx, &versionIds, query, filename, category, keep)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return versionIds, nil
+}
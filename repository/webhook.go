@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/Falokut/go-kit/db"
+	"github.com/pkg/errors"
+)
+
+type Webhook struct {
+	db db.DB
+}
+
+func NewWebhook(db db.DB) Webhook {
+	return Webhook{
+		db: db,
+	}
+}
+
+func (r Webhook) GetSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	subscriptions := []entity.WebhookSubscription{}
+	query := `
+		SELECT name, categories, event_types
+		FROM webhook_subscriptions
+		FOR UPDATE
+	`
+	err := r.db.Select(ctx, &subscriptions, query)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return subscriptions, nil
+}
+
+// DeleteSubscriptions удаляет подписки, доставки удалённых подписок сохраняются
+func (r Webhook) DeleteSubscriptions(ctx context.Context, names []string) error {
+	query := `
+		DELETE FROM webhook_subscriptions
+		WHERE name = ANY($1)
+	`
+	_, err := r.db.Exec(ctx, query, names)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+func (r Webhook) UpsertSubscription(ctx context.Context, subscription entity.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (name, categories, event_types)
+		VALUES ($1, COALESCE($2::TEXT[], '{}'), COALESCE($3::TEXT[], '{}'))
+		ON CONFLICT (name) DO UPDATE SET
+			categories = excluded.categories,
+			event_types = excluded.event_types
+	`
+	_, err := r.db.Exec(ctx, query, subscription.Name, subscription.Categories, subscription.EventTypes)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries захватывает не более limit доставок, время попытки которых наступило,
+// откладывая следующую попытку до claimedUntil. Запрос выполняется без транзакции,
+// доставки, захваченные другим экземпляром, пропускаются
+func (r Webhook) ClaimDueDeliveries(
+	ctx context.Context,
+	now time.Time,
+	claimedUntil time.Time,
+	limit int,
+) ([]entity.WebhookDelivery, error) {
+	deliveries := []entity.WebhookDelivery{}
+	query := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d
+			SET next_attempt_at = $3
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.id, d.event_id, d.subscription, d.status, d.attempts, d.last_error, d.next_attempt_at, d.updated_at
+		)
+		SELECT
+			c.id, c.subscription, c.status, c.attempts, c.last_error, c.next_attempt_at, c.updated_at,
+			e.id AS event_id, e.event_type, e.category, e.filename, e.actor, e.created_at AS event_created_at
+		FROM claimed c
+		JOIN storage_events e ON e.id = c.event_id
+		ORDER BY c.id
+	`
+	err := r.db.Select(ctx, &deliveries, query, entity.WebhookDeliveryPending, now, claimedUntil, limit)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки, доставка, вручную изменённая после захвата, не перезаписывается
+func (r Webhook) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5, updated_at = $6
+		WHERE id = $1 AND status = $7
+	`
+	_, err := r.db.Exec(ctx, query,
+		delivery.Id,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.LastError,
+		delivery.NextAttemptAt,
+		delivery.UpdatedAt,
+		entity.WebhookDeliveryPending,
+	)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
+
+// ListDeadDeliveries возвращает недоставленные события от новых к старым, пустая подписка не ограничивает выборку
+func (r Webhook) ListDeadDeliveries(
+	ctx context.Context,
+	subscription string,
+	limit int,
+	offset int,
+) ([]entity.WebhookDelivery, error) {
+	deliveries := []entity.WebhookDelivery{}
+	query := `
+		SELECT
+			d.id, d.subscription, d.status, d.attempts, d.last_error, d.next_attempt_at, d.updated_at,
+			e.id AS event_id, e.event_type, e.category, e.filename, e.actor, e.created_at AS event_created_at
+		FROM webhook_deliveries d
+		JOIN storage_events e ON e.id = d.event_id
+		WHERE d.status = $1 AND ($2 = '' OR d.subscription = $2)
+		ORDER BY d.updated_at DESC, d.id
+		LIMIT $3 OFFSET $4
+	`
+	err := r.db.Select(ctx, &deliveries, query, entity.WebhookDeliveryDead, subscription, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return deliveries, nil
+}
+
+// RetryDeadDelivery возвращает недоставленное событие в очередь доставки
+func (r Webhook) RetryDeadDelivery(ctx context.Context, id int64, now time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = 0, next_attempt_at = $3, updated_at = $3
+		WHERE id = $1 AND status = $4
+	`
+	result, err := r.db.Exec(ctx, query, id, entity.WebhookDeliveryPending, now, entity.WebhookDeliveryDead)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithMessage(err, "rows affected")
+	}
+	if affected == 0 {
+		return domain.ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// DeleteDeliveredEvents удаляет события старше before, опубликованные в брокер и доставленные всем подпискам
+func (r Webhook) DeleteDeliveredEvents(ctx context.Context, before time.Time) error {
+	query := `
+		DELETE FROM storage_events e
+		WHERE e.created_at <= $1 AND e.published_at IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM webhook_deliveries d
+			WHERE d.event_id = e.id AND d.status <> $2
+		)
+	`
+	_, err := r.db.Exec(ctx, query, before, entity.WebhookDeliveryDelivered)
+	if err != nil {
+		return errors.WithMessagef(err, "exec query: %s", query)
+	}
+	return nil
+}
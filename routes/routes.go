@@ -4,20 +4,141 @@ import (
 	"net/http"
 
 	"storage-service/controller"
+	"storage-service/entity"
 
 	"github.com/Falokut/go-kit/cluster"
+	http2 "github.com/Falokut/go-kit/http"
 	"github.com/Falokut/go-kit/http/endpoint"
 	"github.com/Falokut/go-kit/http/router"
 )
 
 type Router struct {
-	Files controller.Files
+	Files    controller.Files
+	Trash    controller.Trash
+	Bulk     controller.Bulk
+	Category controller.Category
+	Versions controller.Versions
+	Locks    controller.Locks
+	Groups   controller.PendingGroups
+	Pending  controller.PendingAdmin
+	Refs     controller.References
+	Webhooks controller.Webhooks
+	Events   controller.EventStream
+	Audit    controller.Audit
+	Auth     controller.Auth
+	ApiKeys  controller.ApiKeys
+	Quotas   controller.Quotas
+	Limits   controller.RateLimits
+}
+
+const (
+	// PermissionExtra ключ cluster.EndpointDescriptor.Extra с разрешением, требуемым для маршрута
+	PermissionExtra = "permission"
+	// AnonymousExtra ключ cluster.EndpointDescriptor.Extra, разрешающий запрос без учётных данных к публичным файлам
+	AnonymousExtra = "anonymous"
+	// TransferExtra ключ cluster.EndpointDescriptor.Extra, отмечающий загрузку или скачивание файла
+	// для ограничения одновременных передач
+	TransferExtra = "transfer"
+)
+
+// requires разрешение вида ресурс:действие[:категория], параметры маршрута в фигурных скобках подставляются из пути запроса
+func requires(permission string) map[string]any {
+	return map[string]any{PermissionExtra: permission}
+}
+
+// requiresOrPublic как requires, но публичные файлы доступны и без разрешения
+func requiresOrPublic(permission string) map[string]any {
+	return map[string]any{PermissionExtra: permission, AnonymousExtra: true}
+}
+
+// transfer отмечает маршрут загрузки или скачивания файла
+func transfer(extra map[string]any) map[string]any {
+	extra[TransferExtra] = true
+	return extra
+}
+
+// auditActions названия действий журнала аудита, ключ - метод и путь маршрута,
+// маршрут без названия записывается под своим методом и путём, см. AuditAction
+// nolint:gochecknoglobals
+var auditActions = map[string]string{
+	http.MethodPost + " /file/:category":                                            entity.AuditFileUpload,
+	http.MethodPost + " /file/:category/:filename":                                  entity.AuditFileUpload,
+	http.MethodGet + " /file/:category/:filename":                                   entity.AuditFileDownload,
+	http.MethodDelete + " /file/:category/:filename":                                entity.AuditFileDelete,
+	http.MethodGet + " /file/:category/:filename/exist":                             entity.AuditFileExist,
+	http.MethodPost + " /file/:category/:filename/commit":                           entity.AuditFileCommit,
+	http.MethodPost + " /file/:category/:filename/rollback":                         entity.AuditFileRollback,
+	http.MethodGet + " /file/:category/:filename/pending":                           entity.AuditFilePending,
+	http.MethodPost + " /file/:category/:filename/extend":                           entity.AuditFileExtend,
+	http.MethodPost + " /file/:category/:filename/expiration":                       entity.AuditFileExpiration,
+	http.MethodPost + " /file/:category/:filename/retention":                        entity.AuditFileRetention,
+	http.MethodPost + " /file/:category/:filename/legal-hold":                       entity.AuditFileLegalHold,
+	http.MethodGet + " /file/:category/:filename/lock":                              entity.AuditFileLock,
+	http.MethodGet + " /file/:category/:filename/versions":                          entity.AuditVersionList,
+	http.MethodPost + " /file/:category/:filename/versions/:versionId/restore":      entity.AuditVersionRestore,
+	http.MethodDelete + " /file/:category/:filename/versions/:versionId":            entity.AuditVersionDelete,
+	http.MethodGet + " /file/:category/:filename/references":                        entity.AuditReferenceList,
+	http.MethodPost + " /file/:category/:filename/references":                       entity.AuditReferenceAttach,
+	http.MethodDelete + " /file/:category/:filename/references/:ownerType/:ownerId": entity.AuditReferenceDetach,
+	http.MethodGet + " /reference/:ownerType/:ownerId":                              entity.AuditReferenceOwner,
+	http.MethodGet + " /pending-group/:groupId":                                     entity.AuditGroupGet,
+	http.MethodPost + " /pending-group/:groupId/commit":                             entity.AuditGroupCommit,
+	http.MethodPost + " /pending-group/:groupId/rollback":                           entity.AuditGroupRollback,
+	http.MethodPost + " /pending-group/:groupId/extend":                             entity.AuditGroupExtend,
+	http.MethodGet + " /trash/:category":                                            entity.AuditTrashList,
+	http.MethodPost + " /trash/:category/:id/restore":                               entity.AuditTrashRestore,
+	http.MethodPost + " /bulk-delete/:category":                                     entity.AuditBulkDelete,
+	http.MethodGet + " /bulk-delete/:category/:jobId":                               entity.AuditBulkDeleteJob,
+	http.MethodGet + " /category":                                                   entity.AuditCategoryList,
+	http.MethodPost + " /category":                                                  entity.AuditCategoryCreate,
+	http.MethodGet + " /category/:name":                                             entity.AuditCategoryGet,
+	http.MethodDelete + " /category/:name":                                          entity.AuditCategoryDelete,
+	http.MethodPost + " /category/:name/force-delete":                               entity.AuditCategoryForceStart,
+	http.MethodPost + " /category/:name/force-delete/confirm":                       entity.AuditCategoryForce,
+	http.MethodGet + " /category/:name/force-delete/:jobId":                         entity.AuditCategoryForceJob,
+	http.MethodGet + " /quota/:category":                                            entity.AuditQuotaGet,
+	http.MethodGet + " /admin/quotas":                                               entity.AuditQuotaList,
+	http.MethodGet + " /admin/pending":                                              entity.AuditPendingList,
+	http.MethodGet + " /admin/pending/stats":                                        entity.AuditPendingStats,
+	http.MethodGet + " /admin/pending/dead-letters":                                 entity.AuditPendingDead,
+	http.MethodPost + " /admin/pending/expire":                                      entity.AuditPendingExpire,
+	http.MethodPost + " /admin/pending/commit":                                      entity.AuditPendingCommit,
+	http.MethodGet + " /admin/webhooks/dead-letters":                                entity.AuditWebhookDead,
+	http.MethodPost + " /admin/webhooks/dead-letters/:id/retry":                     entity.AuditWebhookRetry,
+	http.MethodGet + " /events/stream":                                              entity.AuditEventStream,
+	http.MethodGet + " /admin/audit":                                                entity.AuditList,
+	http.MethodGet + " /admin/audit/export":                                         entity.AuditExport,
+	http.MethodGet + " /admin/api-keys":                                             entity.AuditApiKeyList,
+	http.MethodPost + " /admin/api-keys":                                            entity.AuditApiKeyCreate,
+	http.MethodPost + " /admin/api-keys/:id/rotate":                                 entity.AuditApiKeyRotate,
+	http.MethodDelete + " /admin/api-keys/:id":                                      entity.AuditApiKeyRevoke,
+}
+
+// AuditAction действие журнала аудита для маршрута, все маршруты записываются в журнал,
+// для маршрута без названия действием считаются его метод и путь
+func AuditAction(method string, path string) string {
+	action, ok := auditActions[method+" "+path]
+	if ok {
+		return action
+	}
+	return method + " " + path
 }
 
 func (r Router) Handler(wrapper endpoint.Wrapper) *router.Router {
 	mux := router.New()
 	for _, desc := range EndpointDescriptors(r) {
-		mux.Handler(desc.HttpMethod, desc.Path, wrapper.Endpoint(desc.Handler))
+		middlewares := []http2.Middleware{r.Audit.Middleware(AuditAction(desc.HttpMethod, desc.Path), desc.Path)}
+		// проверка прав после аудита, чтобы отклонённые запросы тоже попадали в журнал
+		if desc.UserAuthRequired {
+			permission, _ := desc.Extra[PermissionExtra].(string)
+			anonymous, _ := desc.Extra[AnonymousExtra].(bool)
+			middlewares = append(middlewares, r.Auth.Middleware(permission, desc.Path, anonymous))
+		}
+		// лимиты после проверки прав, чтобы клиент определялся по проверенным учётным данным
+		isTransfer, _ := desc.Extra[TransferExtra].(bool)
+		middlewares = append(middlewares, r.Limits.Middleware(desc.HttpMethod+" "+desc.Path, isTransfer))
+		endpointWrapper := wrapper.WithMiddlewares(middlewares...)
+		mux.Handler(desc.HttpMethod, desc.Path, endpointWrapper.Endpoint(desc.Handler))
 	}
 
 	return mux
@@ -26,39 +147,361 @@ func (r Router) Handler(wrapper endpoint.Wrapper) *router.Router {
 func EndpointDescriptors(r Router) []cluster.EndpointDescriptor {
 	return []cluster.EndpointDescriptor{
 		{
-			HttpMethod: http.MethodPost,
-			Path:       "/file/:category",
-			Handler:    r.Files.UploadFile,
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category",
+			UserAuthRequired: true,
+			Extra:            transfer(requires("files:write:{category}")),
+			Handler:          r.Files.UploadFile,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename",
+			UserAuthRequired: true,
+			Extra:            transfer(requires("files:write:{category}")),
+			Handler:          r.Files.UploadFile,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename",
+			UserAuthRequired: true,
+			Extra:            transfer(requiresOrPublic("files:read:{category}")),
+			Handler:          r.Files.GetFile,
+		},
+		{
+			HttpMethod:       http.MethodDelete,
+			Path:             "/file/:category/:filename",
+			UserAuthRequired: true,
+			Extra:            requires("files:delete:{category}"),
+			Handler:          r.Files.DeleteFile,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename/exist",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Files.IsFileExist,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/commit",
+			UserAuthRequired: true,
+			Extra:            requires("files:commit:{category}"),
+			Handler:          r.Files.Commit,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/rollback",
+			UserAuthRequired: true,
+			Extra:            requires("files:commit:{category}"),
+			Handler:          r.Files.Rollback,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename/pending",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Files.GetPending,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/extend",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Files.ExtendPending,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/pending",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Pending.List,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/pending/stats",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Pending.Stats,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/pending/dead-letters",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Pending.DeadLetters,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/admin/pending/expire",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Pending.Expire,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/admin/pending/commit",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Pending.Commit,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/webhooks/dead-letters",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Webhooks.DeadLetters,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/admin/webhooks/dead-letters/:id/retry",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Webhooks.Retry,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/audit",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Audit.List,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/audit/export",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Audit.Export,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/admin/api-keys",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.ApiKeys.Create,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/api-keys",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.ApiKeys.List,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/admin/api-keys/:id/rotate",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.ApiKeys.Rotate,
+		},
+		{
+			HttpMethod:       http.MethodDelete,
+			Path:             "/admin/api-keys/:id",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.ApiKeys.Revoke,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/admin/quotas",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Quotas.List,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/quota/:category",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Quotas.Get,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/events/stream",
+			UserAuthRequired: true,
+			Extra:            requires(entity.PermissionAdmin),
+			Handler:          r.Events.Stream,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/pending-group/:groupId",
+			UserAuthRequired: true,
+			Extra:            requires("groups:read"),
+			Handler:          r.Groups.Get,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/pending-group/:groupId/commit",
+			UserAuthRequired: true,
+			Extra:            requires("groups:commit"),
+			Handler:          r.Groups.Commit,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/pending-group/:groupId/rollback",
+			UserAuthRequired: true,
+			Extra:            requires("groups:commit"),
+			Handler:          r.Groups.Rollback,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/pending-group/:groupId/extend",
+			UserAuthRequired: true,
+			Extra:            requires("groups:write"),
+			Handler:          r.Groups.Extend,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/expiration",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Files.SetExpiration,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename/versions",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Versions.List,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/versions/:versionId/restore",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Versions.Restore,
+		},
+		{
+			HttpMethod:       http.MethodDelete,
+			Path:             "/file/:category/:filename/versions/:versionId",
+			UserAuthRequired: true,
+			Extra:            requires("files:delete:{category}"),
+			Handler:          r.Versions.Delete,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename/references",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Refs.FileReferences,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/references",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Refs.Attach,
+		},
+		{
+			HttpMethod:       http.MethodDelete,
+			Path:             "/file/:category/:filename/references/:ownerType/:ownerId",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Refs.Detach,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/reference/:ownerType/:ownerId",
+			UserAuthRequired: true,
+			Extra:            requires("references:read"),
+			Handler:          r.Refs.OwnerReferences,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/file/:category/:filename/lock",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Locks.Get,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/retention",
+			UserAuthRequired: true,
+			Extra:            requires("files:lock:{category}"),
+			Handler:          r.Locks.SetRetention,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/file/:category/:filename/legal-hold",
+			UserAuthRequired: true,
+			Extra:            requires("files:lock:{category}"),
+			Handler:          r.Locks.SetLegalHold,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/trash/:category",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Trash.List,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/trash/:category/:id/restore",
+			UserAuthRequired: true,
+			Extra:            requires("files:write:{category}"),
+			Handler:          r.Trash.Restore,
+		},
+		{
+			HttpMethod:       http.MethodPost,
+			Path:             "/bulk-delete/:category",
+			UserAuthRequired: true,
+			Extra:            requires("files:delete:{category}"),
+			Handler:          r.Bulk.Delete,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/bulk-delete/:category/:jobId",
+			UserAuthRequired: true,
+			Extra:            requires("files:read:{category}"),
+			Handler:          r.Bulk.GetJob,
+		},
+		{
+			HttpMethod:       http.MethodGet,
+			Path:             "/category",
+			UserAuthRequired: true,
+			Extra:            requires("categories:read"),
+			Handler:          r.Category.List,
 		},
 		{
-			HttpMethod: http.MethodPost,
-			Path:       "/file/:category/:filename",
-			Handler:    r.Files.UploadFile,
+			HttpMethod:       http.MethodPost,
+			Path:             "/category",
+			UserAuthRequired: true,
+			Extra:            requires("categories:write"),
+			Handler:          r.Category.Create,
 		},
 		{
-			HttpMethod: http.MethodGet,
-			Path:       "/file/:category/:filename",
-			Handler:    r.Files.GetFile,
+			HttpMethod:       http.MethodGet,
+			Path:             "/category/:name",
+			UserAuthRequired: true,
+			Extra:            requires("categories:read"),
+			Handler:          r.Category.Get,
 		},
 		{
-			HttpMethod: http.MethodDelete,
-			Path:       "/file/:category/:filename",
-			Handler:    r.Files.DeleteFile,
+			HttpMethod:       http.MethodDelete,
+			Path:             "/category/:name",
+			UserAuthRequired: true,
+			Extra:            requires("categories:write"),
+			Handler:          r.Category.Delete,
 		},
 		{
-			HttpMethod: http.MethodGet,
-			Path:       "/file/:category/:filename/exist",
-			Handler:    r.Files.IsFileExist,
+			HttpMethod:       http.MethodPost,
+			Path:             "/category/:name/force-delete",
+			UserAuthRequired: true,
+			Extra:            requires("categories:write"),
+			Handler:          r.Category.RequestForceDelete,
 		},
 		{
-			HttpMethod: http.MethodPost,
-			Path:       "/file/:category/:filename/commit",
-			Handler:    r.Files.Commit,
+			HttpMethod:       http.MethodPost,
+			Path:             "/category/:name/force-delete/confirm",
+			UserAuthRequired: true,
+			Extra:            requires("categories:write"),
+			Handler:          r.Category.ForceDelete,
 		},
 		{
-			HttpMethod: http.MethodPost,
-			Path:       "/file/:category/:filename/rollback",
-			Handler:    r.Files.Rollback,
+			HttpMethod:       http.MethodGet,
+			Path:             "/category/:name/force-delete/:jobId",
+			UserAuthRequired: true,
+			Extra:            requires("categories:read"),
+			Handler:          r.Category.GetDeleteJob,
 		},
 	}
 }
@@ -0,0 +1,18 @@
+package routes_test
+
+import (
+	"testing"
+
+	"storage-service/routes"
+)
+
+func TestEveryRouteHasAuditAction(t *testing.T) {
+	t.Parallel()
+
+	for _, desc := range routes.EndpointDescriptors(routes.Router{}) {
+		action := routes.AuditAction(desc.HttpMethod, desc.Path)
+		if action == desc.HttpMethod+" "+desc.Path {
+			t.Errorf("route %s %s has no audit action name", desc.HttpMethod, desc.Path)
+		}
+	}
+}
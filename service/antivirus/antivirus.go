@@ -0,0 +1,307 @@
+package antivirus
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/http/types"
+	"github.com/Falokut/go-kit/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// IsolatedPrefix изолированные заражённые объекты хранятся в бакете категории под этим префиксом
+const IsolatedPrefix = ".infected/"
+
+const (
+	defaultScanTimeout = 10 * time.Minute
+	defaultRetryDelay  = time.Minute
+	defaultBatchSize   = 10
+)
+
+type Scanner interface {
+	Scan(ctx context.Context, reader io.Reader) (*entity.ScanResult, error)
+}
+
+type ScanRepo interface {
+	UpsertScan(ctx context.Context, scan entity.FileScan) error
+	GetScan(ctx context.Context, scanId string) (*entity.FileScan, error)
+	GetScanStatus(ctx context.Context, category string, objectKey string) (string, error)
+	ClaimScans(ctx context.Context, now time.Time, leaseUntil time.Time, limit int) ([]entity.FileScan, error)
+	RescheduleScan(ctx context.Context, scanId string, nextScanAt time.Time, now time.Time) error
+	RecordScanFailure(ctx context.Context, scanId string, errText string, nextScanAt time.Time, now time.Time) error
+	MarkScanInfected(ctx context.Context, scanId string, signature string, now time.Time) error
+	DeleteScan(ctx context.Context, scanId string) (bool, error)
+}
+
+type FileRepo interface {
+	GetFile(
+		ctx context.Context,
+		filename string,
+		category string,
+		opt *types.RangeOption,
+	) (*entity.Metadata, io.ReadSeekCloser, error)
+	MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
+	DeleteFile(ctx context.Context, filename string, category string) error
+}
+
+type CategorySettings interface {
+	Settings(ctx context.Context, category string) (entity.CategorySettings, error)
+}
+
+type Events interface {
+	InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error)
+}
+
+type Config struct {
+	// ScanTimeout ограничение одной проверки, на это время проверка закрепляется за экземпляром сервиса
+	ScanTimeout time.Duration
+	// RetryDelay через сколько повторить неудачную проверку
+	RetryDelay time.Duration
+	BatchSize  int
+}
+
+// Antivirus держит новые файлы на карантине до проверки: GetFile отказывает в выдаче объекта,
+// пока проверка не завершена, заражённые файлы удаляются или изолируются в зависимости от настройки категории
+type Antivirus struct {
+	scanner    Scanner
+	repo       ScanRepo
+	files      FileRepo
+	categories CategorySettings
+	eventRepo  Events
+	logger     log.Logger
+	cfg        Config
+}
+
+// NewAntivirus при scanner == nil файлы остаются на карантине, пока сканер не будет настроен
+func NewAntivirus(
+	scanner Scanner,
+	repo ScanRepo,
+	files FileRepo,
+	categories CategorySettings,
+	eventRepo Events,
+	logger log.Logger,
+	cfg Config,
+) Antivirus {
+	if cfg.ScanTimeout <= 0 {
+		cfg.ScanTimeout = defaultScanTimeout
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	return Antivirus{
+		scanner:    scanner,
+		repo:       repo,
+		files:      files,
+		categories: categories,
+		eventRepo:  eventRepo,
+		logger:     logger,
+		cfg:        cfg,
+	}
+}
+
+// Quarantine ставит объект на карантин до записи в хранилище и возвращает идентификатор проверки.
+// Объект синхронной проверки воркер не берёт, пока не истечёт ScanTimeout
+func (s Antivirus) Quarantine(ctx context.Context, category string, objectKey string, filename string, mode string) (string, error) {
+	now := time.Now().UTC()
+	nextScanAt := now
+	if mode == entity.ScanModeSync {
+		nextScanAt = now.Add(s.cfg.ScanTimeout)
+	}
+	scan := entity.FileScan{
+		ScanId:     uuid.NewString(),
+		Category:   category,
+		ObjectKey:  objectKey,
+		Filename:   filename,
+		Status:     entity.ScanStatusPending,
+		NextScanAt: nextScanAt,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	err := s.repo.UpsertScan(ctx, scan)
+	if err != nil {
+		return "", errors.WithMessage(err, "upsert scan")
+	}
+	return scan.ScanId, nil
+}
+
+// Defer передаёт проверку воркеру, например, если синхронная проверка не удалась
+func (s Antivirus) Defer(ctx context.Context, scanId string) error {
+	now := time.Now().UTC()
+	err := s.repo.RescheduleScan(ctx, scanId, now, now)
+	if err != nil {
+		return errors.WithMessage(err, "reschedule scan")
+	}
+	return nil
+}
+
+// Scan синхронно проверяет объект, поставленный на карантин,
+// заражённый объект удаляется или изолируется до возврата результата
+func (s Antivirus) Scan(ctx context.Context, scanId string) (*entity.ScanResult, error) {
+	scan, err := s.repo.GetScan(ctx, scanId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get scan")
+	}
+	if scan == nil {
+		// объект уже перезаписан или удалён
+		return &entity.ScanResult{}, nil
+	}
+	return s.scan(ctx, *scan, false)
+}
+
+// CheckAccess возвращает domain.ErrFileQuarantined для непроверенного объекта
+// и domain.ErrFileInfected для заражённого, который не удалось удалить
+func (s Antivirus) CheckAccess(ctx context.Context, category string, objectKey string) error {
+	status, err := s.repo.GetScanStatus(ctx, category, objectKey)
+	if err != nil {
+		return errors.WithMessage(err, "get scan status")
+	}
+	switch status {
+	case entity.ScanStatusPending:
+		return domain.ErrFileQuarantined
+	case entity.ScanStatusInfected:
+		return domain.ErrFileInfected
+	default:
+		return nil
+	}
+}
+
+// ProcessScans проверяет объекты, ожидающие асинхронной проверки, возвращает true, если выбрана полная пачка.
+// Неудачная проверка повторяется через RetryDelay, объект остаётся на карантине
+func (s Antivirus) ProcessScans(ctx context.Context) (bool, error) {
+	now := time.Now().UTC()
+	scans, err := s.repo.ClaimScans(ctx, now, now.Add(s.cfg.ScanTimeout), s.cfg.BatchSize)
+	if err != nil {
+		return false, errors.WithMessage(err, "claim scans")
+	}
+	for _, scan := range scans {
+		scanCtx, cancel := context.WithTimeout(ctx, s.cfg.ScanTimeout)
+		_, err := s.scan(scanCtx, scan, true)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		s.logger.Error(
+			ctx,
+			"antivirus: scan file",
+			log.String("category", scan.Category),
+			log.String("filename", scan.Filename),
+			log.Any("error", err),
+		)
+		now := time.Now().UTC()
+		err = s.repo.RecordScanFailure(ctx, scan.ScanId, err.Error(), now.Add(s.cfg.RetryDelay), now)
+		if err != nil {
+			return false, errors.WithMessage(err, "record scan failure")
+		}
+	}
+	return len(scans) == s.cfg.BatchSize, nil
+}
+
+// scan при notify снятие с карантина отмечается событием scanned, синхронная проверка его не записывает,
+// так как файл не был доступен до проверки
+func (s Antivirus) scan(ctx context.Context, scan entity.FileScan, notify bool) (*entity.ScanResult, error) {
+	if s.scanner == nil {
+		return nil, errors.New("antivirus scanner is not configured")
+	}
+
+	_, reader, err := s.files.GetFile(ctx, scan.ObjectKey, scan.Category, nil)
+	if errors.Is(err, domain.ErrFileNotFound) {
+		return s.forget(ctx, scan)
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "get file")
+	}
+	result, err := s.scanner.Scan(ctx, reader)
+	_ = reader.Close()
+	if err != nil {
+		return nil, errors.WithMessage(err, "scan")
+	}
+
+	if result.Infected {
+		err = s.handleInfected(ctx, scan, result.Signature)
+		if err != nil {
+			return nil, errors.WithMessage(err, "handle infected file")
+		}
+		return result, nil
+	}
+
+	// проверка, заменённая новой загрузкой, не снимает с карантина новое содержимое
+	released, err := s.repo.DeleteScan(ctx, scan.ScanId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete scan")
+	}
+	if released && notify {
+		s.recordEvent(ctx, entity.NewStorageEvent(entity.EventScanned, scan.Filename, scan.Category, ""))
+	}
+	return result, nil
+}
+
+// forget удаляет проверку объекта, удалённого до её завершения
+func (s Antivirus) forget(ctx context.Context, scan entity.FileScan) (*entity.ScanResult, error) {
+	current, err := s.repo.GetScan(ctx, scan.ScanId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get scan")
+	}
+	if current == nil {
+		return &entity.ScanResult{}, nil
+	}
+	if current.ObjectKey != scan.ObjectKey {
+		// объект перенесён во время проверки, например, при подтверждении загрузки
+		return nil, errors.Errorf("object moved to '%s' during scan", current.ObjectKey)
+	}
+	_, err = s.repo.DeleteScan(ctx, scan.ScanId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete scan")
+	}
+	return &entity.ScanResult{}, nil
+}
+
+// handleInfected сначала отмечает объект заражённым, чтобы он не выдавался, даже если удалить его не получится,
+// например, из-за блокировки от удаления
+func (s Antivirus) handleInfected(ctx context.Context, scan entity.FileScan, signature string) error {
+	err := s.repo.MarkScanInfected(ctx, scan.ScanId, signature, time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "mark scan infected")
+	}
+	current, err := s.repo.GetScan(ctx, scan.ScanId)
+	if err != nil {
+		return errors.WithMessage(err, "get scan")
+	}
+	if current == nil {
+		return nil
+	}
+	s.recordEvent(ctx, entity.NewStorageEvent(entity.EventInfected, scan.Filename, scan.Category, ""))
+
+	settings, err := s.categories.Settings(ctx, scan.Category)
+	if err != nil {
+		return errors.WithMessage(err, "get category settings")
+	}
+	if settings.InfectedAction == entity.InfectedActionIsolate {
+		err = s.files.MoveFile(ctx, scan.Category, current.ObjectKey, IsolatedPrefix+scan.ScanId)
+		if err != nil {
+			return errors.WithMessage(err, "isolate file")
+		}
+		return nil
+	}
+	err = s.files.DeleteFile(ctx, current.ObjectKey, scan.Category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return errors.WithMessage(err, "delete file")
+	}
+	return nil
+}
+
+// recordEvent событие публикует воркер outbox
+func (s Antivirus) recordEvent(ctx context.Context, event entity.StorageEvent) {
+	_, err := s.eventRepo.InsertEvent(ctx, event)
+	if err != nil {
+		s.logger.Error(ctx, "antivirus: insert event", log.String("type", event.Type), log.Any("error", err))
+	}
+}
@@ -0,0 +1,313 @@
+package antivirus_test
+
+import (
+	"context"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/antivirus"
+
+	"github.com/Falokut/go-kit/http/types"
+	"github.com/Falokut/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// scanRepo проверки по идентификатору, новая проверка объекта заменяет прежнюю
+type scanRepo struct {
+	scans map[string]entity.FileScan
+}
+
+func (r *scanRepo) UpsertScan(_ context.Context, scan entity.FileScan) error {
+	for scanId, other := range r.scans {
+		if other.Category == scan.Category && other.ObjectKey == scan.ObjectKey {
+			delete(r.scans, scanId)
+		}
+	}
+	r.scans[scan.ScanId] = scan
+	return nil
+}
+
+func (r *scanRepo) GetScan(_ context.Context, scanId string) (*entity.FileScan, error) {
+	scan, ok := r.scans[scanId]
+	if !ok {
+		return nil, nil // nolint:nilnil
+	}
+	return &scan, nil
+}
+
+func (r *scanRepo) GetScanStatus(_ context.Context, category string, objectKey string) (string, error) {
+	for _, scan := range r.scans {
+		if scan.Category == category && scan.ObjectKey == objectKey {
+			return scan.Status, nil
+		}
+	}
+	return "", nil
+}
+
+func (r *scanRepo) ClaimScans(_ context.Context, now time.Time, leaseUntil time.Time, limit int) ([]entity.FileScan, error) {
+	claimed := make([]entity.FileScan, 0)
+	for scanId, scan := range r.scans {
+		if len(claimed) == limit || scan.Status != entity.ScanStatusPending || scan.NextScanAt.After(now) {
+			continue
+		}
+		scan.NextScanAt = leaseUntil
+		r.scans[scanId] = scan
+		claimed = append(claimed, scan)
+	}
+	return claimed, nil
+}
+
+func (r *scanRepo) RescheduleScan(_ context.Context, scanId string, nextScanAt time.Time, _ time.Time) error {
+	scan := r.scans[scanId]
+	scan.NextScanAt = nextScanAt
+	r.scans[scanId] = scan
+	return nil
+}
+
+func (r *scanRepo) RecordScanFailure(_ context.Context, scanId string, errText string, nextScanAt time.Time, _ time.Time) error {
+	scan := r.scans[scanId]
+	scan.Attempts++
+	scan.LastError = errText
+	scan.NextScanAt = nextScanAt
+	r.scans[scanId] = scan
+	return nil
+}
+
+func (r *scanRepo) MarkScanInfected(_ context.Context, scanId string, signature string, _ time.Time) error {
+	scan, ok := r.scans[scanId]
+	if ok {
+		scan.Status = entity.ScanStatusInfected
+		scan.Signature = signature
+		r.scans[scanId] = scan
+	}
+	return nil
+}
+
+func (r *scanRepo) DeleteScan(_ context.Context, scanId string) (bool, error) {
+	_, ok := r.scans[scanId]
+	delete(r.scans, scanId)
+	return ok, nil
+}
+
+// storage объекты бакета: ключ - содержимое
+type storage struct {
+	objects map[string]string
+}
+
+func (s *storage) GetFile(
+	_ context.Context,
+	filename string,
+	_ string,
+	_ *types.RangeOption,
+) (*entity.Metadata, io.ReadSeekCloser, error) {
+	content, ok := s.objects[filename]
+	if !ok {
+		return nil, nil, domain.ErrFileNotFound
+	}
+	return &entity.Metadata{Filename: filename}, readSeekCloser{strings.NewReader(content)}, nil
+}
+
+func (s *storage) MoveFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	content, ok := s.objects[srcFilename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	s.objects[dstFilename] = content
+	delete(s.objects, srcFilename)
+	return nil
+}
+
+func (s *storage) DeleteFile(_ context.Context, filename string, _ string) error {
+	delete(s.objects, filename)
+	return nil
+}
+
+type readSeekCloser struct {
+	*strings.Reader
+}
+
+func (readSeekCloser) Close() error {
+	return nil
+}
+
+// scanner находит заражённое содержимое по слову virus
+type scanner struct{}
+
+func (scanner) Scan(_ context.Context, reader io.Reader) (*entity.ScanResult, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(string(content), "virus") {
+		return &entity.ScanResult{Infected: true, Signature: "Test.Virus"}, nil
+	}
+	return &entity.ScanResult{}, nil
+}
+
+type settings string
+
+func (s settings) Settings(context.Context, string) (entity.CategorySettings, error) {
+	return entity.CategorySettings{ScanMode: entity.ScanModeAsync, InfectedAction: string(s)}, nil
+}
+
+type events struct {
+	types []string
+}
+
+func (e *events) InsertEvent(_ context.Context, event entity.StorageEvent) (int64, error) {
+	e.types = append(e.types, event.Type)
+	return int64(len(e.types)), nil
+}
+
+func newAntivirus(repo *scanRepo, storage *storage, infectedAction string, events *events) antivirus.Antivirus {
+	var logger log.Logger
+	return antivirus.NewAntivirus(scanner{}, repo, storage, settings(infectedAction), events, logger, antivirus.Config{})
+}
+
+func TestQuarantineUntilScanned(t *testing.T) {
+	t.Parallel()
+
+	repo := &scanRepo{scans: map[string]entity.FileScan{}}
+	storage := &storage{objects: map[string]string{"a.txt": "clean"}}
+	events := &events{}
+	service := newAntivirus(repo, storage, "", events)
+
+	_, err := service.Quarantine(t.Context(), "docs", "a.txt", "a.txt", entity.ScanModeAsync)
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	err = service.CheckAccess(t.Context(), "docs", "a.txt")
+	if !errors.Is(err, domain.ErrFileQuarantined) {
+		t.Fatalf("expected quarantined error before scan, got %v", err)
+	}
+
+	_, err = service.ProcessScans(t.Context())
+	if err != nil {
+		t.Fatalf("process scans: %v", err)
+	}
+	err = service.CheckAccess(t.Context(), "docs", "a.txt")
+	if err != nil {
+		t.Fatalf("expected clean file to be released, got %v", err)
+	}
+	if len(repo.scans) != 0 {
+		t.Fatalf("scan of clean file must be deleted, got %v", repo.scans)
+	}
+	if len(events.types) != 1 || events.types[0] != entity.EventScanned {
+		t.Fatalf("expected scanned event, got %v", events.types)
+	}
+}
+
+func TestSyncScanIsNotClaimedByWorker(t *testing.T) {
+	t.Parallel()
+
+	repo := &scanRepo{scans: map[string]entity.FileScan{}}
+	storage := &storage{objects: map[string]string{"a.txt": "clean"}}
+	events := &events{}
+	service := newAntivirus(repo, storage, "", events)
+
+	scanId, err := service.Quarantine(t.Context(), "docs", "a.txt", "a.txt", entity.ScanModeSync)
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	_, err = service.ProcessScans(t.Context())
+	if err != nil {
+		t.Fatalf("process scans: %v", err)
+	}
+	if _, ok := repo.scans[scanId]; !ok {
+		t.Fatal("worker must not take scan while it is checked synchronously")
+	}
+
+	result, err := service.Scan(t.Context(), scanId)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if result.Infected {
+		t.Fatal("expected clean result")
+	}
+	if len(repo.scans) != 0 || len(events.types) != 0 {
+		t.Fatalf("expected file to be released without event, got %v and %v", repo.scans, events.types)
+	}
+}
+
+func TestInfectedFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		infectedAction string
+		expected       func(scanId string) map[string]string
+	}{
+		{
+			name:     "deleted by default",
+			expected: func(string) map[string]string { return map[string]string{} },
+		},
+		{
+			name:           "isolated",
+			infectedAction: entity.InfectedActionIsolate,
+			expected: func(scanId string) map[string]string {
+				return map[string]string{antivirus.IsolatedPrefix + scanId: "virus"}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := &scanRepo{scans: map[string]entity.FileScan{}}
+			storage := &storage{objects: map[string]string{"a.txt": "virus"}}
+			events := &events{}
+			service := newAntivirus(repo, storage, test.infectedAction, events)
+
+			scanId, err := service.Quarantine(t.Context(), "docs", "a.txt", "a.txt", entity.ScanModeAsync)
+			if err != nil {
+				t.Fatalf("quarantine: %v", err)
+			}
+			_, err = service.ProcessScans(t.Context())
+			if err != nil {
+				t.Fatalf("process scans: %v", err)
+			}
+
+			expected := test.expected(scanId)
+			if !maps.Equal(storage.objects, expected) {
+				t.Fatalf("expected %v, got %v", expected, storage.objects)
+			}
+			if repo.scans[scanId].Status != entity.ScanStatusInfected || repo.scans[scanId].Signature != "Test.Virus" {
+				t.Fatalf("expected scan to be marked infected, got %v", repo.scans[scanId])
+			}
+			if len(events.types) != 1 || events.types[0] != entity.EventInfected {
+				t.Fatalf("expected infected event, got %v", events.types)
+			}
+		})
+	}
+}
+
+func TestForgetDeletedFile(t *testing.T) {
+	t.Parallel()
+
+	repo := &scanRepo{scans: map[string]entity.FileScan{}}
+	storage := &storage{objects: map[string]string{"a.txt": "clean"}}
+	events := &events{}
+	service := newAntivirus(repo, storage, "", events)
+
+	_, err := service.Quarantine(t.Context(), "docs", "a.txt", "a.txt", entity.ScanModeAsync)
+	if err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	delete(storage.objects, "a.txt")
+
+	_, err = service.ProcessScans(t.Context())
+	if err != nil {
+		t.Fatalf("process scans: %v", err)
+	}
+	if len(repo.scans) != 0 {
+		t.Fatalf("scan of deleted file must be forgotten, got %v", repo.scans)
+	}
+	if len(events.types) != 0 {
+		t.Fatalf("deleted file must not be reported as scanned, got %v", events.types)
+	}
+}
@@ -0,0 +1,180 @@
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultNetwork   = "tcp"
+	defaultTimeout   = 30 * time.Second
+	defaultChunkSize = 64 * 1024
+
+	instreamCommand = "zINSTREAM\x00"
+	responseClean   = "OK"
+	infectedSuffix  = " FOUND"
+	errorSuffix     = " ERROR"
+)
+
+type ClamdConfig struct {
+	// Network tcp или unix
+	Network string
+	// Address host:port или путь к unix сокету
+	Address string
+	// Timeout ограничение каждой операции с сокетом, а не всей проверки, чтобы не прерывать проверку больших файлов
+	Timeout   time.Duration
+	ChunkSize int
+}
+
+// Clamd проверяет содержимое командой INSTREAM протокола clamd,
+// размер проверяемого потока ограничивается настройкой StreamMaxLength clamd
+type Clamd struct {
+	cfg ClamdConfig
+}
+
+func NewClamd(cfg ClamdConfig) Clamd {
+	if cfg.Network == "" {
+		cfg.Network = defaultNetwork
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = defaultChunkSize
+	}
+	return Clamd{
+		cfg: cfg,
+	}
+}
+
+func (c Clamd) Scan(ctx context.Context, reader io.Reader) (*entity.ScanResult, error) {
+	dialer := net.Dialer{Timeout: c.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, c.cfg.Network, c.cfg.Address)
+	if err != nil {
+		return nil, errors.WithMessage(err, "dial clamd")
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+
+	contentErr, writeErr := c.stream(conn, reader)
+	if contentErr != nil {
+		return nil, errors.WithMessage(contentErr, "read content")
+	}
+	// при превышении StreamMaxLength clamd отвечает ошибкой и закрывает соединение, не дочитав поток,
+	// поэтому ответ читается и после ошибки записи
+	line, err := c.response(conn)
+	if err != nil {
+		if writeErr != nil {
+			return nil, errors.WithMessage(writeErr, "stream to clamd")
+		}
+		return nil, err
+	}
+	result, err := parseResponse(line)
+	if err != nil {
+		return nil, err
+	}
+	// ответ о непереданном до конца потоке подтверждает только заражение
+	if writeErr != nil && !result.Infected {
+		return nil, errors.WithMessage(writeErr, "stream to clamd")
+	}
+	return result, nil
+}
+
+// stream передаёт содержимое чанками, contentErr - ошибка чтения содержимого, writeErr - ошибка записи в сокет
+func (c Clamd) stream(conn net.Conn, reader io.Reader) (contentErr error, writeErr error) {
+	err := c.write(conn, []byte(instreamCommand))
+	if err != nil {
+		return nil, errors.WithMessage(err, "write command")
+	}
+
+	chunk := make([]byte, 4+c.cfg.ChunkSize) // nolint:mnd
+	for {
+		n, readErr := io.ReadFull(reader, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n)) // nolint:gosec
+			err = c.write(conn, chunk[:4+n])
+			if err != nil {
+				return nil, errors.WithMessage(err, "write chunk")
+			}
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr, nil
+		}
+	}
+
+	// поток завершается чанком нулевой длины
+	err = c.write(conn, make([]byte, 4)) // nolint:mnd
+	if err != nil {
+		return nil, errors.WithMessage(err, "write end of stream")
+	}
+	return nil, nil
+}
+
+func (c Clamd) write(conn net.Conn, data []byte) error {
+	err := c.deadline(conn)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(data)
+	return err
+}
+
+func (c Clamd) response(conn net.Conn) (string, error) {
+	err := c.deadline(conn)
+	if err != nil {
+		return "", err
+	}
+	line, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && line == "" {
+		return "", errors.WithMessage(err, "read clamd response")
+	}
+	return line, nil
+}
+
+func (c Clamd) deadline(conn net.Conn) error {
+	if c.cfg.Timeout <= 0 {
+		return nil
+	}
+	err := conn.SetDeadline(time.Now().Add(c.cfg.Timeout))
+	if err != nil {
+		return errors.WithMessage(err, "set deadline")
+	}
+	return nil
+}
+
+// parseResponse разбирает ответ вида "stream: OK", "stream: <сигнатура> FOUND" или "<причина> ERROR"
+func parseResponse(line string) (*entity.ScanResult, error) {
+	line = strings.TrimSpace(strings.TrimRight(line, "\x00"))
+	_, result, found := strings.Cut(line, ": ")
+	if !found {
+		result = line
+	}
+	switch {
+	case result == responseClean:
+		return &entity.ScanResult{}, nil
+	case strings.HasSuffix(result, infectedSuffix):
+		return &entity.ScanResult{
+			Infected:  true,
+			Signature: strings.TrimSuffix(result, infectedSuffix),
+		}, nil
+	case strings.HasSuffix(result, errorSuffix):
+		return nil, errors.Errorf("clamd error: %s", strings.TrimSuffix(result, errorSuffix))
+	default:
+		return nil, errors.Errorf("unexpected clamd response: %s", line)
+	}
+}
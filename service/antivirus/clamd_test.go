@@ -0,0 +1,155 @@
+package antivirus_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/service/antivirus"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd отвечает на INSTREAM как clamd: находит сигнатуру EICAR и ограничивает размер потока maxStream байтами
+func fakeClamd(t *testing.T, network string, address string, maxStream int) string {
+	t.Helper()
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxStream)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxStream int) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	content := bytes.Buffer{}
+	for {
+		size := make([]byte, 4)
+		_, err = io.ReadFull(reader, size)
+		if err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if content.Len()+int(n) > maxStream {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		_, err = io.CopyN(&content, reader, int64(n))
+		if err != nil {
+			return
+		}
+	}
+
+	if strings.Contains(content.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamdScan(t *testing.T) {
+	t.Parallel()
+
+	address := fakeClamd(t, "tcp", "127.0.0.1:0", 1024*1024)
+	clamd := antivirus.NewClamd(antivirus.ClamdConfig{
+		Network:   "tcp",
+		Address:   address,
+		Timeout:   time.Second,
+		ChunkSize: 16,
+	})
+
+	result, err := clamd.Scan(context.Background(), strings.NewReader(strings.Repeat("clean content ", 100)))
+	if err != nil || result.Infected {
+		t.Fatalf("expected clean result, got %+v, %v", result, err)
+	}
+
+	result, err = clamd.Scan(context.Background(), strings.NewReader("prefix "+eicar))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("expected infected result, got %+v, %v", result, err)
+	}
+
+	result, err = clamd.Scan(context.Background(), strings.NewReader(""))
+	if err != nil || result.Infected {
+		t.Fatalf("expected empty stream to be clean, got %+v, %v", result, err)
+	}
+}
+
+func TestClamdUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	fakeClamd(t, "unix", socket, 1024*1024)
+	clamd := antivirus.NewClamd(antivirus.ClamdConfig{
+		Network: "unix",
+		Address: socket,
+		Timeout: time.Second,
+	})
+
+	result, err := clamd.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil || !result.Infected {
+		t.Fatalf("expected infected result, got %+v, %v", result, err)
+	}
+}
+
+func TestClamdStreamLimit(t *testing.T) {
+	t.Parallel()
+
+	address := fakeClamd(t, "tcp", "127.0.0.1:0", 64)
+	clamd := antivirus.NewClamd(antivirus.ClamdConfig{
+		Network:   "tcp",
+		Address:   address,
+		Timeout:   time.Second,
+		ChunkSize: 32,
+	})
+
+	_, err := clamd.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 1024*1024)))
+	if err == nil {
+		t.Fatal("expected stream limit error")
+	}
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	t.Parallel()
+
+	clamd := antivirus.NewClamd(antivirus.ClamdConfig{
+		Network: "unix",
+		Address: filepath.Join(t.TempDir(), "missing.sock"),
+		Timeout: time.Second,
+	})
+	_, err := clamd.Scan(context.Background(), strings.NewReader("content"))
+	if err == nil {
+		t.Fatal("expected dial error")
+	}
+}
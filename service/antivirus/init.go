@@ -0,0 +1,23 @@
+package antivirus
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const WorkerQueueName = "file_scans"
+
+func EnqueueSeedJob(ctx context.Context, client *bgjob.Client) error {
+	err := client.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    "file_scans",
+		Queue: WorkerQueueName,
+		Type:  "file_scans",
+	})
+	if err != nil && !errors.Is(err, bgjob.ErrJobAlreadyExist) {
+		return errors.WithMessage(err, "enqueue job")
+	}
+
+	return nil
+}
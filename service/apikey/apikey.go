@@ -0,0 +1,226 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/netip"
+	"strings"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	secretSize = 32
+	// keySeparator разделяет идентификатор и секрет в ключе вида <id>.<secret>
+	keySeparator = "."
+)
+
+type Repo interface {
+	InsertApiKey(ctx context.Context, key entity.ApiKey) error
+	GetApiKey(ctx context.Context, id string) (*entity.ApiKey, error)
+	ListApiKeys(ctx context.Context, includeRevoked bool) ([]entity.ApiKey, error)
+	RotateApiKey(ctx context.Context, id string, secretHash string, previousExpiresAt time.Time, now time.Time) error
+	RevokeApiKey(ctx context.Context, id string, now time.Time) error
+}
+
+type ApiKeys struct {
+	repo Repo
+}
+
+func NewApiKeys(repo Repo) ApiKeys {
+	return ApiKeys{
+		repo: repo,
+	}
+}
+
+// Create сохраняет ключ с ограничениями из key и возвращает его вместе с открытым значением,
+// открытое значение больше нигде не хранится и не может быть получено повторно
+func (s ApiKeys) Create(ctx context.Context, key entity.ApiKey) (*entity.ApiKey, string, error) {
+	err := validateAllowedIps(key.AllowedIps)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, "", domain.NewInvalidArgumentError("expiresAt must be in the future", domain.ErrCodeInvalidApiKey)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "new secret")
+	}
+	if key.Categories == nil {
+		key.Categories = []string{}
+	}
+	if key.AllowedIps == nil {
+		key.AllowedIps = []string{}
+	}
+	key.Id = uuid.NewString()
+	key.SecretHash = hashSecret(secret)
+	key.CreatedAt = now
+	err = s.repo.InsertApiKey(ctx, key)
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "insert api key")
+	}
+	return &key, key.Id + keySeparator + secret, nil
+}
+
+func (s ApiKeys) List(ctx context.Context, includeRevoked bool) ([]entity.ApiKey, error) {
+	keys, err := s.repo.ListApiKeys(ctx, includeRevoked)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list api keys")
+	}
+	return keys, nil
+}
+
+// Rotate выпускает новый секрет ключа, предыдущий секрет принимается ещё gracePeriod,
+// чтобы клиенты успели перейти на новое значение
+func (s ApiKeys) Rotate(ctx context.Context, id string, gracePeriod time.Duration) (*entity.ApiKey, string, error) {
+	if uuid.Validate(id) != nil {
+		return nil, "", domain.ErrApiKeyNotFound
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "new secret")
+	}
+	now := time.Now().UTC()
+	err = s.repo.RotateApiKey(ctx, id, hashSecret(secret), now.Add(gracePeriod), now)
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "rotate api key")
+	}
+	key, err := s.repo.GetApiKey(ctx, id)
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "get api key")
+	}
+	return key, id + keySeparator + secret, nil
+}
+
+func (s ApiKeys) Revoke(ctx context.Context, id string) error {
+	if uuid.Validate(id) != nil {
+		return domain.ErrApiKeyNotFound
+	}
+	err := s.repo.RevokeApiKey(ctx, id, time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "revoke api key")
+	}
+	return nil
+}
+
+// Resolve возвращает субъекта ключа rawKey, предъявленного с адреса remoteIp,
+// при любой ошибке проверки возвращается domain.ErrUnauthorized
+func (s ApiKeys) Resolve(ctx context.Context, rawKey string, remoteIp string) (*entity.Principal, error) {
+	id, secret, ok := strings.Cut(rawKey, keySeparator)
+	if !ok || uuid.Validate(id) != nil || secret == "" {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, "malformed api key")
+	}
+	key, err := s.repo.GetApiKey(ctx, id)
+	if errors.Is(err, domain.ErrApiKeyNotFound) {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, "unknown api key")
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "get api key")
+	}
+
+	err = check(*key, secret, remoteIp, time.Now().UTC())
+	if err != nil {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, err.Error())
+	}
+	principal := key.Principal()
+	return &principal, nil
+}
+
+// check проверяет секрет, срок действия и адрес клиента для ключа key
+func check(key entity.ApiKey, secret string, remoteIp string, now time.Time) error {
+	if key.RevokedAt != nil {
+		return errors.New("api key is revoked")
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return errors.New("api key is expired")
+	}
+
+	hash := hashSecret(secret)
+	current := subtle.ConstantTimeCompare([]byte(hash), []byte(key.SecretHash)) == 1
+	previous := key.PreviousSecretHash != "" &&
+		key.PreviousExpiresAt != nil && now.Before(*key.PreviousExpiresAt) &&
+		subtle.ConstantTimeCompare([]byte(hash), []byte(key.PreviousSecretHash)) == 1
+	if !current && !previous {
+		return errors.New("invalid api key secret")
+	}
+
+	if !ipAllowed(key.AllowedIps, remoteIp) {
+		return errors.Errorf("address %s is not allowed for api key", remoteIp)
+	}
+	return nil
+}
+
+func ipAllowed(allowedIps []string, remoteIp string) bool {
+	if len(allowedIps) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(remoteIp)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, allowed := range allowedIps {
+		prefix, err := parsePrefix(allowed)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix принимает подсеть в нотации CIDR или одиночный адрес
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func validateAllowedIps(allowedIps []string) error {
+	for _, allowed := range allowedIps {
+		_, err := parsePrefix(allowed)
+		if err != nil {
+			return domain.NewInvalidArgumentError(
+				"allowedIps must contain ip addresses or cidr subnets, invalid value "+allowed,
+				domain.ErrCodeInvalidApiKey,
+			)
+		}
+	}
+	return nil
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", errors.WithMessage(err, "read random")
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashSecret секрет содержит 256 бит случайных данных, поэтому медленный хэш не требуется
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,213 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/apikey"
+)
+
+type memoryRepo struct {
+	keys map[string]entity.ApiKey
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{keys: make(map[string]entity.ApiKey)}
+}
+
+func (r *memoryRepo) InsertApiKey(_ context.Context, key entity.ApiKey) error {
+	for _, existing := range r.keys {
+		if existing.Name == key.Name && existing.RevokedAt == nil {
+			return domain.ErrApiKeyAlreadyExist
+		}
+	}
+	r.keys[key.Id] = key
+	return nil
+}
+
+func (r *memoryRepo) GetApiKey(_ context.Context, id string) (*entity.ApiKey, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, domain.ErrApiKeyNotFound
+	}
+	return &key, nil
+}
+
+func (r *memoryRepo) ListApiKeys(_ context.Context, _ bool) ([]entity.ApiKey, error) {
+	return nil, nil
+}
+
+func (r *memoryRepo) RotateApiKey(_ context.Context, id string, secretHash string, previousExpiresAt time.Time, now time.Time) error {
+	key, ok := r.keys[id]
+	if !ok || key.RevokedAt != nil {
+		return domain.ErrApiKeyNotFound
+	}
+	key.PreviousSecretHash = key.SecretHash
+	key.PreviousExpiresAt = &previousExpiresAt
+	key.SecretHash = secretHash
+	key.RotatedAt = &now
+	r.keys[id] = key
+	return nil
+}
+
+func (r *memoryRepo) RevokeApiKey(_ context.Context, id string, now time.Time) error {
+	key, ok := r.keys[id]
+	if !ok || key.RevokedAt != nil {
+		return domain.ErrApiKeyNotFound
+	}
+	key.RevokedAt = &now
+	r.keys[id] = key
+	return nil
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	service := apikey.NewApiKeys(newMemoryRepo())
+
+	key, secret, err := service.Create(ctx, entity.ApiKey{
+		Name:       "thumbnailer",
+		Categories: []string{"avatars"},
+		Operations: []string{entity.ApiKeyOperationRead, entity.ApiKeyOperationWrite},
+		AllowedIps: []string{"10.0.0.0/8", "192.168.1.10"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if key.SecretHash == "" || key.SecretHash == secret {
+		t.Fatalf("secret must be stored hashed")
+	}
+
+	principal, err := service.Resolve(ctx, secret, "10.1.2.3")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if principal.Subject != entity.ApiKeySubjectPrefix+"thumbnailer" {
+		t.Fatalf("unexpected subject %s", principal.Subject)
+	}
+	if !principal.Allowed("files:write:avatars") || principal.Allowed("files:write:documents") ||
+		principal.Allowed("files:delete:avatars") || principal.Allowed(entity.PermissionAdmin) {
+		t.Fatalf("unexpected permissions %v", principal.Permissions)
+	}
+
+	_, err = service.Resolve(ctx, secret, "192.168.1.10")
+	if err != nil {
+		t.Fatalf("resolve from single address: %v", err)
+	}
+	rejected := map[string]struct {
+		rawKey   string
+		remoteIp string
+	}{
+		"foreign address": {secret, "172.16.0.1"},
+		"wrong secret":    {key.Id + ".wrong", "10.1.2.3"},
+		"malformed":       {"not-a-key", "10.1.2.3"},
+		"unknown id":      {"00000000-0000-0000-0000-000000000000.secret", "10.1.2.3"},
+	}
+	for name, c := range rejected {
+		_, err := service.Resolve(ctx, c.rawKey, c.remoteIp)
+		if !errors.Is(err, domain.ErrUnauthorized) {
+			t.Errorf("%s: expected unauthorized, got %v", name, err)
+		}
+	}
+
+	err = service.Revoke(ctx, key.Id)
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	_, err = service.Resolve(ctx, secret, "10.1.2.3")
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized for revoked key, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	service := apikey.NewApiKeys(newMemoryRepo())
+
+	withGrace, oldSecret, err := service.Create(ctx, entity.ApiKey{Name: "with-grace", Operations: []string{"read"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, newSecret, err := service.Rotate(ctx, withGrace.Id, time.Hour)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	for _, secret := range []string{oldSecret, newSecret} {
+		_, err := service.Resolve(ctx, secret, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("resolve during grace period: %v", err)
+		}
+	}
+
+	withoutGrace, oldSecret, err := service.Create(ctx, entity.ApiKey{Name: "without-grace", Operations: []string{"read"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, _, err = service.Rotate(ctx, withoutGrace.Id, 0)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	_, err = service.Resolve(ctx, oldSecret, "127.0.0.1")
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized for rotated secret, got %v", err)
+	}
+}
+
+func TestCreateValidation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	service := apikey.NewApiKeys(newMemoryRepo())
+
+	_, _, err := service.Create(ctx, entity.ApiKey{Name: "client", AllowedIps: []string{"10.0.0.0/33"}})
+	invalidArgError := domain.InvalidArgumentError{}
+	if !errors.As(err, &invalidArgError) || invalidArgError.ErrCode != domain.ErrCodeInvalidApiKey {
+		t.Fatalf("expected invalid api key error, got %v", err)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	_, _, err = service.Create(ctx, entity.ApiKey{Name: "client", ExpiresAt: &expired})
+	if !errors.As(err, &invalidArgError) {
+		t.Fatalf("expected invalid api key error, got %v", err)
+	}
+
+	_, _, err = service.Create(ctx, entity.ApiKey{Name: "client"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, _, err = service.Create(ctx, entity.ApiKey{Name: "client"})
+	if !errors.Is(err, domain.ErrApiKeyAlreadyExist) {
+		t.Fatalf("expected already exist, got %v", err)
+	}
+}
+
+func TestApiKeyPrincipal(t *testing.T) {
+	t.Parallel()
+	principal := entity.ApiKey{
+		Name:       "cleaner",
+		Operations: []string{entity.ApiKeyOperationDelete, entity.ApiKeyOperationCommit},
+	}.Principal()
+	expected := []string{"files:delete:*", "files:commit:*", "groups:commit"}
+	if !slices.Equal(principal.Permissions, expected) {
+		t.Fatalf("unexpected permissions %v", principal.Permissions)
+	}
+
+	// ключ с ограничением категорий не видит список категорий
+	principal = entity.ApiKey{
+		Name:       "avatars",
+		Categories: []string{"avatars"},
+		Operations: []string{entity.ApiKeyOperationRead},
+	}.Principal()
+	expected = []string{"files:read:avatars", "groups:read", "references:read"}
+	if !slices.Equal(principal.Permissions, expected) {
+		t.Fatalf("unexpected permissions %v", principal.Permissions)
+	}
+	if principal.Allowed("files:read:docs") || principal.Allowed("categories:read") {
+		t.Fatalf("key must be limited to its categories, got %v", principal.Permissions)
+	}
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"context"
+
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultListLimit = 100
+	exportPageSize   = 1000
+)
+
+type Repo interface {
+	InsertRecord(ctx context.Context, record entity.AuditRecord) error
+	ListRecords(ctx context.Context, filter entity.AuditFilter) ([]entity.AuditRecord, error)
+	ListRecordsAfter(ctx context.Context, afterId int64, filter entity.AuditFilter, limit int) ([]entity.AuditRecord, error)
+}
+
+type Audit struct {
+	repo Repo
+}
+
+func NewAudit(repo Repo) Audit {
+	return Audit{
+		repo: repo,
+	}
+}
+
+func (s Audit) Record(ctx context.Context, record entity.AuditRecord) error {
+	err := s.repo.InsertRecord(ctx, record)
+	if err != nil {
+		return errors.WithMessage(err, "insert audit record")
+	}
+	return nil
+}
+
+func (s Audit) List(ctx context.Context, filter entity.AuditFilter) ([]entity.AuditRecord, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+	records, err := s.repo.ListRecords(ctx, filter)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list audit records")
+	}
+	return records, nil
+}
+
+// Export передаёт в write все записи, подходящие под фильтр, от старых к новым,
+// записи читаются страницами, чтобы не держать весь журнал в памяти
+func (s Audit) Export(ctx context.Context, filter entity.AuditFilter, write func(record entity.AuditRecord) error) error {
+	afterId := int64(0)
+	for {
+		records, err := s.repo.ListRecordsAfter(ctx, afterId, filter, exportPageSize)
+		if err != nil {
+			return errors.WithMessage(err, "list audit records")
+		}
+		for _, record := range records {
+			err = write(record)
+			if err != nil {
+				return errors.WithMessage(err, "write audit record")
+			}
+			afterId = record.Id
+		}
+		if len(records) < exportPageSize {
+			return nil
+		}
+	}
+}
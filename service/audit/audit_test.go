@@ -0,0 +1,123 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+
+	"storage-service/entity"
+	"storage-service/service/audit"
+
+	"github.com/pkg/errors"
+)
+
+// repo записи журнала по возрастанию идентификатора, pages - количество прочитанных страниц выгрузки
+type repo struct {
+	records []entity.AuditRecord
+	filter  entity.AuditFilter
+	pages   int
+}
+
+func newRepo(count int) *repo {
+	r := &repo{}
+	for i := range count {
+		r.records = append(r.records, entity.AuditRecord{Id: int64(i + 1)})
+	}
+	return r
+}
+
+func (r *repo) InsertRecord(_ context.Context, record entity.AuditRecord) error {
+	r.records = append(r.records, record)
+	return nil
+}
+
+func (r *repo) ListRecords(_ context.Context, filter entity.AuditFilter) ([]entity.AuditRecord, error) {
+	r.filter = filter
+	return r.records[:min(filter.Limit, len(r.records))], nil
+}
+
+func (r *repo) ListRecordsAfter(_ context.Context, afterId int64, _ entity.AuditFilter, limit int) ([]entity.AuditRecord, error) {
+	r.pages++
+	page := make([]entity.AuditRecord, 0, limit)
+	for _, record := range r.records {
+		if record.Id > afterId && len(page) < limit {
+			page = append(page, record)
+		}
+	}
+	return page, nil
+}
+
+func TestListDefaultLimit(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(150)
+	service := audit.NewAudit(repo)
+
+	records, err := service.List(t.Context(), entity.AuditFilter{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if repo.filter.Limit != 100 || len(records) != 100 {
+		t.Fatalf("expected default limit 100, got %d records with limit %d", len(records), repo.filter.Limit)
+	}
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		count int
+		pages int
+	}{
+		{name: "empty log", count: 0, pages: 1},
+		{name: "single page", count: 10, pages: 1},
+		{name: "full last page", count: 2000, pages: 3},
+		{name: "several pages", count: 2500, pages: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := newRepo(test.count)
+			service := audit.NewAudit(repo)
+
+			lastId := int64(0)
+			err := service.Export(t.Context(), entity.AuditFilter{}, func(record entity.AuditRecord) error {
+				if record.Id != lastId+1 {
+					t.Fatalf("expected record %d, got %d", lastId+1, record.Id)
+				}
+				lastId = record.Id
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("export: %v", err)
+			}
+			if lastId != int64(test.count) || repo.pages != test.pages {
+				t.Fatalf("expected %d records in %d pages, got %d in %d", test.count, test.pages, lastId, repo.pages)
+			}
+		})
+	}
+}
+
+func TestExportStopsOnWriteError(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(2500)
+	service := audit.NewAudit(repo)
+
+	writeErr := errors.New("client disconnected")
+	written := 0
+	err := service.Export(t.Context(), entity.AuditFilter{}, func(entity.AuditRecord) error {
+		written++
+		if written == 5 {
+			return writeErr
+		}
+		return nil
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+	if written != 5 || repo.pages != 1 {
+		t.Fatalf("export must stop on write error, got %d records in %d pages", written, repo.pages)
+	}
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+
+	defaultPermissionsClaim = "permissions"
+)
+
+type Config struct {
+	Algorithm  string
+	HmacSecret string
+	// PublicKeys открытые ключи RSA в формате PEM, для токенов без kid
+	PublicKeys []string
+	// JwksFile путь к локальному JWKS, ключ выбирается по kid токена
+	JwksFile         string
+	Issuer           string
+	Audience         string
+	PermissionsClaim string
+	Leeway           time.Duration
+}
+
+type publicKey struct {
+	kid string
+	key *rsa.PublicKey
+}
+
+// Verifier проверяет подпись и срок действия bearer токенов и извлекает разрешения
+type Verifier struct {
+	parser           *jwt.Parser
+	algorithm        string
+	hmacSecret       []byte
+	publicKeys       []publicKey
+	permissionsClaim string
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{cfg.Algorithm}),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	verifier := &Verifier{
+		parser:           jwt.NewParser(options...),
+		algorithm:        cfg.Algorithm,
+		permissionsClaim: cfg.PermissionsClaim,
+	}
+	if verifier.permissionsClaim == "" {
+		verifier.permissionsClaim = defaultPermissionsClaim
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmHS256:
+		if cfg.HmacSecret == "" {
+			return nil, errors.New("hmac secret is required for HS256")
+		}
+		verifier.hmacSecret = []byte(cfg.HmacSecret)
+	case AlgorithmRS256:
+		for i, pemKey := range cfg.PublicKeys {
+			key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pemKey))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "parse public key %d", i)
+			}
+			verifier.publicKeys = append(verifier.publicKeys, publicKey{key: key})
+		}
+		if cfg.JwksFile != "" {
+			keys, err := readJwks(cfg.JwksFile)
+			if err != nil {
+				return nil, errors.WithMessage(err, "read jwks")
+			}
+			verifier.publicKeys = append(verifier.publicKeys, keys...)
+		}
+		if len(verifier.publicKeys) == 0 {
+			return nil, errors.New("public keys or jwks file are required for RS256")
+		}
+	default:
+		return nil, errors.Errorf("unsupported algorithm %s", cfg.Algorithm)
+	}
+	return verifier, nil
+}
+
+// Verify возвращает domain.ErrUnauthorized, если токен не прошёл проверку
+func (v *Verifier) Verify(rawToken string) (*entity.Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(rawToken, claims, v.key)
+	if err != nil {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, err.Error())
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, err.Error())
+	}
+	permissions, err := v.permissions(claims)
+	if err != nil {
+		return nil, errors.WithMessage(domain.ErrUnauthorized, err.Error())
+	}
+	return &entity.Principal{
+		Subject:     subject,
+		Permissions: permissions,
+	}, nil
+}
+
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	if v.algorithm == AlgorithmHS256 {
+		return v.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if len(v.publicKeys) == 1 {
+			return v.publicKeys[0].key, nil
+		}
+		return nil, errors.New("token kid is required when several keys are configured")
+	}
+	for _, key := range v.publicKeys {
+		if key.kid == kid {
+			return key.key, nil
+		}
+	}
+	return nil, errors.Errorf("unknown key id %s", kid)
+}
+
+// permissions поддерживает claim в виде массива строк и строки через пробел, как scope в OAuth 2.0
+func (v *Verifier) permissions(claims jwt.MapClaims) ([]string, error) {
+	switch value := claims[v.permissionsClaim].(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		return strings.Fields(value), nil
+	case []any:
+		permissions := make([]string, 0, len(value))
+		for _, item := range value {
+			permission, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("%s claim must contain strings", v.permissionsClaim)
+			}
+			permissions = append(permissions, permission)
+		}
+		return permissions, nil
+	default:
+		return nil, errors.Errorf("%s claim must be a string or an array of strings", v.permissionsClaim)
+	}
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// readJwks читает RSA ключи подписи, остальные ключи пропускаются
+func readJwks(path string) ([]publicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "read file")
+	}
+	set := jwks{}
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, errors.WithMessage(err, "unmarshal jwks")
+	}
+
+	keys := make([]publicKey, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "decode modulus of key %s", jwk.Kid)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "decode exponent of key %s", jwk.Kid)
+		}
+		keys = append(keys, publicKey{
+			kid: jwk.Kid,
+			key: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			},
+		})
+	}
+	return keys, nil
+}
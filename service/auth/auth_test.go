@@ -0,0 +1,215 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const secret = "test-secret"
+
+func hmacToken(t *testing.T, claims jwt.MapClaims, key string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func newHmacVerifier(t *testing.T) *auth.Verifier {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{
+		Algorithm:  auth.AlgorithmHS256,
+		HmacSecret: secret,
+		Issuer:     "issuer",
+	})
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+	return verifier
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":         "user-1",
+		"iss":         "issuer",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+		"permissions": []any{"files:read:avatars", "files:write:*"},
+	}
+}
+
+func TestVerifyHmac(t *testing.T) {
+	t.Parallel()
+	verifier := newHmacVerifier(t)
+
+	principal, err := verifier.Verify(hmacToken(t, validClaims(), secret))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if principal.Subject != "user-1" {
+		t.Fatalf("unexpected subject %s", principal.Subject)
+	}
+	if !slices.Equal(principal.Permissions, []string{"files:read:avatars", "files:write:*"}) {
+		t.Fatalf("unexpected permissions %v", principal.Permissions)
+	}
+}
+
+func TestVerifyScopeString(t *testing.T) {
+	t.Parallel()
+	verifier := newHmacVerifier(t)
+	claims := validClaims()
+	claims["permissions"] = "files:read:avatars  admin"
+
+	principal, err := verifier.Verify(hmacToken(t, claims, secret))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !slices.Equal(principal.Permissions, []string{"files:read:avatars", "admin"}) {
+		t.Fatalf("unexpected permissions %v", principal.Permissions)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	t.Parallel()
+	verifier := newHmacVerifier(t)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	withoutExp := validClaims()
+	delete(withoutExp, "exp")
+	otherIssuer := validClaims()
+	otherIssuer["iss"] = "other"
+	invalidPermissions := validClaims()
+	invalidPermissions["permissions"] = []any{1}
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	tokens := map[string]string{
+		"wrong secret":        hmacToken(t, validClaims(), "other-secret"),
+		"expired":             hmacToken(t, expired, secret),
+		"without exp":         hmacToken(t, withoutExp, secret),
+		"other issuer":        hmacToken(t, otherIssuer, secret),
+		"invalid permissions": hmacToken(t, invalidPermissions, secret),
+		"alg none":            noneToken,
+		"malformed":           "not-a-token",
+	}
+	for name, token := range tokens {
+		_, err := verifier.Verify(token)
+		if !errors.Is(err, domain.ErrUnauthorized) {
+			t.Errorf("%s: expected unauthorized, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyRsaJwks(t *testing.T) {
+	t.Parallel()
+	firstKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	secondKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	jwksFile := writeJwks(t, map[string]*rsa.PublicKey{
+		"first":  &firstKey.PublicKey,
+		"second": &secondKey.PublicKey,
+	})
+	verifier, err := auth.NewVerifier(auth.Config{
+		Algorithm: auth.AlgorithmRS256,
+		JwksFile:  jwksFile,
+	})
+	if err != nil {
+		t.Fatalf("new verifier: %v", err)
+	}
+
+	sign := func(kid string, key *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims())
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+
+	_, err = verifier.Verify(sign("second", secondKey))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	_, err = verifier.Verify(sign("first", secondKey))
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized for key mismatch, got %v", err)
+	}
+	_, err = verifier.Verify(sign("unknown", secondKey))
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized for unknown kid, got %v", err)
+	}
+	_, err = verifier.Verify(hmacToken(t, validClaims(), secret))
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized for HS256 token, got %v", err)
+	}
+}
+
+func TestPrincipalAllowed(t *testing.T) {
+	t.Parallel()
+	principal := entity.Principal{
+		Permissions: []string{"files:read:avatars", "files:write:*", "categories:read"},
+	}
+	cases := map[string]bool{
+		"files:read:avatars":   true,
+		"files:read:documents": false,
+		"files:write:docs":     true,
+		"files:lock:docs":      false,
+		"categories:read":      true,
+		"categories:write":     false,
+		"files:read":           false,
+		"admin":                false,
+	}
+	for required, expected := range cases {
+		if principal.Allowed(required) != expected {
+			t.Errorf("%s: expected %v", required, expected)
+		}
+	}
+}
+
+func writeJwks(t *testing.T, keys map[string]*rsa.PublicKey) string {
+	t.Helper()
+	set := map[string][]map[string]string{"keys": {}}
+	for kid, key := range keys {
+		set["keys"] = append(set["keys"], map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	return path
+}
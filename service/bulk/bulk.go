@@ -0,0 +1,449 @@
+package bulk
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const (
+	statConcurrency = 16
+)
+
+type FileRepo interface {
+	StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error)
+	ListFiles(ctx context.Context, category string, prefix string, startAfter string, limit int) ([]string, error)
+}
+
+// Trash файлы удаляются с возможностью восстановления, как через DELETE /file, но пачкой:
+// исходные объекты удаляются одним запросом, pending записи и сроки жизни очищаются в транзакции корзины
+type Trash interface {
+	MoveFilesToTrash(ctx context.Context, category string, filenames []string, deletedBy string) (map[string]error, error)
+}
+
+type JobRepo interface {
+	InsertJob(ctx context.Context, job entity.BulkDeleteJob) error
+	GetJob(ctx context.Context, id string) (*entity.BulkDeleteJob, error)
+	UpdateJobProgress(ctx context.Context, id string, lastKey string, deleted int, failed int, lastError string, now time.Time) error
+	UpdateJobStatus(ctx context.Context, id string, status string, lastError string, now time.Time) error
+}
+
+type Locks interface {
+	LockedFiles(ctx context.Context, category string, filenames []string) ([]string, error)
+	Release(ctx context.Context, filename string, category string) error
+}
+
+type JobEnqueuer interface {
+	Enqueue(ctx context.Context, req bgjob.EnqueueRequest) error
+}
+
+type Config struct {
+	MaxFilenames    int
+	SyncPrefixLimit int
+	PageSize        int
+}
+
+type Bulk struct {
+	repo     FileRepo
+	trash    Trash
+	jobRepo  JobRepo
+	locks    Locks
+	enqueuer JobEnqueuer
+	cfg      Config
+}
+
+func NewBulk(
+	repo FileRepo,
+	trash Trash,
+	jobRepo JobRepo,
+	locks Locks,
+	enqueuer JobEnqueuer,
+	cfg Config,
+) Bulk {
+	return Bulk{
+		repo:     repo,
+		trash:    trash,
+		jobRepo:  jobRepo,
+		locks:    locks,
+		enqueuer: enqueuer,
+		cfg:      cfg,
+	}
+}
+
+// Delete удаляет файлы по именам или префиксу, файлы других владельцев пропускаются со статусом forbidden
+func (s Bulk) Delete(
+	ctx context.Context,
+	req entity.BulkDeleteRequest,
+	accessor entity.Accessor,
+) (*entity.BulkDeleteResult, error) {
+	switch {
+	case accessor.Anonymous():
+		return nil, domain.ErrUnauthorized
+	case len(req.Filenames) > 0 && req.Prefix != "":
+		return nil, domain.NewInvalidArgumentError(
+			"only one of filenames and prefix can be specified",
+			domain.ErrCodeInvalidBulkDelete,
+		)
+	case len(req.Filenames) > s.cfg.MaxFilenames:
+		return nil, domain.NewInvalidArgumentError(
+			"too many filenames",
+			domain.ErrCodeInvalidBulkDelete,
+		)
+	case len(req.Filenames) > 0:
+		return s.deleteFilenames(ctx, req.Category, unique(req.Filenames), req.DeletedBy, accessor)
+	case req.Prefix != "":
+		return s.deletePrefix(ctx, req.Category, req.Prefix, req.DeletedBy, accessor)
+	default:
+		return nil, domain.NewInvalidArgumentError(
+			"filenames or prefix must be specified",
+			domain.ErrCodeInvalidBulkDelete,
+		)
+	}
+}
+
+func (s Bulk) GetJob(ctx context.Context, category string, id string) (*entity.BulkDeleteJob, error) {
+	job, err := s.jobRepo.GetJob(ctx, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get job")
+	}
+	if job.Category != category {
+		return nil, domain.ErrBulkDeleteJobNotFound
+	}
+	return job, nil
+}
+
+// deleteFilenames удаляет существующие файлы, которыми accessor может управлять
+func (s Bulk) deleteFilenames(
+	ctx context.Context,
+	category string,
+	filenames []string,
+	deletedBy string,
+	accessor entity.Accessor,
+) (*entity.BulkDeleteResult, error) {
+	files, err := s.stat(ctx, category, filenames)
+	if err != nil {
+		return nil, errors.WithMessage(err, "stat files")
+	}
+
+	results := make([]entity.BulkDeleteFileResult, 0, len(filenames))
+	toDelete := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		metadata := files[filename]
+		switch {
+		case metadata == nil || entity.IsInternalObject(filename):
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusNotFound,
+			})
+		case !metadata.CanModify(accessor):
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusForbidden,
+			})
+		default:
+			toDelete = append(toDelete, filename)
+		}
+	}
+
+	deleted, err := s.deleteFiles(ctx, category, toDelete, deletedBy)
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete files")
+	}
+	return &entity.BulkDeleteResult{Files: append(results, deleted...)}, nil
+}
+
+// deleteListed удаляет файлы из листинга, владельцы файлов проверяются, только если accessor ограничен
+func (s Bulk) deleteListed(
+	ctx context.Context,
+	category string,
+	filenames []string,
+	deletedBy string,
+	accessor entity.Accessor,
+) ([]entity.BulkDeleteFileResult, error) {
+	if accessor.Unrestricted {
+		return s.deleteFiles(ctx, category, filenames, deletedBy)
+	}
+	result, err := s.deleteFilenames(ctx, category, filenames, deletedBy, accessor)
+	if err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+func (s Bulk) deletePrefix(
+	ctx context.Context,
+	category string,
+	prefix string,
+	deletedBy string,
+	accessor entity.Accessor,
+) (*entity.BulkDeleteResult, error) {
+	filenames, err := s.listFiles(ctx, category, prefix, "", s.cfg.SyncPrefixLimit+1)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list files")
+	}
+
+	if len(filenames) <= s.cfg.SyncPrefixLimit {
+		deleted, err := s.deleteListed(ctx, category, filenames, deletedBy, accessor)
+		if err != nil {
+			return nil, errors.WithMessage(err, "delete files")
+		}
+		return &entity.BulkDeleteResult{Files: deleted}, nil
+	}
+
+	now := time.Now().UTC()
+	job := entity.BulkDeleteJob{
+		Id:        uuid.NewString(),
+		Category:  category,
+		Prefix:    prefix,
+		Owner:     jobOwner(accessor),
+		DeletedBy: deletedBy,
+		Status:    entity.BulkDeleteJobInProgress,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.jobRepo.InsertJob(ctx, job)
+	if err != nil {
+		return nil, errors.WithMessage(err, "insert job")
+	}
+
+	err = s.enqueuer.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    job.Id,
+		Queue: WorkerQueueName,
+		Type:  jobType,
+		Arg:   []byte(job.Id),
+	})
+	if err != nil {
+		_ = s.jobRepo.UpdateJobStatus(ctx, job.Id, entity.BulkDeleteJobFailed, err.Error(), time.Now().UTC())
+		return nil, errors.WithMessage(err, "enqueue job")
+	}
+
+	return &entity.BulkDeleteResult{Job: &job}, nil
+}
+
+// ProcessJob удаляет очередную страницу файлов по префиксу,
+// возвращает true, если все файлы обработаны
+func (s Bulk) ProcessJob(ctx context.Context, id string) (bool, error) {
+	job, err := s.jobRepo.GetJob(ctx, id)
+	switch {
+	case errors.Is(err, domain.ErrBulkDeleteJobNotFound):
+		return true, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "get job")
+	case job.Status != entity.BulkDeleteJobInProgress:
+		return true, nil
+	}
+
+	filenames, err := s.listFiles(ctx, job.Category, job.Prefix, job.LastKey, s.cfg.PageSize)
+	if err != nil {
+		return false, errors.WithMessage(err, "list files")
+	}
+	if len(filenames) == 0 {
+		err = s.jobRepo.UpdateJobStatus(ctx, job.Id, entity.BulkDeleteJobDone, "", time.Now().UTC())
+		if err != nil {
+			return false, errors.WithMessage(err, "update job status")
+		}
+		return true, nil
+	}
+
+	results, err := s.deleteListed(ctx, job.Category, filenames, job.DeletedBy, job.Accessor())
+	if err != nil {
+		return false, errors.WithMessage(err, "delete files")
+	}
+
+	deleted, failed, lastError := 0, 0, ""
+	for _, result := range results {
+		switch result.Status {
+		case entity.BulkDeleteStatusError:
+			failed++
+			lastError = result.Error
+		case entity.BulkDeleteStatusLocked:
+			failed++
+			lastError = domain.ErrFileLocked.Error()
+		case entity.BulkDeleteStatusForbidden:
+			failed++
+			lastError = domain.ErrForbidden.Error()
+		case entity.BulkDeleteStatusNotFound:
+			// файл удалён между листингом и удалением
+		default:
+			deleted++
+		}
+	}
+	err = s.jobRepo.UpdateJobProgress(
+		ctx,
+		job.Id,
+		filenames[len(filenames)-1],
+		deleted,
+		failed,
+		lastError,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return false, errors.WithMessage(err, "update job progress")
+	}
+	return false, nil
+}
+
+func (s Bulk) FailJob(ctx context.Context, id string, reason error) error {
+	err := s.jobRepo.UpdateJobStatus(ctx, id, entity.BulkDeleteJobFailed, reason.Error(), time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "update job status")
+	}
+	return nil
+}
+
+// deleteFiles переносит незаблокированные файлы в корзину и снимает записи о блокировках удалённых файлов
+func (s Bulk) deleteFiles(
+	ctx context.Context,
+	category string,
+	filenames []string,
+	deletedBy string,
+) ([]entity.BulkDeleteFileResult, error) {
+	if len(filenames) == 0 {
+		return []entity.BulkDeleteFileResult{}, nil
+	}
+
+	lockedFiles, err := s.locks.LockedFiles(ctx, category, filenames)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get locked files")
+	}
+	results := make([]entity.BulkDeleteFileResult, 0, len(filenames))
+	if len(lockedFiles) > 0 {
+		locked := make(map[string]bool, len(lockedFiles))
+		for _, filename := range lockedFiles {
+			locked[filename] = true
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusLocked,
+			})
+		}
+		filenames = slices.DeleteFunc(slices.Clone(filenames), func(filename string) bool {
+			return locked[filename]
+		})
+		if len(filenames) == 0 {
+			return results, nil
+		}
+	}
+
+	failed, err := s.trash.MoveFilesToTrash(ctx, category, filenames, deletedBy)
+	if err != nil {
+		return nil, errors.WithMessage(err, "move files to trash")
+	}
+	for _, filename := range filenames {
+		err := failed[filename]
+		switch {
+		case errors.Is(err, domain.ErrFileNotFound):
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusNotFound,
+			})
+		case err != nil:
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusError,
+				Error:    err.Error(),
+			})
+		default:
+			err = s.locks.Release(ctx, filename, category)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "release lock of '%s'", filename)
+			}
+			results = append(results, entity.BulkDeleteFileResult{
+				Filename: filename,
+				Status:   entity.BulkDeleteStatusDeleted,
+			})
+		}
+	}
+	return results, nil
+}
+
+// listFiles возвращает не более limit пользовательских файлов, следующих после startAfter.
+// Служебные объекты пропускаются, листинг продолжается, пока не наберётся limit файлов или не закончатся объекты
+func (s Bulk) listFiles(ctx context.Context, category string, prefix string, startAfter string, limit int) ([]string, error) {
+	result := make([]string, 0, limit)
+	for {
+		filenames, err := s.repo.ListFiles(ctx, category, prefix, startAfter, limit)
+		if err != nil {
+			return nil, errors.WithMessage(err, "list files")
+		}
+		for _, filename := range filenames {
+			if entity.IsInternalObject(filename) {
+				continue
+			}
+			result = append(result, filename)
+			if len(result) == limit {
+				return result, nil
+			}
+		}
+		if len(filenames) < limit {
+			return result, nil
+		}
+		startAfter = filenames[len(filenames)-1]
+	}
+}
+
+// stat возвращает метаданные существующих файлов по именам
+func (s Bulk) stat(ctx context.Context, category string, filenames []string) (map[string]*entity.Metadata, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	files := make(map[string]*entity.Metadata, len(filenames))
+	sem := make(chan struct{}, statConcurrency)
+	for _, filename := range filenames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			metadata, err := s.repo.StatFile(ctx, filename, category)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, domain.ErrFileNotFound):
+			case err != nil:
+				if firstErr == nil {
+					firstErr = errors.WithMessagef(err, "stat file '%s'", filename)
+				}
+			default:
+				files[filename] = metadata
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return files, nil
+}
+
+// jobOwner владелец файлов, которые может удалить задача, пустой для неограниченного доступа
+func jobOwner(accessor entity.Accessor) string {
+	if accessor.Unrestricted {
+		return ""
+	}
+	return accessor.Subject
+}
+
+func unique(filenames []string) []string {
+	seen := make(map[string]bool, len(filenames))
+	result := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		if seen[filename] {
+			continue
+		}
+		seen[filename] = true
+		result = append(result, filename)
+	}
+	return result
+}
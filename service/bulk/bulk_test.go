@@ -0,0 +1,326 @@
+package bulk_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/bulk"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+// storage объекты бакета в лексикографическом порядке, как их возвращает листинг minio,
+// owners владельцы файлов по именам, trashed перенесённые в корзину файлы
+type storage struct {
+	mu        sync.Mutex
+	objects   []string
+	owners    map[string]string
+	trashed   []string
+	deletedBy string
+}
+
+func (s *storage) StatFile(_ context.Context, filename string, _ string) (*entity.Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(s.objects, filename) {
+		return nil, domain.ErrFileNotFound
+	}
+	return &entity.Metadata{Filename: filename, Owner: s.owners[filename]}, nil
+}
+
+func (s *storage) ListFiles(_ context.Context, _ string, prefix string, startAfter string, limit int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]string, 0, limit)
+	for _, name := range s.objects {
+		if name <= startAfter || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		result = append(result, name)
+		if len(result) == limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (s *storage) MoveFilesToTrash(_ context.Context, _ string, filenames []string, deletedBy string) (map[string]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failed := make(map[string]error)
+	for _, filename := range filenames {
+		index := slices.Index(s.objects, filename)
+		if index < 0 {
+			failed[filename] = domain.ErrFileNotFound
+			continue
+		}
+		s.objects = slices.Delete(s.objects, index, index+1)
+		s.trashed = append(s.trashed, filename)
+		s.deletedBy = deletedBy
+	}
+	return failed, nil
+}
+
+type jobs struct {
+	job entity.BulkDeleteJob
+}
+
+func (r *jobs) InsertJob(_ context.Context, job entity.BulkDeleteJob) error {
+	r.job = job
+	return nil
+}
+
+func (r *jobs) GetJob(context.Context, string) (*entity.BulkDeleteJob, error) {
+	job := r.job
+	return &job, nil
+}
+
+func (r *jobs) UpdateJobProgress(_ context.Context, _ string, lastKey string, deleted int, failed int, _ string, _ time.Time) error {
+	r.job.LastKey = lastKey
+	r.job.Deleted += int64(deleted)
+	r.job.Failed += int64(failed)
+	return nil
+}
+
+func (r *jobs) UpdateJobStatus(_ context.Context, _ string, status string, _ string, _ time.Time) error {
+	r.job.Status = status
+	return nil
+}
+
+// locks заблокированные файлы, released файлы, записи о блокировках которых сняты
+type locks struct {
+	locked   map[string]bool
+	released []string
+}
+
+func (l *locks) LockedFiles(_ context.Context, _ string, filenames []string) ([]string, error) {
+	locked := make([]string, 0)
+	for _, filename := range filenames {
+		if l.locked[filename] {
+			locked = append(locked, filename)
+		}
+	}
+	return locked, nil
+}
+
+func (l *locks) Release(_ context.Context, filename string, _ string) error {
+	l.released = append(l.released, filename)
+	return nil
+}
+
+type enqueuer struct{}
+
+func (enqueuer) Enqueue(context.Context, bgjob.EnqueueRequest) error {
+	return nil
+}
+
+var admin = entity.Accessor{Unrestricted: true}
+
+func newBulk(repo *storage, jobRepo *jobs, locks *locks) bulk.Bulk {
+	return bulk.NewBulk(repo, repo, jobRepo, locks, enqueuer{}, bulk.Config{
+		MaxFilenames:    10,
+		SyncPrefixLimit: 2,
+		PageSize:        2,
+	})
+}
+
+func TestProcessJobSkipsInternalObjects(t *testing.T) {
+	t.Parallel()
+
+	// служебные объекты сортируются между пользовательскими и занимают целые страницы листинга
+	repo := &storage{objects: []string{
+		"a",
+		"a.pending/x", "a.pending/y", "a.pending/z",
+		"b",
+		"b.versions/1", "b.versions/2",
+		"c",
+	}}
+	jobRepo := &jobs{}
+	service := newBulk(repo, jobRepo, &locks{})
+
+	jobRepo.job = entity.BulkDeleteJob{Id: "job", Category: "images", Status: entity.BulkDeleteJobInProgress}
+	for range 10 {
+		done, err := service.ProcessJob(t.Context(), "job")
+		if err != nil {
+			t.Fatalf("process job: %v", err)
+		}
+		if done {
+			break
+		}
+	}
+	if jobRepo.job.Status != entity.BulkDeleteJobDone || jobRepo.job.Deleted != 3 {
+		t.Fatalf("expected all files deleted, got %+v", jobRepo.job)
+	}
+	for _, name := range repo.objects {
+		if !entity.IsInternalObject(name) {
+			t.Fatalf("file %q is not deleted", name)
+		}
+	}
+}
+
+func TestDeletePrefixFillsPage(t *testing.T) {
+	t.Parallel()
+
+	repo := &storage{objects: []string{"a", "a.pending/1", "a.pending/2", "a.pending/3", "b", "c"}}
+	jobRepo := &jobs{}
+	service := newBulk(repo, jobRepo, &locks{})
+
+	result, err := service.Delete(t.Context(), entity.BulkDeleteRequest{Category: "images", Prefix: "a"}, admin)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if result.Job != nil || len(result.Files) != 1 {
+		t.Fatalf("expected synchronous delete, got %+v", result)
+	}
+
+	repo.objects = []string{"a", "a.pending/1", "a.pending/2", "a.pending/3", "ab", "ac"}
+	result, err = service.Delete(t.Context(), entity.BulkDeleteRequest{Category: "images", Prefix: "a"}, admin)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// три файла при синхронном лимите 2 - удаление в фоне, служебные объекты не уменьшают страницу
+	if result.Job == nil {
+		t.Fatalf("expected background job, got %+v", result.Files)
+	}
+}
+
+func TestDeleteFilesMovesToTrash(t *testing.T) {
+	t.Parallel()
+
+	repo := &storage{objects: []string{"a", "b", "c"}}
+	locks := &locks{locked: map[string]bool{"b": true}}
+	service := newBulk(repo, &jobs{}, locks)
+
+	result, err := service.Delete(t.Context(), entity.BulkDeleteRequest{
+		Category:  "images",
+		Filenames: []string{"a", "b", "missing", ".trash/x", "a"},
+		DeletedBy: "alice",
+	}, admin)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, file := range result.Files {
+		statuses[file.Filename] = file.Status
+	}
+	expected := map[string]string{
+		"a":        entity.BulkDeleteStatusDeleted,
+		"b":        entity.BulkDeleteStatusLocked,
+		"missing":  entity.BulkDeleteStatusNotFound,
+		".trash/x": entity.BulkDeleteStatusNotFound,
+	}
+	if !maps.Equal(statuses, expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+	if !slices.Equal(repo.trashed, []string{"a"}) || repo.deletedBy != "alice" {
+		t.Fatalf("expected only a in trash deleted by alice, got %v by %q", repo.trashed, repo.deletedBy)
+	}
+	if !slices.Equal(locks.released, []string{"a"}) {
+		t.Fatalf("expected lock of a to be released, got %v", locks.released)
+	}
+}
+
+func TestDeleteFilesTrashError(t *testing.T) {
+	t.Parallel()
+
+	repo := &failingTrash{storage: &storage{objects: []string{"a"}}, err: errors.New("minio is unavailable")}
+	locks := &locks{}
+	service := bulk.NewBulk(repo, repo, &jobs{}, locks, enqueuer{}, bulk.Config{MaxFilenames: 10})
+
+	result, err := service.Delete(t.Context(), entity.BulkDeleteRequest{Category: "images", Filenames: []string{"a"}}, admin)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Status != entity.BulkDeleteStatusError {
+		t.Fatalf("expected error status, got %+v", result.Files)
+	}
+	if len(locks.released) != 0 {
+		t.Fatal("lock of not deleted file must be kept")
+	}
+}
+
+func TestDeleteSkipsFilesOfOtherOwners(t *testing.T) {
+	t.Parallel()
+
+	owners := map[string]string{"a": "alice", "b": "bob"}
+	repo := &storage{objects: []string{"a", "b", "c"}, owners: owners}
+	service := newBulk(repo, &jobs{}, &locks{})
+	alice := entity.Accessor{Subject: "alice"}
+
+	result, err := service.Delete(t.Context(), entity.BulkDeleteRequest{
+		Category:  "images",
+		Filenames: []string{"a", "b", "c"},
+	}, alice)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	statuses := make(map[string]string)
+	for _, file := range result.Files {
+		statuses[file.Filename] = file.Status
+	}
+	expected := map[string]string{
+		"a": entity.BulkDeleteStatusDeleted,
+		"b": entity.BulkDeleteStatusForbidden,
+		"c": entity.BulkDeleteStatusDeleted,
+	}
+	if !maps.Equal(statuses, expected) {
+		t.Fatalf("expected %v, got %v", expected, statuses)
+	}
+
+	_, err = service.Delete(t.Context(), entity.BulkDeleteRequest{Category: "images", Prefix: "b"}, entity.Accessor{})
+	if !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+
+	// фоновая задача удаляет файлы с правами субъекта, который её создал, и от его имени
+	repo = &storage{objects: []string{"a1", "a2", "a3"}, owners: map[string]string{"a2": "bob"}}
+	jobRepo := &jobs{}
+	service = newBulk(repo, jobRepo, &locks{})
+	result, err = service.Delete(t.Context(), entity.BulkDeleteRequest{
+		Category:  "images",
+		Prefix:    "a",
+		DeletedBy: "alice",
+	}, alice)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if result.Job == nil || result.Job.Owner != "alice" {
+		t.Fatalf("expected background job of alice, got %+v", result)
+	}
+	for range 10 {
+		done, err := service.ProcessJob(t.Context(), result.Job.Id)
+		if err != nil {
+			t.Fatalf("process job: %v", err)
+		}
+		if done {
+			break
+		}
+	}
+	if !slices.Equal(repo.objects, []string{"a2"}) || jobRepo.job.Failed != 1 {
+		t.Fatalf("file of bob must be kept, got %v and %+v", repo.objects, jobRepo.job)
+	}
+	if repo.deletedBy != "alice" {
+		t.Fatalf("expected files deleted by alice, got %q", repo.deletedBy)
+	}
+}
+
+type failingTrash struct {
+	*storage
+	err error
+}
+
+func (s *failingTrash) MoveFilesToTrash(_ context.Context, _ string, filenames []string, _ string) (map[string]error, error) {
+	failed := make(map[string]error, len(filenames))
+	for _, filename := range filenames {
+		failed[filename] = s.err
+	}
+	return failed, nil
+}
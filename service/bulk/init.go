@@ -0,0 +1,6 @@
+package bulk
+
+const (
+	WorkerQueueName = "bulk_delete"
+	jobType         = "bulk_delete"
+)
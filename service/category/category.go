@@ -0,0 +1,521 @@
+package category
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const (
+	tokenSize = 16
+
+	// statsCacheTtl статистика для списка категорий требует листинга всех объектов бакета, поэтому кэшируется
+	statsCacheTtl = time.Minute
+)
+
+// правила именования бакетов S3
+var nameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+type CategoryTxRunner interface {
+	CategoryTx(ctx context.Context, tx func(ctx context.Context, tx CategoryTx) error) error
+}
+
+type CategoryTx interface {
+	InsertCategory(ctx context.Context, category entity.Category) error
+	UpsertCategoryStatus(ctx context.Context, name string, status string, now time.Time) error
+	ConsumeDeleteToken(ctx context.Context, token string, category string, now time.Time) error
+	InsertDeleteJob(ctx context.Context, job entity.CategoryDeleteJob) error
+	DeleteCategoryData(ctx context.Context, name string) error
+	UpdateDeleteJob(ctx context.Context, id string, status string, deleted int, lastError string, now time.Time) error
+	InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error)
+}
+
+type CategoryRepo interface {
+	GetCategory(ctx context.Context, name string) (*entity.Category, error)
+	GetCategories(ctx context.Context) ([]entity.Category, error)
+	InsertDeleteToken(ctx context.Context, token entity.CategoryDeleteToken) error
+	GetDeleteJob(ctx context.Context, id string) (*entity.CategoryDeleteJob, error)
+	UpdateDeleteJob(ctx context.Context, id string, status string, deleted int, lastError string, now time.Time) error
+	DeleteCategoryData(ctx context.Context, name string) error
+}
+
+type Storage interface {
+	ListCategories(ctx context.Context) ([]string, error)
+	IsCategoryExist(ctx context.Context, category string) (bool, error)
+	CategoryStats(ctx context.Context, category string) (*entity.CategoryStats, error)
+	CreateCategory(ctx context.Context, category string) error
+	DeleteCategory(ctx context.Context, category string) error
+	ListFiles(ctx context.Context, category string, prefix string, startAfter string, limit int) ([]string, error)
+	DeleteFiles(ctx context.Context, category string, filenames []string) (map[string]error, error)
+}
+
+type LockRepo interface {
+	HasLockedFiles(ctx context.Context, category string, now time.Time) (bool, error)
+}
+
+type JobEnqueuer interface {
+	Enqueue(ctx context.Context, req bgjob.EnqueueRequest) error
+}
+
+type Config struct {
+	Defaults             map[string]entity.CategorySettings
+	ConfirmationTokenTtl time.Duration
+	PageSize             int
+}
+
+type Category struct {
+	txRunner CategoryTxRunner
+	repo     CategoryRepo
+	storage  Storage
+	lockRepo LockRepo
+	enqueuer JobEnqueuer
+	cfg      Config
+	stats    *statsCache
+}
+
+func NewCategory(
+	txRunner CategoryTxRunner,
+	repo CategoryRepo,
+	storage Storage,
+	lockRepo LockRepo,
+	enqueuer JobEnqueuer,
+	cfg Config,
+) Category {
+	return Category{
+		txRunner: txRunner,
+		repo:     repo,
+		storage:  storage,
+		lockRepo: lockRepo,
+		enqueuer: enqueuer,
+		cfg:      cfg,
+		stats:    &statsCache{entries: make(map[string]cachedStats)},
+	}
+}
+
+// Settings возвращает настройки категории: сохранённые при создании категории через api,
+// иначе заданные в конфигурации
+func (s Category) Settings(ctx context.Context, name string) (entity.CategorySettings, error) {
+	category, err := s.repo.GetCategory(ctx, name)
+	switch {
+	case errors.Is(err, domain.ErrCategoryNotFound):
+		return s.cfg.Defaults[name], nil
+	case err != nil:
+		return entity.CategorySettings{}, errors.WithMessage(err, "get category")
+	case category.Status == entity.CategoryStatusDeleting:
+		return entity.CategorySettings{}, domain.ErrCategoryIsDeleting
+	default:
+		return category.Settings, nil
+	}
+}
+
+func (s Category) List(ctx context.Context) ([]entity.CategoryInfo, error) {
+	buckets, err := s.storage.ListCategories(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list categories")
+	}
+	managed, err := s.repo.GetCategories(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get categories")
+	}
+
+	names := slices.Clone(buckets)
+	managedByName := make(map[string]entity.Category, len(managed))
+	for _, category := range managed {
+		managedByName[category.Name] = category
+		if !slices.Contains(names, category.Name) {
+			names = append(names, category.Name)
+		}
+	}
+	slices.Sort(names)
+
+	result := make([]entity.CategoryInfo, 0, len(names))
+	for _, name := range names {
+		info, err := s.info(ctx, name, managedByName, slices.Contains(buckets, name), true)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "category '%s' info", name)
+		}
+		result = append(result, *info)
+	}
+	return result, nil
+}
+
+func (s Category) Get(ctx context.Context, name string) (*entity.CategoryInfo, error) {
+	exist, err := s.storage.IsCategoryExist(ctx, name)
+	if err != nil {
+		return nil, errors.WithMessage(err, "is category exist")
+	}
+
+	managedByName := make(map[string]entity.Category)
+	category, err := s.repo.GetCategory(ctx, name)
+	switch {
+	case errors.Is(err, domain.ErrCategoryNotFound) && !exist:
+		return nil, domain.ErrCategoryNotFound
+	case errors.Is(err, domain.ErrCategoryNotFound):
+	case err != nil:
+		return nil, errors.WithMessage(err, "get category")
+	default:
+		managedByName[name] = *category
+	}
+
+	info, err := s.info(ctx, name, managedByName, exist, false)
+	if err != nil {
+		return nil, errors.WithMessage(err, "category info")
+	}
+	return info, nil
+}
+
+func (s Category) Create(ctx context.Context, name string, settings entity.CategorySettings) (*entity.Category, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, domain.NewInvalidArgumentError(
+			"category name must be 3-63 characters long and contain only lowercase letters, digits, dots and hyphens",
+			domain.ErrCodeInvalidCategoryName,
+		)
+	}
+
+	category := entity.Category{
+		Name:      name,
+		Settings:  settings,
+		Status:    entity.CategoryStatusActive,
+		CreatedAt: time.Now().UTC(),
+	}
+	// запись категории сохраняется, только если бакет создан
+	err := s.txRunner.CategoryTx(ctx, func(ctx context.Context, tx CategoryTx) error {
+		err := tx.InsertCategory(ctx, category)
+		if err != nil {
+			return errors.WithMessage(err, "insert category")
+		}
+		err = s.storage.CreateCategory(ctx, name)
+		if err != nil {
+			return errors.WithMessage(err, "create category")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "category tx")
+	}
+	return &category, nil
+}
+
+// Delete удаляет категорию без пользовательских файлов вместе со служебными объектами
+func (s Category) Delete(ctx context.Context, name string) error {
+	category, err := s.Get(ctx, name)
+	if err != nil {
+		return errors.WithMessage(err, "get category")
+	}
+	if category.Status == entity.CategoryStatusDeleting {
+		return domain.ErrCategoryIsDeleting
+	}
+	if category.Stats.ObjectCount > 0 {
+		return domain.ErrCategoryNotEmpty
+	}
+
+	for {
+		filenames, err := s.storage.ListFiles(ctx, name, "", "", s.cfg.PageSize)
+		if err != nil {
+			return errors.WithMessage(err, "list files")
+		}
+		if len(filenames) == 0 {
+			break
+		}
+		if slices.ContainsFunc(filenames, func(filename string) bool { return !entity.IsInternalObject(filename) }) {
+			return domain.ErrCategoryNotEmpty
+		}
+		err = s.deleteFiles(ctx, name, filenames)
+		if err != nil {
+			return errors.WithMessage(err, "delete internal files")
+		}
+	}
+
+	err = s.storage.DeleteCategory(ctx, name)
+	if err != nil {
+		return errors.WithMessage(err, "delete category")
+	}
+	err = s.repo.DeleteCategoryData(ctx, name)
+	if err != nil {
+		return errors.WithMessage(err, "delete category data")
+	}
+	return nil
+}
+
+// RequestForceDelete выдаёт токен, которым необходимо подтвердить удаление непустой категории
+func (s Category) RequestForceDelete(ctx context.Context, name string) (*entity.CategoryDeleteToken, error) {
+	_, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get category")
+	}
+
+	err = s.checkLockedFiles(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, tokenSize)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return nil, errors.WithMessage(err, "generate token")
+	}
+	token := entity.CategoryDeleteToken{
+		Token:     hex.EncodeToString(raw),
+		Category:  name,
+		ExpiresAt: time.Now().UTC().Add(s.cfg.ConfirmationTokenTtl),
+	}
+	err = s.repo.InsertDeleteToken(ctx, token)
+	if err != nil {
+		return nil, errors.WithMessage(err, "insert delete token")
+	}
+	return &token, nil
+}
+
+// ForceDelete подтверждает удаление токеном, токен расходуется только вместе с созданием задачи удаления
+func (s Category) ForceDelete(ctx context.Context, name string, token string) (*entity.CategoryDeleteJob, error) {
+	err := s.checkLockedFiles(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := entity.CategoryDeleteJob{
+		Id:        uuid.NewString(),
+		Category:  name,
+		Status:    entity.CategoryDeleteJobInProgress,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = s.txRunner.CategoryTx(ctx, func(ctx context.Context, tx CategoryTx) error {
+		err := tx.ConsumeDeleteToken(ctx, token, name, now)
+		if err != nil {
+			return errors.WithMessage(err, "consume delete token")
+		}
+		err = tx.UpsertCategoryStatus(ctx, name, entity.CategoryStatusDeleting, now)
+		if err != nil {
+			return errors.WithMessage(err, "upsert category status")
+		}
+		err = tx.InsertDeleteJob(ctx, job)
+		if err != nil {
+			return errors.WithMessage(err, "insert delete job")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "category tx")
+	}
+
+	err = s.enqueuer.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    job.Id,
+		Queue: WorkerQueueName,
+		Type:  jobType,
+		Arg:   []byte(job.Id),
+	})
+	if err != nil {
+		failErr := s.repo.UpdateDeleteJob(ctx, job.Id, entity.CategoryDeleteJobFailed, 0, err.Error(), time.Now().UTC())
+		if failErr != nil {
+			return nil, errors.WithMessagef(err, "enqueue job, update delete job: %v", failErr)
+		}
+		return nil, errors.WithMessage(err, "enqueue job")
+	}
+	return &job, nil
+}
+
+func (s Category) GetDeleteJob(ctx context.Context, name string, id string) (*entity.CategoryDeleteJob, error) {
+	job, err := s.repo.GetDeleteJob(ctx, id)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get delete job")
+	}
+	if job.Category != name {
+		return nil, domain.ErrCategoryDeleteJobNotFound
+	}
+	return job, nil
+}
+
+// ProcessDeleteJob удаляет очередную страницу объектов категории,
+// когда объектов не осталось, удаляет бакет и все записи категории.
+// Возвращает true, если удаление завершено
+func (s Category) ProcessDeleteJob(ctx context.Context, id string) (bool, error) {
+	job, err := s.repo.GetDeleteJob(ctx, id)
+	switch {
+	case errors.Is(err, domain.ErrCategoryDeleteJobNotFound):
+		return true, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "get delete job")
+	case job.Status != entity.CategoryDeleteJobInProgress:
+		return true, nil
+	}
+
+	filenames, err := s.storage.ListFiles(ctx, job.Category, "", "", s.cfg.PageSize)
+	if err != nil {
+		return false, errors.WithMessage(err, "list files")
+	}
+
+	if len(filenames) > 0 {
+		err = s.deleteFiles(ctx, job.Category, filenames)
+		if err != nil {
+			return false, errors.WithMessage(err, "delete files")
+		}
+		err = s.txRunner.CategoryTx(ctx, func(ctx context.Context, tx CategoryTx) error {
+			// служебные объекты (версии, загрузки, корзина) удаляются без событий
+			for _, filename := range filenames {
+				if strings.HasPrefix(filename, ".") {
+					continue
+				}
+				_, err := tx.InsertEvent(ctx, entity.NewStorageEvent(entity.EventDeleted, filename, job.Category, ""))
+				if err != nil {
+					return errors.WithMessagef(err, "insert event for '%s'", filename)
+				}
+			}
+			err := tx.UpdateDeleteJob(
+				ctx,
+				job.Id,
+				entity.CategoryDeleteJobInProgress,
+				len(filenames),
+				"",
+				time.Now().UTC(),
+			)
+			if err != nil {
+				return errors.WithMessage(err, "update delete job")
+			}
+			return nil
+		})
+		if err != nil {
+			return false, errors.WithMessage(err, "category tx")
+		}
+		return false, nil
+	}
+
+	err = s.storage.DeleteCategory(ctx, job.Category)
+	if err != nil {
+		return false, errors.WithMessage(err, "delete category")
+	}
+	err = s.txRunner.CategoryTx(ctx, func(ctx context.Context, tx CategoryTx) error {
+		err := tx.DeleteCategoryData(ctx, job.Category)
+		if err != nil {
+			return errors.WithMessage(err, "delete category data")
+		}
+		err = tx.UpdateDeleteJob(ctx, job.Id, entity.CategoryDeleteJobDone, 0, "", time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "update delete job")
+		}
+		return nil
+	})
+	if err != nil {
+		return false, errors.WithMessage(err, "category tx")
+	}
+	return true, nil
+}
+
+func (s Category) FailDeleteJob(ctx context.Context, id string, reason error) error {
+	err := s.repo.UpdateDeleteJob(ctx, id, entity.CategoryDeleteJobFailed, 0, reason.Error(), time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "update delete job")
+	}
+	return nil
+}
+
+func (s Category) deleteFiles(ctx context.Context, name string, filenames []string) error {
+	failed, err := s.storage.DeleteFiles(ctx, name, filenames)
+	if err != nil {
+		return errors.WithMessage(err, "delete files")
+	}
+	for filename, removeErr := range failed {
+		return errors.WithMessagef(removeErr, "delete file '%s'", filename)
+	}
+	return nil
+}
+
+func (s Category) info(
+	ctx context.Context,
+	name string,
+	managedByName map[string]entity.Category,
+	bucketExist bool,
+	cached bool,
+) (*entity.CategoryInfo, error) {
+	info := &entity.CategoryInfo{
+		Name:     name,
+		Status:   entity.CategoryStatusActive,
+		Settings: s.cfg.Defaults[name],
+	}
+	managed, isManaged := managedByName[name]
+	if isManaged {
+		info.Managed = true
+		info.Status = managed.Status
+		info.Settings = managed.Settings
+		info.CreatedAt = &managed.CreatedAt
+	}
+
+	if !bucketExist {
+		return info, nil
+	}
+	now := time.Now()
+	if cached {
+		stats, ok := s.stats.get(name, now)
+		if ok {
+			info.Stats = stats
+			return info, nil
+		}
+	}
+	stats, err := s.storage.CategoryStats(ctx, name)
+	switch {
+	case errors.Is(err, domain.ErrCategoryNotFound):
+		return info, nil
+	case err != nil:
+		return nil, errors.WithMessage(err, "category stats")
+	}
+	s.stats.put(name, *stats, now)
+	info.Stats = *stats
+	return info, nil
+}
+
+// checkLockedFiles категорию нельзя удалить, пока в ней есть заблокированные файлы
+func (s Category) checkLockedFiles(ctx context.Context, name string) error {
+	locked, err := s.lockRepo.HasLockedFiles(ctx, name, time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "has locked files")
+	}
+	if locked {
+		return errors.WithMessage(domain.ErrFileLocked, "category has locked files")
+	}
+	return nil
+}
+
+type cachedStats struct {
+	stats     entity.CategoryStats
+	expiresAt time.Time
+}
+
+// statsCache статистика категорий, полученная не раньше statsCacheTtl назад
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedStats
+}
+
+func (c *statsCache) get(name string, now time.Time) (entity.CategoryStats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[name]
+	if !ok || !now.Before(entry.expiresAt) {
+		return entity.CategoryStats{}, false
+	}
+	return entry.stats, true
+}
+
+func (c *statsCache) put(name string, stats entity.CategoryStats, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for cachedName, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, cachedName)
+		}
+	}
+	c.entries[name] = cachedStats{stats: stats, expiresAt: now.Add(statsCacheTtl)}
+}
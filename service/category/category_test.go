@@ -0,0 +1,310 @@
+package category_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/category"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+// repo записи категорий, транзакция откатывает изменения при ошибке
+type repo struct {
+	categories map[string]entity.Category
+	tokens     map[string]string
+	jobs       map[string]entity.CategoryDeleteJob
+	events     []entity.StorageEvent
+	jobErr     error
+}
+
+func newRepo() *repo {
+	return &repo{
+		categories: map[string]entity.Category{},
+		tokens:     map[string]string{},
+		jobs:       map[string]entity.CategoryDeleteJob{},
+	}
+}
+
+func (r *repo) CategoryTx(ctx context.Context, tx func(ctx context.Context, tx category.CategoryTx) error) error {
+	categories, tokens, jobs := maps.Clone(r.categories), maps.Clone(r.tokens), maps.Clone(r.jobs)
+	events := slices.Clone(r.events)
+	err := tx(ctx, r)
+	if err != nil {
+		r.categories, r.tokens, r.jobs, r.events = categories, tokens, jobs, events
+	}
+	return err
+}
+
+func (r *repo) InsertCategory(_ context.Context, category entity.Category) error {
+	r.categories[category.Name] = category
+	return nil
+}
+
+func (r *repo) GetCategory(_ context.Context, name string) (*entity.Category, error) {
+	category, ok := r.categories[name]
+	if !ok {
+		return nil, domain.ErrCategoryNotFound
+	}
+	return &category, nil
+}
+
+func (r *repo) GetCategories(context.Context) ([]entity.Category, error) {
+	return nil, nil
+}
+
+func (r *repo) UpsertCategoryStatus(_ context.Context, name string, status string, _ time.Time) error {
+	category := r.categories[name]
+	category.Name = name
+	category.Status = status
+	r.categories[name] = category
+	return nil
+}
+
+func (r *repo) InsertDeleteToken(_ context.Context, token entity.CategoryDeleteToken) error {
+	r.tokens[token.Token] = token.Category
+	return nil
+}
+
+func (r *repo) ConsumeDeleteToken(_ context.Context, token string, category string, _ time.Time) error {
+	if r.tokens[token] != category {
+		return domain.ErrInvalidConfirmationToken
+	}
+	delete(r.tokens, token)
+	return nil
+}
+
+func (r *repo) InsertDeleteJob(_ context.Context, job entity.CategoryDeleteJob) error {
+	if r.jobErr != nil {
+		return r.jobErr
+	}
+	r.jobs[job.Id] = job
+	return nil
+}
+
+func (r *repo) GetDeleteJob(_ context.Context, id string) (*entity.CategoryDeleteJob, error) {
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, domain.ErrCategoryDeleteJobNotFound
+	}
+	return &job, nil
+}
+
+func (r *repo) UpdateDeleteJob(_ context.Context, id string, status string, _ int, _ string, _ time.Time) error {
+	job := r.jobs[id]
+	job.Status = status
+	r.jobs[id] = job
+	return nil
+}
+
+func (r *repo) InsertEvent(_ context.Context, event entity.StorageEvent) (int64, error) {
+	r.events = append(r.events, event)
+	return int64(len(r.events)), nil
+}
+
+func (r *repo) DeleteCategoryData(_ context.Context, name string) error {
+	delete(r.categories, name)
+	return nil
+}
+
+type storage struct {
+	buckets    []string
+	files      []string
+	createErr  error
+	statsCalls int
+}
+
+func (s *storage) ListCategories(context.Context) ([]string, error) {
+	return s.buckets, nil
+}
+
+func (s *storage) IsCategoryExist(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+func (s *storage) CategoryStats(context.Context, string) (*entity.CategoryStats, error) {
+	s.statsCalls++
+	return &entity.CategoryStats{ObjectCount: 1}, nil
+}
+
+func (s *storage) CreateCategory(context.Context, string) error {
+	return s.createErr
+}
+
+func (s *storage) DeleteCategory(context.Context, string) error {
+	return nil
+}
+
+func (s *storage) ListFiles(_ context.Context, _ string, _ string, _ string, limit int) ([]string, error) {
+	return slices.Clone(s.files[:min(limit, len(s.files))]), nil
+}
+
+func (s *storage) DeleteFiles(_ context.Context, _ string, filenames []string) (map[string]error, error) {
+	s.files = slices.DeleteFunc(s.files, func(filename string) bool {
+		return slices.Contains(filenames, filename)
+	})
+	return nil, nil
+}
+
+type locks bool
+
+func (l locks) HasLockedFiles(context.Context, string, time.Time) (bool, error) {
+	return bool(l), nil
+}
+
+type enqueuer struct{}
+
+func (enqueuer) Enqueue(context.Context, bgjob.EnqueueRequest) error {
+	return nil
+}
+
+func newCategory(repo *repo, storage *storage, locked locks) category.Category {
+	return category.NewCategory(repo, repo, storage, locked, enqueuer{}, category.Config{
+		ConfirmationTokenTtl: time.Minute,
+		PageSize:             10,
+	})
+}
+
+func TestCreateWithoutBucketKeepsNoRecord(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	createErr := errors.New("minio is unavailable")
+	service := newCategory(repo, &storage{createErr: createErr}, false)
+
+	_, err := service.Create(t.Context(), "avatars", entity.CategorySettings{})
+	if !errors.Is(err, createErr) {
+		t.Fatalf("expected create error, got %v", err)
+	}
+	if len(repo.categories) != 0 {
+		t.Fatalf("category record must be rolled back, got %v", repo.categories)
+	}
+
+	service = newCategory(repo, &storage{}, false)
+	_, err = service.Create(t.Context(), "avatars", entity.CategorySettings{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, ok := repo.categories["avatars"]; !ok {
+		t.Fatal("category record is not saved")
+	}
+}
+
+func TestForceDeleteIsAtomic(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	repo.jobErr = errors.New("insert failed")
+	service := newCategory(repo, &storage{buckets: []string{"avatars"}}, false)
+
+	token, err := service.RequestForceDelete(t.Context(), "avatars")
+	if err != nil {
+		t.Fatalf("request force delete: %v", err)
+	}
+	_, err = service.ForceDelete(t.Context(), "avatars", token.Token)
+	if !errors.Is(err, repo.jobErr) {
+		t.Fatalf("expected insert job error, got %v", err)
+	}
+	if _, ok := repo.tokens[token.Token]; !ok {
+		t.Fatal("token must not be consumed without delete job")
+	}
+	if _, ok := repo.categories["avatars"]; ok {
+		t.Fatal("category status must not change without delete job")
+	}
+
+	repo.jobErr = nil
+	job, err := service.ForceDelete(t.Context(), "avatars", token.Token)
+	if err != nil {
+		t.Fatalf("force delete: %v", err)
+	}
+	if repo.categories["avatars"].Status != entity.CategoryStatusDeleting || repo.jobs[job.Id].Id != job.Id {
+		t.Fatalf("unexpected state %v %v", repo.categories, repo.jobs)
+	}
+	_, err = service.ForceDelete(t.Context(), "avatars", token.Token)
+	if !errors.Is(err, domain.ErrInvalidConfirmationToken) {
+		t.Fatalf("token must be consumed, got %v", err)
+	}
+}
+
+func TestForceDeleteLockedCategory(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	repo.tokens["token"] = "avatars"
+	service := newCategory(repo, &storage{buckets: []string{"avatars"}}, true)
+
+	_, err := service.ForceDelete(t.Context(), "avatars", "token")
+	if !errors.Is(err, domain.ErrFileLocked) {
+		t.Fatalf("expected locked error, got %v", err)
+	}
+	if _, ok := repo.tokens["token"]; !ok {
+		t.Fatal("token must not be consumed")
+	}
+}
+
+func TestProcessDeleteJobRecordsEvents(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	repo.tokens["token"] = "avatars"
+	storage := &storage{buckets: []string{"avatars"}, files: []string{".versions/a.png/1", "a.png", "b.png"}}
+	service := newCategory(repo, storage, false)
+
+	job, err := service.ForceDelete(t.Context(), "avatars", "token")
+	if err != nil {
+		t.Fatalf("force delete: %v", err)
+	}
+	done, err := service.ProcessDeleteJob(t.Context(), job.Id)
+	if err != nil || done {
+		t.Fatalf("expected first page to be deleted, got %v and %v", done, err)
+	}
+	done, err = service.ProcessDeleteJob(t.Context(), job.Id)
+	if err != nil || !done {
+		t.Fatalf("expected delete job to be done, got %v and %v", done, err)
+	}
+
+	deleted := make([]string, 0, len(repo.events))
+	for _, event := range repo.events {
+		if event.Type != entity.EventDeleted || event.Category != "avatars" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		deleted = append(deleted, event.Filename)
+	}
+	if !slices.Equal(deleted, []string{"a.png", "b.png"}) {
+		t.Fatalf("expected deleted events only for files, got %v", deleted)
+	}
+}
+
+func TestListCachesStats(t *testing.T) {
+	t.Parallel()
+
+	storage := &storage{buckets: []string{"avatars", "documents"}}
+	service := newCategory(newRepo(), storage, false)
+
+	for range 3 {
+		categories, err := service.List(t.Context())
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		if len(categories) != 2 || categories[0].Stats.ObjectCount != 1 {
+			t.Fatalf("unexpected categories %+v", categories)
+		}
+	}
+	if storage.statsCalls != 2 {
+		t.Fatalf("expected stats of each bucket to be listed once, got %d calls", storage.statsCalls)
+	}
+
+	_, err := service.Get(t.Context(), "avatars")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if storage.statsCalls != 3 {
+		t.Fatalf("get must return fresh stats, got %d calls", storage.statsCalls)
+	}
+}
@@ -0,0 +1,6 @@
+package category
+
+const (
+	WorkerQueueName = "category_delete"
+	jobType         = "category_delete"
+)
@@ -0,0 +1,153 @@
+package expiration
+
+import (
+	"context"
+	"storage-service/domain"
+	"storage-service/entity"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ExpirationTxRunner interface {
+	ExpirationTx(ctx context.Context, tx func(ctx context.Context, tx ExpiredFilesTx) error) error
+}
+
+type ExpiredFilesTx interface {
+	GetExpiredFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.FileToDelete, error)
+	DeleteExpiration(ctx context.Context, filename string, category string) error
+}
+
+type ExpirationRepo interface {
+	UpsertExpiration(ctx context.Context, filename string, category string, expiresAt time.Time) error
+	DeleteExpiration(ctx context.Context, filename string, category string) error
+	GetExpiration(ctx context.Context, filename string, category string) (*time.Time, error)
+}
+
+// Trash файл с истёкшим сроком жизни перемещается в корзину, как при удалении через API
+type Trash interface {
+	MoveToTrash(ctx context.Context, filename string, category string, deletedBy string) error
+}
+
+type Locks interface {
+	IsLocked(ctx context.Context, filename string, category string) (bool, error)
+}
+
+type Expiration struct {
+	txRunner        ExpirationTxRunner
+	trash           Trash
+	expirationRepo  ExpirationRepo
+	locks           Locks
+	maxDeletedFiles int
+}
+
+func NewExpiration(
+	txRunner ExpirationTxRunner,
+	trash Trash,
+	expirationRepo ExpirationRepo,
+	locks Locks,
+	maxDeletedFiles int,
+) Expiration {
+	return Expiration{
+		txRunner:        txRunner,
+		trash:           trash,
+		expirationRepo:  expirationRepo,
+		locks:           locks,
+		maxDeletedFiles: maxDeletedFiles,
+	}
+}
+
+// ExpiresAt вычисляет момент истечения срока жизни файла,
+// nil означает, что файл хранится бессрочно
+func ExpiresAt(now time.Time, expiresAt *time.Time, ttl time.Duration) (*time.Time, error) {
+	switch {
+	case expiresAt != nil && ttl != 0:
+		return nil, domain.NewInvalidArgumentError(
+			"only one of expiresAt and ttl can be specified",
+			domain.ErrCodeInvalidExpiration,
+		)
+	case ttl < 0:
+		return nil, domain.NewInvalidArgumentError("ttl must be positive", domain.ErrCodeInvalidExpiration)
+	case ttl > 0:
+		result := now.Add(ttl)
+		return &result, nil
+	case expiresAt != nil && !expiresAt.After(now):
+		return nil, domain.NewInvalidArgumentError("expiresAt must be in the future", domain.ErrCodeInvalidExpiration)
+	case expiresAt != nil:
+		result := expiresAt.UTC()
+		return &result, nil
+	default:
+		return nil, nil // nolint:nilnil
+	}
+}
+
+func (s Expiration) SetExpiration(ctx context.Context, filename string, category string, expiresAt *time.Time) error {
+	if expiresAt == nil {
+		err := s.expirationRepo.DeleteExpiration(ctx, filename, category)
+		if err != nil {
+			return errors.WithMessage(err, "delete expiration")
+		}
+		return nil
+	}
+
+	err := s.expirationRepo.UpsertExpiration(ctx, filename, category, *expiresAt)
+	if err != nil {
+		return errors.WithMessage(err, "upsert expiration")
+	}
+	return nil
+}
+
+func (s Expiration) GetExpiration(ctx context.Context, filename string, category string) (*time.Time, error) {
+	expiresAt, err := s.expirationRepo.GetExpiration(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get expiration")
+	}
+	return expiresAt, nil
+}
+
+// DeleteExpiredFiles перемещает файлы с истёкшим сроком жизни в корзину, срок жизни удаляется только у перемещённых файлов:
+// заблокированный файл будет удалён после снятия блокировки, перемещение после ошибки повторяется при следующем запуске
+func (s Expiration) DeleteExpiredFiles(ctx context.Context) error {
+	now := time.Now().UTC()
+	failed := 0
+	var firstErr error
+	err := s.txRunner.ExpirationTx(ctx, func(ctx context.Context, tx ExpiredFilesTx) error {
+		files, err := tx.GetExpiredFiles(ctx, now, s.maxDeletedFiles)
+		if err != nil {
+			return errors.WithMessage(err, "get expired files")
+		}
+		for _, file := range files {
+			// блокировка имеет приоритет над сроком жизни
+			locked, err := s.locks.IsLocked(ctx, file.Filename, file.Category)
+			if err != nil {
+				return errors.WithMessagef(err, "is file '%s' locked", file.Filename)
+			}
+			if locked {
+				continue
+			}
+
+			// событие deleted записывает корзина
+			err = s.trash.MoveToTrash(ctx, file.Filename, file.Category, "")
+			if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+				failed++
+				if firstErr == nil {
+					firstErr = errors.WithMessagef(err, "move file with name '%s' and category '%s' to trash", file.Filename, file.Category)
+				}
+				continue
+			}
+
+			err = tx.DeleteExpiration(ctx, file.Filename, file.Category)
+			if err != nil {
+				return errors.WithMessagef(err, "delete expiration of '%s'", file.Filename)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "expiration tx")
+	}
+	if firstErr != nil {
+		return errors.WithMessagef(firstErr, "%d files are not moved to trash", failed)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package expiration_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/expiration"
+
+	"github.com/pkg/errors"
+)
+
+func TestExpiresAt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		ttl       time.Duration
+		expected  *time.Time
+		invalid   bool
+	}{
+		{name: "without expiration"},
+		{name: "ttl", ttl: time.Hour, expected: &future},
+		{name: "expires at", expiresAt: &future, expected: &future},
+		{name: "both", expiresAt: &future, ttl: time.Hour, invalid: true},
+		{name: "negative ttl", ttl: -time.Second, invalid: true},
+		{name: "expires at in the past", expiresAt: &past, invalid: true},
+		{name: "expires at now", expiresAt: &now, invalid: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := expiration.ExpiresAt(now, test.expiresAt, test.ttl)
+			var invalidArgument domain.InvalidArgumentError
+			if test.invalid != errors.As(err, &invalidArgument) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			switch {
+			case test.expected == nil && result != nil:
+				t.Fatalf("expected no expiration, got %v", result)
+			case test.expected != nil && (result == nil || !result.Equal(*test.expected)):
+				t.Fatalf("expected %v, got %v", test.expected, result)
+			}
+		})
+	}
+}
+
+// expiredFiles сроки жизни файлов, транзакция откатывает изменения при ошибке
+type expiredFiles struct {
+	files map[string]bool
+}
+
+func (r *expiredFiles) ExpirationTx(ctx context.Context, tx func(ctx context.Context, tx expiration.ExpiredFilesTx) error) error {
+	files := maps.Clone(r.files)
+	err := tx(ctx, r)
+	if err != nil {
+		r.files = files
+	}
+	return err
+}
+
+func (r *expiredFiles) GetExpiredFiles(context.Context, time.Time, int) ([]entity.FileToDelete, error) {
+	files := make([]entity.FileToDelete, 0)
+	for _, filename := range slices.Sorted(maps.Keys(r.files)) {
+		files = append(files, entity.FileToDelete{Filename: filename, Category: "images"})
+	}
+	return files, nil
+}
+
+func (r *expiredFiles) DeleteExpiration(_ context.Context, filename string, _ string) error {
+	delete(r.files, filename)
+	return nil
+}
+
+type trash struct {
+	moved   []string
+	missing map[string]bool
+	failing map[string]bool
+}
+
+func (t *trash) MoveToTrash(_ context.Context, filename string, _ string, _ string) error {
+	switch {
+	case t.missing[filename]:
+		return errors.WithMessage(domain.ErrFileNotFound, "move file")
+	case t.failing[filename]:
+		return errors.New("minio is unavailable")
+	}
+	t.moved = append(t.moved, filename)
+	return nil
+}
+
+type locks map[string]bool
+
+func (l locks) IsLocked(_ context.Context, filename string, _ string) (bool, error) {
+	return l[filename], nil
+}
+
+func TestDeleteExpiredFilesMovesToTrash(t *testing.T) {
+	t.Parallel()
+
+	repo := &expiredFiles{files: map[string]bool{"expired": true, "missing": true}}
+	trash := &trash{missing: map[string]bool{"missing": true}}
+	service := expiration.NewExpiration(repo, trash, nil, locks{}, 10)
+
+	err := service.DeleteExpiredFiles(t.Context())
+	if err != nil {
+		t.Fatalf("delete expired files: %v", err)
+	}
+	if len(trash.moved) != 1 || trash.moved[0] != "expired" {
+		t.Fatalf("expected only expired file in trash, got %v", trash.moved)
+	}
+	if len(repo.files) != 0 {
+		t.Fatalf("expirations of handled files must be deleted, got %v", repo.files)
+	}
+}
+
+func TestDeleteExpiredFilesKeepsSkippedExpirations(t *testing.T) {
+	t.Parallel()
+
+	repo := &expiredFiles{files: map[string]bool{"expired": true, "locked": true, "failing": true}}
+	trash := &trash{failing: map[string]bool{"failing": true}}
+	service := expiration.NewExpiration(repo, trash, nil, locks{"locked": true}, 10)
+
+	err := service.DeleteExpiredFiles(t.Context())
+	if err == nil {
+		t.Fatal("expected error of failed move")
+	}
+	if !slices.Equal(trash.moved, []string{"expired"}) {
+		t.Fatalf("expected only expired file in trash, got %v", trash.moved)
+	}
+	expected := map[string]bool{"locked": true, "failing": true}
+	if !maps.Equal(repo.files, expected) {
+		t.Fatalf("expected expirations %v to be kept, got %v", expected, repo.files)
+	}
+}
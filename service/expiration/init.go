@@ -0,0 +1,23 @@
+package expiration
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const WorkerQueueName = "expired_files"
+
+func EnqueueSeedJob(ctx context.Context, client *bgjob.Client) error {
+	err := client.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    "expiration",
+		Queue: WorkerQueueName,
+		Type:  "expiration",
+	})
+	if err != nil && !errors.Is(err, bgjob.ErrJobAlreadyExist) {
+		return errors.WithMessage(err, "enqueue job")
+	}
+
+	return nil
+}
@@ -3,50 +3,187 @@ package service
 import (
 	"bytes"
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
-	"slices"
+	"time"
 
 	"storage-service/domain"
 	"storage-service/entity"
+	"storage-service/service/expiration"
+	"storage-service/service/pending"
+	"storage-service/service/quota"
+	"storage-service/service/transform"
+	"storage-service/service/validation"
 
 	"github.com/Falokut/go-kit/http/types"
+	"github.com/Falokut/go-kit/log"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+// stagingPrefix загружаемые без подтверждения файлы записываются под временным именем
+// и переносятся под своё имя после проверок
+const stagingPrefix = ".uploads/"
+
 //go:generate mockgen -source=repository.go -destination=mocks/imageStorage.go
 type FileStorage interface {
 	UploadFile(ctx context.Context, file entity.Metadata, reader io.Reader) error
 	GetFile(ctx context.Context, filename string, category string, opt *types.RangeOption) (*entity.Metadata, io.ReadSeekCloser, error)
 	IsFileExist(ctx context.Context, filename string, category string) (bool, error)
+	StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error)
+	MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
 	DeleteFile(ctx context.Context, filename string, category string) error
 }
 
 type Pending interface {
+	Begin(ctx context.Context, file entity.PendingFile, ttl time.Duration) (*time.Time, error)
+	Extend(ctx context.Context, fileName string, category string, ttl time.Duration) (*entity.PendingFile, error)
 	Enqueue(ctx context.Context, fileName string, category string) error
+	Fail(ctx context.Context, fileName string, category string, reason error) error
+	Get(ctx context.Context, fileName string, category string) (*entity.PendingFile, error)
+	IsStaged(ctx context.Context, fileName string, category string) (bool, error)
+	ValidateCommit(ctx context.Context, fileName string, category string, force bool) (*entity.PendingFile, error)
 	Rollback(ctx context.Context, fileName string, category string) error
-	Commit(ctx context.Context, fileName string, category string) error
+	Commit(ctx context.Context, fileName string, category string, force bool) error
+	GetGroup(ctx context.Context, groupId string, accessor entity.Accessor) (*entity.PendingGroup, error)
+	ExtendGroup(ctx context.Context, groupId string, ttl time.Duration, accessor entity.Accessor) (*entity.PendingGroup, error)
+	ValidateGroupCommit(ctx context.Context, groupId string, accessor entity.Accessor) ([]entity.PendingFile, error)
+	CommitGroup(ctx context.Context, groupId string, accessor entity.Accessor) error
+	RollbackGroup(ctx context.Context, groupId string, accessor entity.Accessor) error
+	List(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error)
+	Stats(ctx context.Context) ([]entity.PendingCategoryStats, error)
+	ForceExpire(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult
+	ListDeadLetters(ctx context.Context, category string, limit int, offset int) ([]entity.PendingDeadLetter, error)
+}
+
+type Trash interface {
+	MoveToTrash(ctx context.Context, filename string, category string, deletedBy string) error
+}
+
+type Expiration interface {
+	SetExpiration(ctx context.Context, filename string, category string, expiresAt *time.Time) error
+	GetExpiration(ctx context.Context, filename string, category string) (*time.Time, error)
+}
+
+type CategorySettings interface {
+	Settings(ctx context.Context, category string) (entity.CategorySettings, error)
+}
+
+type Versions interface {
+	ArchiveCurrent(ctx context.Context, filename string, category string) (string, error)
+	Discard(ctx context.Context, filename string, category string, versionId string) error
+	Trim(ctx context.Context, filename string, category string) error
+	Restore(ctx context.Context, filename string, category string, versionId string) error
+	ObjectKey(ctx context.Context, filename string, category string, versionId string) (string, error)
+}
+
+type Locks interface {
+	Check(ctx context.Context, filename string, category string) error
+	ApplyDefaults(ctx context.Context, filename string, category string) error
+	Release(ctx context.Context, filename string, category string) error
+}
+
+type UploadTxRunner interface {
+	UploadTx(ctx context.Context, tx func(ctx context.Context, tx UploadTx) error) error
+}
+
+// UploadTx срок жизни загруженного файла и событие о загрузке записываются вместе
+type UploadTx interface {
+	UpsertExpiration(ctx context.Context, filename string, category string, expiresAt time.Time) error
+	DeleteExpiration(ctx context.Context, filename string, category string) error
+	InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error)
+}
+
+type Quotas interface {
+	Reserve(
+		ctx context.Context,
+		category string,
+		client string,
+		size int64,
+		replacedBytes int64,
+		newObject bool,
+	) (*entity.QuotaReservation, int64, error)
+	Release(ctx context.Context, reservation entity.QuotaReservation) error
+}
+
+type Antivirus interface {
+	Quarantine(ctx context.Context, category string, objectKey string, filename string, mode string) (string, error)
+	Defer(ctx context.Context, scanId string) error
+	Scan(ctx context.Context, scanId string) (*entity.ScanResult, error)
+	CheckAccess(ctx context.Context, category string, objectKey string) error
+}
+
+type Validators interface {
+	Start(cfg entity.CategoryValidation, header []byte, contentType string) (*validation.Run, error)
+}
+
+type ImageTransformer interface {
+	Supports(contentType string) bool
+	// Transform возвращает поток без метаданных, ошибки разбора изображения возвращаются при чтении
+	Transform(contentType string, reader io.Reader) io.Reader
 }
 
 type Files struct {
-	storage            FileStorage
-	supportedFileTypes []string
-	pendingSrv         Pending
+	storage          FileStorage
+	validators       Validators
+	pendingSrv       Pending
+	trashSrv         Trash
+	expirationSrv    Expiration
+	categories       CategorySettings
+	imageTransformer ImageTransformer
+	versionsSrv      Versions
+	lockSrv          Locks
+	txRunner         UploadTxRunner
+	quotas           Quotas
+	antivirus        Antivirus
+	logger           log.Logger
 }
 
-func NewFiles(storage FileStorage, supportedFileTypes []string, pendingSrv Pending) Files {
+func NewFiles(
+	storage FileStorage,
+	validators Validators,
+	pendingSrv Pending,
+	trashSrv Trash,
+	expirationSrv Expiration,
+	categories CategorySettings,
+	imageTransformer ImageTransformer,
+	versionsSrv Versions,
+	lockSrv Locks,
+	txRunner UploadTxRunner,
+	quotas Quotas,
+	antivirus Antivirus,
+	logger log.Logger,
+) Files {
 	return Files{
-		storage:            storage,
-		supportedFileTypes: supportedFileTypes,
-		pendingSrv:         pendingSrv,
+		storage:          storage,
+		validators:       validators,
+		pendingSrv:       pendingSrv,
+		trashSrv:         trashSrv,
+		expirationSrv:    expirationSrv,
+		categories:       categories,
+		imageTransformer: imageTransformer,
+		versionsSrv:      versionsSrv,
+		lockSrv:          lockSrv,
+		txRunner:         txRunner,
+		quotas:           quotas,
+		antivirus:        antivirus,
+		logger:           logger,
 	}
 }
 
-func (s Files) UploadFile(ctx context.Context, req entity.UploadFileRequest) (string, error) {
+func (s Files) UploadFile(ctx context.Context, req entity.UploadFileRequest) (*entity.UploadedFile, error) {
 	if req.ContentReader == nil {
-		return "", domain.NewInvalidArgumentError("file has zero size", domain.ErrCodeFileHasZeroSize)
+		return nil, domain.NewInvalidArgumentError("file has zero size", domain.ErrCodeFileHasZeroSize)
+	}
+	if req.GroupId != "" && !req.Pending {
+		return nil, domain.NewInvalidArgumentError("groupId requires pending upload", domain.ErrCodePendingInGroup)
+	}
+
+	expiresAt, err := expiration.ExpiresAt(time.Now().UTC(), req.ExpiresAt, req.Ttl)
+	if err != nil {
+		return nil, errors.WithMessage(err, "calc expiration")
 	}
 
 	header := make([]byte, 512)
@@ -55,83 +192,787 @@ func (s Files) UploadFile(ctx context.Context, req entity.UploadFileRequest) (st
 
 	contentType := mimetype.Detect(header[:n]).String()
 
-	if len(s.supportedFileTypes) != 0 && !slices.Contains(s.supportedFileTypes, contentType) {
-		return "", domain.NewInvalidArgumentError(
-			fmt.Sprintf("file type is not supported. file type: '%s'", contentType),
-			domain.ErrCodeUnsupportedFileType,
-		)
+	settings, err := s.categories.Settings(ctx, req.Category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get category settings")
 	}
 
+	// проверки видят исходное содержимое, до удаления метаданных изображения
+	checks, err := s.validators.Start(settings.Validation, header[:n], contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer checks.Close()
+	reader = checks.Reader(reader)
+
 	filename := req.Filename
 	if filename == "" {
 		filename = uuid.NewString()
 	}
 
+	err = s.lockSrv.Check(ctx, filename, req.Category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "check lock")
+	}
+
+	// перезапись передаёт файл новому владельцу, поэтому разрешена только владельцу текущего файла,
+	// pending загрузка заменит текущий файл при подтверждении и проверяется так же
+	current, err := s.storage.StatFile(ctx, filename, req.Category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return nil, errors.WithMessage(err, "stat file")
+	}
+	if current != nil && !current.CanModify(req.Accessor) {
+		return nil, domain.AccessDenied(req.Accessor.Anonymous())
+	}
+	if req.Pending {
+		// место текущего файла освобождается только при подтверждении
+		current = nil
+	}
+
 	metadata := entity.Metadata{
 		Filename:    filename,
 		PrettyName:  req.PrettyName,
 		Category:    req.Category,
 		ContentType: contentType,
 		Size:        -1, // размер неизвестен заранее
+		Owner:       req.Accessor.Subject,
+		Visibility:  visibility(req.Visibility, settings),
+	}
+	if settings.StripImageMetadata && s.imageTransformer.Supports(contentType) {
+		reader = s.imageTransformer.Transform(contentType, reader)
+	}
+
+	if settings.Versioning {
+		metadata.VersionId = uuid.NewString()
+	}
+
+	// перезаписанный без версионирования объект освобождает место, версионирование сохраняет его отдельным объектом
+	replacedBytes := int64(0)
+	newObject := current == nil || settings.Versioning
+	if !newObject {
+		replacedBytes = current.Size
+	}
+	reservation, allowance, err := s.quotas.Reserve(ctx, req.Category, metadata.Owner, req.Size, replacedBytes, newObject)
+	if err != nil {
+		return nil, errors.WithMessage(err, "reserve quota")
 	}
+	// записанный объект учитывается хранилищем, поэтому резерв освобождается и после успешной загрузки, и после ошибки
+	defer func() {
+		s.logRollback(ctx, "release quota", filename, req.Category, s.quotas.Release(ctx, *reservation))
+	}()
+	limited := quota.NewLimitedReader(reader, allowance)
 
-	// Если файл Pending
+	// Если файл Pending, он загружается в область pending и не виден под своим именем до Commit,
+	// иначе загружается под временным именем и заменяет текущий файл только после всех проверок
 	if req.Pending {
-		err := s.pendingSrv.Enqueue(ctx, filename, req.Category)
+		metadata.Filename = pending.ObjectName(filename)
+	} else {
+		metadata.Filename = stagingObjectName()
+	}
+
+	var pendingExpiresAt *time.Time
+	if req.Pending {
+		pendingExpiresAt, err = s.pendingSrv.Begin(ctx, entity.PendingFile{
+			Filename:      filename,
+			Category:      req.Category,
+			GroupId:       req.GroupId,
+			UploadedBy:    req.UploadedBy,
+			FileExpiresAt: expiresAt,
+		}, req.PendingTtl)
 		if err != nil {
-			return "", errors.WithMessage(err, "enqueue pending file")
+			return nil, errors.WithMessage(err, "begin pending upload")
+		}
+	}
+
+	// файл на карантине с момента появления в хранилище до завершения проверки
+	scanId := ""
+	if settings.ScanMode != "" {
+		scanId, err = s.antivirus.Quarantine(ctx, req.Category, metadata.Filename, filename, settings.ScanMode)
+		if err != nil {
+			if req.Pending {
+				s.logRollback(ctx, "fail pending file", filename, req.Category, s.pendingSrv.Fail(ctx, filename, req.Category, err))
+			}
+			return nil, errors.WithMessage(err, "quarantine file")
 		}
 	}
 
 	// Streaming upload в хранилище
-	err := s.storage.UploadFile(ctx, metadata, reader)
+	hash := sha256.New()
+	counter := &countingReader{reader: io.TeeReader(limited, hash)}
+	err = s.storage.UploadFile(ctx, metadata, counter)
+	if err != nil {
+		// ошибки отката не должны скрыть ошибку загрузки
+		if req.Pending {
+			s.logRollback(ctx, "fail pending file", filename, req.Category, s.pendingSrv.Fail(ctx, filename, req.Category, err))
+		}
+		if scanId != "" {
+			// воркер проверит то, что осталось в хранилище, или снимет карантин, если объекта нет
+			s.logRollback(ctx, "defer scan", filename, req.Category, s.antivirus.Defer(ctx, scanId))
+		}
+		if limited.Exceeded() {
+			return nil, domain.ErrQuotaExceeded
+		}
+		if checks.Err() != nil {
+			return nil, checks.Err()
+		}
+		if errors.Is(err, transform.ErrInvalidImage) {
+			// текст ошибки разбора не возвращается клиенту
+			return nil, domain.NewInvalidArgumentError("invalid image", domain.ErrCodeInvalidImage)
+		}
+		return nil, errors.WithMessage(err, "save file")
+	}
+
+	// проверки, которым нужно всё содержимое, завершаются после записи, отклонённый файл удаляется
+	err = checks.Finish()
+	if err != nil {
+		s.discardUpload(ctx, req, filename, metadata.Filename, err)
+		return nil, err
+	}
+
+	quarantined := scanId != ""
+	if settings.ScanMode == entity.ScanModeSync {
+		result, err := s.antivirus.Scan(ctx, scanId)
+		switch {
+		case err != nil:
+			// недоступность антивируса не отклоняет загрузку, файл остаётся на карантине до проверки воркером
+			err = s.antivirus.Defer(ctx, scanId)
+			if err != nil {
+				s.discardUpload(ctx, req, filename, metadata.Filename, err)
+				return nil, errors.WithMessage(err, "defer scan")
+			}
+		case result.Infected:
+			s.discardUpload(ctx, req, filename, metadata.Filename, domain.ErrFileInfected)
+			return nil, errors.WithMessagef(domain.ErrFileInfected, "signature '%s'", result.Signature)
+		default:
+			quarantined = false
+		}
+	}
+
+	if req.Pending {
+		err = s.pendingSrv.Enqueue(ctx, filename, req.Category)
+		if err != nil {
+			// загрузка могла быть отменена во время записи, записанный объект не должен остаться в области pending
+			s.discardUpload(ctx, req, filename, metadata.Filename, err)
+			return nil, errors.WithMessage(err, "enqueue pending file")
+		}
+	} else {
+		archivedVersionId, err := s.replace(ctx, metadata.Filename, filename, req.Category, settings.Versioning)
+		if err != nil {
+			s.discardUpload(ctx, req, filename, metadata.Filename, err)
+			return nil, errors.WithMessage(err, "replace file")
+		}
+		overwritten := archivedVersionId != "" || current != nil
+
+		// pending файл блокируется только после подтверждения загрузки,
+		// файл уже записан, поэтому ошибка блокировки не возвращается клиенту
+		err = s.lockSrv.ApplyDefaults(ctx, filename, req.Category)
+		if err != nil {
+			s.logger.Error(ctx, "files: apply default lock",
+				log.String("filename", filename),
+				log.String("category", req.Category),
+				log.Any("error", err),
+			)
+		}
+
+		eventType := entity.EventUploaded
+		if overwritten {
+			eventType = entity.EventOverwritten
+		}
+		// событие публикует воркер outbox
+		event := entity.NewStorageEvent(eventType, filename, req.Category, req.UploadedBy)
+		err = s.txRunner.UploadTx(ctx, func(ctx context.Context, tx UploadTx) error {
+			// срок жизни меняется только после записи файла, перезаписанный файл без срока жизни хранится бессрочно
+			err := setExpiration(ctx, tx, filename, req.Category, expiresAt)
+			if err != nil {
+				return errors.WithMessage(err, "set expiration")
+			}
+			_, err = tx.InsertEvent(ctx, event)
+			if err != nil {
+				return errors.WithMessage(err, "insert event")
+			}
+			return nil
+		})
+		if err != nil {
+			// файл уже записан, ошибка в ответе заставила бы клиента повторить успешную загрузку
+			s.logger.Error(ctx, "files: record upload",
+				log.String("filename", filename),
+				log.String("category", req.Category),
+				log.Any("error", err),
+			)
+		}
+	}
+
+	return &entity.UploadedFile{
+		Filename:         filename,
+		Size:             counter.n,
+		Checksum:         hex.EncodeToString(hash.Sum(nil)),
+		VersionId:        metadata.VersionId,
+		ExpiresAt:        expiresAt,
+		PendingExpiresAt: pendingExpiresAt,
+		Owner:            metadata.Owner,
+		Visibility:       metadata.Visibility,
+		Quarantined:      quarantined,
+	}, nil
+}
+
+func setExpiration(ctx context.Context, tx UploadTx, filename string, category string, expiresAt *time.Time) error {
+	if expiresAt == nil {
+		return tx.DeleteExpiration(ctx, filename, category)
+	}
+	return tx.UpsertExpiration(ctx, filename, category, *expiresAt)
+}
+
+// discardUpload удаляет отклонённый объект, записанный под временным именем, текущий файл не меняется,
+// pending загрузка отмечается неудачной и её объект удаляет сервис pending.
+// Ошибки отката не должны скрыть причину отклонения
+func (s Files) discardUpload(
+	ctx context.Context,
+	req entity.UploadFileRequest,
+	filename string,
+	objectName string,
+	reason error,
+) {
+	if req.Pending {
+		err := s.pendingSrv.Fail(ctx, filename, req.Category, reason)
+		if err == nil {
+			return
+		}
+		// загрузка уже не в статусе uploading, например, отменена параллельно, объект удаляется здесь
+		s.logRollback(ctx, "fail pending file", filename, req.Category, err)
+	}
+	err := s.storage.DeleteFile(ctx, objectName, req.Category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		s.logRollback(ctx, "delete staged file", objectName, req.Category, err)
+	}
+}
+
+// replace заменяет текущий файл загруженным объектом, при версионировании текущее содержимое
+// предварительно копируется в версию. Возвращает идентификатор сохранённой версии
+func (s Files) replace(ctx context.Context, objectName string, filename string, category string, versioning bool) (string, error) {
+	archivedVersionId, err := s.archiveCurrent(ctx, filename, category, versioning)
+	if err != nil {
+		return "", err
+	}
+	err = s.storage.MoveFile(ctx, category, objectName, filename)
+	if err != nil {
+		return "", s.discardVersion(ctx, filename, category, archivedVersionId, errors.WithMessage(err, "move file"))
+	}
+	s.trimVersions(ctx, filename, category, archivedVersionId)
+	return archivedVersionId, nil
+}
+
+// archiveCurrent копирует текущее содержимое в версию, если в категории включено версионирование
+func (s Files) archiveCurrent(ctx context.Context, filename string, category string, versioning bool) (string, error) {
+	if !versioning {
+		return "", nil
+	}
+	versionId, err := s.versionsSrv.ArchiveCurrent(ctx, filename, category)
 	if err != nil {
-		return "", errors.WithMessage(err, "save file")
+		return "", errors.WithMessagef(err, "archive current version of '%s'", filename)
 	}
+	return versionId, nil
+}
 
-	return filename, nil
+// discardVersion удаляет версию, сохранённую для незавершённой замены, и возвращает причину отмены
+func (s Files) discardVersion(ctx context.Context, filename string, category string, versionId string, reason error) error {
+	if versionId == "" {
+		return reason
+	}
+	err := s.versionsSrv.Discard(ctx, filename, category, versionId)
+	if err != nil {
+		return errors.WithMessagef(reason, "discard version '%s': %v", versionId, err)
+	}
+	return reason
+}
+
+// trimVersions удаляет версии сверх ограничения категории после замены файла,
+// файл уже заменён, поэтому ошибка не возвращается: лишние версии удалятся при следующей замене
+func (s Files) trimVersions(ctx context.Context, filename string, category string, versionId string) {
+	if versionId == "" {
+		return
+	}
+	err := s.versionsSrv.Trim(ctx, filename, category)
+	if err != nil {
+		s.logger.Error(ctx, "files: trim versions",
+			log.String("filename", filename),
+			log.String("category", category),
+			log.Any("error", err),
+		)
+	}
+}
+
+func (s Files) logRollback(ctx context.Context, action string, filename string, category string, err error) {
+	if err == nil {
+		return
+	}
+	s.logger.Error(ctx, "files: rollback: "+action,
+		log.String("filename", filename),
+		log.String("category", category),
+		log.Any("error", err),
+	)
 }
 
 func (s Files) GetFile(
 	ctx context.Context,
-	req domain.FileRequest,
+	req domain.GetFileRequest,
 	opt *types.RangeOption,
+	accessor entity.Accessor,
 ) (*entity.Metadata, io.ReadSeekCloser, error) {
-	metadata, contentReader, err := s.storage.GetFile(ctx, req.Filename, req.Category, opt)
+	objectKey := req.Filename
+	if req.VersionId != "" {
+		var err error
+		objectKey, err = s.versionsSrv.ObjectKey(ctx, req.Filename, req.Category, req.VersionId)
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "get version object key")
+		}
+	}
+
+	metadata, contentReader, err := s.storage.GetFile(ctx, objectKey, req.Category, opt)
+	if errors.Is(err, domain.ErrFileNotFound) && req.IncludePending && req.VersionId == "" {
+		objectKey = pending.ObjectName(req.Filename)
+		metadata, contentReader, err = s.storage.GetFile(ctx, objectKey, req.Category, opt)
+	}
 	if err != nil {
 		return nil, nil, errors.WithMessage(err, "get file")
 	}
+	if !metadata.CanRead(accessor) {
+		_ = contentReader.Close()
+		return nil, nil, domain.AccessDenied(accessor.Anonymous())
+	}
+	err = s.antivirus.CheckAccess(ctx, req.Category, objectKey)
+	if err != nil {
+		_ = contentReader.Close()
+		return nil, nil, errors.WithMessage(err, "check antivirus scan")
+	}
+	metadata.Filename = req.Filename
+
+	metadata.ExpiresAt, err = s.expirationSrv.GetExpiration(ctx, req.Filename, req.Category)
+	if err != nil {
+		_ = contentReader.Close()
+		return nil, nil, errors.WithMessage(err, "get expiration")
+	}
 	return metadata, contentReader, nil
 }
 
-func (s Files) IsFileExist(ctx context.Context, req domain.FileRequest) (bool, error) {
+func (s Files) SetExpiration(ctx context.Context, req domain.SetExpirationRequest, accessor entity.Accessor) (*time.Time, error) {
+	expiresAt, err := expiration.ExpiresAt(
+		time.Now().UTC(),
+		req.ExpiresAt,
+		time.Duration(req.Ttl)*time.Second,
+	)
+	if err != nil {
+		return nil, errors.WithMessage(err, "calc expiration")
+	}
+
+	metadata, err := s.storage.StatFile(ctx, req.Filename, req.Category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "stat file")
+	}
+	if !metadata.CanModify(accessor) {
+		return nil, domain.AccessDenied(accessor.Anonymous())
+	}
+
+	err = s.expirationSrv.SetExpiration(ctx, req.Filename, req.Category, expiresAt)
+	if err != nil {
+		return nil, errors.WithMessage(err, "set expiration")
+	}
+	return expiresAt, nil
+}
+
+func (s Files) IsFileExist(ctx context.Context, req domain.FileExistRequest, accessor entity.Accessor) (bool, error) {
+	err := s.checkRead(ctx, req.Filename, req.Category, accessor)
+	if err != nil {
+		return false, err
+	}
 	exists, err := s.storage.IsFileExist(ctx, req.Filename, req.Category)
 	if err != nil {
 		return false, errors.WithMessage(err, "is file exist")
 	}
-	return exists, nil
+	if exists || !req.IncludePending {
+		return exists, nil
+	}
+
+	err = s.checkRead(ctx, pending.ObjectName(req.Filename), req.Category, accessor)
+	if err != nil {
+		return false, err
+	}
+	staged, err := s.pendingSrv.IsStaged(ctx, req.Filename, req.Category)
+	if err != nil {
+		return false, errors.WithMessage(err, "is file staged")
+	}
+	return staged, nil
 }
 
-func (s Files) DeleteFile(ctx context.Context, req domain.FileRequest) error {
-	err := s.storage.DeleteFile(ctx, req.Filename, req.Category)
+func (s Files) DeleteFile(ctx context.Context, req domain.FileRequest, deletedBy string, accessor entity.Accessor) error {
+	err := s.checkModify(ctx, req.Filename, req.Category, accessor)
+	if err != nil {
+		return err
+	}
+
+	err = s.lockSrv.Check(ctx, req.Filename, req.Category)
+	if err != nil {
+		return errors.WithMessage(err, "check lock")
+	}
+
+	err = s.trashSrv.MoveToTrash(ctx, req.Filename, req.Category, deletedBy)
 	if err != nil {
 		return errors.WithMessage(err, "delete file")
 	}
+
+	err = s.lockSrv.Release(ctx, req.Filename, req.Category)
+	if err != nil {
+		return errors.WithMessage(err, "release lock")
+	}
 	return nil
 }
 
-func (s Files) Rollback(ctx context.Context, req domain.FileRequest) error {
-	err := s.pendingSrv.Rollback(ctx, req.Filename, req.Category)
+func (s Files) Rollback(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) error {
+	err := s.checkModify(ctx, pending.ObjectName(req.Filename), req.Category, accessor)
+	if err != nil {
+		return err
+	}
+
+	err = s.pendingSrv.Rollback(ctx, req.Filename, req.Category)
 	if err != nil {
 		return errors.WithMessage(err, "rollback file")
 	}
 	return nil
 }
 
-func (s Files) Commit(ctx context.Context, req domain.FileRequest) error {
-	err := s.pendingSrv.Commit(ctx, req.Filename, req.Category)
+// GetPending состояние загрузки, доступное тем, кто может прочитать загруженный объект или заменяемый им файл
+func (s Files) GetPending(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) (*entity.PendingFile, error) {
+	err := s.checkRead(ctx, pending.ObjectName(req.Filename), req.Category, accessor)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkRead(ctx, req.Filename, req.Category, accessor)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.pendingSrv.Get(ctx, req.Filename, req.Category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending file")
+	}
+	return file, nil
+}
+
+func (s Files) ExtendPending(ctx context.Context, req domain.ExtendPendingRequest, accessor entity.Accessor) (*entity.PendingFile, error) {
+	err := s.checkModify(ctx, pending.ObjectName(req.Filename), req.Category, accessor)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.pendingSrv.Extend(ctx, req.Filename, req.Category, time.Duration(req.Ttl)*time.Second)
+	if err != nil {
+		return nil, errors.WithMessage(err, "extend pending file")
+	}
+	return file, nil
+}
+
+// Commit подтверждает загрузку владельцем загрузки, если загрузка заменяет файл, он также должен принадлежать accessor
+func (s Files) Commit(ctx context.Context, req domain.FileRequest, accessor entity.Accessor) error {
+	err := s.checkCommit(ctx, req.Filename, req.Category, accessor)
+	if err != nil {
+		return err
+	}
+	return s.commit(ctx, req.Filename, req.Category, false)
+}
+
+// checkCommit проверяет владельца загрузки в области pending и файла, который она заменит
+func (s Files) checkCommit(ctx context.Context, filename string, category string, accessor entity.Accessor) error {
+	err := s.checkModify(ctx, pending.ObjectName(filename), category, accessor)
+	if err != nil {
+		return err
+	}
+	return s.checkModify(ctx, filename, category, accessor)
+}
+
+// checkModify проверяет, что accessor владеет объектом, отсутствие объекта обрабатывает вызывающая операция
+func (s Files) checkModify(ctx context.Context, objectName string, category string, accessor entity.Accessor) error {
+	if accessor.Unrestricted {
+		return nil
+	}
+	metadata, err := s.storage.StatFile(ctx, objectName, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return nil
+	case err != nil:
+		return errors.WithMessage(err, "stat file")
+	case !metadata.CanModify(accessor):
+		return domain.AccessDenied(accessor.Anonymous())
+	default:
+		return nil
+	}
+}
+
+// checkRead проверяет видимость объекта для accessor, отсутствующий объект проверку проходит
+func (s Files) checkRead(ctx context.Context, objectName string, category string, accessor entity.Accessor) error {
+	if accessor.Unrestricted {
+		return nil
+	}
+	metadata, err := s.storage.StatFile(ctx, objectName, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return nil
+	case err != nil:
+		return errors.WithMessage(err, "stat file")
+	case !metadata.CanRead(accessor):
+		return domain.AccessDenied(accessor.Anonymous())
+	default:
+		return nil
+	}
+}
+
+// ListPending список загрузок для администратора
+func (s Files) ListPending(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error) {
+	files, err := s.pendingSrv.List(ctx, filter)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list pending files")
+	}
+	return files, nil
+}
+
+func (s Files) PendingStats(ctx context.Context) ([]entity.PendingCategoryStats, error) {
+	stats, err := s.pendingSrv.Stats(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending stats")
+	}
+	return stats, nil
+}
+
+func (s Files) ListPendingDeadLetters(ctx context.Context, req domain.PendingDeadLetterListRequest) ([]entity.PendingDeadLetter, error) {
+	deadLetters, err := s.pendingSrv.ListDeadLetters(ctx, req.Category, req.Limit, req.Offset)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list pending dead letters")
+	}
+	return deadLetters, nil
+}
+
+func (s Files) ForceExpirePending(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult {
+	return s.pendingSrv.ForceExpire(ctx, files)
+}
+
+// ForceCommitPending подтверждает загрузки без учёта срока подтверждения,
+// каждая загрузка подтверждается независимо от остальных
+func (s Files) ForceCommitPending(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult {
+	results := make([]entity.PendingActionResult, 0, len(files))
+	for _, file := range files {
+		result := entity.PendingActionResult{
+			Filename: file.Filename,
+			Category: file.Category,
+			Status:   entity.PendingStatusCommitted,
+		}
+		err := s.commit(ctx, file.Filename, file.Category, true)
+		switch {
+		case errors.Is(err, domain.ErrPendingFileNotFound):
+			result.Status = entity.PendingActionNotFound
+		case err != nil:
+			result.Status = entity.PendingActionError
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s Files) commit(ctx context.Context, filename string, category string, force bool) error {
+	file, err := s.pendingSrv.ValidateCommit(ctx, filename, category, force)
+	if err != nil {
+		return errors.WithMessage(err, "validate commit")
+	}
+
+	// подтверждение перезаписывает файл с тем же именем
+	err = s.lockSrv.Check(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "check lock")
+	}
+
+	settings, err := s.categories.Settings(ctx, category)
+	if err != nil {
+		return errors.WithMessage(err, "get category settings")
+	}
+	archivedVersionId, err := s.archiveCurrent(ctx, filename, category, settings.Versioning)
+	if err != nil {
+		return err
+	}
+
+	err = s.pendingSrv.Commit(ctx, filename, category, force)
+	if err != nil {
+		return s.discardVersion(ctx, filename, category, archivedVersionId, errors.WithMessage(err, "commit file"))
+	}
+	s.trimVersions(ctx, filename, category, archivedVersionId)
+
+	// срок жизни, указанный при загрузке, применяется к подтверждённому файлу
+	err = s.expirationSrv.SetExpiration(ctx, filename, category, file.FileExpiresAt)
+	if err != nil {
+		return errors.WithMessage(err, "set expiration")
+	}
+
+	err = s.lockSrv.ApplyDefaults(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "apply default lock")
+	}
+	return nil
+}
+
+func (s Files) GetPendingGroup(
+	ctx context.Context,
+	req domain.PendingGroupRequest,
+	accessor entity.Accessor,
+) (*entity.PendingGroup, error) {
+	group, err := s.pendingSrv.GetGroup(ctx, req.GroupId, accessor)
 	if err != nil {
-		return errors.WithMessage(err, "commit file")
+		return nil, errors.WithMessage(err, "get pending group")
+	}
+	return group, nil
+}
+
+func (s Files) ExtendPendingGroup(
+	ctx context.Context,
+	req domain.ExtendPendingGroupRequest,
+	accessor entity.Accessor,
+) (*entity.PendingGroup, error) {
+	err := s.checkGroupModify(ctx, req.GroupId, accessor)
+	if err != nil {
+		return nil, err
+	}
+	group, err := s.pendingSrv.ExtendGroup(ctx, req.GroupId, time.Duration(req.Ttl)*time.Second, accessor)
+	if err != nil {
+		return nil, errors.WithMessage(err, "extend pending group")
+	}
+	return group, nil
+}
+
+// RollbackGroup отменяет группу, загрузки которой принадлежат accessor
+func (s Files) RollbackGroup(ctx context.Context, req domain.PendingGroupRequest, accessor entity.Accessor) error {
+	err := s.checkGroupModify(ctx, req.GroupId, accessor)
+	if err != nil {
+		return err
+	}
+	err = s.pendingSrv.RollbackGroup(ctx, req.GroupId, accessor)
+	if err != nil {
+		return errors.WithMessage(err, "rollback group")
+	}
+	return nil
+}
+
+// checkGroupModify проверяет, что все загрузки группы принадлежат accessor
+func (s Files) checkGroupModify(ctx context.Context, groupId string, accessor entity.Accessor) error {
+	if accessor.Unrestricted {
+		return nil
+	}
+	group, err := s.pendingSrv.GetGroup(ctx, groupId, accessor)
+	if err != nil {
+		return errors.WithMessage(err, "get pending group")
+	}
+	for _, file := range group.Files {
+		err = s.checkModify(ctx, pending.ObjectName(file.Filename), file.Category, accessor)
+		if err != nil {
+			return errors.WithMessagef(err, "check owner of '%s'", file.Filename)
+		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// CommitGroup подтверждает все файлы группы, при ошибке ни один файл группы не становится видимым
+func (s Files) CommitGroup(ctx context.Context, req domain.PendingGroupRequest, accessor entity.Accessor) error {
+	files, err := s.pendingSrv.ValidateGroupCommit(ctx, req.GroupId, accessor)
+	if err != nil {
+		return errors.WithMessage(err, "validate group commit")
+	}
+	for _, file := range files {
+		err = s.checkCommit(ctx, file.Filename, file.Category, accessor)
+		if err != nil {
+			return errors.WithMessagef(err, "check owner of '%s'", file.Filename)
+		}
+	}
+
+	for _, file := range files {
+		err = s.lockSrv.Check(ctx, file.Filename, file.Category)
+		if err != nil {
+			return errors.WithMessagef(err, "check lock of '%s'", file.Filename)
+		}
+	}
+
+	archived := make([]archivedVersion, 0)
+	discard := func(reason error) error {
+		for _, version := range archived {
+			reason = s.discardVersion(ctx, version.filename, version.category, version.versionId, reason)
+		}
+		return reason
+	}
+	for _, file := range files {
+		settings, err := s.categories.Settings(ctx, file.Category)
+		if err != nil {
+			return discard(errors.WithMessage(err, "get category settings"))
+		}
+		versionId, err := s.archiveCurrent(ctx, file.Filename, file.Category, settings.Versioning)
+		if err != nil {
+			return discard(err)
+		}
+		if versionId != "" {
+			archived = append(archived, archivedVersion{
+				filename:  file.Filename,
+				category:  file.Category,
+				versionId: versionId,
+			})
+		}
+	}
+
+	err = s.pendingSrv.CommitGroup(ctx, req.GroupId, accessor)
+	switch {
+	case errors.Is(err, domain.ErrPendingFileCommitting):
+		// часть файлов уже доступна под своими именами, сохранённые версии остаются, подтверждение завершит воркер
+		return errors.WithMessage(err, "commit group")
+	case err != nil:
+		return discard(errors.WithMessage(err, "commit group"))
+	}
+	for _, version := range archived {
+		s.trimVersions(ctx, version.filename, version.category, version.versionId)
+	}
+
+	for _, file := range files {
+		err = s.expirationSrv.SetExpiration(ctx, file.Filename, file.Category, file.FileExpiresAt)
+		if err != nil {
+			return errors.WithMessagef(err, "set expiration of '%s'", file.Filename)
+		}
+		err = s.lockSrv.ApplyDefaults(ctx, file.Filename, file.Category)
+		if err != nil {
+			return errors.WithMessagef(err, "apply default lock of '%s'", file.Filename)
+		}
+	}
+	return nil
+}
+
+// visibility видимость загружаемого файла: указанная при загрузке, по умолчанию категории или internal
+func visibility(requested string, settings entity.CategorySettings) string {
+	switch {
+	case requested != "":
+		return requested
+	case settings.DefaultVisibility != "":
+		return settings.DefaultVisibility
+	default:
+		return entity.VisibilityInternal
+	}
+}
+
+// stagingObjectName временное имя объекта для загрузки, которая ещё не прошла проверки
+func stagingObjectName() string {
+	return stagingPrefix + uuid.NewString()
+}
+
+type archivedVersion struct {
+	filename  string
+	category  string
+	versionId string
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,306 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service"
+	"storage-service/service/pending"
+	"storage-service/service/validation"
+
+	"github.com/Falokut/go-kit/http/types"
+	"github.com/Falokut/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+// storage объекты бакета: ключ - содержимое, owners владельцы приватных объектов
+type storage struct {
+	objects map[string]string
+	owners  map[string]string
+}
+
+func (s *storage) UploadFile(_ context.Context, file entity.Metadata, reader io.Reader) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.objects[file.Filename] = string(content)
+	return nil
+}
+
+func (s *storage) GetFile(context.Context, string, string, *types.RangeOption) (*entity.Metadata, io.ReadSeekCloser, error) {
+	return nil, nil, domain.ErrFileNotFound
+}
+
+func (s *storage) IsFileExist(_ context.Context, filename string, _ string) (bool, error) {
+	_, ok := s.objects[filename]
+	return ok, nil
+}
+
+func (s *storage) StatFile(_ context.Context, filename string, _ string) (*entity.Metadata, error) {
+	content, ok := s.objects[filename]
+	if !ok {
+		return nil, domain.ErrFileNotFound
+	}
+	metadata := &entity.Metadata{Filename: filename, Size: int64(len(content))}
+	owner, ok := s.owners[filename]
+	if ok {
+		metadata.Owner = owner
+		metadata.Visibility = entity.VisibilityPrivate
+	}
+	return metadata, nil
+}
+
+func (s *storage) MoveFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	content, ok := s.objects[srcFilename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	s.objects[dstFilename] = content
+	delete(s.objects, srcFilename)
+	return nil
+}
+
+func (s *storage) DeleteFile(_ context.Context, filename string, _ string) error {
+	delete(s.objects, filename)
+	return nil
+}
+
+type settings entity.CategorySettings
+
+func (s settings) Settings(context.Context, string) (entity.CategorySettings, error) {
+	return entity.CategorySettings(s), nil
+}
+
+// pendingFiles статусы загрузок по именам файлов, неудачная загрузка удаляет объект из области pending,
+// остальные методы сервиса в тестах не вызываются
+type pendingFiles struct {
+	service.Pending
+	storage    *storage
+	statuses   map[string]string
+	enqueueErr error
+}
+
+func (p *pendingFiles) Begin(_ context.Context, file entity.PendingFile, _ time.Duration) (*time.Time, error) {
+	p.statuses[file.Filename] = entity.PendingStatusUploading
+	return nil, nil // nolint:nilnil
+}
+
+func (p *pendingFiles) Enqueue(_ context.Context, filename string, _ string) error {
+	if p.enqueueErr != nil {
+		return p.enqueueErr
+	}
+	p.statuses[filename] = entity.PendingStatusPending
+	return nil
+}
+
+func (p *pendingFiles) Get(_ context.Context, filename string, category string) (*entity.PendingFile, error) {
+	return &entity.PendingFile{Filename: filename, Category: category, Status: p.statuses[filename]}, nil
+}
+
+func (p *pendingFiles) Fail(_ context.Context, filename string, _ string, _ error) error {
+	p.statuses[filename] = entity.PendingStatusFailed
+	delete(p.storage.objects, pending.ObjectName(filename))
+	return nil
+}
+
+// antivirus отклоняет постановку на карантин, остальные методы сервиса в тестах не вызываются
+type antivirus struct {
+	service.Antivirus
+	err error
+}
+
+func (a antivirus) Quarantine(context.Context, string, string, string, string) (string, error) {
+	return "", a.err
+}
+
+type locks struct{}
+
+func (locks) Check(context.Context, string, string) error {
+	return nil
+}
+
+func (locks) ApplyDefaults(context.Context, string, string) error {
+	return nil
+}
+
+func (locks) Release(context.Context, string, string) error {
+	return nil
+}
+
+type uploadTx struct{}
+
+func (t uploadTx) UploadTx(ctx context.Context, tx func(ctx context.Context, tx service.UploadTx) error) error {
+	return tx(ctx, t)
+}
+
+func (uploadTx) UpsertExpiration(context.Context, string, string, time.Time) error {
+	return nil
+}
+
+func (uploadTx) DeleteExpiration(context.Context, string, string) error {
+	return nil
+}
+
+func (uploadTx) InsertEvent(context.Context, entity.StorageEvent) (int64, error) {
+	return 1, nil
+}
+
+type quotas struct{}
+
+func (quotas) Reserve(context.Context, string, string, int64, int64, bool) (*entity.QuotaReservation, int64, error) {
+	return &entity.QuotaReservation{}, -1, nil
+}
+
+func (quotas) Release(context.Context, entity.QuotaReservation) error {
+	return nil
+}
+
+func newFiles(storage *storage, cfg settings, pendingSrv service.Pending, antivirus service.Antivirus) service.Files {
+	var logger log.Logger
+	return service.NewFiles(
+		storage,
+		validation.NewPipelines(nil),
+		pendingSrv,
+		nil,
+		nil,
+		cfg,
+		nil,
+		nil,
+		locks{},
+		uploadTx{},
+		quotas{},
+		antivirus,
+		logger,
+	)
+}
+
+func TestRejectedUploadKeepsCurrentFile(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("text ", 200)
+	tests := []struct {
+		name     string
+		content  string
+		rejected bool
+	}{
+		{name: "valid content replaces file", content: text},
+		// незавершённый символ UTF-8 обнаруживается только после чтения всего содержимого
+		{name: "content rejected after upload", content: text + "\xd0", rejected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			storage := &storage{objects: map[string]string{"a.txt": "current"}}
+			cfg := settings{Validation: entity.CategoryValidation{Text: entity.TextValidation{Enabled: true}}}
+			files := newFiles(storage, cfg, nil, nil)
+
+			_, err := files.UploadFile(t.Context(), entity.UploadFileRequest{
+				Filename:      "a.txt",
+				Category:      "notes",
+				Accessor:      entity.Accessor{Unrestricted: true},
+				Size:          int64(len(test.content)),
+				ContentReader: strings.NewReader(test.content),
+			})
+			expected := map[string]string{"a.txt": test.content}
+			if test.rejected {
+				invalidArgErr := domain.InvalidArgumentError{}
+				if !errors.As(err, &invalidArgErr) || invalidArgErr.ErrCode != domain.ErrCodeInvalidFileContent {
+					t.Fatalf("expected invalid content error, got %v", err)
+				}
+				expected = map[string]string{"a.txt": "current"}
+			} else if err != nil {
+				t.Fatalf("upload file: %v", err)
+			}
+			if !maps.Equal(storage.objects, expected) {
+				t.Fatalf("expected %v, got %v", expected, storage.objects)
+			}
+		})
+	}
+}
+
+func TestFailedQuarantineFailsPendingUpload(t *testing.T) {
+	t.Parallel()
+
+	storage := &storage{objects: map[string]string{}}
+	pendingFiles := &pendingFiles{storage: storage, statuses: map[string]string{}}
+	quarantineErr := errors.New("database is unavailable")
+	files := newFiles(storage, settings{ScanMode: entity.ScanModeAsync}, pendingFiles, antivirus{err: quarantineErr})
+
+	_, err := files.UploadFile(t.Context(), entity.UploadFileRequest{
+		Filename:      "a.txt",
+		Category:      "notes",
+		Accessor:      entity.Accessor{Unrestricted: true},
+		Size:          4,
+		ContentReader: strings.NewReader("text"),
+		Pending:       true,
+	})
+	if !errors.Is(err, quarantineErr) {
+		t.Fatalf("expected quarantine error, got %v", err)
+	}
+	if pendingFiles.statuses["a.txt"] != entity.PendingStatusFailed || len(storage.objects) != 0 {
+		t.Fatalf("expected failed upload without objects, got %v and %v", pendingFiles.statuses, storage.objects)
+	}
+}
+
+func TestFailedEnqueueDiscardsStagedFile(t *testing.T) {
+	t.Parallel()
+
+	storage := &storage{objects: map[string]string{}}
+	enqueueErr := errors.New("database is unavailable")
+	pendingFiles := &pendingFiles{storage: storage, statuses: map[string]string{}, enqueueErr: enqueueErr}
+	files := newFiles(storage, settings{}, pendingFiles, nil)
+
+	_, err := files.UploadFile(t.Context(), entity.UploadFileRequest{
+		Filename:      "a.txt",
+		Category:      "notes",
+		Accessor:      entity.Accessor{Unrestricted: true},
+		Size:          4,
+		ContentReader: strings.NewReader("text"),
+		Pending:       true,
+	})
+	if !errors.Is(err, enqueueErr) {
+		t.Fatalf("expected enqueue error, got %v", err)
+	}
+	if pendingFiles.statuses["a.txt"] != entity.PendingStatusFailed || len(storage.objects) != 0 {
+		t.Fatalf("expected failed upload without staged object, got %v and %v", pendingFiles.statuses, storage.objects)
+	}
+}
+
+func TestPrivateFileIsHiddenFromOtherSubjects(t *testing.T) {
+	t.Parallel()
+
+	storage := &storage{
+		objects: map[string]string{"a.txt": "text", pending.ObjectName("b.txt"): "text"},
+		owners:  map[string]string{"a.txt": "alice", pending.ObjectName("b.txt"): "alice"},
+	}
+	pendingFiles := &pendingFiles{storage: storage, statuses: map[string]string{"b.txt": entity.PendingStatusPending}}
+	files := newFiles(storage, settings{}, pendingFiles, nil)
+	alice := entity.Accessor{Subject: "alice"}
+	bob := entity.Accessor{Subject: "bob"}
+
+	exists, err := files.IsFileExist(t.Context(), domain.FileExistRequest{Filename: "a.txt", Category: "notes"}, alice)
+	if err != nil || !exists {
+		t.Fatalf("owner must see the file, got %v, %v", exists, err)
+	}
+	_, err = files.IsFileExist(t.Context(), domain.FileExistRequest{Filename: "a.txt", Category: "notes"}, bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	file, err := files.GetPending(t.Context(), domain.FileRequest{Filename: "b.txt", Category: "notes"}, alice)
+	if err != nil || file.Status != entity.PendingStatusPending {
+		t.Fatalf("owner must see the upload, got %+v, %v", file, err)
+	}
+	_, err = files.GetPending(t.Context(), domain.FileRequest{Filename: "b.txt", Category: "notes"}, bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+type LockTxRunner interface {
+	LockTx(ctx context.Context, tx func(ctx context.Context, tx LockTx) error) error
+}
+
+type LockTx interface {
+	UpsertLock(ctx context.Context, lock entity.FileLock, now time.Time) error
+}
+
+type LockRepo interface {
+	GetLock(ctx context.Context, filename string, category string) (*entity.FileLock, error)
+	DeleteLock(ctx context.Context, filename string, category string) error
+	LockedFiles(ctx context.Context, category string, filenames []string, now time.Time) ([]string, error)
+}
+
+type FileRepo interface {
+	IsFileExist(ctx context.Context, filename string, category string) (bool, error)
+	StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error)
+	SetObjectLock(ctx context.Context, lock entity.FileLock) error
+}
+
+type CategorySettings interface {
+	Settings(ctx context.Context, category string) (entity.CategorySettings, error)
+}
+
+// Locks защищает файлы от удаления и перезаписи на стороне сервиса,
+// для бакетов с включённой блокировкой объектов дополнительно выставляет блокировку в хранилище
+type Locks struct {
+	txRunner   LockTxRunner
+	repo       FileRepo
+	lockRepo   LockRepo
+	categories CategorySettings
+}
+
+func NewLocks(txRunner LockTxRunner, repo FileRepo, lockRepo LockRepo, categories CategorySettings) Locks {
+	return Locks{
+		txRunner:   txRunner,
+		repo:       repo,
+		lockRepo:   lockRepo,
+		categories: categories,
+	}
+}
+
+func (s Locks) Get(ctx context.Context, filename string, category string) (*entity.FileLock, error) {
+	err := s.requireFile(ctx, filename, category)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.lock(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get lock")
+	}
+	return lock, nil
+}
+
+func (s Locks) IsLocked(ctx context.Context, filename string, category string) (bool, error) {
+	lock, err := s.lock(ctx, filename, category)
+	if err != nil {
+		return false, errors.WithMessage(err, "get lock")
+	}
+	return lock.IsLocked(time.Now().UTC()), nil
+}
+
+// Check возвращает domain.ErrFileLocked, если файл нельзя удалить или перезаписать
+func (s Locks) Check(ctx context.Context, filename string, category string) error {
+	locked, err := s.IsLocked(ctx, filename, category)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return domain.ErrFileLocked
+	}
+	return nil
+}
+
+func (s Locks) LockedFiles(ctx context.Context, category string, filenames []string) ([]string, error) {
+	locked, err := s.lockRepo.LockedFiles(ctx, category, filenames, time.Now().UTC())
+	if err != nil {
+		return nil, errors.WithMessage(err, "get locked files")
+	}
+	return locked, nil
+}
+
+// ApplyDefaults устанавливает блокировку нового файла согласно настройкам категории
+func (s Locks) ApplyDefaults(ctx context.Context, filename string, category string) error {
+	settings, err := s.categories.Settings(ctx, category)
+	if err != nil {
+		return errors.WithMessage(err, "get category settings")
+	}
+
+	lock := entity.FileLock{
+		Filename:  filename,
+		Category:  category,
+		LegalHold: settings.LegalHold,
+	}
+	if settings.RetentionMode != "" && settings.RetentionPeriod > 0 {
+		retainUntil := time.Now().UTC().Add(settings.RetentionPeriod)
+		lock.RetentionMode = settings.RetentionMode
+		lock.RetainUntil = &retainUntil
+	}
+
+	// у перезаписанного файла не должно остаться истёкшей блокировки предыдущего содержимого
+	if lock.RetainUntil == nil && !lock.LegalHold {
+		err = s.lockRepo.DeleteLock(ctx, filename, category)
+		if err != nil {
+			return errors.WithMessage(err, "delete lock")
+		}
+		return nil
+	}
+
+	err = s.save(ctx, lock)
+	if err != nil {
+		return errors.WithMessage(err, "save lock")
+	}
+	return nil
+}
+
+// SetRetention устанавливает или снимает срок блокировки файла,
+// срок блокировки в режиме compliance можно только продлить.
+// Блокировку файла с владельцем может менять только владелец
+func (s Locks) SetRetention(
+	ctx context.Context,
+	filename string,
+	category string,
+	mode string,
+	retainUntil *time.Time,
+	accessor entity.Accessor,
+) (*entity.FileLock, error) {
+	now := time.Now().UTC()
+	switch {
+	case mode == "" && retainUntil != nil:
+		return nil, domain.NewInvalidArgumentError("mode must be specified with retainUntil", domain.ErrCodeInvalidLock)
+	case mode != "" && retainUntil == nil:
+		return nil, domain.NewInvalidArgumentError("retainUntil must be specified with mode", domain.ErrCodeInvalidLock)
+	case retainUntil != nil && !retainUntil.After(now):
+		return nil, domain.NewInvalidArgumentError("retainUntil must be in the future", domain.ErrCodeInvalidLock)
+	}
+
+	err := s.requireModify(ctx, filename, category, accessor)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.lock(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get lock")
+	}
+
+	if lock.RetentionMode == entity.RetentionModeCompliance && lock.IsRetained(now) {
+		if mode != entity.RetentionModeCompliance || retainUntil.Before(*lock.RetainUntil) {
+			return nil, domain.NewInvalidArgumentError(
+				"compliance retention can only be extended",
+				domain.ErrCodeInvalidLock,
+			)
+		}
+	}
+
+	lock.RetentionMode = mode
+	lock.RetainUntil = nil
+	if retainUntil != nil {
+		utc := retainUntil.UTC()
+		lock.RetainUntil = &utc
+	}
+	err = s.save(ctx, *lock)
+	if err != nil {
+		return nil, errors.WithMessage(err, "save lock")
+	}
+	return lock, nil
+}
+
+// SetLegalHold устанавливает или снимает удержание файла, удержание файла с владельцем может менять только владелец
+func (s Locks) SetLegalHold(
+	ctx context.Context,
+	filename string,
+	category string,
+	enabled bool,
+	accessor entity.Accessor,
+) (*entity.FileLock, error) {
+	err := s.requireModify(ctx, filename, category, accessor)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := s.lock(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get lock")
+	}
+
+	lock.LegalHold = enabled
+	err = s.save(ctx, *lock)
+	if err != nil {
+		return nil, errors.WithMessage(err, "save lock")
+	}
+	return lock, nil
+}
+
+// Release удаляет запись о блокировке удалённого файла
+func (s Locks) Release(ctx context.Context, filename string, category string) error {
+	err := s.lockRepo.DeleteLock(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "delete lock")
+	}
+	return nil
+}
+
+// save сохраняет блокировку, запись о блокировке не сохраняется, если не удалось выставить блокировку в хранилище
+func (s Locks) save(ctx context.Context, lock entity.FileLock) error {
+	err := s.txRunner.LockTx(ctx, func(ctx context.Context, tx LockTx) error {
+		err := tx.UpsertLock(ctx, lock, time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "upsert lock")
+		}
+		err = s.repo.SetObjectLock(ctx, lock)
+		if err != nil {
+			return errors.WithMessage(err, "set object lock")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "lock tx")
+	}
+	return nil
+}
+
+func (s Locks) lock(ctx context.Context, filename string, category string) (*entity.FileLock, error) {
+	lock, err := s.lockRepo.GetLock(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get lock")
+	}
+	if lock == nil {
+		return &entity.FileLock{Filename: filename, Category: category}, nil
+	}
+	return lock, nil
+}
+
+func (s Locks) requireFile(ctx context.Context, filename string, category string) error {
+	exist, err := s.repo.IsFileExist(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "is file exist")
+	}
+	if !exist {
+		return domain.ErrFileNotFound
+	}
+	return nil
+}
+
+// requireModify проверяет, что файл существует и accessor может им управлять
+func (s Locks) requireModify(ctx context.Context, filename string, category string, accessor entity.Accessor) error {
+	metadata, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return domain.ErrFileNotFound
+	case err != nil:
+		return errors.WithMessage(err, "stat file")
+	case !metadata.CanModify(accessor):
+		return domain.AccessDenied(accessor.Anonymous())
+	default:
+		return nil
+	}
+}
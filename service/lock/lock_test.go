@@ -0,0 +1,226 @@
+package lock_test
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/lock"
+
+	"github.com/pkg/errors"
+)
+
+// repo записи о блокировках, транзакция откатывает изменения при ошибке
+type repo struct {
+	locks map[string]entity.FileLock
+}
+
+func (r *repo) LockTx(ctx context.Context, tx func(ctx context.Context, tx lock.LockTx) error) error {
+	locks := maps.Clone(r.locks)
+	err := tx(ctx, r)
+	if err != nil {
+		r.locks = locks
+	}
+	return err
+}
+
+func (r *repo) UpsertLock(_ context.Context, lock entity.FileLock, _ time.Time) error {
+	r.locks[lock.Filename] = lock
+	return nil
+}
+
+func (r *repo) GetLock(_ context.Context, filename string, _ string) (*entity.FileLock, error) {
+	lock, ok := r.locks[filename]
+	if !ok {
+		return nil, nil // nolint:nilnil
+	}
+	return &lock, nil
+}
+
+func (r *repo) DeleteLock(_ context.Context, filename string, _ string) error {
+	delete(r.locks, filename)
+	return nil
+}
+
+func (r *repo) LockedFiles(context.Context, string, []string, time.Time) ([]string, error) {
+	return nil, nil
+}
+
+// storage файл существует всегда, owner владелец файла
+type storage struct {
+	owner         string
+	objectLockErr error
+}
+
+func (s storage) IsFileExist(context.Context, string, string) (bool, error) {
+	return true, nil
+}
+
+func (s storage) StatFile(_ context.Context, filename string, _ string) (*entity.Metadata, error) {
+	return &entity.Metadata{Filename: filename, Owner: s.owner}, nil
+}
+
+func (s storage) SetObjectLock(context.Context, entity.FileLock) error {
+	return s.objectLockErr
+}
+
+type settings entity.CategorySettings
+
+func (s settings) Settings(context.Context, string) (entity.CategorySettings, error) {
+	return entity.CategorySettings(s), nil
+}
+
+var admin = entity.Accessor{Unrestricted: true}
+
+func TestSetLegalHoldWithoutObjectLock(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{locks: map[string]entity.FileLock{}}
+	objectLockErr := errors.New("minio is unavailable")
+	service := lock.NewLocks(repo, storage{objectLockErr: objectLockErr}, repo, settings{})
+
+	_, err := service.SetLegalHold(t.Context(), "a.txt", "docs", true, admin)
+	if !errors.Is(err, objectLockErr) {
+		t.Fatalf("expected object lock error, got %v", err)
+	}
+	if len(repo.locks) != 0 {
+		t.Fatalf("lock record must be rolled back, got %v", repo.locks)
+	}
+
+	service = lock.NewLocks(repo, storage{}, repo, settings{})
+	_, err = service.SetLegalHold(t.Context(), "a.txt", "docs", true, admin)
+	if err != nil {
+		t.Fatalf("set legal hold: %v", err)
+	}
+	err = service.Check(t.Context(), "a.txt", "docs")
+	if !errors.Is(err, domain.ErrFileLocked) {
+		t.Fatalf("expected locked file, got %v", err)
+	}
+}
+
+func TestChangeLockOfOtherOwner(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{locks: map[string]entity.FileLock{}}
+	service := lock.NewLocks(repo, storage{owner: "alice"}, repo, settings{})
+
+	bob := entity.Accessor{Subject: "bob"}
+	_, err := service.SetLegalHold(t.Context(), "a.txt", "docs", true, bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+	retainUntil := time.Now().Add(time.Hour)
+	_, err = service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeGovernance, &retainUntil, bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+	if len(repo.locks) != 0 {
+		t.Fatalf("lock must not be set, got %v", repo.locks)
+	}
+
+	_, err = service.SetLegalHold(t.Context(), "a.txt", "docs", true, entity.Accessor{Subject: "alice"})
+	if err != nil {
+		t.Fatalf("set legal hold: %v", err)
+	}
+}
+
+func TestComplianceRetentionCanOnlyBeExtended(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{locks: map[string]entity.FileLock{}}
+	service := lock.NewLocks(repo, storage{}, repo, settings{})
+
+	retainUntil := time.Now().Add(2 * time.Hour)
+	_, err := service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeCompliance, &retainUntil, admin)
+	if err != nil {
+		t.Fatalf("set retention: %v", err)
+	}
+
+	shorter := retainUntil.Add(-time.Hour)
+	_, err = service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeCompliance, &shorter, admin)
+	requireInvalidLock(t, err)
+	_, err = service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeGovernance, &retainUntil, admin)
+	requireInvalidLock(t, err)
+	_, err = service.SetRetention(t.Context(), "a.txt", "docs", "", nil, admin)
+	requireInvalidLock(t, err)
+
+	longer := retainUntil.Add(time.Hour)
+	fileLock, err := service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeCompliance, &longer, admin)
+	if err != nil {
+		t.Fatalf("extend retention: %v", err)
+	}
+	if !fileLock.RetainUntil.Equal(longer) {
+		t.Fatalf("expected extended retention, got %v", fileLock.RetainUntil)
+	}
+	err = service.Check(t.Context(), "a.txt", "docs")
+	if !errors.Is(err, domain.ErrFileLocked) {
+		t.Fatalf("expected locked file, got %v", err)
+	}
+}
+
+func TestGovernanceRetentionCanBeRemoved(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{locks: map[string]entity.FileLock{}}
+	service := lock.NewLocks(repo, storage{}, repo, settings{})
+
+	retainUntil := time.Now().Add(time.Hour)
+	_, err := service.SetRetention(t.Context(), "a.txt", "docs", entity.RetentionModeGovernance, &retainUntil, admin)
+	if err != nil {
+		t.Fatalf("set retention: %v", err)
+	}
+	_, err = service.SetRetention(t.Context(), "a.txt", "docs", "", nil, admin)
+	if err != nil {
+		t.Fatalf("remove retention: %v", err)
+	}
+	err = service.Check(t.Context(), "a.txt", "docs")
+	if err != nil {
+		t.Fatalf("expected unlocked file, got %v", err)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{locks: map[string]entity.FileLock{}}
+	service := lock.NewLocks(repo, storage{}, repo, settings{
+		RetentionMode:   entity.RetentionModeCompliance,
+		RetentionPeriod: entity.Day,
+	})
+
+	err := service.ApplyDefaults(t.Context(), "a.txt", "docs")
+	if err != nil {
+		t.Fatalf("apply defaults: %v", err)
+	}
+	fileLock := repo.locks["a.txt"]
+	if fileLock.RetentionMode != entity.RetentionModeCompliance || fileLock.RetainUntil.Before(time.Now().Add(23*time.Hour)) {
+		t.Fatalf("expected retention of category, got %+v", fileLock)
+	}
+
+	// у перезаписанного файла в категории без блокировки не остаётся блокировки прежнего содержимого
+	expiredAt := time.Now().Add(-time.Hour)
+	repo.locks["b.txt"] = entity.FileLock{
+		Filename:      "b.txt",
+		RetentionMode: entity.RetentionModeGovernance,
+		RetainUntil:   &expiredAt,
+	}
+	service = lock.NewLocks(repo, storage{}, repo, settings{})
+	err = service.ApplyDefaults(t.Context(), "b.txt", "docs")
+	if err != nil {
+		t.Fatalf("apply defaults: %v", err)
+	}
+	if _, ok := repo.locks["b.txt"]; ok {
+		t.Fatal("expired lock of previous content must be deleted")
+	}
+}
+
+func requireInvalidLock(t *testing.T, err error) {
+	t.Helper()
+	invalidArgErr := domain.InvalidArgumentError{}
+	if !errors.As(err, &invalidArgErr) || invalidArgErr.ErrCode != domain.ErrCodeInvalidLock {
+		t.Fatalf("expected invalid lock error, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package pending
+
+import (
+	"context"
+	"storage-service/entity"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// cleanup удаляет файлы истёкших, отменённых и неудачных загрузок параллельно, не более cfg.CleanupConcurrency одновременно.
+// Загрузки блокируются до записи результата, поэтому другой экземпляр сервиса их не обрабатывает,
+// ошибка возвращается только при недоступности базы
+func (s Pending) cleanup(ctx context.Context) error {
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		files, err := tx.GetFilesToCleanup(ctx, s.cfg.MaxDeletedFiles)
+		if err != nil {
+			return errors.WithMessage(err, "get files to cleanup")
+		}
+
+		deleteErrs := make([]error, len(files))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, max(s.cfg.CleanupConcurrency, 1))
+		for i, file := range files {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				deleteErrs[i] = s.processPendingFile(ctx, entity.FileToDelete{Filename: file.Filename, Category: file.Category})
+			}()
+		}
+		wg.Wait()
+
+		for i, file := range files {
+			err = s.recordCleanup(ctx, tx, file, deleteErrs[i])
+			if err != nil {
+				return errors.WithMessagef(err, "cleanup file '%s' in category '%s'", file.Filename, file.Category)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	return nil
+}
+
+// cleanupFile удаляет файл завершённой загрузки из области pending сразу после её отмены или истечения,
+// неудачная попытка записывается так же, как воркером, и удаление повторяется воркером
+func (s Pending) cleanupFile(ctx context.Context, file entity.FileToDelete) error {
+	deleteErr := s.processPendingFile(ctx, file)
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		pendingFile, err := tx.GetPendingFileForUpdate(ctx, file.Filename, file.Category)
+		if err != nil {
+			return errors.WithMessage(err, "get pending file")
+		}
+		if pendingFile.CleanedAt != nil {
+			return nil
+		}
+		return s.recordCleanup(ctx, tx, *pendingFile, deleteErr)
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	return nil
+}
+
+// recordCleanup записывает результат удаления файла загрузки, неудачная попытка записывается в саму загрузку,
+// после cfg.MaxCleanupAttempts попыток загрузка переносится в dead letter
+func (s Pending) recordCleanup(ctx context.Context, tx PendingFilesTx, file entity.PendingFile, deleteErr error) error {
+	if deleteErr == nil {
+		err := tx.MarkPendingFileCleaned(ctx, file.Filename, file.Category, time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "mark pending file cleaned")
+		}
+		return nil
+	}
+
+	file.Attempts++
+	file.LastError = deleteErr.Error()
+	if file.Attempts < s.cfg.MaxCleanupAttempts {
+		err := tx.RecordCleanupFailure(ctx, file.Filename, file.Category, file.LastError)
+		if err != nil {
+			return errors.WithMessage(err, "record cleanup failure")
+		}
+		return nil
+	}
+
+	err := tx.InsertPendingDeadLetter(ctx, entity.PendingDeadLetter{
+		Id:         uuid.NewString(),
+		Filename:   file.Filename,
+		Category:   file.Category,
+		GroupId:    file.GroupId,
+		UploadedBy: file.UploadedBy,
+		Attempts:   file.Attempts,
+		LastError:  file.LastError,
+		CreatedAt:  file.CreatedAt,
+		DeadAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "insert pending dead letter")
+	}
+	err = tx.DeletePendingFile(ctx, file.Filename, file.Category)
+	if err != nil {
+		return errors.WithMessage(err, "delete pending file")
+	}
+	return nil
+}
+
+func (s Pending) ListDeadLetters(ctx context.Context, category string, limit int, offset int) ([]entity.PendingDeadLetter, error) {
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	deadLetters, err := s.pendingRepo.ListPendingDeadLetters(ctx, category, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list pending dead letters")
+	}
+	return deadLetters, nil
+}
@@ -2,6 +2,7 @@ package pending
 
 import (
 	"context"
+	"fmt"
 	"storage-service/domain"
 	"storage-service/entity"
 	"time"
@@ -9,102 +10,981 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Prefix незакоммиченные файлы хранятся в бакете категории под этим префиксом
+const Prefix = ".pending/"
+
 type PendingTxRunner interface {
 	DeletePendingFilesTx(ctx context.Context, tx func(ctx context.Context, tx PendingFilesTx) error) error
 }
 
 type PendingFilesTx interface {
-	DeletePendingFiles(ctx context.Context, timeAgo time.Time, maxFiles int) ([]entity.FileToDelete, error)
+	ExpirePendingFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.FileToDelete, error)
+	GetStaleCommittingFiles(ctx context.Context, before time.Time, maxFiles int) ([]entity.PendingFile, error)
+	GetStaleCommittingGroups(ctx context.Context, before time.Time, maxGroups int) ([]entity.PendingGroup, error)
+	GetPendingFileForUpdate(ctx context.Context, filename string, category string) (*entity.PendingFile, error)
+	UpdatePendingFileStatus(ctx context.Context, filename string, category string, from string, status string, errText string, now time.Time) error
+	UpdatePendingFileExpiration(ctx context.Context, filename string, category string, expiresAt time.Time, now time.Time) error
+	UpsertPendingFile(ctx context.Context, file entity.PendingFile) error
+
+	InsertPendingGroup(ctx context.Context, id string, now time.Time, expiresAt time.Time) error
+	GetPendingGroupForUpdate(ctx context.Context, id string) (*entity.PendingGroup, error)
+	GetGroupFilesForUpdate(ctx context.Context, groupId string) ([]entity.PendingFile, error)
+	UpdatePendingGroupStatus(ctx context.Context, id string, status string, now time.Time) error
+	UpdatePendingGroupExpiration(ctx context.Context, id string, expiresAt time.Time, now time.Time) error
+	ExpirePendingGroups(ctx context.Context, now time.Time, maxGroups int) ([]entity.FileToDelete, error)
 	DeletePendingFile(ctx context.Context, filename string, category string) error
+	InsertPendingDeadLetter(ctx context.Context, deadLetter entity.PendingDeadLetter) error
+	GetFilesToCleanup(ctx context.Context, maxFiles int) ([]entity.PendingFile, error)
+	MarkPendingFileCleaned(ctx context.Context, filename string, category string, now time.Time) error
+	RecordCleanupFailure(ctx context.Context, filename string, category string, errText string) error
+
+	InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error)
 }
 
 type PendingFileRepo interface {
+	IsFileExist(ctx context.Context, filename string, category string) (bool, error)
+	MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
 	DeleteFile(ctx context.Context, filename string, category string) error
 }
 
 type PendingRepo interface {
-	InsertPendingFile(ctx context.Context, filename string, category string, createdAt time.Time) error
-	DeletePendingFile(ctx context.Context, filename string, category string) error
+	UpsertPendingFile(ctx context.Context, file entity.PendingFile) error
+	GetPendingFile(ctx context.Context, filename string, category string) (*entity.PendingFile, error)
+	UpdatePendingFileStatus(ctx context.Context, filename string, category string, from string, status string, errText string, now time.Time) error
+	DeleteFinishedPendingFiles(ctx context.Context, before time.Time) error
+	FillMissingExpirations(ctx context.Context, lifetime time.Duration) error
+	GetPendingGroup(ctx context.Context, id string) (*entity.PendingGroup, error)
+	GetGroupFiles(ctx context.Context, groupId string) ([]entity.PendingFile, error)
+	ListPendingFiles(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error)
+	PendingStats(ctx context.Context) ([]entity.PendingCategoryStats, error)
+	ListPendingDeadLetters(ctx context.Context, category string, limit int, offset int) ([]entity.PendingDeadLetter, error)
+}
+
+type Config struct {
+	// FileLifetime срок подтверждения загрузки, если не указан при загрузке
+	FileLifetime time.Duration
+	// MaxFileLifetime ограничение срока, указанного при загрузке или продлении
+	MaxFileLifetime time.Duration
+	HistoryLifetime time.Duration
+	MaxDeletedFiles int
+	// MaxCleanupAttempts после этого числа неудачных попыток удаления загрузка переносится в dead letter
+	MaxCleanupAttempts int
+	CleanupConcurrency int
 }
 
+const (
+	defaultListLimit = 100
+
+	forceExpireReason = "expired by administrator"
+
+	// commitTimeout перенос, не завершённый за это время, считается прерванным и восстанавливается воркером
+	commitTimeout = time.Hour
+)
+
 type Pending struct {
-	txRunner            PendingTxRunner
-	repo                PendingFileRepo
-	pendingRepo         PendingRepo
-	pendingFileLifetime time.Duration
-	maxDeletedFiles     int
+	txRunner    PendingTxRunner
+	repo        PendingFileRepo
+	pendingRepo PendingRepo
+	cfg         Config
 }
 
 func NewPending(
 	txRunner PendingTxRunner,
 	repo PendingFileRepo,
 	pendingRepo PendingRepo,
-	pendingFileLifetime time.Duration,
-	maxDeleteFiles int,
+	cfg Config,
 ) Pending {
 	return Pending{
-		txRunner: txRunner,
-		repo:     repo,
+		txRunner:    txRunner,
+		repo:        repo,
+		pendingRepo: pendingRepo,
+		cfg:         cfg,
+	}
+}
+
+// ObjectName незакоммиченный файл хранится под служебным ключом
+// и становится доступен под своим именем только после Commit
+func ObjectName(filename string) string {
+	return Prefix + filename
+}
+
+// FillMissingExpirations задаёт загрузкам, начатым до появления срока подтверждения, срок по умолчанию от начала загрузки
+func (s Pending) FillMissingExpirations(ctx context.Context) error {
+	err := s.pendingRepo.FillMissingExpirations(ctx, s.cfg.FileLifetime)
+	if err != nil {
+		return errors.WithMessage(err, "fill missing expirations")
+	}
+	return nil
+}
+
+// Begin регистрирует загрузку до записи файла в хранилище и возвращает срок подтверждения,
+// ttl больше настройки отклоняется, 0 - срок по умолчанию.
+// Файл группы получает срок группы, ttl учитывается только при создании группы
+func (s Pending) Begin(ctx context.Context, file entity.PendingFile, ttl time.Duration) (*time.Time, error) {
+	lifetime, err := s.lifetime(ttl)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	file.CreatedAt = now
+	file.ExpiresAt = now.Add(lifetime)
+	if file.GroupId == "" {
+		err = s.pendingRepo.UpsertPendingFile(ctx, file)
+		if err != nil {
+			return nil, errors.WithMessage(err, "upsert pending file")
+		}
+		return &file.ExpiresAt, nil
+	}
+	groupId := file.GroupId
+
+	err = s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		err := tx.InsertPendingGroup(ctx, groupId, now, file.ExpiresAt)
+		if err != nil {
+			return errors.WithMessage(err, "insert pending group")
+		}
+		group, err := tx.GetPendingGroupForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get pending group")
+		}
+		err = s.validateGroup(*group, now)
+		if err != nil {
+			return err
+		}
+
+		file.ExpiresAt = group.ExpiresAt
+		err = tx.UpsertPendingFile(ctx, file)
+		if err != nil {
+			return errors.WithMessage(err, "upsert pending file")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete pending files tx")
+	}
+	return &file.ExpiresAt, nil
+}
+
+// Extend продлевает срок подтверждения загрузки на ttl от текущего момента
+func (s Pending) Extend(ctx context.Context, fileName string, category string, ttl time.Duration) (*entity.PendingFile, error) {
+	lifetime, err := s.lifetime(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *entity.PendingFile
+	err = s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		now := time.Now().UTC()
+		file, err := tx.GetPendingFileForUpdate(ctx, fileName, category)
+		if err != nil {
+			return errors.WithMessage(err, "get pending file")
+		}
+		if file.GroupId != "" {
+			return domain.ErrPendingFileInGroup
+		}
+		if file.Status != entity.PendingStatusUploading {
+			err = s.validateCommit(*file, now)
+			if err != nil {
+				return err
+			}
+		} else if !now.Before(file.ExpiresAt) {
+			return domain.ErrPendingFileExpired
+		}
+
+		file.ExpiresAt = now.Add(lifetime)
+		file.UpdatedAt = now
+		err = tx.UpdatePendingFileExpiration(ctx, fileName, category, file.ExpiresAt, now)
+		if err != nil {
+			return errors.WithMessage(err, "update pending file expiration")
+		}
+		result = file
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete pending files tx")
 	}
+	return result, nil
 }
 
+// Enqueue переводит загруженный файл в ожидание подтверждения,
+// загрузка, которая за время записи истекла или отменена, не возвращается в ожидание
 func (s Pending) Enqueue(ctx context.Context, fileName string, category string) error {
-	err := s.pendingRepo.InsertPendingFile(ctx, fileName, category, time.Now().UTC())
+	err := s.pendingRepo.UpdatePendingFileStatus(
+		ctx,
+		fileName,
+		category,
+		entity.PendingStatusUploading,
+		entity.PendingStatusPending,
+		"",
+		time.Now().UTC(),
+	)
 	if err != nil {
-		return errors.WithMessage(err, "insert pending file")
+		return errors.WithMessage(err, "update pending file status")
 	}
 	return nil
 }
 
-func (s Pending) Commit(ctx context.Context, fileName string, category string) error {
-	err := s.pendingRepo.DeletePendingFile(ctx, fileName, category)
+// Fail отмечает неудачную загрузку и удаляет то, что успело записаться в область pending,
+// неудачное удаление повторит воркер, завершённая загрузка не меняется
+func (s Pending) Fail(ctx context.Context, fileName string, category string, reason error) error {
+	err := s.pendingRepo.UpdatePendingFileStatus(
+		ctx,
+		fileName,
+		category,
+		entity.PendingStatusUploading,
+		entity.PendingStatusFailed,
+		reason.Error(),
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return errors.WithMessage(err, "update pending file status")
+	}
+	err = s.cleanupFile(ctx, entity.FileToDelete{Filename: fileName, Category: category})
 	if err != nil {
-		return errors.WithMessage(err, "delete pending file")
+		return errors.WithMessage(err, "cleanup pending file")
 	}
 	return nil
 }
 
+func (s Pending) Get(ctx context.Context, fileName string, category string) (*entity.PendingFile, error) {
+	file, err := s.pendingRepo.GetPendingFile(ctx, fileName, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending file")
+	}
+	return file, nil
+}
+
+// IsStaged файл загружен в область pending и ожидает подтверждения
+func (s Pending) IsStaged(ctx context.Context, fileName string, category string) (bool, error) {
+	file, err := s.pendingRepo.GetPendingFile(ctx, fileName, category)
+	switch {
+	case errors.Is(err, domain.ErrPendingFileNotFound):
+		return false, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "get pending file")
+	default:
+		return file.Status == entity.PendingStatusPending, nil
+	}
+}
+
+// ValidateCommit проверяет, что файл можно подтвердить, не блокируя запись, и возвращает загрузку,
+// force - подтверждение администратором без учёта срока
+func (s Pending) ValidateCommit(ctx context.Context, fileName string, category string, force bool) (*entity.PendingFile, error) {
+	file, err := s.pendingRepo.GetPendingFile(ctx, fileName, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending file")
+	}
+	if file.GroupId != "" {
+		return nil, domain.ErrPendingFileInGroup
+	}
+	err = s.validateCommitOrForce(*file, time.Now().UTC(), force)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Commit переносит файл из области pending под его имя серверным копированием,
+// force - подтверждение администратором без учёта срока.
+// Загрузка захватывается статусом committing, перенос выполняется вне транзакции,
+// при ошибке переноса загрузка возвращается в ожидание подтверждения
+func (s Pending) Commit(ctx context.Context, fileName string, category string, force bool) error {
+	var file *entity.PendingFile
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		now := time.Now().UTC()
+		var err error
+		file, err = tx.GetPendingFileForUpdate(ctx, fileName, category)
+		if err != nil {
+			return errors.WithMessage(err, "get pending file")
+		}
+		if file.GroupId != "" {
+			return domain.ErrPendingFileInGroup
+		}
+		err = s.validateCommitOrForce(*file, now, force)
+		if err != nil {
+			return err
+		}
+		err = tx.UpdatePendingFileStatus(ctx, fileName, category, file.Status, entity.PendingStatusCommitting, "", now)
+		if err != nil {
+			return errors.WithMessage(err, "update pending file status")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+
+	err = s.repo.MoveFile(ctx, category, ObjectName(fileName), fileName)
+	if err != nil {
+		abortErr := s.finishCommit(ctx, *file, entity.PendingStatusPending)
+		if abortErr != nil {
+			return errors.WithMessagef(err, "move staged file, abort commit: %v", abortErr)
+		}
+		return errors.WithMessage(err, "move staged file")
+	}
+
+	// незавершённое подтверждение перенесённого файла завершит воркер
+	err = s.finishCommit(ctx, *file, entity.PendingStatusCommitted)
+	if err != nil {
+		return errors.WithMessage(err, "finish commit")
+	}
+	return nil
+}
+
+// finishCommit переводит захваченную Commit загрузку в status: committed после переноса файла
+// или pending, если перенос не удался
+func (s Pending) finishCommit(ctx context.Context, file entity.PendingFile, status string) error {
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		err := tx.UpdatePendingFileStatus(ctx, file.Filename, file.Category, entity.PendingStatusCommitting, status, "", time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "update pending file status")
+		}
+		if status != entity.PendingStatusCommitted {
+			return nil
+		}
+		err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventCommitted, file.Filename, file.Category, file.UploadedBy))
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	return nil
+}
+
+// recoverCommits завершает подтверждения, прерванные между переносом файла и сменой статуса:
+// если файла нет в области pending, перенос выполнен и загрузка подтверждается, иначе возвращается в ожидание
+func (s Pending) recoverCommits(ctx context.Context, now time.Time) error {
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		files, err := tx.GetStaleCommittingFiles(ctx, now.Add(-commitTimeout), s.cfg.MaxDeletedFiles)
+		if err != nil {
+			return errors.WithMessage(err, "get stale committing files")
+		}
+		for _, file := range files {
+			staged, err := s.repo.IsFileExist(ctx, ObjectName(file.Filename), file.Category)
+			if err != nil {
+				return errors.WithMessagef(err, "is staged file '%s' exist", file.Filename)
+			}
+			status := entity.PendingStatusCommitted
+			if staged {
+				status = entity.PendingStatusPending
+			}
+			err = tx.UpdatePendingFileStatus(ctx, file.Filename, file.Category, file.Status, status, "", now)
+			if err != nil {
+				return errors.WithMessage(err, "update pending file status")
+			}
+			if staged {
+				continue
+			}
+			err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventCommitted, file.Filename, file.Category, file.UploadedBy))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	return nil
+}
+
+// Rollback отменяет загрузку, повторная отмена и отмена истёкшей или неудачной загрузки не считаются ошибкой,
+// файл удаляется после отмены, неудачное удаление повторит воркер
 func (s Pending) Rollback(ctx context.Context, fileName string, category string) error {
+	rolledBack := false
 	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
-		err := tx.DeletePendingFile(ctx, fileName, category)
+		file, err := tx.GetPendingFileForUpdate(ctx, fileName, category)
+		if err != nil {
+			return errors.WithMessage(err, "get pending file")
+		}
+		if file.GroupId != "" {
+			return domain.ErrPendingFileInGroup
+		}
+		switch file.Status {
+		case entity.PendingStatusCommitted:
+			return domain.ErrPendingFileCommitted
+		case entity.PendingStatusCommitting:
+			return domain.ErrPendingFileCommitting
+		case entity.PendingStatusRolledBack, entity.PendingStatusExpired, entity.PendingStatusFailed:
+			return nil
+		}
+
+		err = tx.UpdatePendingFileStatus(ctx, fileName, category, file.Status, entity.PendingStatusRolledBack, "", time.Now().UTC())
 		if err != nil {
-			return errors.WithMessage(err, "delete pending files")
+			return errors.WithMessage(err, "update pending file status")
 		}
-		err = s.processPendingFile(ctx, entity.FileToDelete{Filename: fileName, Category: category})
+		err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventRolledBack, fileName, category, file.UploadedBy))
 		if err != nil {
-			return errors.WithMessage(err, "process pendng file")
+			return err
 		}
+		rolledBack = true
 		return nil
 	})
 	if err != nil {
 		return errors.WithMessage(err, "delete pending files tx")
 	}
+	if !rolledBack {
+		return nil
+	}
+
+	err = s.cleanupFile(ctx, entity.FileToDelete{Filename: fileName, Category: category})
+	if err != nil {
+		return errors.WithMessage(err, "cleanup pending file")
+	}
 	return nil
 }
 
+func (s Pending) List(ctx context.Context, filter entity.PendingFilter) ([]entity.PendingFile, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+	files, err := s.pendingRepo.ListPendingFiles(ctx, filter)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list pending files")
+	}
+	return files, nil
+}
+
+func (s Pending) Stats(ctx context.Context) ([]entity.PendingCategoryStats, error) {
+	stats, err := s.pendingRepo.PendingStats(ctx)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending stats")
+	}
+	return stats, nil
+}
+
+// ForceExpire досрочно завершает незавершённые загрузки так же, как воркер по истечении срока,
+// каждая загрузка обрабатывается в отдельной транзакции
+func (s Pending) ForceExpire(ctx context.Context, files []entity.FileToDelete) []entity.PendingActionResult {
+	results := make([]entity.PendingActionResult, 0, len(files))
+	for _, file := range files {
+		result := entity.PendingActionResult{
+			Filename: file.Filename,
+			Category: file.Category,
+			Status:   entity.PendingStatusExpired,
+		}
+		err := s.forceExpire(ctx, file)
+		switch {
+		case errors.Is(err, domain.ErrPendingFileNotFound):
+			result.Status = entity.PendingActionNotFound
+		case err != nil:
+			result.Status = entity.PendingActionError
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// forceExpire переводит загрузку в expired, файл удаляется так же, как после истечения срока,
+// загрузки групп завершаются только вместе с группой
+func (s Pending) forceExpire(ctx context.Context, file entity.FileToDelete) error {
+	var expired *entity.PendingFile
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		pendingFile, err := tx.GetPendingFileForUpdate(ctx, file.Filename, file.Category)
+		if err != nil {
+			return errors.WithMessage(err, "get pending file")
+		}
+		if pendingFile.GroupId != "" {
+			return domain.ErrPendingFileInGroup
+		}
+		switch pendingFile.Status {
+		case entity.PendingStatusExpired:
+			return nil
+		case entity.PendingStatusCommitted:
+			return domain.ErrPendingFileCommitted
+		case entity.PendingStatusCommitting:
+			return domain.ErrPendingFileCommitting
+		case entity.PendingStatusRolledBack:
+			return domain.ErrPendingFileRolledBack
+		case entity.PendingStatusFailed:
+			return errors.Errorf("pending file upload is failed: %s", pendingFile.Error)
+		}
+
+		err = tx.UpdatePendingFileStatus(
+			ctx,
+			file.Filename,
+			file.Category,
+			pendingFile.Status,
+			entity.PendingStatusExpired,
+			forceExpireReason,
+			time.Now().UTC(),
+		)
+		if err != nil {
+			return errors.WithMessage(err, "update pending file status")
+		}
+		err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventExpired, file.Filename, file.Category, ""))
+		if err != nil {
+			return err
+		}
+		expired = pendingFile
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	if expired == nil {
+		return nil
+	}
+
+	// неудачное удаление повторит воркер
+	err = s.cleanupFile(ctx, file)
+	if err != nil {
+		return errors.WithMessage(err, "cleanup pending file")
+	}
+	return nil
+}
+
+// ProcessPendingFiles переводит в expired загрузки и группы с истёкшим сроком и удаляет их файлы,
+// ошибка удаления одного файла не влияет на остальные и учитывается в счётчике попыток этого файла
 func (s Pending) ProcessPendingFiles(ctx context.Context) error {
-	timeAgo := time.Now().UTC().Add(-s.pendingFileLifetime)
+	now := time.Now().UTC()
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		expiredFiles, err := tx.ExpirePendingFiles(ctx, now, s.cfg.MaxDeletedFiles)
+		if err != nil {
+			return errors.WithMessage(err, "expire pending files")
+		}
+		expiredGroupFiles, err := tx.ExpirePendingGroups(ctx, now, s.cfg.MaxDeletedFiles)
+		if err != nil {
+			return errors.WithMessage(err, "expire pending groups")
+		}
+		for _, file := range append(expiredFiles, expiredGroupFiles...) {
+			err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventExpired, file.Filename, file.Category, ""))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+
+	err = s.recoverCommits(ctx, now)
+	if err != nil {
+		return errors.WithMessage(err, "recover commits")
+	}
+	err = s.recoverGroupCommits(ctx, now)
+	if err != nil {
+		return errors.WithMessage(err, "recover group commits")
+	}
+
+	err = s.cleanup(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "cleanup pending files")
+	}
+
+	err = s.pendingRepo.DeleteFinishedPendingFiles(ctx, now.Add(-s.cfg.HistoryLifetime))
+	if err != nil {
+		return errors.WithMessage(err, "delete finished pending files")
+	}
+	return nil
+}
+
+// GetGroup группа и её загрузки, accessor должен иметь право чтения категорий всех загрузок группы
+func (s Pending) GetGroup(ctx context.Context, groupId string, accessor entity.Accessor) (*entity.PendingGroup, error) {
+	group, err := s.pendingRepo.GetPendingGroup(ctx, groupId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get pending group")
+	}
+	group.Files, err = s.pendingRepo.GetGroupFiles(ctx, groupId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get group files")
+	}
+	err = checkGroupAccess(group.Files, accessor, entity.ApiKeyOperationRead)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// ValidateGroupCommit проверяет, что группу можно подтвердить, не блокируя записи, и возвращает её загрузки
+func (s Pending) ValidateGroupCommit(ctx context.Context, groupId string, accessor entity.Accessor) ([]entity.PendingFile, error) {
+	group, err := s.GetGroup(ctx, groupId, accessor)
+	if err != nil {
+		return nil, err
+	}
+	err = checkGroupAccess(group.Files, accessor, entity.ApiKeyOperationCommit)
+	if err != nil {
+		return nil, err
+	}
+	err = s.validateGroupCommit(*group, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return group.Files, nil
+}
+
+// CommitGroup подтверждает все загрузки группы, группа подтверждается только если все её файлы загружены.
+// Группа захватывается статусом committing, файлы переносятся вне транзакции,
+// при ошибке переноса уже перенесённые файлы возвращаются в область pending, а группа - в ожидание подтверждения.
+// Если вернуть файл не удалось, группа остаётся в committing, подтверждение завершает воркер,
+// такая ошибка содержит domain.ErrPendingFileCommitting
+func (s Pending) CommitGroup(ctx context.Context, groupId string, accessor entity.Accessor) error {
+	var group *entity.PendingGroup
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		now := time.Now().UTC()
+		var err error
+		group, err = tx.GetPendingGroupForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get pending group")
+		}
+		group.Files, err = tx.GetGroupFilesForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get group files")
+		}
+		err = checkGroupAccess(group.Files, accessor, entity.ApiKeyOperationCommit)
+		if err != nil {
+			return err
+		}
+		err = s.validateGroupCommit(*group, now)
+		if err != nil {
+			return err
+		}
+
+		// загрузки группы переводятся в committing вместе с группой
+		err = tx.UpdatePendingGroupStatus(ctx, groupId, entity.PendingStatusCommitting, now)
+		if err != nil {
+			return errors.WithMessage(err, "update pending group status")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+
+	for i, file := range group.Files {
+		err = s.repo.MoveFile(ctx, file.Category, ObjectName(file.Filename), file.Filename)
+		if err != nil {
+			return s.abortGroupCommit(ctx, *group, group.Files[:i], errors.WithMessagef(err, "move staged file '%s'", file.Filename))
+		}
+	}
+
+	// незавершённое подтверждение перенесённых файлов завершит воркер
+	err = s.finishGroupCommit(ctx, *group, entity.PendingStatusCommitted)
+	if err != nil {
+		return errors.WithMessage(err, "finish group commit")
+	}
+	return nil
+}
+
+// abortGroupCommit возвращает перенесённые файлы группы в область pending, а группу - в ожидание подтверждения
+func (s Pending) abortGroupCommit(ctx context.Context, group entity.PendingGroup, moved []entity.PendingFile, reason error) error {
+	for _, file := range moved {
+		err := s.repo.MoveFile(ctx, file.Category, file.Filename, ObjectName(file.Filename))
+		if err != nil {
+			// часть файлов группы уже доступна под своими именами, группа остаётся в committing
+			return errors.WithMessagef(
+				domain.ErrPendingFileCommitting,
+				"%v, return file '%s' to pending: %v", reason, file.Filename, err,
+			)
+		}
+	}
+
+	err := s.finishGroupCommit(ctx, group, entity.PendingStatusPending)
+	if err != nil {
+		return errors.WithMessagef(reason, "abort group commit: %v", err)
+	}
+	return reason
+}
+
+// finishGroupCommit переводит захваченную CommitGroup группу и её загрузки в status: committed после переноса файлов
+// или pending, если файлы возвращены в область pending
+func (s Pending) finishGroupCommit(ctx context.Context, group entity.PendingGroup, status string) error {
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		now := time.Now().UTC()
+		current, err := tx.GetPendingGroupForUpdate(ctx, group.Id)
+		if err != nil {
+			return errors.WithMessage(err, "get pending group")
+		}
+		if current.Status != entity.PendingStatusCommitting {
+			return errors.WithMessagef(domain.ErrPendingFileConflict, "group status '%s'", current.Status)
+		}
+		err = tx.UpdatePendingGroupStatus(ctx, group.Id, status, now)
+		if err != nil {
+			return errors.WithMessage(err, "update pending group status")
+		}
+		for _, file := range group.Files {
+			err = tx.UpdatePendingFileStatus(ctx, file.Filename, file.Category, entity.PendingStatusCommitting, status, "", now)
+			if err != nil {
+				return errors.WithMessagef(err, "update status of pending file '%s'", file.Filename)
+			}
+			if status != entity.PendingStatusCommitted {
+				continue
+			}
+			err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventCommitted, file.Filename, file.Category, file.UploadedBy))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+	return nil
+}
+
+// recoverGroupCommits завершает подтверждения групп, прерванные во время переноса файлов:
+// если все файлы в области pending, группа возвращается в ожидание, иначе перенос оставшихся файлов завершается.
+// Захват группы продлевается на commitTimeout, неудачное восстановление повторяется после его истечения
+func (s Pending) recoverGroupCommits(ctx context.Context, now time.Time) error {
+	var groups []entity.PendingGroup
 	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
-		files, err := tx.DeletePendingFiles(ctx, timeAgo, s.maxDeletedFiles)
+		var err error
+		groups, err = tx.GetStaleCommittingGroups(ctx, now.Add(-commitTimeout), s.cfg.MaxDeletedFiles)
 		if err != nil {
-			return errors.WithMessage(err, "delete pending files")
+			return errors.WithMessage(err, "get stale committing groups")
+		}
+		for i, group := range groups {
+			groups[i].Files, err = tx.GetGroupFilesForUpdate(ctx, group.Id)
+			if err != nil {
+				return errors.WithMessage(err, "get group files")
+			}
+			err = tx.UpdatePendingGroupStatus(ctx, group.Id, entity.PendingStatusCommitting, now)
+			if err != nil {
+				return errors.WithMessage(err, "update pending group status")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "delete pending files tx")
+	}
+
+	for _, group := range groups {
+		err = s.recoverGroupCommit(ctx, group)
+		if err != nil {
+			return errors.WithMessagef(err, "recover commit of group '%s'", group.Id)
+		}
+	}
+	return nil
+}
+
+func (s Pending) recoverGroupCommit(ctx context.Context, group entity.PendingGroup) error {
+	staged := make([]entity.PendingFile, 0, len(group.Files))
+	for _, file := range group.Files {
+		exist, err := s.repo.IsFileExist(ctx, ObjectName(file.Filename), file.Category)
+		if err != nil {
+			return errors.WithMessagef(err, "is staged file '%s' exist", file.Filename)
+		}
+		if exist {
+			staged = append(staged, file)
+		}
+	}
+	if len(staged) == len(group.Files) {
+		return s.finishGroupCommit(ctx, group, entity.PendingStatusPending)
+	}
+
+	for _, file := range staged {
+		err := s.repo.MoveFile(ctx, file.Category, ObjectName(file.Filename), file.Filename)
+		if err != nil {
+			return errors.WithMessagef(err, "move staged file '%s'", file.Filename)
+		}
+	}
+	return s.finishGroupCommit(ctx, group, entity.PendingStatusCommitted)
+}
+
+// RollbackGroup отменяет все загрузки группы в одной транзакции, файлы удаляются после отмены,
+// повторная отмена и отмена истёкшей группы не считаются ошибкой
+func (s Pending) RollbackGroup(ctx context.Context, groupId string, accessor entity.Accessor) error {
+	var rolledBack []entity.FileToDelete
+	err := s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		group, err := tx.GetPendingGroupForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get pending group")
+		}
+		switch group.Status {
+		case entity.PendingStatusCommitted:
+			return domain.ErrPendingGroupCommitted
+		case entity.PendingStatusCommitting:
+			return domain.ErrPendingFileCommitting
+		case entity.PendingStatusRolledBack, entity.PendingStatusExpired:
+			return nil
+		}
+		files, err := tx.GetGroupFilesForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get group files")
+		}
+		err = checkGroupAccess(files, accessor, entity.ApiKeyOperationCommit)
+		if err != nil {
+			return err
+		}
+
+		err = tx.UpdatePendingGroupStatus(ctx, groupId, entity.PendingStatusRolledBack, time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "update pending group status")
 		}
 		for _, file := range files {
-			err = s.processPendingFile(ctx, file)
+			if file.Status != entity.PendingStatusUploading && file.Status != entity.PendingStatusPending {
+				continue
+			}
+			err = s.recordEvent(ctx, tx, entity.NewStorageEvent(entity.EventRolledBack, file.Filename, file.Category, file.UploadedBy))
 			if err != nil {
-				return errors.WithMessage(err, "process pendng file")
+				return err
 			}
+			rolledBack = append(rolledBack, entity.FileToDelete{Filename: file.Filename, Category: file.Category})
 		}
 		return nil
 	})
 	if err != nil {
 		return errors.WithMessage(err, "delete pending files tx")
 	}
+
+	for _, file := range rolledBack {
+		err = s.cleanupFile(ctx, file)
+		if err != nil {
+			return errors.WithMessagef(err, "cleanup pending file '%s'", file.Filename)
+		}
+	}
 	return nil
 }
 
+// ExtendGroup продлевает срок подтверждения группы и всех её загрузок на ttl от текущего момента
+func (s Pending) ExtendGroup(
+	ctx context.Context,
+	groupId string,
+	ttl time.Duration,
+	accessor entity.Accessor,
+) (*entity.PendingGroup, error) {
+	lifetime, err := s.lifetime(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *entity.PendingGroup
+	err = s.txRunner.DeletePendingFilesTx(ctx, func(ctx context.Context, tx PendingFilesTx) error {
+		now := time.Now().UTC()
+		group, err := tx.GetPendingGroupForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get pending group")
+		}
+		err = s.validateGroup(*group, now)
+		if err != nil {
+			return err
+		}
+		group.Files, err = tx.GetGroupFilesForUpdate(ctx, groupId)
+		if err != nil {
+			return errors.WithMessage(err, "get group files")
+		}
+		err = checkGroupAccess(group.Files, accessor, entity.ApiKeyOperationWrite)
+		if err != nil {
+			return err
+		}
+
+		group.ExpiresAt = now.Add(lifetime)
+		group.UpdatedAt = now
+		err = tx.UpdatePendingGroupExpiration(ctx, groupId, group.ExpiresAt, now)
+		if err != nil {
+			return errors.WithMessage(err, "update pending group expiration")
+		}
+		for i := range group.Files {
+			group.Files[i].ExpiresAt = group.ExpiresAt
+			group.Files[i].UpdatedAt = now
+		}
+		result = group
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "delete pending files tx")
+	}
+	return result, nil
+}
+
+// checkGroupAccess маршрут группы не содержит категорию, поэтому разрешение на операцию
+// проверяется для категории каждой загрузки группы
+func checkGroupAccess(files []entity.PendingFile, accessor entity.Accessor, operation string) error {
+	for _, file := range files {
+		if !accessor.CanAccessCategory(operation, file.Category) {
+			return errors.WithMessagef(domain.ErrForbidden, "%s files of category '%s'", operation, file.Category)
+		}
+	}
+	return nil
+}
+
+func (s Pending) validateGroup(group entity.PendingGroup, now time.Time) error {
+	switch group.Status {
+	case entity.PendingStatusPending:
+		if !now.Before(group.ExpiresAt) {
+			return domain.ErrPendingGroupExpired
+		}
+		return nil
+	case entity.PendingStatusCommitted:
+		return domain.ErrPendingGroupCommitted
+	case entity.PendingStatusCommitting:
+		return domain.ErrPendingFileCommitting
+	case entity.PendingStatusRolledBack:
+		return domain.ErrPendingGroupRolledBack
+	default:
+		return domain.ErrPendingGroupExpired
+	}
+}
+
+func (s Pending) validateGroupCommit(group entity.PendingGroup, now time.Time) error {
+	err := s.validateGroup(group, now)
+	if err != nil {
+		return err
+	}
+	if len(group.Files) == 0 {
+		return domain.ErrPendingFileNotReady
+	}
+	for _, file := range group.Files {
+		if file.Status != entity.PendingStatusPending {
+			return errors.WithMessagef(domain.ErrPendingFileNotReady, "file '%s'", file.Filename)
+		}
+	}
+	return nil
+}
+
+func (s Pending) validateCommitOrForce(file entity.PendingFile, now time.Time, force bool) error {
+	if force && file.Status == entity.PendingStatusPending {
+		return nil
+	}
+	return s.validateCommit(file, now)
+}
+
+func (s Pending) validateCommit(file entity.PendingFile, now time.Time) error {
+	switch file.Status {
+	case entity.PendingStatusPending:
+		if !now.Before(file.ExpiresAt) {
+			return domain.ErrPendingFileExpired
+		}
+		return nil
+	case entity.PendingStatusExpired:
+		return domain.ErrPendingFileExpired
+	case entity.PendingStatusCommitted:
+		return domain.ErrPendingFileCommitted
+	case entity.PendingStatusCommitting:
+		return domain.ErrPendingFileCommitting
+	case entity.PendingStatusRolledBack:
+		return domain.ErrPendingFileRolledBack
+	default:
+		return domain.ErrPendingFileNotReady
+	}
+}
+
+func (s Pending) lifetime(ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl < 0:
+		return 0, domain.NewInvalidArgumentError("pendingTtl must be positive", domain.ErrCodeInvalidExpiration)
+	case ttl == 0:
+		return s.cfg.FileLifetime, nil
+	case ttl > s.cfg.MaxFileLifetime:
+		return 0, domain.NewInvalidArgumentError(
+			fmt.Sprintf("pendingTtl must not exceed %d seconds", int64(s.cfg.MaxFileLifetime.Seconds())),
+			domain.ErrCodeInvalidExpiration,
+		)
+	default:
+		return ttl, nil
+	}
+}
+
+// processPendingFile удаляет только копию в области pending,
+// закоммиченный файл с тем же именем не затрагивается
 func (s Pending) processPendingFile(ctx context.Context, file entity.FileToDelete) error {
-	err := s.repo.DeleteFile(ctx, file.Filename, file.Category)
+	err := s.repo.DeleteFile(ctx, ObjectName(file.Filename), file.Category)
 	switch {
 	case errors.Is(err, domain.ErrFileNotFound):
 		return nil
@@ -114,3 +994,12 @@ func (s Pending) processPendingFile(ctx context.Context, file entity.FileToDelet
 		return nil
 	}
 }
+
+// recordEvent записывает событие в outbox в транзакции изменения, событие публикует воркер outbox
+func (s Pending) recordEvent(ctx context.Context, tx PendingFilesTx, event entity.StorageEvent) error {
+	_, err := tx.InsertEvent(ctx, event)
+	if err != nil {
+		return errors.WithMessage(err, "insert event")
+	}
+	return nil
+}
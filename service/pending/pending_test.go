@@ -0,0 +1,997 @@
+package pending_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/pending"
+
+	"github.com/pkg/errors"
+)
+
+type fileKey struct {
+	filename string
+	category string
+}
+
+// repo записи о загрузках и группах, транзакция откатывает изменения при ошибке
+type repo struct {
+	files       map[fileKey]entity.PendingFile
+	groups      map[string]entity.PendingGroup
+	events      []entity.StorageEvent
+	deadLetters []entity.PendingDeadLetter
+}
+
+func newRepo(files ...entity.PendingFile) *repo {
+	r := &repo{
+		files:  map[fileKey]entity.PendingFile{},
+		groups: map[string]entity.PendingGroup{},
+	}
+	for _, file := range files {
+		r.files[fileKey{file.Filename, file.Category}] = file
+	}
+	return r
+}
+
+func (r *repo) status(filename string) string {
+	return r.files[fileKey{filename, "docs"}].Status
+}
+
+func (r *repo) DeletePendingFilesTx(ctx context.Context, tx func(ctx context.Context, tx pending.PendingFilesTx) error) error {
+	files, groups := maps.Clone(r.files), maps.Clone(r.groups)
+	events, deadLetters := slices.Clone(r.events), slices.Clone(r.deadLetters)
+	err := tx(ctx, r)
+	if err != nil {
+		r.files, r.groups, r.events, r.deadLetters = files, groups, events, deadLetters
+	}
+	return err
+}
+
+func (r *repo) ExpirePendingFiles(_ context.Context, now time.Time, _ int) ([]entity.FileToDelete, error) {
+	expired := make([]entity.FileToDelete, 0)
+	for key, file := range r.files {
+		active := file.Status == entity.PendingStatusUploading || file.Status == entity.PendingStatusPending
+		if file.GroupId != "" || !active || file.ExpiresAt.After(now) {
+			continue
+		}
+		file.Status = entity.PendingStatusExpired
+		r.files[key] = file
+		expired = append(expired, entity.FileToDelete{Filename: file.Filename, Category: file.Category})
+	}
+	return expired, nil
+}
+
+func (r *repo) GetStaleCommittingFiles(_ context.Context, before time.Time, _ int) ([]entity.PendingFile, error) {
+	files := make([]entity.PendingFile, 0)
+	for _, file := range r.files {
+		if file.Status == entity.PendingStatusCommitting && file.UpdatedAt.Before(before) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (r *repo) GetStaleCommittingGroups(_ context.Context, before time.Time, _ int) ([]entity.PendingGroup, error) {
+	groups := make([]entity.PendingGroup, 0)
+	for _, group := range r.groups {
+		if group.Status == entity.PendingStatusCommitting && group.UpdatedAt.Before(before) {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+func (r *repo) GetPendingFileForUpdate(ctx context.Context, filename string, category string) (*entity.PendingFile, error) {
+	return r.GetPendingFile(ctx, filename, category)
+}
+
+func (r *repo) GetPendingFile(_ context.Context, filename string, category string) (*entity.PendingFile, error) {
+	file, ok := r.files[fileKey{filename, category}]
+	if !ok {
+		return nil, domain.ErrPendingFileNotFound
+	}
+	return &file, nil
+}
+
+func (r *repo) UpdatePendingFileStatus(
+	_ context.Context,
+	filename string,
+	category string,
+	from string,
+	status string,
+	errText string,
+	now time.Time,
+) error {
+	key := fileKey{filename, category}
+	file, ok := r.files[key]
+	if !ok {
+		return domain.ErrPendingFileNotFound
+	}
+	if file.Status != from {
+		return domain.ErrPendingFileConflict
+	}
+	file.Status = status
+	file.Error = errText
+	file.UpdatedAt = now
+	r.files[key] = file
+	return nil
+}
+
+func (r *repo) UpdatePendingFileExpiration(_ context.Context, filename string, category string, expiresAt time.Time, now time.Time) error {
+	key := fileKey{filename, category}
+	file := r.files[key]
+	file.ExpiresAt = expiresAt
+	file.UpdatedAt = now
+	r.files[key] = file
+	return nil
+}
+
+func (r *repo) UpsertPendingFile(_ context.Context, file entity.PendingFile) error {
+	file.Status = entity.PendingStatusUploading
+	r.files[fileKey{file.Filename, file.Category}] = file
+	return nil
+}
+
+func (r *repo) InsertPendingGroup(_ context.Context, id string, now time.Time, expiresAt time.Time) error {
+	_, ok := r.groups[id]
+	if !ok {
+		r.groups[id] = entity.PendingGroup{Id: id, Status: entity.PendingStatusPending, CreatedAt: now, ExpiresAt: expiresAt}
+	}
+	return nil
+}
+
+func (r *repo) GetPendingGroupForUpdate(ctx context.Context, id string) (*entity.PendingGroup, error) {
+	return r.GetPendingGroup(ctx, id)
+}
+
+func (r *repo) GetPendingGroup(_ context.Context, id string) (*entity.PendingGroup, error) {
+	group, ok := r.groups[id]
+	if !ok {
+		return nil, domain.ErrPendingGroupNotFound
+	}
+	return &group, nil
+}
+
+func (r *repo) GetGroupFilesForUpdate(ctx context.Context, groupId string) ([]entity.PendingFile, error) {
+	return r.GetGroupFiles(ctx, groupId)
+}
+
+func (r *repo) GetGroupFiles(_ context.Context, groupId string) ([]entity.PendingFile, error) {
+	files := make([]entity.PendingFile, 0)
+	for _, file := range r.files {
+		if file.GroupId == groupId {
+			files = append(files, file)
+		}
+	}
+	slices.SortFunc(files, func(a, b entity.PendingFile) int {
+		return compare(a.Filename, b.Filename)
+	})
+	return files, nil
+}
+
+func compare(a string, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (r *repo) UpdatePendingGroupStatus(_ context.Context, id string, status string, now time.Time) error {
+	group := r.groups[id]
+	group.Status = status
+	group.UpdatedAt = now
+	r.groups[id] = group
+	for key, file := range r.files {
+		if file.GroupId != id || (file.Status != entity.PendingStatusUploading && file.Status != entity.PendingStatusPending) {
+			continue
+		}
+		file.Status = status
+		file.UpdatedAt = now
+		r.files[key] = file
+	}
+	return nil
+}
+
+func (r *repo) UpdatePendingGroupExpiration(_ context.Context, id string, expiresAt time.Time, now time.Time) error {
+	group := r.groups[id]
+	group.ExpiresAt = expiresAt
+	group.UpdatedAt = now
+	r.groups[id] = group
+	return nil
+}
+
+func (r *repo) ExpirePendingGroups(_ context.Context, now time.Time, _ int) ([]entity.FileToDelete, error) {
+	expired := make([]entity.FileToDelete, 0)
+	for id, group := range r.groups {
+		if group.Status != entity.PendingStatusPending || group.ExpiresAt.After(now) {
+			continue
+		}
+		group.Status = entity.PendingStatusExpired
+		r.groups[id] = group
+		for key, file := range r.files {
+			if file.GroupId != id {
+				continue
+			}
+			file.Status = entity.PendingStatusExpired
+			r.files[key] = file
+			expired = append(expired, entity.FileToDelete{Filename: file.Filename, Category: file.Category})
+		}
+	}
+	return expired, nil
+}
+
+func (r *repo) DeletePendingFile(_ context.Context, filename string, category string) error {
+	delete(r.files, fileKey{filename, category})
+	return nil
+}
+
+func (r *repo) InsertPendingDeadLetter(_ context.Context, deadLetter entity.PendingDeadLetter) error {
+	r.deadLetters = append(r.deadLetters, deadLetter)
+	return nil
+}
+
+func (r *repo) InsertEvent(_ context.Context, event entity.StorageEvent) (int64, error) {
+	r.events = append(r.events, event)
+	return int64(len(r.events)), nil
+}
+
+func (r *repo) DeleteFinishedPendingFiles(context.Context, time.Time) error {
+	return nil
+}
+
+func (r *repo) FillMissingExpirations(context.Context, time.Duration) error {
+	return nil
+}
+
+func (r *repo) ListPendingFiles(context.Context, entity.PendingFilter) ([]entity.PendingFile, error) {
+	return nil, nil
+}
+
+func (r *repo) PendingStats(context.Context) ([]entity.PendingCategoryStats, error) {
+	return nil, nil
+}
+
+func (r *repo) GetFilesToCleanup(context.Context, int) ([]entity.PendingFile, error) {
+	files := make([]entity.PendingFile, 0)
+	for _, file := range r.files {
+		finished := file.Status == entity.PendingStatusExpired ||
+			file.Status == entity.PendingStatusRolledBack ||
+			file.Status == entity.PendingStatusFailed
+		if finished && file.CleanedAt == nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (r *repo) MarkPendingFileCleaned(_ context.Context, filename string, category string, now time.Time) error {
+	key := fileKey{filename, category}
+	file := r.files[key]
+	file.CleanedAt = &now
+	r.files[key] = file
+	return nil
+}
+
+func (r *repo) RecordCleanupFailure(_ context.Context, filename string, category string, errText string) error {
+	key := fileKey{filename, category}
+	file := r.files[key]
+	file.Attempts++
+	file.LastError = errText
+	r.files[key] = file
+	return nil
+}
+
+func (r *repo) ListPendingDeadLetters(context.Context, string, int, int) ([]entity.PendingDeadLetter, error) {
+	return r.deadLetters, nil
+}
+
+// storage объекты бакета, moveErr и deleteErr возвращаются при каждом переносе и удалении,
+// moveErrs - при переносе объекта с указанным именем. Очистка удаляет объекты параллельно
+type storage struct {
+	mu        sync.Mutex
+	objects   map[string]bool
+	moveErr   error
+	moveErrs  map[string]error
+	deleteErr error
+}
+
+func (s *storage) IsFileExist(_ context.Context, filename string, _ string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects[filename], nil
+}
+
+func (s *storage) MoveFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.moveErr != nil {
+		return s.moveErr
+	}
+	if s.moveErrs[srcFilename] != nil {
+		return s.moveErrs[srcFilename]
+	}
+	if !s.objects[srcFilename] {
+		return domain.ErrFileNotFound
+	}
+	delete(s.objects, srcFilename)
+	s.objects[dstFilename] = true
+	return nil
+}
+
+func (s *storage) DeleteFile(_ context.Context, filename string, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deleteErr != nil {
+		return s.deleteErr
+	}
+	if !s.objects[filename] {
+		return domain.ErrFileNotFound
+	}
+	delete(s.objects, filename)
+	return nil
+}
+
+func newPending(repo *repo, storage *storage) pending.Pending {
+	return pending.NewPending(repo, storage, repo, pending.Config{
+		FileLifetime:       time.Hour,
+		MaxFileLifetime:    24 * time.Hour,
+		MaxDeletedFiles:    10,
+		MaxCleanupAttempts: 3,
+		CleanupConcurrency: 2,
+	})
+}
+
+func pendingFile(filename string, status string) entity.PendingFile {
+	now := time.Now().UTC()
+	return entity.PendingFile{
+		Filename:  filename,
+		Category:  "docs",
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func TestIsStaged(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(
+		pendingFile("uploading.txt", entity.PendingStatusUploading),
+		pendingFile("pending.txt", entity.PendingStatusPending),
+		pendingFile("committed.txt", entity.PendingStatusCommitted),
+	)
+	service := newPending(repo, &storage{objects: map[string]bool{}})
+
+	expected := map[string]bool{
+		"uploading.txt": false,
+		"pending.txt":   true,
+		"committed.txt": false,
+		"missing.txt":   false,
+	}
+	for filename, staged := range expected {
+		isStaged, err := service.IsStaged(t.Context(), filename, "docs")
+		if err != nil {
+			t.Fatalf("is staged %q: %v", filename, err)
+		}
+		if isStaged != staged {
+			t.Fatalf("expected staged %v for %q, got %v", staged, filename, isStaged)
+		}
+	}
+}
+
+func TestCommit(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(pendingFile("a.txt", entity.PendingStatusPending))
+	storage := &storage{objects: map[string]bool{pending.ObjectName("a.txt"): true}}
+	service := newPending(repo, storage)
+
+	err := service.Commit(t.Context(), "a.txt", "docs", false)
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if repo.status("a.txt") != entity.PendingStatusCommitted || !storage.objects["a.txt"] {
+		t.Fatalf("expected committed file, got %s and %v", repo.status("a.txt"), storage.objects)
+	}
+	if len(repo.events) != 1 || repo.events[0].Type != entity.EventCommitted {
+		t.Fatalf("expected committed event, got %v", repo.events)
+	}
+}
+
+func TestCommitFailedMove(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(pendingFile("a.txt", entity.PendingStatusPending))
+	storage := &storage{
+		objects: map[string]bool{pending.ObjectName("a.txt"): true},
+		moveErr: errors.New("minio is unavailable"),
+	}
+	service := newPending(repo, storage)
+
+	err := service.Commit(t.Context(), "a.txt", "docs", false)
+	if !errors.Is(err, storage.moveErr) {
+		t.Fatalf("expected move error, got %v", err)
+	}
+	if repo.status("a.txt") != entity.PendingStatusPending || len(repo.events) != 0 {
+		t.Fatalf("expected file to wait for commit again, got %s and %v", repo.status("a.txt"), repo.events)
+	}
+
+	storage.moveErr = nil
+	err = service.Commit(t.Context(), "a.txt", "docs", false)
+	if err != nil {
+		t.Fatalf("repeated commit: %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		status   string
+		err      error
+		expected string
+	}{
+		{name: "pending upload", status: entity.PendingStatusPending, expected: entity.PendingStatusRolledBack},
+		{name: "uploading", status: entity.PendingStatusUploading, expected: entity.PendingStatusRolledBack},
+		{
+			name:     "committed upload",
+			status:   entity.PendingStatusCommitted,
+			err:      domain.ErrPendingFileCommitted,
+			expected: entity.PendingStatusCommitted,
+		},
+		{name: "expired upload", status: entity.PendingStatusExpired, expected: entity.PendingStatusExpired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := newRepo(pendingFile("a.txt", test.status))
+			storage := &storage{objects: map[string]bool{pending.ObjectName("a.txt"): true}}
+			service := newPending(repo, storage)
+
+			err := service.Rollback(t.Context(), "a.txt", "docs")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if repo.status("a.txt") != test.expected {
+				t.Fatalf("expected status %s, got %s", test.expected, repo.status("a.txt"))
+			}
+			rolledBack := test.expected == entity.PendingStatusRolledBack
+			if storage.objects[pending.ObjectName("a.txt")] == rolledBack {
+				t.Fatalf("pending object must be deleted only on rollback, got %v", storage.objects)
+			}
+			if rolledBack != (len(repo.events) == 1 && repo.events[0].Type == entity.EventRolledBack) {
+				t.Fatalf("expected rolled back event only on rollback, got %v", repo.events)
+			}
+		})
+	}
+}
+
+func TestCommittingFileIsNotModified(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(pendingFile("a.txt", entity.PendingStatusCommitting))
+	service := newPending(repo, &storage{objects: map[string]bool{}})
+
+	err := service.Rollback(t.Context(), "a.txt", "docs")
+	if !errors.Is(err, domain.ErrPendingFileCommitting) {
+		t.Fatalf("expected committing error on rollback, got %v", err)
+	}
+	err = service.Commit(t.Context(), "a.txt", "docs", true)
+	if !errors.Is(err, domain.ErrPendingFileCommitting) {
+		t.Fatalf("expected committing error on commit, got %v", err)
+	}
+	results := service.ForceExpire(t.Context(), []entity.FileToDelete{{Filename: "a.txt", Category: "docs"}})
+	if results[0].Status != entity.PendingActionError {
+		t.Fatalf("expected force expire error, got %+v", results)
+	}
+}
+
+func TestProcessPendingFilesRecoversCommits(t *testing.T) {
+	t.Parallel()
+
+	stale := time.Now().UTC().Add(-2 * time.Hour)
+	moved := pendingFile("moved.txt", entity.PendingStatusCommitting)
+	moved.UpdatedAt = stale
+	staged := pendingFile("staged.txt", entity.PendingStatusCommitting)
+	staged.UpdatedAt = stale
+	inProgress := pendingFile("in-progress.txt", entity.PendingStatusCommitting)
+	repo := newRepo(moved, staged, inProgress)
+	storage := &storage{objects: map[string]bool{
+		"moved.txt":                      true,
+		pending.ObjectName("staged.txt"): true,
+	}}
+	service := newPending(repo, storage)
+
+	err := service.ProcessPendingFiles(t.Context())
+	if err != nil {
+		t.Fatalf("process pending files: %v", err)
+	}
+	expected := map[string]string{
+		"moved.txt":       entity.PendingStatusCommitted,
+		"staged.txt":      entity.PendingStatusPending,
+		"in-progress.txt": entity.PendingStatusCommitting,
+	}
+	for filename, status := range expected {
+		if repo.status(filename) != status {
+			t.Fatalf("expected %s for %q, got %s", status, filename, repo.status(filename))
+		}
+	}
+	if len(repo.events) != 1 || repo.events[0].Filename != "moved.txt" {
+		t.Fatalf("expected committed event of moved file, got %v", repo.events)
+	}
+}
+
+func TestFinishedUploadIsNotReopened(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status string
+	}{
+		{name: "expired", status: entity.PendingStatusExpired},
+		{name: "rolled back", status: entity.PendingStatusRolledBack},
+		{name: "committed", status: entity.PendingStatusCommitted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := newRepo(pendingFile("a.txt", test.status))
+			storage := &storage{objects: map[string]bool{pending.ObjectName("a.txt"): true}}
+			service := newPending(repo, storage)
+
+			err := service.Enqueue(t.Context(), "a.txt", "docs")
+			if !errors.Is(err, domain.ErrPendingFileConflict) {
+				t.Fatalf("expected conflict on enqueue, got %v", err)
+			}
+			err = service.Fail(t.Context(), "a.txt", "docs", errors.New("upload failed"))
+			if !errors.Is(err, domain.ErrPendingFileConflict) {
+				t.Fatalf("expected conflict on fail, got %v", err)
+			}
+			if repo.status("a.txt") != test.status {
+				t.Fatalf("expected status %s to be kept, got %s", test.status, repo.status("a.txt"))
+			}
+		})
+	}
+}
+
+func TestBeginRejectsLongTtl(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	service := newPending(repo, &storage{objects: map[string]bool{}})
+	file := entity.PendingFile{Filename: "a.txt", Category: "docs"}
+
+	_, err := service.Begin(t.Context(), file, 25*time.Hour)
+	invalidArgument := domain.InvalidArgumentError{}
+	if !errors.As(err, &invalidArgument) || invalidArgument.ErrCode != domain.ErrCodeInvalidExpiration {
+		t.Fatalf("expected invalid expiration, got %v", err)
+	}
+	if len(repo.files) != 0 {
+		t.Fatalf("upload must not be registered, got %v", repo.files)
+	}
+
+	expiresAt, err := service.Begin(t.Context(), file, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	if expiresAt.Before(time.Now().Add(23 * time.Hour)) {
+		t.Fatalf("expected requested ttl, got %v", expiresAt)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	t.Parallel()
+
+	expiredAt := time.Now().UTC().Add(-time.Minute)
+	tests := []struct {
+		name      string
+		status    string
+		expiresAt *time.Time
+		ttl       time.Duration
+		err       error
+	}{
+		{name: "pending upload", status: entity.PendingStatusPending, ttl: 2 * time.Hour},
+		{name: "uploading", status: entity.PendingStatusUploading, ttl: 2 * time.Hour},
+		{
+			name:      "expired upload",
+			status:    entity.PendingStatusPending,
+			expiresAt: &expiredAt,
+			ttl:       time.Hour,
+			err:       domain.ErrPendingFileExpired,
+		},
+		{
+			name:   "committed upload",
+			status: entity.PendingStatusCommitted,
+			ttl:    time.Hour,
+			err:    domain.ErrPendingFileCommitted,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			file := pendingFile("a.txt", test.status)
+			if test.expiresAt != nil {
+				file.ExpiresAt = *test.expiresAt
+			}
+			repo := newRepo(file)
+			service := newPending(repo, &storage{objects: map[string]bool{}})
+
+			extended, err := service.Extend(t.Context(), "a.txt", "docs", test.ttl)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			expiresAt := repo.files[fileKey{"a.txt", "docs"}].ExpiresAt
+			if test.err != nil {
+				if !expiresAt.Equal(file.ExpiresAt) {
+					t.Fatalf("expiration must be kept, got %v", expiresAt)
+				}
+				return
+			}
+			if expiresAt.Before(time.Now().Add(test.ttl-time.Minute)) || !extended.ExpiresAt.Equal(expiresAt) {
+				t.Fatalf("expected expiration after requested ttl, got %v", expiresAt)
+			}
+		})
+	}
+}
+
+func TestExtendRejectsLongTtl(t *testing.T) {
+	t.Parallel()
+
+	file := pendingFile("a.txt", entity.PendingStatusPending)
+	repo := newRepo(file)
+	service := newPending(repo, &storage{objects: map[string]bool{}})
+
+	_, err := service.Extend(t.Context(), "a.txt", "docs", 25*time.Hour)
+	invalidArgument := domain.InvalidArgumentError{}
+	if !errors.As(err, &invalidArgument) || invalidArgument.ErrCode != domain.ErrCodeInvalidExpiration {
+		t.Fatalf("expected invalid expiration, got %v", err)
+	}
+	if !repo.files[fileKey{"a.txt", "docs"}].ExpiresAt.Equal(file.ExpiresAt) {
+		t.Fatal("expiration must be kept")
+	}
+}
+
+func newGroup(repo *repo, groupId string, filenames ...string) *storage {
+	now := time.Now().UTC()
+	repo.groups[groupId] = entity.PendingGroup{
+		Id:        groupId,
+		Status:    entity.PendingStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	storage := &storage{objects: map[string]bool{}, moveErrs: map[string]error{}}
+	for _, filename := range filenames {
+		file := pendingFile(filename, entity.PendingStatusPending)
+		file.GroupId = groupId
+		repo.files[fileKey{filename, "docs"}] = file
+		storage.objects[pending.ObjectName(filename)] = true
+	}
+	return storage
+}
+
+func TestCommitGroup(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt", "b.txt")
+	service := newPending(repo, storage)
+
+	err := service.CommitGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if err != nil {
+		t.Fatalf("commit group: %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusCommitted {
+		t.Fatalf("expected committed group, got %s", repo.groups["group"].Status)
+	}
+	expected := map[string]bool{"a.txt": true, "b.txt": true}
+	if !maps.Equal(storage.objects, expected) {
+		t.Fatalf("expected %v, got %v", expected, storage.objects)
+	}
+	for filename := range expected {
+		if repo.status(filename) != entity.PendingStatusCommitted {
+			t.Fatalf("expected committed %q, got %s", filename, repo.status(filename))
+		}
+	}
+	if len(repo.events) != 2 {
+		t.Fatalf("expected committed event of every file, got %v", repo.events)
+	}
+
+	err = service.RollbackGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if !errors.Is(err, domain.ErrPendingGroupCommitted) {
+		t.Fatalf("expected committed group error on rollback, got %v", err)
+	}
+}
+
+func TestRollbackGroup(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt", "b.txt")
+	service := newPending(repo, storage)
+
+	err := service.RollbackGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if err != nil {
+		t.Fatalf("rollback group: %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusRolledBack {
+		t.Fatalf("expected rolled back group, got %s", repo.groups["group"].Status)
+	}
+	if len(storage.objects) != 0 {
+		t.Fatalf("pending objects must be deleted, got %v", storage.objects)
+	}
+	if repo.status("a.txt") != entity.PendingStatusRolledBack || repo.status("b.txt") != entity.PendingStatusRolledBack {
+		t.Fatalf("expected rolled back files, got %s and %s", repo.status("a.txt"), repo.status("b.txt"))
+	}
+
+	err = service.CommitGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if !errors.Is(err, domain.ErrPendingGroupRolledBack) {
+		t.Fatalf("expected rolled back group error on commit, got %v", err)
+	}
+}
+
+func TestCommitGroupFailedMove(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt", "b.txt")
+	moveErr := errors.New("minio is unavailable")
+	storage.moveErrs[pending.ObjectName("b.txt")] = moveErr
+	service := newPending(repo, storage)
+
+	err := service.CommitGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if !errors.Is(err, moveErr) {
+		t.Fatalf("expected move error, got %v", err)
+	}
+	expected := map[string]bool{pending.ObjectName("a.txt"): true, pending.ObjectName("b.txt"): true}
+	if !maps.Equal(storage.objects, expected) {
+		t.Fatalf("moved files must be returned to pending, got %v", storage.objects)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusPending || repo.status("a.txt") != entity.PendingStatusPending {
+		t.Fatalf("group must wait for commit again, got %v", repo.groups)
+	}
+	if len(repo.events) != 0 {
+		t.Fatalf("expected no events, got %v", repo.events)
+	}
+
+	delete(storage.moveErrs, pending.ObjectName("b.txt"))
+	err = service.CommitGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if err != nil {
+		t.Fatalf("repeated commit: %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusCommitted || len(repo.events) != 2 {
+		t.Fatalf("expected committed group, got %v and %v", repo.groups, repo.events)
+	}
+}
+
+func TestCommitGroupFailedReturnIsRecovered(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt", "b.txt")
+	storage.moveErrs[pending.ObjectName("b.txt")] = errors.New("minio is unavailable")
+	storage.moveErrs["a.txt"] = errors.New("minio is unavailable")
+	service := newPending(repo, storage)
+
+	err := service.CommitGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if !errors.Is(err, domain.ErrPendingFileCommitting) {
+		t.Fatalf("expected committing error, got %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusCommitting {
+		t.Fatalf("group must stay committing, got %v", repo.groups)
+	}
+	err = service.RollbackGroup(t.Context(), "group", entity.Accessor{Unrestricted: true})
+	if !errors.Is(err, domain.ErrPendingFileCommitting) {
+		t.Fatalf("expected committing error on rollback, got %v", err)
+	}
+
+	storage.moveErrs = map[string]error{}
+	group := repo.groups["group"]
+	group.UpdatedAt = time.Now().UTC().Add(-2 * time.Hour)
+	repo.groups["group"] = group
+	err = service.ProcessPendingFiles(t.Context())
+	if err != nil {
+		t.Fatalf("process pending files: %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusCommitted || repo.status("b.txt") != entity.PendingStatusCommitted {
+		t.Fatalf("expected committed group, got %v", repo.groups)
+	}
+	if !storage.objects["a.txt"] || !storage.objects["b.txt"] {
+		t.Fatalf("expected all files to be moved, got %v", storage.objects)
+	}
+}
+
+func TestGroupRequiresPermissionForEveryCategory(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt")
+	file := pendingFile("b.png", entity.PendingStatusPending)
+	file.Category = "images"
+	file.GroupId = "group"
+	repo.files[fileKey{"b.png", "images"}] = file
+	service := newPending(repo, storage)
+
+	docsOnly := entity.Accessor{Subject: "api-key:crm", Permissions: []string{"files:read:docs", "files:commit:docs", "files:write:docs"}}
+	_, err := service.GetGroup(t.Context(), "group", docsOnly)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden get, got %v", err)
+	}
+	_, err = service.ExtendGroup(t.Context(), "group", time.Minute, docsOnly)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden extend, got %v", err)
+	}
+	err = service.CommitGroup(t.Context(), "group", docsOnly)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden commit, got %v", err)
+	}
+	err = service.RollbackGroup(t.Context(), "group", docsOnly)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden rollback, got %v", err)
+	}
+	if repo.groups["group"].Status != entity.PendingStatusPending || !storage.objects[pending.ObjectName("a.txt")] {
+		t.Fatalf("group must not be changed, got %v", repo.groups)
+	}
+
+	allCategories := entity.Accessor{Subject: "api-key:crm", Permissions: []string{"files:read:*"}}
+	group, err := service.GetGroup(t.Context(), "group", allCategories)
+	if err != nil || len(group.Files) != 2 {
+		t.Fatalf("expected group with two files, got %v and %v", group, err)
+	}
+}
+
+func TestForceExpire(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(
+		pendingFile("pending.txt", entity.PendingStatusPending),
+		pendingFile("committed.txt", entity.PendingStatusCommitted),
+	)
+	storage := &storage{objects: map[string]bool{
+		pending.ObjectName("pending.txt"): true,
+		"committed.txt":                   true,
+	}}
+	service := newPending(repo, storage)
+
+	results := service.ForceExpire(t.Context(), []entity.FileToDelete{
+		{Filename: "pending.txt", Category: "docs"},
+		{Filename: "committed.txt", Category: "docs"},
+		{Filename: "missing.txt", Category: "docs"},
+	})
+	expected := []string{entity.PendingStatusExpired, entity.PendingActionError, entity.PendingActionNotFound}
+	for i, status := range expected {
+		if results[i].Status != status {
+			t.Fatalf("expected %s for %q, got %+v", status, results[i].Filename, results[i])
+		}
+	}
+	if repo.status("pending.txt") != entity.PendingStatusExpired || repo.status("committed.txt") != entity.PendingStatusCommitted {
+		t.Fatalf("expected only pending upload to expire, got %v", repo.files)
+	}
+	if !maps.Equal(storage.objects, map[string]bool{"committed.txt": true}) {
+		t.Fatalf("expected only pending object to be deleted, got %v", storage.objects)
+	}
+	if len(repo.events) != 1 || repo.events[0].Type != entity.EventExpired {
+		t.Fatalf("expected expired event, got %v", repo.events)
+	}
+}
+
+func TestForceCommitIgnoresExpiration(t *testing.T) {
+	t.Parallel()
+
+	file := pendingFile("a.txt", entity.PendingStatusPending)
+	file.ExpiresAt = time.Now().UTC().Add(-time.Minute)
+	repo := newRepo(file)
+	storage := &storage{objects: map[string]bool{pending.ObjectName("a.txt"): true}}
+	service := newPending(repo, storage)
+
+	err := service.Commit(t.Context(), "a.txt", "docs", false)
+	if !errors.Is(err, domain.ErrPendingFileExpired) {
+		t.Fatalf("expected expired error, got %v", err)
+	}
+	err = service.Commit(t.Context(), "a.txt", "docs", true)
+	if err != nil {
+		t.Fatalf("force commit: %v", err)
+	}
+	if repo.status("a.txt") != entity.PendingStatusCommitted || !storage.objects["a.txt"] {
+		t.Fatalf("expected committed file, got %s and %v", repo.status("a.txt"), storage.objects)
+	}
+}
+
+func TestForceExpireGroupMember(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := newGroup(repo, "group", "a.txt", "b.txt")
+	service := newPending(repo, storage)
+
+	results := service.ForceExpire(t.Context(), []entity.FileToDelete{{Filename: "a.txt", Category: "docs"}})
+	if results[0].Status != entity.PendingActionError || !strings.HasSuffix(results[0].Error, domain.ErrPendingFileInGroup.Error()) {
+		t.Fatalf("expected group member error, got %+v", results)
+	}
+	if repo.status("a.txt") != entity.PendingStatusPending || !storage.objects[pending.ObjectName("a.txt")] {
+		t.Fatal("group member must be kept")
+	}
+}
+
+func TestFailedCleanupIsRetried(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo(
+		pendingFile("rolled-back.txt", entity.PendingStatusPending),
+		pendingFile("failed.txt", entity.PendingStatusUploading),
+	)
+	storage := &storage{
+		objects: map[string]bool{
+			pending.ObjectName("rolled-back.txt"): true,
+			pending.ObjectName("failed.txt"):      true,
+		},
+		deleteErr: errors.New("minio is unavailable"),
+	}
+	service := newPending(repo, storage)
+
+	err := service.Rollback(t.Context(), "rolled-back.txt", "docs")
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	err = service.Fail(t.Context(), "failed.txt", "docs", errors.New("upload failed"))
+	if err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	for _, filename := range []string{"rolled-back.txt", "failed.txt"} {
+		file := repo.files[fileKey{filename, "docs"}]
+		if file.Attempts != 1 || file.CleanedAt != nil {
+			t.Fatalf("expected recorded cleanup failure of %q, got %+v", filename, file)
+		}
+	}
+
+	storage.deleteErr = nil
+	err = service.ProcessPendingFiles(t.Context())
+	if err != nil {
+		t.Fatalf("process pending files: %v", err)
+	}
+	if len(storage.objects) != 0 {
+		t.Fatalf("expected files to be deleted by worker, got %v", storage.objects)
+	}
+	for _, filename := range []string{"rolled-back.txt", "failed.txt"} {
+		if repo.files[fileKey{filename, "docs"}].CleanedAt == nil {
+			t.Fatalf("expected %q to be cleaned", filename)
+		}
+	}
+}
+
+func TestCleanupMovesToDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	file := pendingFile("a.txt", entity.PendingStatusExpired)
+	file.Attempts = 2
+	repo := newRepo(file)
+	storage := &storage{
+		objects:   map[string]bool{pending.ObjectName("a.txt"): true},
+		deleteErr: errors.New("minio is unavailable"),
+	}
+	service := newPending(repo, storage)
+
+	err := service.ProcessPendingFiles(t.Context())
+	if err != nil {
+		t.Fatalf("process pending files: %v", err)
+	}
+	if len(repo.files) != 0 || len(repo.deadLetters) != 1 || repo.deadLetters[0].Attempts != 3 {
+		t.Fatalf("expected dead letter after 3 attempts, got %v and %v", repo.files, repo.deadLetters)
+	}
+}
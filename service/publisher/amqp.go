@@ -0,0 +1,148 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	exchangeKind = "topic"
+	heartbeat    = 10 * time.Second
+	locale       = "en_US"
+)
+
+type AmqpConfig struct {
+	Url string
+	// Exchange topic exchange, объявляется при подключении, пустой - exchange по умолчанию
+	Exchange string
+	// RoutingKeyPrefix ключ маршрутизации сообщения - префикс и тип события
+	RoutingKeyPrefix string
+	// ConfirmTimeout ожидание подключения и подтверждения публикации брокером
+	ConfirmTimeout time.Duration
+}
+
+// Amqp публикует события в брокер AMQP 0-9-1 в режиме publisher confirms,
+// соединение устанавливается при первой публикации, используется повторно и восстанавливается после ошибки.
+// Публикует только воркер outbox по одному событию, поэтому мьютекс не ожидают обработчики запросов
+type Amqp struct {
+	cfg  AmqpConfig
+	mu   *sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func NewAmqp(cfg AmqpConfig) *Amqp {
+	return &Amqp{
+		cfg: cfg,
+		mu:  &sync.Mutex{},
+	}
+}
+
+// Publish возвращает ошибку, если брокер недоступен или не подтвердил сообщение
+func (p *Amqp) Publish(ctx context.Context, event entity.StorageEvent) error {
+	body, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return errors.WithMessage(err, "marshal message")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.channel()
+	if err != nil {
+		return errors.WithMessage(err, "open channel")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ConfirmTimeout)
+	defer cancel()
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		p.cfg.Exchange,
+		p.cfg.RoutingKeyPrefix+event.Type,
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      amqp.Table{"category": event.Category},
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    strconv.FormatInt(event.Id, 10),
+			Timestamp:    event.CreatedAt,
+			Type:         event.Type,
+			Body:         body,
+		},
+	)
+	if err != nil {
+		p.reset()
+		return errors.WithMessage(err, "publish message")
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// подтверждение может прийти после таймаута, канал пересоздаётся, чтобы не смешивать подтверждения
+		p.reset()
+		return errors.WithMessage(err, "wait confirmation")
+	}
+	if !acked {
+		return errors.New("message is rejected by broker")
+	}
+	return nil
+}
+
+func (p *Amqp) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset()
+	return nil
+}
+
+func (p *Amqp) channel() (*amqp.Channel, error) {
+	if p.ch != nil && !p.ch.IsClosed() {
+		return p.ch, nil
+	}
+	p.reset()
+
+	conn, err := amqp.DialConfig(p.cfg.Url, amqp.Config{
+		Heartbeat: heartbeat,
+		Locale:    locale,
+		Dial:      amqp.DefaultDial(p.cfg.ConfirmTimeout),
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "dial")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithMessage(err, "channel")
+	}
+	err = ch.Confirm(false)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.WithMessage(err, "enable confirms")
+	}
+	if p.cfg.Exchange != "" {
+		err = ch.ExchangeDeclare(p.cfg.Exchange, exchangeKind, true, false, false, false, nil)
+		if err != nil {
+			_ = conn.Close()
+			return nil, errors.WithMessage(err, "declare exchange")
+		}
+	}
+
+	p.conn = conn
+	p.ch = ch
+	return ch, nil
+}
+
+func (p *Amqp) reset() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn = nil
+	p.ch = nil
+}
@@ -0,0 +1,248 @@
+package publisher_test
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/entity"
+	"storage-service/service/publisher"
+)
+
+func newAmqp(t *testing.T, url string) *publisher.Amqp {
+	t.Helper()
+	amqpPublisher := publisher.NewAmqp(publisher.AmqpConfig{
+		Url:              url,
+		Exchange:         "storage",
+		RoutingKeyPrefix: "storage.",
+		ConfirmTimeout:   time.Second,
+	})
+	t.Cleanup(func() {
+		_ = amqpPublisher.Close()
+	})
+	return amqpPublisher
+}
+
+func testEvent(id int64) entity.StorageEvent {
+	return entity.StorageEvent{
+		Id:        id,
+		Type:      entity.EventUploaded,
+		Category:  "images",
+		Filename:  "cat.png",
+		Actor:     "user",
+		CreatedAt: time.Date(2024, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestAmqpPublishConfirmed(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	amqpPublisher := newAmqp(t, broker.Url())
+
+	for id := int64(1); id <= 2; id++ {
+		err := amqpPublisher.Publish(context.Background(), testEvent(id))
+		if err != nil {
+			t.Fatalf("publish event %d: %v", id, err)
+		}
+	}
+
+	messages := broker.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+	if broker.connections.Load() != 1 {
+		t.Fatalf("expected connection to be reused, got %d connections", broker.connections.Load())
+	}
+	message := messages[0]
+	if message.Exchange != "storage" || message.RoutingKey != "storage.uploaded" {
+		t.Fatalf("unexpected destination %s/%s", message.Exchange, message.RoutingKey)
+	}
+	if message.MessageId != "1" || message.Type != entity.EventUploaded || message.ContentType != "application/json" {
+		t.Fatalf("unexpected properties %+v", message)
+	}
+	body := publisher.Message{}
+	err := json.Unmarshal(message.Body, &body)
+	if err != nil {
+		t.Fatalf("unmarshal body: %v", err)
+	}
+	if body != publisher.NewMessage(testEvent(1)) {
+		t.Fatalf("unexpected body %+v", body)
+	}
+}
+
+func TestAmqpPublishNacked(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	broker.nack.Store(true)
+	amqpPublisher := newAmqp(t, broker.Url())
+
+	err := amqpPublisher.Publish(context.Background(), testEvent(1))
+	if err == nil {
+		t.Fatal("expected error for rejected message")
+	}
+	if len(broker.Messages()) != 0 {
+		t.Fatal("rejected message must not be stored")
+	}
+}
+
+func TestAmqpBrokerDown(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	broker.down.Store(true)
+	amqpPublisher := newAmqp(t, broker.Url())
+
+	err := amqpPublisher.Publish(context.Background(), testEvent(1))
+	if err == nil {
+		t.Fatal("expected error while broker is down")
+	}
+}
+
+func TestAmqpReconnect(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	amqpPublisher := newAmqp(t, broker.Url())
+
+	err := amqpPublisher.Publish(context.Background(), testEvent(1))
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	broker.dropConnections()
+
+	// обрыв может быть обнаружен только при следующей публикации, тогда она завершается ошибкой
+	err = amqpPublisher.Publish(context.Background(), testEvent(2))
+	if err != nil {
+		err = amqpPublisher.Publish(context.Background(), testEvent(2))
+	}
+	if err != nil {
+		t.Fatalf("publish after reconnect: %v", err)
+	}
+	if broker.connections.Load() != 2 {
+		t.Fatalf("expected reconnect, got %d connections", broker.connections.Load())
+	}
+}
+
+func TestOutboxRelayKeepsEventsWhileBrokerIsDown(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	broker.down.Store(true)
+	store := newOutboxStore(testEvent(1), testEvent(2), testEvent(3))
+	outbox := publisher.NewOutbox(store, newAmqp(t, broker.Url()), publisher.OutboxConfig{
+		BatchSize: 10,
+	})
+
+	err := outbox.Relay(context.Background())
+	if err == nil {
+		t.Fatal("expected error while broker is down")
+	}
+	if published := store.Published(); len(published) != 0 {
+		t.Fatalf("no events must be marked published, got %v", published)
+	}
+
+	broker.down.Store(false)
+	err = outbox.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if published := store.Published(); !slices.Equal(published, []int64{1, 2, 3}) {
+		t.Fatalf("expected all events published, got %v", published)
+	}
+	messages := broker.Messages()
+	if len(messages) != 3 || messages[0].MessageId != "1" || messages[2].MessageId != "3" {
+		t.Fatalf("expected events in outbox order, got %+v", messages)
+	}
+}
+
+func TestOutboxRelaySkipsClaimedEvents(t *testing.T) {
+	t.Parallel()
+	broker := newFakeBroker(t)
+	store := newOutboxStore(testEvent(1), testEvent(2))
+	outbox := publisher.NewOutbox(store, newAmqp(t, broker.Url()), publisher.OutboxConfig{
+		BatchSize: 10,
+	})
+
+	// событие захвачено другим экземпляром, который ещё публикует его
+	now := time.Now().UTC()
+	_, err := store.ClaimUnpublishedEvents(context.Background(), now, now.Add(-time.Hour), 1)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	err = outbox.Relay(context.Background())
+	if err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+
+	messages := broker.Messages()
+	if len(messages) != 1 || messages[0].MessageId != "2" {
+		t.Fatalf("claimed event must not be relayed again, got %+v", messages)
+	}
+}
+
+// outboxStore outbox в памяти
+type outboxStore struct {
+	mu        *sync.Mutex
+	events    []entity.StorageEvent
+	published map[int64]bool
+	claimed   map[int64]time.Time
+}
+
+func newOutboxStore(events ...entity.StorageEvent) *outboxStore {
+	return &outboxStore{
+		mu:        &sync.Mutex{},
+		events:    events,
+		published: map[int64]bool{},
+		claimed:   map[int64]time.Time{},
+	}
+}
+
+func (s *outboxStore) ClaimUnpublishedEvents(
+	ctx context.Context,
+	now time.Time,
+	claimedBefore time.Time,
+	limit int,
+) ([]entity.StorageEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]entity.StorageEvent, 0)
+	for _, event := range s.events {
+		claimedAt, claimed := s.claimed[event.Id]
+		if s.published[event.Id] || (claimed && claimedAt.After(claimedBefore)) || len(events) == limit {
+			continue
+		}
+		s.claimed[event.Id] = now
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *outboxStore) ReleaseEvents(ctx context.Context, ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.claimed, id)
+	}
+	return nil
+}
+
+func (s *outboxStore) MarkEventsPublished(ctx context.Context, ids []int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		s.published[id] = true
+	}
+	return nil
+}
+
+func (s *outboxStore) Published() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]int64, 0, len(s.published))
+	for _, event := range s.events {
+		if s.published[event.Id] {
+			ids = append(ids, event.Id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,346 @@
+package publisher_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+type brokerMessage struct {
+	Exchange    string
+	RoutingKey  string
+	ContentType string
+	MessageId   string
+	Type        string
+	Body        []byte
+}
+
+// fakeBroker минимальный AMQP 0-9-1 сервер: рукопожатие, каналы, confirm mode, exchange.declare и basic.publish
+type fakeBroker struct {
+	listener net.Listener
+	// down соединения закрываются сразу после подключения
+	down atomic.Bool
+	// nack публикации отклоняются
+	nack        atomic.Bool
+	connections atomic.Int32
+
+	mu       *sync.Mutex
+	conns    []net.Conn
+	messages []brokerMessage
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	broker := &fakeBroker{
+		listener: listener,
+		mu:       &sync.Mutex{},
+	}
+	go broker.accept()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		broker.dropConnections()
+	})
+	return broker
+}
+
+func (b *fakeBroker) Url() string {
+	return "amqp://guest:guest@" + b.listener.Addr().String() + "/"
+}
+
+func (b *fakeBroker) Messages() []brokerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]brokerMessage{}, b.messages...)
+}
+
+// dropConnections обрывает соединения без закрытия по протоколу
+func (b *fakeBroker) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *fakeBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		if b.down.Load() {
+			_ = conn.Close()
+			continue
+		}
+		b.connections.Add(1)
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		go b.serve(conn)
+	}
+}
+
+type publishing struct {
+	channel  uint16
+	message  brokerMessage
+	bodySize uint64
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	header := make([]byte, 8)
+	_, err := io.ReadFull(reader, header)
+	if err != nil || !bytes.Equal(header, []byte("AMQP\x00\x00\x09\x01")) {
+		return
+	}
+
+	start := &argsWriter{}
+	start.octet(0)
+	start.octet(9)
+	start.long(0) // server-properties
+	start.longStr("PLAIN")
+	start.longStr("en_US")
+	if writeMethod(conn, 0, 10, 10, start) != nil {
+		return
+	}
+
+	deliveryTags := map[uint16]uint64{}
+	var current *publishing
+	for {
+		frameType, channel, payload, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		switch frameType {
+		case frameHeartbeat:
+			continue
+		case frameHeader:
+			if current == nil {
+				return
+			}
+			current.bodySize = readContentHeader(payload, &current.message)
+			if current.bodySize == 0 {
+				err = b.confirm(conn, current, deliveryTags)
+				current = nil
+			}
+		case frameBody:
+			if current == nil {
+				return
+			}
+			current.message.Body = append(current.message.Body, payload...)
+			if uint64(len(current.message.Body)) >= current.bodySize {
+				err = b.confirm(conn, current, deliveryTags)
+				current = nil
+			}
+		case frameMethod:
+			args := &argsReader{data: payload}
+			classId, methodId := args.short(), args.short()
+			switch {
+			case classId == 10 && methodId == 11: // connection.start-ok
+				tune := &argsWriter{}
+				tune.short(0)
+				tune.long(131072)
+				tune.short(0)
+				err = writeMethod(conn, 0, 10, 30, tune)
+			case classId == 10 && methodId == 31: // connection.tune-ok
+			case classId == 10 && methodId == 40: // connection.open
+				openOk := &argsWriter{}
+				openOk.shortStr("")
+				err = writeMethod(conn, 0, 10, 41, openOk)
+			case classId == 10 && methodId == 50: // connection.close
+				_ = writeMethod(conn, 0, 10, 51, &argsWriter{})
+				return
+			case classId == 20 && methodId == 10: // channel.open
+				openOk := &argsWriter{}
+				openOk.longStr("")
+				err = writeMethod(conn, channel, 20, 11, openOk)
+			case classId == 20 && methodId == 40: // channel.close
+				err = writeMethod(conn, channel, 20, 41, &argsWriter{})
+			case classId == 40 && methodId == 10: // exchange.declare
+				err = writeMethod(conn, channel, 40, 11, &argsWriter{})
+			case classId == 85 && methodId == 10: // confirm.select
+				err = writeMethod(conn, channel, 85, 11, &argsWriter{})
+			case classId == 60 && methodId == 40: // basic.publish
+				args.short()
+				current = &publishing{
+					channel: channel,
+					message: brokerMessage{
+						Exchange:   args.shortStr(),
+						RoutingKey: args.shortStr(),
+					},
+				}
+			default:
+				return
+			}
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) confirm(conn net.Conn, current *publishing, deliveryTags map[uint16]uint64) error {
+	deliveryTags[current.channel]++
+	confirm := &argsWriter{}
+	confirm.longLong(deliveryTags[current.channel])
+	confirm.octet(0)
+	if b.nack.Load() {
+		return writeMethod(conn, current.channel, 60, 120, confirm)
+	}
+
+	b.mu.Lock()
+	b.messages = append(b.messages, current.message)
+	b.mu.Unlock()
+	return writeMethod(conn, current.channel, 60, 80, confirm)
+}
+
+func readFrame(reader *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:7])+1)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[len(payload)-1] != frameEnd {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+func writeMethod(conn net.Conn, channel uint16, classId uint16, methodId uint16, args *argsWriter) error {
+	payload := &argsWriter{}
+	payload.short(classId)
+	payload.short(methodId)
+	payload.buf.Write(args.buf.Bytes())
+
+	frame := &argsWriter{}
+	frame.octet(frameMethod)
+	frame.short(channel)
+	frame.long(uint32(payload.buf.Len()))
+	frame.buf.Write(payload.buf.Bytes())
+	frame.octet(frameEnd)
+	_, err := conn.Write(frame.buf.Bytes())
+	return err
+}
+
+// readContentHeader разбирает свойства сообщения и возвращает размер тела
+func readContentHeader(payload []byte, message *brokerMessage) uint64 {
+	args := &argsReader{data: payload}
+	args.short() // class-id
+	args.short() // weight
+	bodySize := args.longLong()
+	flags := args.short()
+	for bit := 15; bit >= 2; bit-- {
+		if flags&(1<<bit) == 0 {
+			continue
+		}
+		switch bit {
+		case 15:
+			message.ContentType = args.shortStr()
+		case 13:
+			args.skip(int(args.long()))
+		case 12, 11:
+			args.skip(1)
+		case 7:
+			message.MessageId = args.shortStr()
+		case 6:
+			args.longLong()
+		case 5:
+			message.Type = args.shortStr()
+		default:
+			args.shortStr()
+		}
+	}
+	return bodySize
+}
+
+type argsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *argsWriter) octet(v byte) {
+	w.buf.WriteByte(v)
+}
+
+func (w *argsWriter) short(v uint16) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *argsWriter) long(v uint32) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *argsWriter) longLong(v uint64) {
+	_ = binary.Write(&w.buf, binary.BigEndian, v)
+}
+
+func (w *argsWriter) shortStr(v string) {
+	w.octet(byte(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *argsWriter) longStr(v string) {
+	w.long(uint32(len(v)))
+	w.buf.WriteString(v)
+}
+
+type argsReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *argsReader) skip(n int) {
+	r.pos = min(r.pos+n, len(r.data))
+}
+
+func (r *argsReader) next(n int) []byte {
+	start := min(r.pos, len(r.data))
+	r.skip(n)
+	if r.pos-start < n {
+		return make([]byte, n)
+	}
+	return r.data[start:r.pos]
+}
+
+func (r *argsReader) short() uint16 {
+	return binary.BigEndian.Uint16(r.next(2))
+}
+
+func (r *argsReader) long() uint32 {
+	return binary.BigEndian.Uint32(r.next(4))
+}
+
+func (r *argsReader) longLong() uint64 {
+	return binary.BigEndian.Uint64(r.next(8))
+}
+
+func (r *argsReader) shortStr() string {
+	n := int(r.next(1)[0])
+	return string(r.next(n))
+}
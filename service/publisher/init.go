@@ -0,0 +1,23 @@
+package publisher
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const WorkerQueueName = "storage_events"
+
+func EnqueueSeedJob(ctx context.Context, client *bgjob.Client) error {
+	err := client.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    "storage_events",
+		Queue: WorkerQueueName,
+		Type:  "storage_events",
+	})
+	if err != nil && !errors.Is(err, bgjob.ErrJobAlreadyExist) {
+		return errors.WithMessage(err, "enqueue job")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+// claimTimeout события, захваченные экземпляром, который не завершил публикацию, публикуются повторно по его истечении
+const claimTimeout = time.Hour
+
+type OutboxRepo interface {
+	ClaimUnpublishedEvents(ctx context.Context, now time.Time, claimedBefore time.Time, limit int) ([]entity.StorageEvent, error)
+	MarkEventsPublished(ctx context.Context, ids []int64, now time.Time) error
+	ReleaseEvents(ctx context.Context, ids []int64) error
+}
+
+type OutboxConfig struct {
+	BatchSize int
+}
+
+// Outbox публикует события, записанные в outbox в транзакции изменения, и отмечает опубликованные.
+// События публикуются только воркером, поэтому недоступность брокера не задерживает запросы
+// и не приводит к потере событий, а событие может быть опубликовано повторно
+type Outbox struct {
+	repo      OutboxRepo
+	publisher EventPublisher
+	cfg       OutboxConfig
+}
+
+func NewOutbox(
+	repo OutboxRepo,
+	publisher EventPublisher,
+	cfg OutboxConfig,
+) Outbox {
+	return Outbox{
+		repo:      repo,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Relay публикует не более cfg.BatchSize неопубликованных событий в порядке записи до первой ошибки,
+// опубликованные до ошибки события отмечаются, остальные освобождаются для следующего запуска.
+// События захватываются отдельным запросом, поэтому публикация не удерживает транзакцию
+func (o Outbox) Relay(ctx context.Context) error {
+	now := time.Now().UTC()
+	events, err := o.repo.ClaimUnpublishedEvents(ctx, now, now.Add(-claimTimeout), o.cfg.BatchSize)
+	if err != nil {
+		return errors.WithMessage(err, "claim unpublished events")
+	}
+
+	var publishErr error
+	published := make([]int64, 0, len(events))
+	for _, event := range events {
+		publishErr = o.publisher.Publish(ctx, event)
+		if publishErr != nil {
+			publishErr = errors.WithMessagef(publishErr, "publish event %d", event.Id)
+			break
+		}
+		published = append(published, event.Id)
+	}
+
+	if len(published) > 0 {
+		err = o.repo.MarkEventsPublished(ctx, published, time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "mark events published")
+		}
+	}
+	if publishErr == nil {
+		return nil
+	}
+
+	released := make([]int64, 0, len(events)-len(published))
+	for _, event := range events[len(published):] {
+		released = append(released, event.Id)
+	}
+	err = o.repo.ReleaseEvents(ctx, released)
+	if err != nil {
+		return errors.WithMessagef(publishErr, "release events: %v", err)
+	}
+	return publishErr
+}
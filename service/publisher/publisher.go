@@ -0,0 +1,75 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/log"
+)
+
+const (
+	TypeNone = "none"
+	TypeLog  = "log"
+	TypeAmqp = "amqp"
+)
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event entity.StorageEvent) error
+}
+
+// Message тело сообщения о событии хранилища
+type Message struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Category  string    `json:"category"`
+	Filename  string    `json:"filename"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewMessage(event entity.StorageEvent) Message {
+	return Message{
+		Id:        event.Id,
+		Type:      event.Type,
+		Category:  event.Category,
+		Filename:  event.Filename,
+		Actor:     event.Actor,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+// Noop не публикует события, используется, если брокер не настроен
+type Noop struct {
+}
+
+func NewNoop() Noop {
+	return Noop{}
+}
+
+func (p Noop) Publish(ctx context.Context, event entity.StorageEvent) error {
+	return nil
+}
+
+// Log пишет события в лог вместо брокера
+type Log struct {
+	logger log.Logger
+}
+
+func NewLog(logger log.Logger) Log {
+	return Log{
+		logger: logger,
+	}
+}
+
+func (p Log) Publish(ctx context.Context, event entity.StorageEvent) error {
+	p.logger.Info(ctx, "storage event",
+		log.Int64("id", event.Id),
+		log.String("type", event.Type),
+		log.String("category", event.Category),
+		log.String("filename", event.Filename),
+		log.String("actor", event.Actor),
+	)
+	return nil
+}
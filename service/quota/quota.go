@@ -0,0 +1,235 @@
+package quota
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultReservationTtl = time.Hour
+)
+
+type Config struct {
+	Categories map[string]entity.QuotaLimit
+	Clients    map[string]entity.QuotaLimit
+	// DefaultClient лимит клиентов, для которых не задан собственный лимит
+	DefaultClient entity.QuotaLimit
+	// ReservationTtl срок, после которого резерв незавершённой загрузки освобождается,
+	// например, если экземпляр сервиса остановился во время загрузки
+	ReservationTtl time.Duration
+}
+
+type QuotaTxRunner interface {
+	QuotaTx(ctx context.Context, tx func(ctx context.Context, tx QuotaTx) error) error
+}
+
+type QuotaTx interface {
+	// LockUsage блокирует счётчики до конца транзакции, чтобы одновременные загрузки резервировали место по очереди
+	LockUsage(ctx context.Context, scope string, name string) (*entity.QuotaUsage, error)
+	DeleteExpiredReservations(ctx context.Context, category string, now time.Time) error
+	InsertReservation(ctx context.Context, reservation entity.QuotaReservation) error
+}
+
+type Repo interface {
+	GetUsage(ctx context.Context, scope string, name string) (*entity.QuotaUsage, error)
+	ListUsage(ctx context.Context, scope string) ([]entity.QuotaUsage, error)
+	DeleteReservation(ctx context.Context, id string) error
+}
+
+type Quotas struct {
+	txRunner QuotaTxRunner
+	repo     Repo
+	cfg      Config
+}
+
+func NewQuotas(txRunner QuotaTxRunner, repo Repo, cfg Config) Quotas {
+	if cfg.ReservationTtl <= 0 {
+		cfg.ReservationTtl = defaultReservationTtl
+	}
+	return Quotas{
+		txRunner: txRunner,
+		repo:     repo,
+		cfg:      cfg,
+	}
+}
+
+// Reserve проверяет лимиты категории и клиента и резервирует место и объект для загрузки в одной транзакции,
+// возвращает резерв и сколько байт можно записать, -1 если лимиты не заданы.
+// size объявленный размер содержимого, резервируется он, а если неизвестен (-1) - всё доступное место.
+// replacedBytes размер перезаписываемого объекта, место которого освободится после записи.
+// После записи объекта резерв освобождается через Release
+func (s Quotas) Reserve(
+	ctx context.Context,
+	category string,
+	client string,
+	size int64,
+	replacedBytes int64,
+	newObject bool,
+) (*entity.QuotaReservation, int64, error) {
+	objects := int64(0)
+	if newObject {
+		objects = 1
+	}
+	now := time.Now().UTC()
+	reservation := entity.QuotaReservation{
+		Id:        uuid.NewString(),
+		Category:  category,
+		Owner:     client,
+		Objects:   objects,
+		ExpiresAt: now.Add(s.cfg.ReservationTtl),
+	}
+	allowance := int64(-1)
+	err := s.txRunner.QuotaTx(ctx, func(ctx context.Context, tx QuotaTx) error {
+		err := tx.DeleteExpiredReservations(ctx, category, now)
+		if err != nil {
+			return errors.WithMessage(err, "delete expired reservations")
+		}
+
+		// счётчики блокируются в том же порядке, в котором их обновляют триггеры: категория, затем клиент
+		scopes := []string{entity.QuotaScopeCategory}
+		names := []string{category}
+		if client != "" {
+			scopes = append(scopes, entity.QuotaScopeClient)
+			names = append(names, client)
+		}
+		remaining := int64(-1)
+		for i, scope := range scopes {
+			usage, err := tx.LockUsage(ctx, scope, names[i])
+			if err != nil {
+				return errors.WithMessagef(err, "lock %s usage", scope)
+			}
+			status := entity.QuotaStatus{Usage: *usage, Limit: s.limit(scope, names[i])}
+			if status.Exceeded(0, objects) {
+				return errors.WithMessagef(domain.ErrQuotaExceeded, "%s '%s'", scope, names[i])
+			}
+			scopeRemaining := status.RemainingBytes()
+			if scopeRemaining < 0 {
+				continue
+			}
+			scopeRemaining += replacedBytes
+			if remaining < 0 || scopeRemaining < remaining {
+				remaining = scopeRemaining
+			}
+		}
+
+		// записанный размер может отличаться от объявленного, например, после обработки изображения,
+		// поэтому запись ограничивается только оставшимся местом
+		if remaining == 0 && size > 0 {
+			return domain.ErrQuotaExceeded
+		}
+		allowance = remaining
+		reserved := remaining
+		if size >= 0 && (remaining < 0 || size < remaining) {
+			reserved = size
+		}
+		if reserved > 0 {
+			reservation.Bytes = max(reserved-replacedBytes, 0)
+		}
+
+		err = tx.InsertReservation(ctx, reservation)
+		if err != nil {
+			return errors.WithMessage(err, "insert reservation")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, errors.WithMessage(err, "quota tx")
+	}
+	return &reservation, allowance, nil
+}
+
+// Release освобождает резерв после записи объекта или при ошибке загрузки
+func (s Quotas) Release(ctx context.Context, reservation entity.QuotaReservation) error {
+	err := s.repo.DeleteReservation(ctx, reservation.Id)
+	if err != nil {
+		return errors.WithMessage(err, "delete reservation")
+	}
+	return nil
+}
+
+func (s Quotas) Status(ctx context.Context, scope string, name string) (*entity.QuotaStatus, error) {
+	usage, err := s.repo.GetUsage(ctx, scope, name)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get usage")
+	}
+	return &entity.QuotaStatus{
+		Usage: *usage,
+		Limit: s.limit(scope, name),
+	}, nil
+}
+
+// List использование и лимиты всех учитываемых категорий и клиентов,
+// scope ограничивает выборку категориями или клиентами
+func (s Quotas) List(ctx context.Context, scope string) ([]entity.QuotaStatus, error) {
+	usage, err := s.repo.ListUsage(ctx, scope)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list usage")
+	}
+	statuses := make([]entity.QuotaStatus, 0, len(usage))
+	for _, item := range usage {
+		statuses = append(statuses, entity.QuotaStatus{
+			Usage: item,
+			Limit: s.limit(item.Scope, item.Name),
+		})
+	}
+	return statuses, nil
+}
+
+func (s Quotas) limit(scope string, name string) entity.QuotaLimit {
+	if scope == entity.QuotaScopeCategory {
+		return s.cfg.Categories[name]
+	}
+	limit, ok := s.cfg.Clients[name]
+	if ok {
+		return limit
+	}
+	return s.cfg.DefaultClient
+}
+
+// LimitedReader прерывает чтение с domain.ErrQuotaExceeded, как только прочитано больше limit байт,
+// чтобы загрузка остановилась при превышении квоты, а не после записи всего файла
+type LimitedReader struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// NewLimitedReader при limit < 0 чтение не ограничивается
+func NewLimitedReader(reader io.Reader, limit int64) *LimitedReader {
+	return &LimitedReader{
+		reader: reader,
+		limit:  limit,
+	}
+}
+
+func (r *LimitedReader) Read(p []byte) (int, error) {
+	if r.limit < 0 {
+		return r.reader.Read(p)
+	}
+	if r.exceeded {
+		return 0, domain.ErrQuotaExceeded
+	}
+	// читается не больше одного байта сверх лимита, чтобы обнаружить превышение
+	if int64(len(p)) > r.limit-r.read+1 {
+		p = p[:r.limit-r.read+1]
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		r.exceeded = true
+		return 0, domain.ErrQuotaExceeded
+	}
+	return n, err
+}
+
+func (r *LimitedReader) Exceeded() bool {
+	return r.exceeded
+}
@@ -0,0 +1,216 @@
+package quota_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/quota"
+)
+
+// memoryRepo счётчики и резервы, транзакция выполняется под мьютексом, как под блокировкой строк счётчиков
+type memoryRepo struct {
+	mu           *sync.Mutex
+	usage        map[string]entity.QuotaUsage
+	reservations map[string]entity.QuotaReservation
+}
+
+func newMemoryRepo(usage map[string]entity.QuotaUsage) memoryRepo {
+	return memoryRepo{
+		mu:           &sync.Mutex{},
+		usage:        usage,
+		reservations: map[string]entity.QuotaReservation{},
+	}
+}
+
+func (r memoryRepo) QuotaTx(ctx context.Context, tx func(ctx context.Context, tx quota.QuotaTx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return tx(ctx, r)
+}
+
+func (r memoryRepo) LockUsage(ctx context.Context, scope string, name string) (*entity.QuotaUsage, error) {
+	return r.GetUsage(ctx, scope, name)
+}
+
+func (r memoryRepo) GetUsage(_ context.Context, scope string, name string) (*entity.QuotaUsage, error) {
+	usage, ok := r.usage[scope+"/"+name]
+	if !ok {
+		return &entity.QuotaUsage{Scope: scope, Name: name}, nil
+	}
+	return &usage, nil
+}
+
+func (r memoryRepo) ListUsage(_ context.Context, _ string) ([]entity.QuotaUsage, error) {
+	return nil, nil
+}
+
+func (r memoryRepo) InsertReservation(_ context.Context, reservation entity.QuotaReservation) error {
+	r.reservations[reservation.Id] = reservation
+	r.apply(reservation, 1)
+	return nil
+}
+
+func (r memoryRepo) DeleteReservation(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reservation, ok := r.reservations[id]
+	if ok {
+		delete(r.reservations, id)
+		r.apply(reservation, -1)
+	}
+	return nil
+}
+
+func (r memoryRepo) DeleteExpiredReservations(_ context.Context, category string, now time.Time) error {
+	for id, reservation := range r.reservations {
+		if reservation.Category == category && reservation.ExpiresAt.Before(now) {
+			delete(r.reservations, id)
+			r.apply(reservation, -1)
+		}
+	}
+	return nil
+}
+
+// apply обновляет счётчики, как триггер на quota_reservations
+func (r memoryRepo) apply(reservation entity.QuotaReservation, sign int64) {
+	keys := []string{entity.QuotaScopeCategory + "/" + reservation.Category}
+	if reservation.Owner != "" {
+		keys = append(keys, entity.QuotaScopeClient+"/"+reservation.Owner)
+	}
+	for _, key := range keys {
+		usage := r.usage[key]
+		usage.ReservedBytes += sign * reservation.Bytes
+		usage.ReservedObjects += sign * reservation.Objects
+		r.usage[key] = usage
+	}
+}
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	repo := newMemoryRepo(map[string]entity.QuotaUsage{
+		"category/avatars": {Scope: entity.QuotaScopeCategory, Name: "avatars", Bytes: 600, Objects: 3},
+		"client/svc":       {Scope: entity.QuotaScopeClient, Name: "svc", Bytes: 900, Objects: 2},
+	})
+	service := quota.NewQuotas(repo, repo, quota.Config{
+		Categories:    map[string]entity.QuotaLimit{"avatars": {MaxBytes: 1000, MaxObjects: 3}},
+		DefaultClient: entity.QuotaLimit{MaxBytes: 1000},
+	})
+	ctx := t.Context()
+
+	// без объявленного размера резервируется всё доступное место
+	reservation, allowance, err := service.Reserve(ctx, "avatars", "", -1, 0, false)
+	if err != nil || allowance != 400 || reservation.Bytes != 400 {
+		t.Fatalf("category allowance: got %d, %+v, %v", allowance, reservation, err)
+	}
+	_, _, err = service.Reserve(ctx, "avatars", "", 1, 0, false)
+	if !errors.Is(err, domain.ErrQuotaExceeded) {
+		t.Fatalf("reserved space must not be available, got %v", err)
+	}
+	err = service.Release(ctx, *reservation)
+	if err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	// резервируется объявленный размер, а запись ограничивается оставшимся местом клиента
+	reservation, allowance, err = service.Reserve(ctx, "avatars", "svc", 100, 50, false)
+	if err != nil || allowance != 150 || reservation.Bytes != 50 {
+		t.Fatalf("declared size with replaced object: got %d, %+v, %v", allowance, reservation, err)
+	}
+	_, allowance, err = service.Reserve(ctx, "avatars", "svc", 101, 0, false)
+	if err != nil || allowance != 50 {
+		t.Fatalf("expected client allowance reduced by reservation, got %d, %v", allowance, err)
+	}
+
+	_, _, err = service.Reserve(ctx, "avatars", "", 0, 0, true)
+	if !errors.Is(err, domain.ErrQuotaExceeded) {
+		t.Fatalf("expected objects limit to be exceeded, got %v", err)
+	}
+	reservation, allowance, err = service.Reserve(ctx, "docs", "", -1, 0, true)
+	if err != nil || allowance != -1 || reservation.Objects != 1 {
+		t.Fatalf("unlimited category: got %d, %+v, %v", allowance, reservation, err)
+	}
+	// объявленный размер не ограничивает запись, обработанное изображение может оказаться больше исходного
+	_, allowance, err = service.Reserve(ctx, "docs", "", 100, 0, true)
+	if err != nil || allowance != -1 {
+		t.Fatalf("declared size in unlimited category: got %d, %v", allowance, err)
+	}
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	t.Parallel()
+
+	repo := newMemoryRepo(map[string]entity.QuotaUsage{})
+	service := quota.NewQuotas(repo, repo, quota.Config{
+		Categories: map[string]entity.QuotaLimit{"avatars": {MaxObjects: 5}},
+	})
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved int
+	)
+	for range 20 {
+		wg.Go(func() {
+			_, _, err := service.Reserve(t.Context(), "avatars", "", 10, 0, true)
+			if err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if reserved != 5 {
+		t.Fatalf("expected 5 reservations within objects limit, got %d", reserved)
+	}
+}
+
+func TestExpiredReservationIsReleased(t *testing.T) {
+	t.Parallel()
+
+	repo := newMemoryRepo(map[string]entity.QuotaUsage{})
+	service := quota.NewQuotas(repo, repo, quota.Config{
+		Categories:     map[string]entity.QuotaLimit{"avatars": {MaxObjects: 1}},
+		ReservationTtl: time.Nanosecond,
+	})
+
+	_, _, err := service.Reserve(t.Context(), "avatars", "", 10, 0, true)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	_, _, err = service.Reserve(t.Context(), "avatars", "", 10, 0, true)
+	if err != nil {
+		t.Fatalf("reservation of interrupted upload must expire, got %v", err)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	t.Parallel()
+
+	reader := quota.NewLimitedReader(bytes.NewReader(make([]byte, 10)), 10)
+	data, err := io.ReadAll(reader)
+	if err != nil || len(data) != 10 || reader.Exceeded() {
+		t.Fatalf("read within limit: got %d bytes, %v", len(data), err)
+	}
+
+	reader = quota.NewLimitedReader(bytes.NewReader(make([]byte, 11)), 10)
+	_, err = io.ReadAll(reader)
+	if !errors.Is(err, domain.ErrQuotaExceeded) || !reader.Exceeded() {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+
+	reader = quota.NewLimitedReader(bytes.NewReader(make([]byte, 100)), -1)
+	data, err = io.ReadAll(reader)
+	if err != nil || len(data) != 100 {
+		t.Fatalf("unlimited read: got %d bytes, %v", len(data), err)
+	}
+}
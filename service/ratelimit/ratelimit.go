@@ -0,0 +1,194 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval как часто удаляются заполненные корзины неактивных клиентов
+const sweepInterval = time.Minute
+
+// Limit скорость пополнения корзины токенов, нулевое значение Rate не ограничивает запросы
+type Limit struct {
+	// Rate запросов в секунду
+	Rate float64
+	// Burst ёмкость корзины, сколько запросов можно выполнить подряд, если 0, равна Rate, но не меньше 1
+	Burst int
+}
+
+type Config struct {
+	// Client лимит клиентов, для которых не задан собственный лимит
+	Client  Limit
+	Clients map[string]Limit
+	// Routes лимиты маршрутов, общие для всех клиентов, ключ - метод и путь маршрута
+	Routes map[string]Limit
+	// Ip лимит запросов с одного IP адреса, проверяется до учётных данных
+	Ip Limit
+	// MaxClientTransfers и MaxTransfers ограничения одновременных загрузок и скачиваний клиента и сервиса, 0 - без ограничения
+	MaxClientTransfers int
+	MaxTransfers       int
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// Limiter состояние лимитов одного экземпляра сервиса, пересоздаётся при получении новой конфигурации
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu              *sync.Mutex
+	clientBuckets   map[string]*bucket
+	routeBuckets    map[string]*bucket
+	ipBuckets       map[string]*bucket
+	clientTransfers map[string]int
+	transfers       int
+	lastSweep       time.Time
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:             cfg,
+		now:             time.Now,
+		mu:              &sync.Mutex{},
+		clientBuckets:   make(map[string]*bucket),
+		routeBuckets:    make(map[string]*bucket),
+		ipBuckets:       make(map[string]*bucket),
+		clientTransfers: make(map[string]int),
+	}
+}
+
+// Allow расходует токен клиента и токен маршрута, если доступны оба,
+// иначе возвращает, через сколько запрос может быть выполнен
+func (l *Limiter) Allow(client string, route string) (time.Duration, bool) {
+	clientLimit, ok := l.cfg.Clients[client]
+	if !ok {
+		clientLimit = l.cfg.Client
+	}
+	routeLimit := l.cfg.Routes[route]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	buckets := make([]*bucket, 0, 2) // nolint:mnd
+	if clientLimit.Rate > 0 {
+		buckets = append(buckets, l.bucket(l.clientBuckets, client, clientLimit, now))
+	}
+	if routeLimit.Rate > 0 {
+		buckets = append(buckets, l.bucket(l.routeBuckets, route, routeLimit, now))
+	}
+	return take(buckets)
+}
+
+// AllowIp расходует токен IP адреса клиента
+func (l *Limiter) AllowIp(ip string) (time.Duration, bool) {
+	if l.cfg.Ip.Rate <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	return take([]*bucket{l.bucket(l.ipBuckets, ip, l.cfg.Ip, now)})
+}
+
+// AcquireTransfer занимает место для загрузки или скачивания клиента,
+// release должен быть вызван по завершении передачи
+func (l *Limiter) AcquireTransfer(client string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxTransfers > 0 && l.transfers >= l.cfg.MaxTransfers {
+		return nil, false
+	}
+	if l.cfg.MaxClientTransfers > 0 && l.clientTransfers[client] >= l.cfg.MaxClientTransfers {
+		return nil, false
+	}
+	l.transfers++
+	l.clientTransfers[client]++
+
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.transfers--
+			l.clientTransfers[client]--
+			if l.clientTransfers[client] <= 0 {
+				delete(l.clientTransfers, client)
+			}
+		})
+	}, true
+}
+
+func (l *Limiter) bucket(buckets map[string]*bucket, key string, limit Limit, now time.Time) *bucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens:  burst(limit),
+			updated: now,
+			limit:   limit,
+		}
+		buckets[key] = b
+		return b
+	}
+	b.refill(now)
+	return b
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed*b.limit.Rate, burst(b.limit))
+		b.updated = now
+	}
+}
+
+// sweep удаляет заполненные корзины, они не отличаются от новых
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for _, buckets := range []map[string]*bucket{l.clientBuckets, l.routeBuckets, l.ipBuckets} {
+		for key, b := range buckets {
+			b.refill(now)
+			if b.tokens >= burst(b.limit) {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+// take расходует по токену из каждой корзины, если токены есть во всех,
+// токен не расходуется, если запрос отклоняет другая корзина
+func take(buckets []*bucket) (time.Duration, bool) {
+	wait := time.Duration(0)
+	for _, b := range buckets {
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration((1-b.tokens)/b.limit.Rate*float64(time.Second)))
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return 0, true
+}
+
+func burst(limit Limit) float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return max(math.Ceil(limit.Rate), 1)
+}
@@ -0,0 +1,126 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"storage-service/service/ratelimit"
+)
+
+func TestAllow(t *testing.T) {
+	t.Parallel()
+
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Client:  ratelimit.Limit{Rate: 1, Burst: 2},
+		Clients: map[string]ratelimit.Limit{"api-key:unlimited": {}},
+		Routes:  map[string]ratelimit.Limit{"DELETE /file/:category/:filename": {Rate: 0.001}},
+	})
+
+	for range 2 {
+		_, ok := limiter.Allow("api-key:svc", "GET /file/:category/:filename")
+		if !ok {
+			t.Fatal("expected request within burst to be allowed")
+		}
+	}
+	wait, ok := limiter.Allow("api-key:svc", "GET /file/:category/:filename")
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("expected client limit to be exceeded, got %v, %v", wait, ok)
+	}
+
+	for range 5 {
+		_, ok = limiter.Allow("api-key:unlimited", "GET /file/:category/:filename")
+		if !ok {
+			t.Fatal("expected client without limit to be allowed")
+		}
+	}
+
+	// лимит маршрута общий для всех клиентов, отклонённый запрос не расходует токен клиента
+	_, ok = limiter.Allow("api-key:a", "DELETE /file/:category/:filename")
+	if !ok {
+		t.Fatal("expected first route request to be allowed")
+	}
+	wait, ok = limiter.Allow("api-key:b", "DELETE /file/:category/:filename")
+	if ok || wait < time.Minute {
+		t.Fatalf("expected route limit to be exceeded, got %v, %v", wait, ok)
+	}
+	for range 2 {
+		_, ok = limiter.Allow("api-key:b", "GET /file/:category/:filename")
+		if !ok {
+			t.Fatal("expected rejected route request to keep client tokens")
+		}
+	}
+}
+
+func TestAllowIp(t *testing.T) {
+	t.Parallel()
+
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Client: ratelimit.Limit{Rate: 1, Burst: 1},
+		Ip:     ratelimit.Limit{Rate: 1, Burst: 2},
+	})
+
+	for range 2 {
+		_, ok := limiter.AllowIp("10.0.0.1")
+		if !ok {
+			t.Fatal("expected request within burst to be allowed")
+		}
+	}
+	wait, ok := limiter.AllowIp("10.0.0.1")
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("expected ip limit to be exceeded, got %v, %v", wait, ok)
+	}
+	_, ok = limiter.AllowIp("10.0.0.2")
+	if !ok {
+		t.Fatal("expected request from another ip to be allowed")
+	}
+	// лимит IP адреса не расходует токены клиента с тем же адресом
+	_, ok = limiter.Allow("ip:10.0.0.1", "GET /file/:category/:filename")
+	if !ok {
+		t.Fatal("expected client tokens to be kept")
+	}
+
+	limiter = ratelimit.NewLimiter(ratelimit.Config{})
+	for range 100 {
+		_, ok = limiter.AllowIp("10.0.0.1")
+		if !ok {
+			t.Fatal("expected requests without ip limit to be allowed")
+		}
+	}
+}
+
+func TestAcquireTransfer(t *testing.T) {
+	t.Parallel()
+
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		MaxClientTransfers: 1,
+		MaxTransfers:       2,
+	})
+
+	release, ok := limiter.AcquireTransfer("a")
+	if !ok {
+		t.Fatal("expected first transfer to be allowed")
+	}
+	_, ok = limiter.AcquireTransfer("a")
+	if ok {
+		t.Fatal("expected client transfer limit to be exceeded")
+	}
+	_, ok = limiter.AcquireTransfer("b")
+	if !ok {
+		t.Fatal("expected transfer of another client to be allowed")
+	}
+	_, ok = limiter.AcquireTransfer("c")
+	if ok {
+		t.Fatal("expected global transfer limit to be exceeded")
+	}
+
+	release()
+	release()
+	_, ok = limiter.AcquireTransfer("a")
+	if !ok {
+		t.Fatal("expected transfer to be allowed after release")
+	}
+	_, ok = limiter.AcquireTransfer("c")
+	if ok {
+		t.Fatal("expected repeated release to free a single transfer")
+	}
+}
@@ -0,0 +1,23 @@
+package reference
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const WorkerQueueName = "unreferenced_files"
+
+func EnqueueSeedJob(ctx context.Context, client *bgjob.Client) error {
+	err := client.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    "references",
+		Queue: WorkerQueueName,
+		Type:  "references",
+	})
+	if err != nil && !errors.Is(err, bgjob.ErrJobAlreadyExist) {
+		return errors.WithMessage(err, "enqueue job")
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package reference
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+type ReferenceTxRunner interface {
+	ReferenceTx(ctx context.Context, tx func(ctx context.Context, tx ReferenceTx) error) error
+}
+
+type ReferenceTx interface {
+	InsertReference(ctx context.Context, ref entity.FileReference) error
+	DeleteReference(ctx context.Context, ref entity.FileReference) error
+	CountReferences(ctx context.Context, filename string, category string) (int, error)
+	UpsertOrphan(ctx context.Context, filename string, category string, now time.Time) error
+	DeleteOrphan(ctx context.Context, filename string, category string) error
+}
+
+type ReferenceRepo interface {
+	GetFileReferences(ctx context.Context, filename string, category string) ([]entity.FileReference, error)
+	GetOwnerReferences(ctx context.Context, ownerType string, ownerId string) ([]entity.FileReference, error)
+	ClaimCollectableOrphans(
+		ctx context.Context,
+		before time.Time,
+		claimedBefore time.Time,
+		now time.Time,
+		maxFiles int,
+	) ([]entity.FileOrphan, error)
+	DeleteClaimedOrphan(ctx context.Context, orphan entity.FileOrphan) error
+}
+
+type FileRepo interface {
+	StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error)
+}
+
+// Trash файл без ссылок перемещается в корзину, как при удалении через API
+type Trash interface {
+	MoveToTrash(ctx context.Context, filename string, category string, deletedBy string) error
+}
+
+type Locks interface {
+	IsLocked(ctx context.Context, filename string, category string) (bool, error)
+}
+
+// claimTimeout отметка, не обработанная за это время после захвата, захватывается воркером повторно
+const claimTimeout = time.Hour
+
+type Config struct {
+	// GracePeriod время между удалением последней ссылки и удалением файла
+	GracePeriod     time.Duration
+	MaxDeletedFiles int
+}
+
+// References учитывает ссылки доменных сущностей на файлы,
+// файл, у которого не осталось ссылок, удаляется воркером по истечении GracePeriod.
+// Файлы, на которые никогда не ссылались, не удаляются
+type References struct {
+	txRunner      ReferenceTxRunner
+	repo          FileRepo
+	referenceRepo ReferenceRepo
+	trash         Trash
+	locks         Locks
+	cfg           Config
+}
+
+func NewReferences(
+	txRunner ReferenceTxRunner,
+	repo FileRepo,
+	referenceRepo ReferenceRepo,
+	trash Trash,
+	locks Locks,
+	cfg Config,
+) References {
+	return References{
+		txRunner:      txRunner,
+		repo:          repo,
+		referenceRepo: referenceRepo,
+		trash:         trash,
+		locks:         locks,
+		cfg:           cfg,
+	}
+}
+
+func (s References) Attach(ctx context.Context, ref entity.FileReference) (*entity.FileReference, error) {
+	if entity.IsInternalObject(ref.Filename) {
+		return nil, domain.ErrFileNotFound
+	}
+	_, err := s.repo.StatFile(ctx, ref.Filename, ref.Category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "stat file")
+	}
+
+	ref.CreatedAt = time.Now().UTC()
+	err = s.txRunner.ReferenceTx(ctx, func(ctx context.Context, tx ReferenceTx) error {
+		err := tx.InsertReference(ctx, ref)
+		if err != nil {
+			return errors.WithMessage(err, "insert reference")
+		}
+		err = tx.DeleteOrphan(ctx, ref.Filename, ref.Category)
+		if err != nil {
+			return errors.WithMessage(err, "delete orphan")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "reference tx")
+	}
+	return &ref, nil
+}
+
+// Detach удаляет ссылку, после удаления последней ссылки файл становится кандидатом на удаление
+func (s References) Detach(ctx context.Context, ref entity.FileReference) error {
+	err := s.txRunner.ReferenceTx(ctx, func(ctx context.Context, tx ReferenceTx) error {
+		err := tx.DeleteReference(ctx, ref)
+		if err != nil {
+			return errors.WithMessage(err, "delete reference")
+		}
+		count, err := tx.CountReferences(ctx, ref.Filename, ref.Category)
+		if err != nil {
+			return errors.WithMessage(err, "count references")
+		}
+		if count > 0 {
+			return nil
+		}
+		err = tx.UpsertOrphan(ctx, ref.Filename, ref.Category, time.Now().UTC())
+		if err != nil {
+			return errors.WithMessage(err, "upsert orphan")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "reference tx")
+	}
+	return nil
+}
+
+func (s References) FileReferences(ctx context.Context, filename string, category string) ([]entity.FileReference, error) {
+	refs, err := s.referenceRepo.GetFileReferences(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get file references")
+	}
+	return refs, nil
+}
+
+// OwnerReferences ссылки сущности на файлы, ссылки на файлы категорий, которые accessor не может читать, не возвращаются
+func (s References) OwnerReferences(
+	ctx context.Context,
+	ownerType string,
+	ownerId string,
+	accessor entity.Accessor,
+) ([]entity.FileReference, error) {
+	refs, err := s.referenceRepo.GetOwnerReferences(ctx, ownerType, ownerId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get owner references")
+	}
+	return slices.DeleteFunc(refs, func(ref entity.FileReference) bool {
+		return !accessor.CanAccessCategory(entity.ApiKeyOperationRead, ref.Category)
+	}), nil
+}
+
+// DeleteUnreferencedFiles перемещает в корзину файлы, у которых не осталось ссылок дольше GracePeriod.
+// Отметки захватываются на claimTimeout, файлы перемещаются вне транзакции, отметка удаляется только после перемещения:
+// заблокированный файл и файл, который не удалось переместить, обрабатываются повторно после истечения захвата
+func (s References) DeleteUnreferencedFiles(ctx context.Context) error {
+	now := time.Now().UTC()
+	orphans, err := s.referenceRepo.ClaimCollectableOrphans(
+		ctx,
+		now.Add(-s.cfg.GracePeriod),
+		now.Add(-claimTimeout),
+		now,
+		s.cfg.MaxDeletedFiles,
+	)
+	if err != nil {
+		return errors.WithMessage(err, "claim collectable orphans")
+	}
+
+	failed := 0
+	var firstErr error
+	for _, orphan := range orphans {
+		collected, err := s.collect(ctx, orphan)
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = errors.WithMessagef(err, "move file with name '%s' and category '%s' to trash", orphan.Filename, orphan.Category)
+			}
+			continue
+		}
+		if !collected {
+			continue
+		}
+		err = s.referenceRepo.DeleteClaimedOrphan(ctx, orphan)
+		if err != nil {
+			return errors.WithMessagef(err, "delete orphan of '%s'", orphan.Filename)
+		}
+	}
+	if firstErr != nil {
+		return errors.WithMessagef(firstErr, "%d files are not moved to trash", failed)
+	}
+	return nil
+}
+
+// collect возвращает true, если отметка больше не нужна: файл перемещён в корзину, удалён или перезаписан
+func (s References) collect(ctx context.Context, orphan entity.FileOrphan) (bool, error) {
+	// блокировка имеет приоритет над удалением по ссылкам, файл удаляется после снятия блокировки
+	locked, err := s.locks.IsLocked(ctx, orphan.Filename, orphan.Category)
+	if err != nil {
+		return false, errors.WithMessage(err, "is file locked")
+	}
+	if locked {
+		return false, nil
+	}
+
+	metadata, err := s.repo.StatFile(ctx, orphan.Filename, orphan.Category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return true, nil
+	case err != nil:
+		return false, errors.WithMessage(err, "stat file")
+	case metadata.CreatedAt.After(orphan.OrphanedAt):
+		// файл перезаписан после удаления последней ссылки
+		return true, nil
+	}
+
+	// событие deleted записывает корзина
+	err = s.trash.MoveToTrash(ctx, orphan.Filename, orphan.Category, "")
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package reference_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/reference"
+
+	"github.com/pkg/errors"
+)
+
+// repo отметки файлов без ссылок по имени файла
+type repo struct {
+	orphans   map[string]entity.FileOrphan
+	refs      map[string]int
+	ownerRefs []entity.FileReference
+}
+
+func newRepo() *repo {
+	return &repo{orphans: map[string]entity.FileOrphan{}, refs: map[string]int{}}
+}
+
+func (r *repo) ReferenceTx(ctx context.Context, tx func(ctx context.Context, tx reference.ReferenceTx) error) error {
+	orphans, refs := maps.Clone(r.orphans), maps.Clone(r.refs)
+	err := tx(ctx, r)
+	if err != nil {
+		r.orphans, r.refs = orphans, refs
+	}
+	return err
+}
+
+func (r *repo) InsertReference(_ context.Context, ref entity.FileReference) error {
+	r.refs[ref.Filename]++
+	return nil
+}
+
+func (r *repo) DeleteReference(_ context.Context, ref entity.FileReference) error {
+	r.refs[ref.Filename]--
+	return nil
+}
+
+func (r *repo) CountReferences(_ context.Context, filename string, _ string) (int, error) {
+	return r.refs[filename], nil
+}
+
+func (r *repo) UpsertOrphan(_ context.Context, filename string, category string, now time.Time) error {
+	r.orphans[filename] = entity.FileOrphan{Filename: filename, Category: category, OrphanedAt: now}
+	return nil
+}
+
+func (r *repo) DeleteOrphan(_ context.Context, filename string, _ string) error {
+	delete(r.orphans, filename)
+	return nil
+}
+
+func (r *repo) GetFileReferences(context.Context, string, string) ([]entity.FileReference, error) {
+	return nil, nil
+}
+
+func (r *repo) GetOwnerReferences(context.Context, string, string) ([]entity.FileReference, error) {
+	return slices.Clone(r.ownerRefs), nil
+}
+
+func (r *repo) ClaimCollectableOrphans(
+	_ context.Context,
+	before time.Time,
+	claimedBefore time.Time,
+	now time.Time,
+	_ int,
+) ([]entity.FileOrphan, error) {
+	claimed := make([]entity.FileOrphan, 0)
+	for filename, orphan := range r.orphans {
+		expired := orphan.ClaimedAt == nil || !orphan.ClaimedAt.After(claimedBefore)
+		if orphan.OrphanedAt.After(before) || !expired || r.refs[filename] > 0 {
+			continue
+		}
+		orphan.ClaimedAt = &now
+		r.orphans[filename] = orphan
+		claimed = append(claimed, orphan)
+	}
+	return claimed, nil
+}
+
+func (r *repo) DeleteClaimedOrphan(_ context.Context, orphan entity.FileOrphan) error {
+	current, ok := r.orphans[orphan.Filename]
+	if ok && current.ClaimedAt != nil && current.ClaimedAt.Equal(*orphan.ClaimedAt) {
+		delete(r.orphans, orphan.Filename)
+	}
+	return nil
+}
+
+// storage объекты бакета: имя - время записи
+type storage map[string]time.Time
+
+func (s storage) StatFile(_ context.Context, filename string, _ string) (*entity.Metadata, error) {
+	createdAt, ok := s[filename]
+	if !ok {
+		return nil, domain.ErrFileNotFound
+	}
+	return &entity.Metadata{Filename: filename, CreatedAt: createdAt}, nil
+}
+
+type trash struct {
+	storage storage
+	trashed []string
+	errs    map[string]error
+}
+
+func (t *trash) MoveToTrash(_ context.Context, filename string, _ string, _ string) error {
+	if t.errs[filename] != nil {
+		return t.errs[filename]
+	}
+	delete(t.storage, filename)
+	t.trashed = append(t.trashed, filename)
+	return nil
+}
+
+type locks map[string]bool
+
+func (l locks) IsLocked(_ context.Context, filename string, _ string) (bool, error) {
+	return l[filename], nil
+}
+
+func TestDeleteUnreferencedFiles(t *testing.T) {
+	t.Parallel()
+
+	orphanedAt := time.Now().UTC().Add(-2 * time.Hour)
+	repo := newRepo()
+	storage := storage{
+		"a.txt":         orphanedAt.Add(-time.Hour),
+		"locked.txt":    orphanedAt.Add(-time.Hour),
+		"failed.txt":    orphanedAt.Add(-time.Hour),
+		"rewritten.txt": orphanedAt.Add(time.Minute),
+	}
+	for _, filename := range []string{"a.txt", "locked.txt", "failed.txt", "rewritten.txt", "missing.txt"} {
+		repo.orphans[filename] = entity.FileOrphan{Filename: filename, Category: "docs", OrphanedAt: orphanedAt}
+	}
+	moveErr := errors.New("minio is unavailable")
+	trash := &trash{storage: storage, errs: map[string]error{"failed.txt": moveErr}}
+	service := reference.NewReferences(repo, storage, repo, trash, locks{"locked.txt": true}, reference.Config{
+		GracePeriod:     time.Hour,
+		MaxDeletedFiles: 10,
+	})
+
+	err := service.DeleteUnreferencedFiles(t.Context())
+	if !errors.Is(err, moveErr) {
+		t.Fatalf("expected move error, got %v", err)
+	}
+	if !slices.Equal(trash.trashed, []string{"a.txt"}) {
+		t.Fatalf("expected only a.txt in trash, got %v", trash.trashed)
+	}
+	remaining := slices.Sorted(maps.Keys(repo.orphans))
+	if !slices.Equal(remaining, []string{"failed.txt", "locked.txt"}) {
+		t.Fatalf("orphans of locked and not moved files must be kept, got %v", remaining)
+	}
+
+	// захваченные отметки не обрабатываются повторно до истечения захвата
+	delete(trash.errs, "failed.txt")
+	err = service.DeleteUnreferencedFiles(t.Context())
+	if err != nil || len(trash.trashed) != 1 {
+		t.Fatalf("claimed orphans must be skipped, got %v and %v", err, trash.trashed)
+	}
+
+	claimedAt := time.Now().UTC().Add(-2 * time.Hour)
+	for filename, orphan := range repo.orphans {
+		orphan.ClaimedAt = &claimedAt
+		repo.orphans[filename] = orphan
+	}
+	err = service.DeleteUnreferencedFiles(t.Context())
+	if err != nil {
+		t.Fatalf("delete unreferenced files: %v", err)
+	}
+	if !slices.Equal(trash.trashed, []string{"a.txt", "failed.txt"}) {
+		t.Fatalf("expected failed.txt to be moved on retry, got %v", trash.trashed)
+	}
+}
+
+func TestAttachedFileIsKept(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	storage := storage{"a.txt": time.Now().UTC().Add(-3 * time.Hour)}
+	trash := &trash{storage: storage}
+	service := reference.NewReferences(repo, storage, repo, trash, locks{}, reference.Config{MaxDeletedFiles: 10})
+	ref := entity.FileReference{Filename: "a.txt", Category: "docs", OwnerType: "post", OwnerId: "1"}
+
+	_, err := service.Attach(t.Context(), ref)
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	err = service.Detach(t.Context(), ref)
+	if err != nil {
+		t.Fatalf("detach: %v", err)
+	}
+	_, err = service.Attach(t.Context(), ref)
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+
+	err = service.DeleteUnreferencedFiles(t.Context())
+	if err != nil {
+		t.Fatalf("delete unreferenced files: %v", err)
+	}
+	if len(trash.trashed) != 0 || len(repo.orphans) != 0 {
+		t.Fatalf("referenced file must be kept, got %v and %v", trash.trashed, repo.orphans)
+	}
+}
+
+func TestOwnerReferencesOfReadableCategories(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	repo.ownerRefs = []entity.FileReference{
+		{Filename: "a.txt", Category: "docs", OwnerType: "order", OwnerId: "1"},
+		{Filename: "b.png", Category: "images", OwnerType: "order", OwnerId: "1"},
+	}
+	storage := storage{}
+	service := reference.NewReferences(repo, storage, repo, &trash{storage: storage}, locks{}, reference.Config{MaxDeletedFiles: 10})
+
+	accessor := entity.Accessor{Subject: "api-key:crm", Permissions: []string{"files:read:docs"}}
+	refs, err := service.OwnerReferences(t.Context(), "order", "1", accessor)
+	if err != nil {
+		t.Fatalf("owner references: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Filename != "a.txt" {
+		t.Fatalf("expected only references to readable categories, got %v", refs)
+	}
+
+	refs, err = service.OwnerReferences(t.Context(), "order", "1", entity.Accessor{Unrestricted: true})
+	if err != nil || len(refs) != 2 {
+		t.Fatalf("expected all references, got %v and %v", refs, err)
+	}
+}
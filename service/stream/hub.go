@@ -0,0 +1,208 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/Falokut/go-kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Channel канал уведомлений postgres, в который триггер на storage_events пишет идентификатор события
+	Channel = "storage_events"
+
+	reconnectDelay = time.Second
+)
+
+type Listener interface {
+	Listen(ctx context.Context, channel string, ready func(), handle func(payload string)) error
+}
+
+type EventRepo interface {
+	GetEventCursor(ctx context.Context, afterId int64) (*entity.EventCursor, error)
+	GetLastEventCursor(ctx context.Context) (*entity.EventCursor, error)
+	GetEventsAfter(ctx context.Context, cursor entity.EventCursor, limit int) ([]entity.StorageEvent, error)
+}
+
+// Subscription подписка на уведомления о новых событиях, сами события подписчик читает через EventsAfter,
+// поэтому медленный подписчик не теряет события, а пропущенные уведомления объединяются в одно
+type Subscription struct {
+	Wake <-chan struct{}
+	wake chan struct{}
+}
+
+// Hub слушает уведомления postgres и будит подписчиков этого экземпляра сервиса
+type Hub struct {
+	listener Listener
+	repo     EventRepo
+	logger   log.Logger
+
+	mu            *sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	listening     bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewHub(listener Listener, repo EventRepo, logger log.Logger) *Hub {
+	return &Hub{
+		listener:      listener,
+		repo:          repo,
+		logger:        logger,
+		mu:            &sync.Mutex{},
+		subscriptions: make(map[*Subscription]struct{}),
+		cancel:        func() {},
+	}
+}
+
+// Run запускает прослушивание в фоне до вызова Close
+func (h *Hub) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan struct{})
+	go func() {
+		defer close(h.done)
+		h.run(ctx)
+	}()
+}
+
+// Close останавливает прослушивание и закрывает подписки, без Run только закрывает подписки
+func (h *Hub) Close() error {
+	h.cancel()
+	if h.done != nil {
+		<-h.done
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = false
+	for subscription := range h.subscriptions {
+		h.remove(subscription)
+	}
+	return nil
+}
+
+func (h *Hub) run(ctx context.Context) {
+	for {
+		err := h.listener.Listen(ctx, Channel, h.ready, func(string) {
+			h.wakeAll()
+		})
+		h.stopListening()
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Error(ctx, "event stream: listen notifications", log.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// ready после переподключения подписчики будятся, чтобы прочитать события, уведомления о которых потеряны
+func (h *Hub) ready() {
+	h.mu.Lock()
+	h.listening = true
+	h.mu.Unlock()
+	h.wakeAll()
+}
+
+// stopListening новые подписки не принимаются до переподключения, текущие продолжают читать события по таймеру
+func (h *Hub) stopListening() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = false
+}
+
+func (h *Hub) wakeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscriptions {
+		select {
+		case subscription.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *Hub) Subscribe() (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.listening {
+		return nil, domain.ErrEventStreamUnavailable
+	}
+
+	wake := make(chan struct{}, 1)
+	subscription := &Subscription{
+		Wake: wake,
+		wake: wake,
+	}
+	h.subscriptions[subscription] = struct{}{}
+	return subscription, nil
+}
+
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(subscription)
+}
+
+func (h *Hub) remove(subscription *Subscription) {
+	_, ok := h.subscriptions[subscription]
+	if !ok {
+		return
+	}
+	delete(h.subscriptions, subscription)
+	close(subscription.wake)
+}
+
+// Cursor позиция, с которой начинается поток: после события lastEventId или после последнего события, если lastEventId = 0
+func (h *Hub) Cursor(ctx context.Context, lastEventId int64) (entity.EventCursor, error) {
+	if lastEventId > 0 {
+		cursor, err := h.repo.GetEventCursor(ctx, lastEventId)
+		if err == nil {
+			return *cursor, nil
+		}
+		if !errors.Is(err, domain.ErrStorageEventNotFound) {
+			return entity.EventCursor{}, errors.WithMessage(err, "get event cursor")
+		}
+	}
+
+	// событие и все более новые удалены по сроку хранения, пропускать нечего
+	cursor, err := h.repo.GetLastEventCursor(ctx)
+	if err != nil {
+		return entity.EventCursor{}, errors.WithMessage(err, "get last event cursor")
+	}
+	return *cursor, nil
+}
+
+// EventsAfter читает не более limit событий после cursor и возвращает подходящие под фильтр
+// и позицию после прочитанных. more - прочитано limit событий, и за ними могут быть ещё
+func (h *Hub) EventsAfter(
+	ctx context.Context,
+	cursor entity.EventCursor,
+	filter entity.EventFilter,
+	limit int,
+) ([]entity.StorageEvent, entity.EventCursor, bool, error) {
+	events, err := h.repo.GetEventsAfter(ctx, cursor, limit)
+	if err != nil {
+		return nil, cursor, false, errors.WithMessage(err, "get events after")
+	}
+
+	matched := make([]entity.StorageEvent, 0, len(events))
+	for _, event := range events {
+		cursor = entity.NewEventCursor(event)
+		if filter.Match(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched, cursor, len(events) == limit, nil
+}
@@ -0,0 +1,216 @@
+package stream_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/stream"
+
+	"github.com/Falokut/go-kit/log"
+)
+
+// listener уведомления отправляются тестом через notify после подключения
+type listener struct {
+	mu     *sync.Mutex
+	handle func(payload string)
+}
+
+func newListener() *listener {
+	return &listener{mu: &sync.Mutex{}}
+}
+
+func (l *listener) Listen(ctx context.Context, _ string, ready func(), handle func(payload string)) error {
+	l.mu.Lock()
+	l.handle = handle
+	l.mu.Unlock()
+	ready()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (l *listener) notify(payload string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handle(payload)
+}
+
+// repo события в порядке фиксации транзакций
+type repo struct {
+	events []entity.StorageEvent
+}
+
+func (r repo) GetEventCursor(_ context.Context, afterId int64) (*entity.EventCursor, error) {
+	for _, event := range r.events {
+		if event.Id == afterId {
+			cursor := entity.NewEventCursor(event)
+			return &cursor, nil
+		}
+	}
+	return nil, domain.ErrStorageEventNotFound
+}
+
+func (r repo) GetLastEventCursor(context.Context) (*entity.EventCursor, error) {
+	cursor := entity.EventCursor{}
+	if len(r.events) > 0 {
+		cursor = entity.NewEventCursor(r.events[len(r.events)-1])
+	}
+	return &cursor, nil
+}
+
+func (r repo) GetEventsAfter(_ context.Context, cursor entity.EventCursor, limit int) ([]entity.StorageEvent, error) {
+	events := make([]entity.StorageEvent, 0)
+	for _, event := range r.events {
+		after := event.TxId > cursor.TxId || event.TxId == cursor.TxId && event.Id > cursor.Id
+		if after && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func event(id int64, txId int64, eventType string) entity.StorageEvent {
+	event := entity.NewStorageEvent(eventType, "a.txt", "docs", "")
+	event.Id = id
+	event.TxId = txId
+	return event
+}
+
+func newHub(listener stream.Listener, repo repo) *stream.Hub {
+	var logger log.Logger
+	return stream.NewHub(listener, repo, logger)
+}
+
+func closeHub(t *testing.T, hub *stream.Hub) {
+	t.Helper()
+	closed := make(chan struct{})
+	go func() {
+		_ = hub.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close is blocked")
+	}
+}
+
+func subscribe(t *testing.T, hub *stream.Hub) *stream.Subscription {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		subscription, err := hub.Subscribe()
+		if err == nil {
+			return subscription
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribe: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseWithoutRun(t *testing.T) {
+	t.Parallel()
+
+	hub := newHub(newListener(), repo{})
+	closeHub(t, hub)
+
+	_, err := hub.Subscribe()
+	if err == nil {
+		t.Fatal("subscribe must fail before listening")
+	}
+}
+
+func TestNotificationWakesSubscribers(t *testing.T) {
+	t.Parallel()
+
+	listener := newListener()
+	hub := newHub(listener, repo{})
+	hub.Run()
+	subscription := subscribe(t, hub)
+
+	// уведомления, которые подписчик не успел прочитать, объединяются и не закрывают подписку
+	for range 100 {
+		listener.notify("1")
+	}
+	select {
+	case _, ok := <-subscription.Wake:
+		if !ok {
+			t.Fatal("slow subscriber must not be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscriber is not woken")
+	}
+
+	closeHub(t, hub)
+	_, ok := <-subscription.Wake
+	if ok {
+		t.Fatal("subscription must be closed with the hub")
+	}
+}
+
+func TestEventsAfter(t *testing.T) {
+	t.Parallel()
+
+	// событие 2 зафиксировано после события 3
+	hub := newHub(newListener(), repo{events: []entity.StorageEvent{
+		event(1, 10, entity.EventUploaded),
+		event(3, 11, entity.EventDeleted),
+		event(2, 12, entity.EventUploaded),
+		event(4, 13, entity.EventUploaded),
+	}})
+	filter := entity.EventFilter{EventTypes: []string{entity.EventUploaded}}
+
+	cursor, err := hub.Cursor(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+	events, cursor, more, err := hub.EventsAfter(t.Context(), cursor, filter, 2)
+	if err != nil {
+		t.Fatalf("events after: %v", err)
+	}
+	if len(events) != 1 || events[0].Id != 2 || !more {
+		t.Fatalf("expected event 2 and more events, got %v and %v", events, more)
+	}
+	if cursor != (entity.EventCursor{TxId: 12, Id: 2}) {
+		t.Fatalf("cursor must pass filtered events, got %+v", cursor)
+	}
+
+	// возобновление после события 3 не пропускает событие 2, зафиксированное позже
+	cursor, err = hub.Cursor(t.Context(), 3)
+	if err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+	events, _, more, err = hub.EventsAfter(t.Context(), cursor, entity.EventFilter{}, 10)
+	if err != nil {
+		t.Fatalf("events after: %v", err)
+	}
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	if !slices.Equal(ids, []int64{2, 4}) || more {
+		t.Fatalf("expected events 2 and 4, got %v and %v", ids, more)
+	}
+}
+
+func TestCursorStartsAfterLastEvent(t *testing.T) {
+	t.Parallel()
+
+	hub := newHub(newListener(), repo{events: []entity.StorageEvent{event(1, 10, entity.EventUploaded)}})
+	for _, lastEventId := range []int64{0, 100} {
+		cursor, err := hub.Cursor(t.Context(), lastEventId)
+		if err != nil {
+			t.Fatalf("cursor: %v", err)
+		}
+		events, _, _, err := hub.EventsAfter(t.Context(), cursor, entity.EventFilter{}, 10)
+		if err != nil || len(events) != 0 {
+			t.Fatalf("lastEventId %d: history must not be replayed, got %v and %v", lastEventId, events, err)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package transform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jpegContentType = "image/jpeg"
+	pngContentType  = "image/png"
+
+	jpegQuality = 95
+
+	orientationTag    = 0x0112
+	orientationNormal = 1
+
+	// maxHeaderSize сегменты JPEG и чанки PNG до пиксельных данных хранятся в памяти,
+	// пока не известна ориентация, изображение с метаданными большего размера отклоняется
+	maxHeaderSize = 16 << 20
+	// maxExifSize из чанка eXIf читается не больше этого размера, ориентация ищется только в прочитанной части
+	maxExifSize = 1 << 20
+	// maxPngKeywordSize ключевое слово текстового чанка PNG не длиннее 79 байт и завершается NUL
+	maxPngKeywordSize = 80
+)
+
+// ErrInvalidImage изображение не удалось разобрать, подробности разбора содержатся только в тексте ошибки
+var ErrInvalidImage = errors.New("invalid image")
+
+var (
+	exifHeader    = []byte("Exif\x00\x00")
+	iccHeader     = []byte("ICC_PROFILE\x00")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	pngXmpKeyword = map[string]bool{
+		"XML:com.adobe.xmp":     true,
+		"Raw profile type exif": true,
+		"Raw profile type APP1": true,
+		"Raw profile type xmp":  true,
+	}
+)
+
+// ImageMetadata удаляет EXIF/XMP метаданные из JPEG и PNG
+// и применяет EXIF ориентацию к пикселям изображения
+type ImageMetadata struct {
+}
+
+func NewImageMetadata() ImageMetadata {
+	return ImageMetadata{}
+}
+
+func (t ImageMetadata) Supports(contentType string) bool {
+	return contentType == jpegContentType || contentType == pngContentType
+}
+
+// Transform возвращает поток изображения без метаданных. Метаданные разбираются при первом чтении,
+// пиксельные данные копируются без изменений и без чтения всего файла в память,
+// изображение декодируется целиком, только если нужно применить ориентацию.
+// Ошибка разбора изображения содержит ErrInvalidImage, ошибка чтения reader возвращается без изменений
+func (t ImageMetadata) Transform(contentType string, reader io.Reader) io.Reader {
+	return &imageReader{
+		contentType: contentType,
+		src:         &source{reader: reader},
+	}
+}
+
+type imageReader struct {
+	contentType string
+	src         *source
+	out         io.Reader
+	err         error
+}
+
+func (r *imageReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.out == nil {
+		r.out, r.err = r.start()
+		if r.err != nil {
+			return 0, r.err
+		}
+	}
+	return r.out.Read(p)
+}
+
+func (r *imageReader) start() (io.Reader, error) {
+	switch r.contentType {
+	case jpegContentType:
+		stripper := &jpegStripper{src: r.src, reader: bufio.NewReader(r.src), orientation: orientationNormal}
+		err := stripper.readHeader()
+		if err != nil {
+			return nil, err
+		}
+		if stripper.orientation == orientationNormal {
+			return stripper.stream(), nil
+		}
+		return reorientJpeg(r.src, stripper.stream(), stripper.orientation, stripper.icc)
+	case pngContentType:
+		stripper := &pngStripper{src: r.src, reader: bufio.NewReader(r.src), orientation: orientationNormal}
+		err := stripper.readHeader()
+		if err != nil {
+			return nil, err
+		}
+		if stripper.orientation == orientationNormal {
+			return stripper, nil
+		}
+		return reorientPng(r.src, stripper, stripper.orientation)
+	default:
+		return r.src, nil
+	}
+}
+
+// source запоминает ошибку чтения исходного потока, чтобы отличить её от ошибки разбора изображения
+type source struct {
+	reader io.Reader
+	err    error
+}
+
+func (s *source) Read(p []byte) (int, error) {
+	n, err := s.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.err = err
+	}
+	return n, err
+}
+
+// invalid возвращает ошибку чтения исходного потока, если она была, иначе ошибку разбора изображения
+func (s *source) invalid(err error, message string) error {
+	switch {
+	case s.err != nil:
+		return s.err
+	case errors.Is(err, ErrInvalidImage):
+		return err
+	case err != nil:
+		return errors.WithMessagef(ErrInvalidImage, "%s: %v", message, err)
+	default:
+		return errors.WithMessage(ErrInvalidImage, message)
+	}
+}
+
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerTEM  = 0x01
+	markerRST0 = 0xD0
+	markerRST7 = 0xD7
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+)
+
+// jpegStripper разбирает сегменты JPEG до начала скана, сегменты APP1 (EXIF и XMP) отбрасываются,
+// скан и всё, что после него, копируется без изменений
+type jpegStripper struct {
+	src         *source
+	reader      *bufio.Reader
+	header      bytes.Buffer
+	icc         [][]byte
+	orientation int
+}
+
+func (s *jpegStripper) readHeader() error {
+	soi := make([]byte, 2)
+	_, err := io.ReadFull(s.reader, soi)
+	if err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return s.src.invalid(err, "invalid jpeg signature")
+	}
+	s.header.Write(soi)
+
+	for {
+		marker, err := s.readMarker()
+		if err != nil {
+			return err
+		}
+		switch {
+		case marker == markerEOI:
+			return s.src.invalid(nil, "jpeg has no scan")
+		case marker == markerTEM || (marker >= markerRST0 && marker <= markerRST7):
+			s.header.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		length := make([]byte, 2)
+		_, err = io.ReadFull(s.reader, length)
+		if err != nil {
+			return s.src.invalid(err, "truncated jpeg segment length")
+		}
+		size := int(binary.BigEndian.Uint16(length))
+		if size < 2 {
+			return s.src.invalid(nil, "invalid jpeg segment length")
+		}
+		if marker == markerSOS {
+			s.header.Write([]byte{0xFF, marker})
+			s.header.Write(length)
+			return nil
+		}
+
+		payload := make([]byte, size-2)
+		_, err = io.ReadFull(s.reader, payload)
+		if err != nil {
+			return s.src.invalid(err, "truncated jpeg segment")
+		}
+		if marker == markerAPP1 {
+			if bytes.HasPrefix(payload, exifHeader) {
+				s.orientation = exifOrientation(payload[len(exifHeader):])
+			}
+			continue
+		}
+
+		raw := append([]byte{0xFF, marker}, length...)
+		raw = append(raw, payload...)
+		if s.header.Len()+len(raw) > maxHeaderSize {
+			return s.src.invalid(nil, "jpeg metadata is too large")
+		}
+		if marker == markerAPP2 && bytes.HasPrefix(payload, iccHeader) {
+			s.icc = append(s.icc, raw)
+		}
+		s.header.Write(raw)
+	}
+}
+
+func (s *jpegStripper) readMarker() (byte, error) {
+	b, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, s.src.invalid(err, "truncated jpeg marker")
+	}
+	if b != 0xFF {
+		return 0, s.src.invalid(nil, "expected jpeg marker")
+	}
+	// перед маркером может быть любое количество байт 0xFF
+	for b == 0xFF {
+		b, err = s.reader.ReadByte()
+		if err != nil {
+			return 0, s.src.invalid(err, "truncated jpeg marker")
+		}
+	}
+	if b == 0 {
+		return 0, s.src.invalid(nil, "invalid jpeg marker")
+	}
+	return b, nil
+}
+
+// stream сегменты без метаданных, затем скан без изменений
+func (s *jpegStripper) stream() io.Reader {
+	return io.MultiReader(&s.header, s.reader)
+}
+
+// pngStripper отбрасывает чанк eXIf и текстовые чанки с XMP и EXIF, остальные чанки копируются без изменений.
+// Чанки до пиксельных данных хранятся в памяти, пока не известна ориентация, последующие копируются по мере чтения
+type pngStripper struct {
+	src         *source
+	reader      *bufio.Reader
+	pending     bytes.Buffer
+	remaining   int64
+	imageData   bool
+	ended       bool
+	orientation int
+}
+
+func (s *pngStripper) readHeader() error {
+	signature := make([]byte, len(pngSignature))
+	_, err := io.ReadFull(s.reader, signature)
+	if err != nil || !bytes.Equal(signature, pngSignature) {
+		return s.src.invalid(err, "invalid png signature")
+	}
+	s.pending.Write(signature)
+
+	for !s.imageData && !s.ended {
+		err = s.nextChunk()
+		if err != nil {
+			return err
+		}
+		if s.imageData {
+			break
+		}
+		if int64(s.pending.Len())+s.remaining > maxHeaderSize {
+			return s.src.invalid(nil, "png metadata is too large")
+		}
+		_, err = io.CopyN(&s.pending, s.reader, s.remaining)
+		if err != nil {
+			return s.src.invalid(err, "truncated png chunk")
+		}
+		s.remaining = 0
+	}
+	return nil
+}
+
+func (s *pngStripper) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if s.pending.Len() > 0 {
+			return s.pending.Read(p)
+		}
+		if s.remaining > 0 {
+			n, err := s.reader.Read(p[:min(int64(len(p)), s.remaining)])
+			s.remaining -= int64(n)
+			switch {
+			case errors.Is(err, io.EOF) && s.remaining > 0:
+				return n, s.src.invalid(nil, "truncated png chunk")
+			case err != nil && !errors.Is(err, io.EOF):
+				return n, s.src.invalid(err, "read png chunk")
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if s.ended {
+			return 0, io.EOF
+		}
+		err := s.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// nextChunk читает заголовок следующего чанка, чанки с метаданными пропускаются,
+// заголовок оставленного чанка записывается в pending, а его данные и CRC остаются в reader
+func (s *pngStripper) nextChunk() error {
+	for {
+		header := make([]byte, 8)
+		_, err := io.ReadFull(s.reader, header)
+		if err != nil {
+			return s.src.invalid(err, "truncated png chunk header")
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		if length > 1<<31-1 {
+			return s.src.invalid(nil, "invalid png chunk length")
+		}
+		chunkType := string(header[4:8])
+
+		switch chunkType {
+		case "eXIf":
+			payload := make([]byte, min(length, maxExifSize))
+			_, err = io.ReadFull(s.reader, payload)
+			if err != nil {
+				return s.src.invalid(err, "truncated png chunk 'eXIf'")
+			}
+			// ориентация после пиксельных данных не применяется, такой eXIf только удаляется
+			if !s.imageData {
+				s.orientation = exifOrientation(payload)
+			}
+			err = s.discard(length - int64(len(payload)) + 4)
+			if err != nil {
+				return err
+			}
+			continue
+		case "iTXt", "tEXt", "zTXt":
+			prefix := make([]byte, min(length, maxPngKeywordSize))
+			_, err = io.ReadFull(s.reader, prefix)
+			if err != nil {
+				return s.src.invalid(err, "truncated png text chunk")
+			}
+			keyword, _, _ := bytes.Cut(prefix, []byte{0})
+			if pngXmpKeyword[string(keyword)] {
+				err = s.discard(length - int64(len(prefix)) + 4)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			s.pending.Write(header)
+			s.pending.Write(prefix)
+			s.remaining = length - int64(len(prefix)) + 4
+			return nil
+		case "IDAT":
+			s.imageData = true
+		case "IEND":
+			s.ended = true
+		}
+		s.pending.Write(header)
+		s.remaining = length + 4
+		return nil
+	}
+}
+
+func (s *pngStripper) discard(n int64) error {
+	_, err := io.CopyN(io.Discard, s.reader, n)
+	if err != nil {
+		return s.src.invalid(err, "truncated png chunk")
+	}
+	return nil
+}
+
+// reorientJpeg декодирует изображение без метаданных, применяет ориентацию и кодирует заново
+func reorientJpeg(src *source, stripped io.Reader, orientation int, icc [][]byte) (io.Reader, error) {
+	img, err := jpeg.Decode(stripped)
+	if err != nil {
+		return nil, src.invalid(err, "decode jpeg")
+	}
+	encoded := bytes.NewBuffer(nil)
+	err = jpeg.Encode(encoded, orient(img, orientation), &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, errors.WithMessage(err, "encode jpeg")
+	}
+
+	// стандартный энкодер не пишет цветовой профиль, возвращаем его сразу после SOI
+	result := encoded.Bytes()
+	readers := []io.Reader{bytes.NewReader(result[:2])}
+	for _, segment := range icc {
+		readers = append(readers, bytes.NewReader(segment))
+	}
+	readers = append(readers, bytes.NewReader(result[2:]))
+	return io.MultiReader(readers...), nil
+}
+
+func reorientPng(src *source, stripped io.Reader, orientation int) (io.Reader, error) {
+	img, err := png.Decode(stripped)
+	if err != nil {
+		return nil, src.invalid(err, "decode png")
+	}
+	encoded := bytes.NewBuffer(nil)
+	err = png.Encode(encoded, orient(img, orientation))
+	if err != nil {
+		return nil, errors.WithMessage(err, "encode png")
+	}
+	return encoded, nil
+}
+
+// exifOrientation возвращает значение тега Orientation из TIFF структуры EXIF,
+// при любой ошибке разбора считается, что поворот не требуется
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return orientationNormal
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return orientationNormal
+	}
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := range entries {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return orientationNormal
+		}
+		if order.Uint16(tiff[entry:]) != orientationTag {
+			continue
+		}
+		value := int(order.Uint16(tiff[entry+8:]))
+		if value < 1 || value > 8 {
+			return orientationNormal
+		}
+		return value
+	}
+	return orientationNormal
+}
+
+// orient поворачивает и отражает изображение согласно EXIF ориентации
+func orient(src image.Image, orientation int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, color.NRGBAModel.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)))
+		}
+	}
+	return dst
+}
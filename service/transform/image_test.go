@@ -0,0 +1,273 @@
+package transform_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"storage-service/service/transform"
+
+	"github.com/pkg/errors"
+)
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func transformAll(contentType string, data []byte) ([]byte, error) {
+	reader := transform.NewImageMetadata().Transform(contentType, iotest.OneByteReader(bytes.NewReader(data)))
+	return io.ReadAll(reader)
+}
+
+// isRed цвет пикселя ближе к красному, чем к синему
+func isRed(img image.Image, x int, y int) bool {
+	r, _, b, _ := img.At(x, y).RGBA()
+	return r > b
+}
+
+func TestTransform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		fixture     string
+		contentType string
+		decode      func(io.Reader) (image.Image, error)
+		width       int
+		height      int
+		// redAt точка, которая после применения ориентации должна остаться красной, blueAt - синей
+		redAt    image.Point
+		blueAt   image.Point
+		contains []string
+	}{
+		{
+			name:        "jpeg rotated by orientation 6",
+			fixture:     "orientation6.jpg",
+			contentType: "image/jpeg",
+			decode:      jpeg.Decode,
+			width:       8,
+			height:      16,
+			redAt:       image.Pt(6, 3),
+			blueAt:      image.Pt(1, 3),
+			contains:    []string{"ICC_PROFILE"},
+		},
+		{
+			name:        "jpeg with normal orientation keeps other segments",
+			fixture:     "normal.jpg",
+			contentType: "image/jpeg",
+			decode:      jpeg.Decode,
+			width:       16,
+			height:      8,
+			redAt:       image.Pt(3, 2),
+			blueAt:      image.Pt(12, 2),
+		},
+		{
+			name:        "png rotated by orientation 3",
+			fixture:     "orientation3.png",
+			contentType: "image/png",
+			decode:      png.Decode,
+			width:       16,
+			height:      8,
+			redAt:       image.Pt(12, 6),
+			blueAt:      image.Pt(3, 2),
+		},
+		{
+			name:        "png with xmp after image data",
+			fixture:     "trailing_xmp.png",
+			contentType: "image/png",
+			decode:      png.Decode,
+			width:       16,
+			height:      8,
+			redAt:       image.Pt(3, 2),
+			blueAt:      image.Pt(12, 2),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, err := transformAll(test.contentType, fixture(t, test.fixture))
+			if err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+			for _, metadata := range []string{"Exif", "xmpmeta", "XML:com.adobe.xmp"} {
+				if bytes.Contains(result, []byte(metadata)) {
+					t.Fatalf("result still contains %q", metadata)
+				}
+			}
+			for _, kept := range test.contains {
+				if !bytes.Contains(result, []byte(kept)) {
+					t.Fatalf("result lost %q", kept)
+				}
+			}
+
+			img, err := test.decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+			bounds := img.Bounds()
+			if bounds.Dx() != test.width || bounds.Dy() != test.height {
+				t.Fatalf("expected %dx%d, got %dx%d", test.width, test.height, bounds.Dx(), bounds.Dy())
+			}
+			if !isRed(img, test.redAt.X, test.redAt.Y) || isRed(img, test.blueAt.X, test.blueAt.Y) {
+				t.Fatal("orientation is not applied")
+			}
+		})
+	}
+}
+
+func TestTransformKeepsJpegScanData(t *testing.T) {
+	t.Parallel()
+
+	data := fixture(t, "normal.jpg")
+	result, err := transformAll("image/jpeg", data)
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	scan := bytes.Index(data, []byte{0xFF, 0xDA})
+	if !bytes.HasSuffix(result, data[scan:]) {
+		t.Fatal("scan data is changed")
+	}
+}
+
+// withSegmentLength заменяет длину первого сегмента с маркером marker
+func withSegmentLength(t *testing.T, data []byte, marker byte, length uint16) []byte {
+	t.Helper()
+	index := bytes.Index(data, []byte{0xFF, marker})
+	if index < 0 {
+		t.Fatalf("segment %x not found", marker)
+	}
+	result := bytes.Clone(data)
+	binary.BigEndian.PutUint16(result[index+2:], length)
+	return result
+}
+
+func withChunkLength(t *testing.T, data []byte, chunkType string, length uint32) []byte {
+	t.Helper()
+	index := bytes.Index(data, []byte(chunkType))
+	if index < 4 {
+		t.Fatalf("chunk %s not found", chunkType)
+	}
+	result := bytes.Clone(data)
+	binary.BigEndian.PutUint32(result[index-4:], length)
+	return result
+}
+
+func TestTransformInvalid(t *testing.T) {
+	t.Parallel()
+
+	jpegRotated := fixture(t, "orientation6.jpg")
+	jpegNormal := fixture(t, "normal.jpg")
+	pngRotated := fixture(t, "orientation3.png")
+	pngNormal := fixture(t, "trailing_xmp.png")
+	jpegScan := bytes.Index(jpegNormal, []byte{0xFF, 0xDA})
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{name: "empty jpeg", contentType: "image/jpeg", data: nil},
+		{name: "jpeg signature", contentType: "image/jpeg", data: []byte("\xFF\xD9not a jpeg")},
+		{name: "jpeg without scan", contentType: "image/jpeg", data: []byte("\xFF\xD8\xFF\xD9")},
+		{name: "jpeg garbage instead of marker", contentType: "image/jpeg", data: []byte("\xFF\xD8garbage")},
+		{name: "jpeg truncated marker", contentType: "image/jpeg", data: []byte("\xFF\xD8\xFF\xFF")},
+		{name: "jpeg truncated in segment length", contentType: "image/jpeg", data: jpegNormal[:5]},
+		{name: "jpeg truncated in segment", contentType: "image/jpeg", data: jpegNormal[:jpegScan-10]},
+		{name: "jpeg truncated in scan of rotated image", contentType: "image/jpeg", data: jpegRotated[:len(jpegRotated)-40]},
+		{name: "jpeg segment shorter than its length", contentType: "image/jpeg", data: withSegmentLength(t, jpegNormal, 0xE1, 1)},
+		{name: "jpeg segment longer than file", contentType: "image/jpeg", data: withSegmentLength(t, jpegNormal, 0xE1, 0xFFFF)},
+		{name: "png signature", contentType: "image/png", data: []byte("\x89PNG\r\n\x1a")},
+		{name: "png truncated chunk header", contentType: "image/png", data: pngNormal[:12]},
+		{name: "png truncated chunk", contentType: "image/png", data: pngNormal[:20]},
+		{name: "png truncated image data", contentType: "image/png", data: pngNormal[:len(pngNormal)-30]},
+		{name: "png truncated rotated image", contentType: "image/png", data: pngRotated[:len(pngRotated)-20]},
+		{name: "png huge chunk length", contentType: "image/png", data: withChunkLength(t, pngNormal, "IHDR", 0xFFFFFFF0)},
+		{name: "png huge exif length", contentType: "image/png", data: withChunkLength(t, pngRotated, "eXIf", 0x7FFFFFFF)},
+		{name: "png huge text length", contentType: "image/png", data: withChunkLength(t, pngRotated, "tEXt", 0x7FFFFFFF)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := transformAll(test.contentType, test.data)
+			if !errors.Is(err, transform.ErrInvalidImage) {
+				t.Fatalf("expected invalid image, got %v", err)
+			}
+		})
+	}
+}
+
+// exifSegment APP1 сегмент с произвольной TIFF структурой
+func exifSegment(tiff []byte) []byte {
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestTransformIgnoresMalformedExif(t *testing.T) {
+	t.Parallel()
+
+	jpegNormal := fixture(t, "normal.jpg")
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{name: "short tiff", tiff: []byte("MM")},
+		{name: "unknown byte order", tiff: []byte("XX\x00*\x00\x00\x00\x08\x00\x00")},
+		{name: "ifd offset out of range", tiff: []byte("MM\x00*\xFF\xFF\xFF\x00")},
+		{name: "entry count beyond data", tiff: []byte("MM\x00*\x00\x00\x00\x08\xFF\xFF\x01\x12")},
+		{name: "orientation out of range", tiff: []byte("MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x09\x00\x00")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			data := append(bytes.Clone(jpegNormal[:2]), exifSegment(test.tiff)...)
+			data = append(data, jpegNormal[2:]...)
+			result, err := transformAll("image/jpeg", data)
+			if err != nil {
+				t.Fatalf("transform: %v", err)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+			if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+				t.Fatalf("image must not be rotated, got %v", img.Bounds())
+			}
+		})
+	}
+}
+
+func TestTransformReturnsReadError(t *testing.T) {
+	t.Parallel()
+
+	readErr := errors.New("connection reset")
+	for _, name := range []string{"orientation6.jpg", "normal.jpg", "orientation3.png", "trailing_xmp.png"} {
+		contentType := "image/jpeg"
+		if bytes.HasSuffix([]byte(name), []byte(".png")) {
+			contentType = "image/png"
+		}
+		data := fixture(t, name)
+		for _, cut := range []int{1, 20, len(data) / 2} {
+			reader := io.MultiReader(bytes.NewReader(data[:cut]), iotest.ErrReader(readErr))
+			_, err := io.ReadAll(transform.NewImageMetadata().Transform(contentType, reader))
+			if !errors.Is(err, readErr) || errors.Is(err, transform.ErrInvalidImage) {
+				t.Fatalf("%s cut at %d: expected read error, got %v", name, cut, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package trash
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/txix-open/bgjob"
+)
+
+const WorkerQueueName = "trash_files"
+
+func EnqueueSeedJob(ctx context.Context, client *bgjob.Client) error {
+	err := client.Enqueue(ctx, bgjob.EnqueueRequest{
+		Id:    "trash",
+		Queue: WorkerQueueName,
+		Type:  "trash",
+	})
+	if err != nil && !errors.Is(err, bgjob.ErrJobAlreadyExist) {
+		return errors.WithMessage(err, "enqueue job")
+	}
+
+	return nil
+}
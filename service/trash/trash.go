@@ -0,0 +1,376 @@
+package trash
+
+import (
+	"context"
+	"storage-service/domain"
+	"storage-service/entity"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Prefix объекты в корзине хранятся в бакете категории под этим префиксом,
+	// имя файла из пути запроса не может содержать '/', поэтому пересечений с обычными файлами нет
+	Prefix = ".trash/"
+
+	defaultListLimit = 100
+
+	copyConcurrency = 16
+)
+
+type TrashTxRunner interface {
+	TrashTx(ctx context.Context, tx func(ctx context.Context, tx TrashFilesTx) error) error
+}
+
+type TrashFilesTx interface {
+	InsertTrashFile(ctx context.Context, file entity.TrashFile) error
+	DeleteTrashFile(ctx context.Context, id string, category string) (*entity.TrashFile, error)
+	InsertEvent(ctx context.Context, event entity.StorageEvent) (int64, error)
+	DeletePendingFilesByNames(ctx context.Context, category string, filenames []string) error
+	DeleteExpirationsByNames(ctx context.Context, category string, filenames []string) error
+}
+
+type TrashRepo interface {
+	GetTrashFile(ctx context.Context, id string, category string) (*entity.TrashFile, error)
+	GetTrashFiles(ctx context.Context, category string, limit int, offset int) ([]entity.TrashFile, error)
+	GetExpiredTrashFiles(ctx context.Context, now time.Time, maxFiles int) ([]entity.TrashFile, error)
+}
+
+type FileRepo interface {
+	IsFileExist(ctx context.Context, filename string, category string) (bool, error)
+	CopyFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
+	MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
+	DeleteFile(ctx context.Context, filename string, category string) error
+	DeleteFiles(ctx context.Context, category string, filenames []string) (map[string]error, error)
+}
+
+type CategorySettings interface {
+	Settings(ctx context.Context, category string) (entity.CategorySettings, error)
+}
+
+type Trash struct {
+	txRunner         TrashTxRunner
+	repo             FileRepo
+	trashRepo        TrashRepo
+	categories       CategorySettings
+	defaultRetention time.Duration
+	maxPurgedFiles   int
+}
+
+func NewTrash(
+	txRunner TrashTxRunner,
+	repo FileRepo,
+	trashRepo TrashRepo,
+	categories CategorySettings,
+	defaultRetention time.Duration,
+	maxPurgedFiles int,
+) Trash {
+	return Trash{
+		txRunner:         txRunner,
+		repo:             repo,
+		trashRepo:        trashRepo,
+		categories:       categories,
+		defaultRetention: defaultRetention,
+		maxPurgedFiles:   maxPurgedFiles,
+	}
+}
+
+// MoveToTrash переносит файл в корзину, объект переносится вне транзакции,
+// если записать файл корзины не удалось, объект возвращается под своё имя
+func (s Trash) MoveToTrash(ctx context.Context, filename string, category string, deletedBy string) error {
+	retention, err := s.retention(ctx, category)
+	if err != nil {
+		return errors.WithMessage(err, "get retention")
+	}
+
+	now := time.Now().UTC()
+	file := entity.TrashFile{
+		Id:        uuid.NewString(),
+		Filename:  filename,
+		Category:  category,
+		DeletedAt: now,
+		DeletedBy: deletedBy,
+		PurgeAt:   now.Add(retention),
+	}
+	err = s.repo.MoveFile(ctx, category, filename, Prefix+file.Id)
+	if err != nil {
+		return errors.WithMessage(err, "move file to trash")
+	}
+
+	err = s.txRunner.TrashTx(ctx, func(ctx context.Context, tx TrashFilesTx) error {
+		err := tx.InsertTrashFile(ctx, file)
+		if err != nil {
+			return errors.WithMessage(err, "insert trash file")
+		}
+		_, err = tx.InsertEvent(ctx, entity.NewStorageEvent(entity.EventDeleted, filename, category, deletedBy))
+		if err != nil {
+			return errors.WithMessage(err, "insert event")
+		}
+		return nil
+	})
+	if err != nil {
+		// без отката объект остался бы в корзине без записи, его нельзя было бы восстановить и удалить
+		moveErr := s.repo.MoveFile(ctx, category, Prefix+file.Id, filename)
+		if moveErr != nil {
+			return errors.WithMessagef(err, "trash tx, move file from trash: %v", moveErr)
+		}
+		return errors.WithMessage(err, "trash tx")
+	}
+	return nil
+}
+
+// MoveFilesToTrash переносит файлы категории в корзину пачкой: объекты копируются в корзину,
+// исходные удаляются одним запросом, записи корзины и события вместе с очисткой pending записей
+// и сроков жизни файлов сохраняются в одной транзакции. Возвращает ошибки по именам не перенесённых файлов
+func (s Trash) MoveFilesToTrash(
+	ctx context.Context,
+	category string,
+	filenames []string,
+	deletedBy string,
+) (map[string]error, error) {
+	retention, err := s.retention(ctx, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get retention")
+	}
+
+	now := time.Now().UTC()
+	files := make([]entity.TrashFile, 0, len(filenames))
+	for _, filename := range filenames {
+		files = append(files, entity.TrashFile{
+			Id:        uuid.NewString(),
+			Filename:  filename,
+			Category:  category,
+			DeletedAt: now,
+			DeletedBy: deletedBy,
+			PurgeAt:   now.Add(retention),
+		})
+	}
+	failed := s.copyToTrash(ctx, files)
+	copied := make([]entity.TrashFile, 0, len(files))
+	for _, file := range files {
+		if failed[file.Filename] == nil {
+			copied = append(copied, file)
+		}
+	}
+	if len(copied) == 0 {
+		return failed, nil
+	}
+
+	originals := make([]string, 0, len(copied))
+	for _, file := range copied {
+		originals = append(originals, file.Filename)
+	}
+	// без удаления копий не удалённый файл остался бы и под своим именем, и в корзине без записи
+	removeFailed, err := s.repo.DeleteFiles(ctx, category, originals)
+	if err != nil {
+		discardErr := s.discardCopies(ctx, category, copied)
+		if discardErr != nil {
+			return nil, errors.WithMessagef(err, "delete files, %v", discardErr)
+		}
+		return nil, errors.WithMessage(err, "delete files")
+	}
+	moved := make([]entity.TrashFile, 0, len(copied))
+	notRemoved := make([]entity.TrashFile, 0, len(removeFailed))
+	for _, file := range copied {
+		if removeFailed[file.Filename] == nil {
+			moved = append(moved, file)
+		} else {
+			notRemoved = append(notRemoved, file)
+		}
+	}
+	if len(notRemoved) > 0 {
+		discardErr := s.discardCopies(ctx, category, notRemoved)
+		for _, file := range notRemoved {
+			failed[file.Filename] = errors.WithMessage(removeFailed[file.Filename], "remove object")
+			if discardErr != nil {
+				failed[file.Filename] = errors.WithMessagef(removeFailed[file.Filename], "remove object, %v", discardErr)
+			}
+		}
+	}
+	if len(moved) == 0 {
+		return failed, nil
+	}
+
+	deleted := make([]string, 0, len(moved))
+	for _, file := range moved {
+		deleted = append(deleted, file.Filename)
+	}
+	err = s.txRunner.TrashTx(ctx, func(ctx context.Context, tx TrashFilesTx) error {
+		for _, file := range moved {
+			err := tx.InsertTrashFile(ctx, file)
+			if err != nil {
+				return errors.WithMessagef(err, "insert trash file '%s'", file.Filename)
+			}
+			_, err = tx.InsertEvent(ctx, entity.NewStorageEvent(entity.EventDeleted, file.Filename, category, deletedBy))
+			if err != nil {
+				return errors.WithMessage(err, "insert event")
+			}
+		}
+		err := tx.DeletePendingFilesByNames(ctx, category, deleted)
+		if err != nil {
+			return errors.WithMessage(err, "delete pending files")
+		}
+		err = tx.DeleteExpirationsByNames(ctx, category, deleted)
+		if err != nil {
+			return errors.WithMessage(err, "delete expirations")
+		}
+		return nil
+	})
+	if err != nil {
+		for _, file := range moved {
+			moveErr := s.repo.MoveFile(ctx, category, Prefix+file.Id, file.Filename)
+			if moveErr != nil {
+				return nil, errors.WithMessagef(err, "trash tx, move file '%s' from trash: %v", file.Filename, moveErr)
+			}
+		}
+		return nil, errors.WithMessage(err, "trash tx")
+	}
+	return failed, nil
+}
+
+// copyToTrash копирует объекты в корзину, возвращает ошибки копирования по именам файлов
+func (s Trash) copyToTrash(ctx context.Context, files []entity.TrashFile) map[string]error {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	failed := make(map[string]error)
+	sem := make(chan struct{}, copyConcurrency)
+	for _, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := s.repo.CopyFile(ctx, file.Category, file.Filename, Prefix+file.Id)
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			failed[file.Filename] = errors.WithMessage(err, "copy file to trash")
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+// discardCopies удаляет копии файлов, которые не удалось перенести в корзину
+func (s Trash) discardCopies(ctx context.Context, category string, files []entity.TrashFile) error {
+	copies := make([]string, 0, len(files))
+	for _, file := range files {
+		copies = append(copies, Prefix+file.Id)
+	}
+	failed, err := s.repo.DeleteFiles(ctx, category, copies)
+	if err != nil {
+		return errors.WithMessage(err, "remove copies")
+	}
+	for filename, removeErr := range failed {
+		return errors.WithMessagef(removeErr, "remove copy '%s'", filename)
+	}
+	return nil
+}
+
+// Restore возвращает файл из корзины, объект переносится до удаления записи корзины,
+// если удалить запись не удалось, объект возвращается в корзину
+func (s Trash) Restore(ctx context.Context, id string, category string) (*entity.TrashFile, error) {
+	file, err := s.trashRepo.GetTrashFile(ctx, id, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get trash file")
+	}
+
+	exist, err := s.repo.IsFileExist(ctx, file.Filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "is file exist")
+	}
+	if exist {
+		return nil, domain.ErrFileAlreadyExist
+	}
+
+	err = s.repo.MoveFile(ctx, category, Prefix+file.Id, file.Filename)
+	if err != nil {
+		return nil, errors.WithMessage(err, "move file from trash")
+	}
+
+	err = s.txRunner.TrashTx(ctx, func(ctx context.Context, tx TrashFilesTx) error {
+		_, err := tx.DeleteTrashFile(ctx, id, category)
+		// запись удаляет и очистка корзины, не нашедшая перенесённый объект
+		if err != nil && !errors.Is(err, domain.ErrTrashFileNotFound) {
+			return errors.WithMessage(err, "delete trash file")
+		}
+		return nil
+	})
+	if err != nil {
+		moveErr := s.repo.MoveFile(ctx, category, file.Filename, Prefix+file.Id)
+		if moveErr != nil {
+			return nil, errors.WithMessagef(err, "trash tx, move file to trash: %v", moveErr)
+		}
+		return nil, errors.WithMessage(err, "trash tx")
+	}
+	return file, nil
+}
+
+func (s Trash) List(ctx context.Context, category string, limit int, offset int) ([]entity.TrashFile, error) {
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	files, err := s.trashRepo.GetTrashFiles(ctx, category, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get trash files")
+	}
+	return files, nil
+}
+
+// PurgeExpiredFiles удаляет объекты с истёкшим сроком хранения, затем их записи.
+// Запись удаляется только после удаления объекта, поэтому прерванная очистка повторяется при следующем запуске
+func (s Trash) PurgeExpiredFiles(ctx context.Context) error {
+	files, err := s.trashRepo.GetExpiredTrashFiles(ctx, time.Now().UTC(), s.maxPurgedFiles)
+	if err != nil {
+		return errors.WithMessage(err, "get expired trash files")
+	}
+
+	purged := make([]entity.TrashFile, 0, len(files))
+	var purgeErr error
+	for _, file := range files {
+		err = s.repo.DeleteFile(ctx, Prefix+file.Id, file.Category)
+		if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+			purgeErr = errors.WithMessagef(err, "purge file with id '%s' and category '%s'", file.Id, file.Category)
+			continue
+		}
+		purged = append(purged, file)
+	}
+	if len(purged) == 0 {
+		return purgeErr
+	}
+
+	err = s.txRunner.TrashTx(ctx, func(ctx context.Context, tx TrashFilesTx) error {
+		for _, file := range purged {
+			_, err := tx.DeleteTrashFile(ctx, file.Id, file.Category)
+			// файл мог быть восстановлен до удаления объекта
+			if err != nil && !errors.Is(err, domain.ErrTrashFileNotFound) {
+				return errors.WithMessagef(err, "delete trash file with id '%s'", file.Id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "trash tx")
+	}
+	return purgeErr
+}
+
+func (s Trash) retention(ctx context.Context, category string) (time.Duration, error) {
+	settings, err := s.categories.Settings(ctx, category)
+	if err != nil {
+		return 0, errors.WithMessage(err, "get category settings")
+	}
+	if settings.TrashRetention == 0 {
+		return s.defaultRetention, nil
+	}
+	return settings.TrashRetention, nil
+}
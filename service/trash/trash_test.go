@@ -0,0 +1,345 @@
+package trash_test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/trash"
+
+	"github.com/pkg/errors"
+)
+
+// txRunner выполняет функцию без транзакции, при ошибке функции или commitErr отменяет изменения строк
+type txRunner struct {
+	files     map[string]entity.TrashFile
+	events    []entity.StorageEvent
+	pending   []string
+	expires   []string
+	commitErr error
+}
+
+func (r *txRunner) TrashTx(ctx context.Context, tx func(ctx context.Context, tx trash.TrashFilesTx) error) error {
+	files := make(map[string]entity.TrashFile, len(r.files))
+	for id, file := range r.files {
+		files[id] = file
+	}
+	events, pending, expires := len(r.events), len(r.pending), len(r.expires)
+	err := tx(ctx, r)
+	if err == nil {
+		err = r.commitErr
+	}
+	if err != nil {
+		r.files = files
+		r.events = r.events[:events]
+		r.pending = r.pending[:pending]
+		r.expires = r.expires[:expires]
+	}
+	return err
+}
+
+func (r *txRunner) InsertTrashFile(_ context.Context, file entity.TrashFile) error {
+	r.files[file.Id] = file
+	return nil
+}
+
+func (r *txRunner) DeleteTrashFile(_ context.Context, id string, _ string) (*entity.TrashFile, error) {
+	file, ok := r.files[id]
+	if !ok {
+		return nil, domain.ErrTrashFileNotFound
+	}
+	delete(r.files, id)
+	return &file, nil
+}
+
+func (r *txRunner) InsertEvent(_ context.Context, event entity.StorageEvent) (int64, error) {
+	r.events = append(r.events, event)
+	return int64(len(r.events)), nil
+}
+
+func (r *txRunner) DeletePendingFilesByNames(_ context.Context, _ string, filenames []string) error {
+	r.pending = append(r.pending, filenames...)
+	return nil
+}
+
+func (r *txRunner) DeleteExpirationsByNames(_ context.Context, _ string, filenames []string) error {
+	r.expires = append(r.expires, filenames...)
+	return nil
+}
+
+func (r *txRunner) GetTrashFile(_ context.Context, id string, _ string) (*entity.TrashFile, error) {
+	file, ok := r.files[id]
+	if !ok {
+		return nil, domain.ErrTrashFileNotFound
+	}
+	return &file, nil
+}
+
+func (r *txRunner) GetTrashFiles(context.Context, string, int, int) ([]entity.TrashFile, error) {
+	return nil, nil
+}
+
+func (r *txRunner) GetExpiredTrashFiles(_ context.Context, now time.Time, _ int) ([]entity.TrashFile, error) {
+	expired := make([]entity.TrashFile, 0)
+	for _, file := range r.files {
+		if file.PurgeAt.Before(now) {
+			expired = append(expired, file)
+		}
+	}
+	return expired, nil
+}
+
+// storage объекты бакета, removeErr ошибки пакетного удаления по именам объектов
+type storage struct {
+	mu        sync.Mutex
+	objects   map[string]bool
+	moveErr   error
+	removeErr map[string]error
+}
+
+func (s *storage) IsFileExist(_ context.Context, filename string, _ string) (bool, error) {
+	return s.objects[filename], nil
+}
+
+func (s *storage) CopyFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.objects[srcFilename] {
+		return domain.ErrFileNotFound
+	}
+	s.objects[dstFilename] = true
+	return nil
+}
+
+func (s *storage) MoveFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	if s.moveErr != nil {
+		return s.moveErr
+	}
+	if !s.objects[srcFilename] {
+		return domain.ErrFileNotFound
+	}
+	delete(s.objects, srcFilename)
+	s.objects[dstFilename] = true
+	return nil
+}
+
+func (s *storage) DeleteFile(_ context.Context, filename string, _ string) error {
+	if !s.objects[filename] {
+		return domain.ErrFileNotFound
+	}
+	delete(s.objects, filename)
+	return nil
+}
+
+func (s *storage) DeleteFiles(_ context.Context, _ string, filenames []string) (map[string]error, error) {
+	failed := make(map[string]error)
+	for _, filename := range filenames {
+		err := s.removeErr[filename]
+		if err != nil {
+			failed[filename] = err
+			continue
+		}
+		delete(s.objects, filename)
+	}
+	return failed, nil
+}
+
+type settings entity.CategorySettings
+
+func (s settings) Settings(context.Context, string) (entity.CategorySettings, error) {
+	return entity.CategorySettings(s), nil
+}
+
+func newTrash(runner *txRunner, repo *storage, categorySettings settings) trash.Trash {
+	return trash.NewTrash(runner, repo, runner, categorySettings, time.Hour, 10)
+}
+
+func TestMoveToTrash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		settings  settings
+		retention time.Duration
+	}{
+		{name: "default retention", retention: time.Hour},
+		{name: "category retention", settings: settings{TrashRetention: time.Minute}, retention: time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			runner := &txRunner{files: map[string]entity.TrashFile{}}
+			repo := &storage{objects: map[string]bool{"file": true}}
+			err := newTrash(runner, repo, test.settings).MoveToTrash(t.Context(), "file", "images", "alice")
+			if err != nil {
+				t.Fatalf("move to trash: %v", err)
+			}
+			if len(runner.files) != 1 || len(runner.events) != 1 {
+				t.Fatalf("expected one trash file and one event, got %d and %d", len(runner.files), len(runner.events))
+			}
+			for id, file := range runner.files {
+				if file.DeletedBy != "alice" || file.PurgeAt.Sub(file.DeletedAt) != test.retention {
+					t.Fatalf("unexpected trash file %+v", file)
+				}
+				if repo.objects["file"] || !repo.objects[trash.Prefix+id] {
+					t.Fatalf("object is not moved to trash: %v", repo.objects)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveToTrashFailedMoveKeepsFile(t *testing.T) {
+	t.Parallel()
+
+	runner := &txRunner{files: map[string]entity.TrashFile{}}
+	moveErr := errors.New("minio is unavailable")
+	repo := &storage{objects: map[string]bool{"file": true}, moveErr: moveErr}
+	err := newTrash(runner, repo, settings{}).MoveToTrash(t.Context(), "file", "images", "alice")
+	if !errors.Is(err, moveErr) {
+		t.Fatalf("expected move error, got %v", err)
+	}
+	if len(runner.files) != 0 || len(runner.events) != 0 || !repo.objects["file"] {
+		t.Fatalf("failed move must not change trash: %v %v %v", runner.files, runner.events, repo.objects)
+	}
+}
+
+func TestMoveToTrashFailedCommitReturnsFile(t *testing.T) {
+	t.Parallel()
+
+	commitErr := errors.New("connection lost")
+	runner := &txRunner{files: map[string]entity.TrashFile{}, commitErr: commitErr}
+	repo := &storage{objects: map[string]bool{"file": true}}
+	err := newTrash(runner, repo, settings{}).MoveToTrash(t.Context(), "file", "images", "alice")
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("expected commit error, got %v", err)
+	}
+	if len(runner.files) != 0 || len(repo.objects) != 1 || !repo.objects["file"] {
+		t.Fatalf("object must be returned from trash: %v %v", runner.files, repo.objects)
+	}
+}
+
+func TestMoveFilesToTrash(t *testing.T) {
+	t.Parallel()
+
+	removeErr := errors.New("access denied")
+	runner := &txRunner{files: map[string]entity.TrashFile{}}
+	repo := &storage{
+		objects:   map[string]bool{"a": true, "b": true, "c": true},
+		removeErr: map[string]error{"c": removeErr},
+	}
+	failed, err := newTrash(runner, repo, settings{}).MoveFilesToTrash(t.Context(), "images", []string{"a", "b", "c", "missing"}, "alice")
+	if err != nil {
+		t.Fatalf("move files to trash: %v", err)
+	}
+	if len(failed) != 2 || !errors.Is(failed["c"], removeErr) || !errors.Is(failed["missing"], domain.ErrFileNotFound) {
+		t.Fatalf("unexpected failed files %v", failed)
+	}
+	expected := map[string]bool{"c": true}
+	for id, file := range runner.files {
+		if file.DeletedBy != "alice" {
+			t.Fatalf("unexpected trash file %+v", file)
+		}
+		expected[trash.Prefix+id] = true
+	}
+	if len(runner.files) != 2 || len(runner.events) != 2 || !maps.Equal(repo.objects, expected) {
+		t.Fatalf("expected a and b in trash, got %v and %v", runner.files, repo.objects)
+	}
+	if !slices.Equal(runner.pending, []string{"a", "b"}) || !slices.Equal(runner.expires, []string{"a", "b"}) {
+		t.Fatalf("expected rows of a and b to be deleted, got %v and %v", runner.pending, runner.expires)
+	}
+}
+
+func TestMoveFilesToTrashFailedCommitReturnsFiles(t *testing.T) {
+	t.Parallel()
+
+	commitErr := errors.New("connection lost")
+	runner := &txRunner{files: map[string]entity.TrashFile{}, commitErr: commitErr}
+	repo := &storage{objects: map[string]bool{"a": true, "b": true}}
+	_, err := newTrash(runner, repo, settings{}).MoveFilesToTrash(t.Context(), "images", []string{"a", "b"}, "alice")
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("expected commit error, got %v", err)
+	}
+	expected := map[string]bool{"a": true, "b": true}
+	if len(runner.files) != 0 || len(runner.pending) != 0 || !maps.Equal(repo.objects, expected) {
+		t.Fatalf("files must be returned from trash: %v %v", runner.files, repo.objects)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		objects map[string]bool
+		err     error
+	}{
+		{name: "restored", objects: map[string]bool{trash.Prefix + "id": true}},
+		{name: "file with same name exists", objects: map[string]bool{trash.Prefix + "id": true, "file": true}, err: domain.ErrFileAlreadyExist},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			runner := &txRunner{files: map[string]entity.TrashFile{
+				"id": {Id: "id", Filename: "file", Category: "images"},
+			}}
+			repo := &storage{objects: test.objects}
+			_, err := newTrash(runner, repo, settings{}).Restore(t.Context(), "id", "images")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			_, inTrash := runner.files["id"]
+			if test.err != nil && (!inTrash || !repo.objects[trash.Prefix+"id"]) {
+				t.Fatal("failed restore must keep trash file")
+			}
+			if test.err == nil && (inTrash || !repo.objects["file"]) {
+				t.Fatal("file is not restored")
+			}
+		})
+	}
+}
+
+func TestRestoreFailedCommitKeepsTrashFile(t *testing.T) {
+	t.Parallel()
+
+	commitErr := errors.New("connection lost")
+	runner := &txRunner{
+		files:     map[string]entity.TrashFile{"id": {Id: "id", Filename: "file", Category: "images"}},
+		commitErr: commitErr,
+	}
+	repo := &storage{objects: map[string]bool{trash.Prefix + "id": true}}
+	_, err := newTrash(runner, repo, settings{}).Restore(t.Context(), "id", "images")
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("expected commit error, got %v", err)
+	}
+	_, inTrash := runner.files["id"]
+	if !inTrash || len(repo.objects) != 1 || !repo.objects[trash.Prefix+"id"] {
+		t.Fatalf("object must be returned to trash: %v %v", runner.files, repo.objects)
+	}
+}
+
+func TestPurgeExpiredFiles(t *testing.T) {
+	t.Parallel()
+
+	past := time.Now().Add(-time.Minute)
+	runner := &txRunner{files: map[string]entity.TrashFile{
+		"expired": {Id: "expired", Category: "images", PurgeAt: past},
+		"missing": {Id: "missing", Category: "images", PurgeAt: past},
+		"kept":    {Id: "kept", Category: "images", PurgeAt: time.Now().Add(time.Hour)},
+	}}
+	repo := &storage{objects: map[string]bool{trash.Prefix + "expired": true, trash.Prefix + "kept": true}}
+	err := newTrash(runner, repo, settings{}).PurgeExpiredFiles(t.Context())
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if len(runner.files) != 1 || repo.objects[trash.Prefix+"expired"] || !repo.objects[trash.Prefix+"kept"] {
+		t.Fatalf("unexpected state after purge: %v %v", runner.files, repo.objects)
+	}
+}
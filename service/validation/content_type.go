@@ -0,0 +1,30 @@
+package validation
+
+import (
+	"fmt"
+	"slices"
+
+	"storage-service/domain"
+)
+
+// ContentType пропускает только разрешённые content-type, определённые по первым байтам файла
+type ContentType struct {
+	supported []string
+}
+
+// NewContentType при пустом supported разрешены все content-type
+func NewContentType(supported []string) ContentType {
+	return ContentType{
+		supported: supported,
+	}
+}
+
+func (v ContentType) Start(_ []byte, contentType string) (Check, error) {
+	if len(v.supported) != 0 && !slices.Contains(v.supported, contentType) {
+		return nil, domain.NewInvalidArgumentError(
+			fmt.Sprintf("file type is not supported. file type: '%s'", contentType),
+			domain.ErrCodeUnsupportedFileType,
+		)
+	}
+	return nil, nil
+}
@@ -0,0 +1,111 @@
+package validation
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+)
+
+// maxImageConfigBytes размеры изображения должны встретиться в начале файла,
+// JPEG с метаданными больше этого размера отклоняется
+const maxImageConfigBytes = 1024 * 1024
+
+type ImageConfig struct {
+	// MaxWidth 0 - без ограничения
+	MaxWidth int
+	// MaxHeight 0 - без ограничения
+	MaxHeight int
+	// MaxPixels 0 - без ограничения
+	MaxPixels int64
+}
+
+// Image ограничивает размеры JPEG, PNG и GIF изображений, чтобы распаковка изображения
+// (например, при удалении метаданных) не заняла всю память. Размеры читаются из заголовка изображения,
+// поэтому файл отклоняется до чтения пиксельных данных
+type Image struct {
+	cfg ImageConfig
+}
+
+func NewImage(cfg ImageConfig) Image {
+	return Image{
+		cfg: cfg,
+	}
+}
+
+func (v Image) Start(_ []byte, contentType string) (Check, error) {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, nil
+	}
+	return &imageCheck{cfg: v.cfg}, nil
+}
+
+type imageCheck struct {
+	cfg     ImageConfig
+	buf     bytes.Buffer
+	checked bool
+}
+
+func (c *imageCheck) Write(p []byte) (int, error) {
+	if c.checked {
+		return len(p), nil
+	}
+	c.buf.Write(p[:min(len(p), maxImageConfigBytes-c.buf.Len())])
+	config, _, err := image.DecodeConfig(bytes.NewReader(c.buf.Bytes()))
+	if err != nil {
+		if c.buf.Len() >= maxImageConfigBytes {
+			return 0, invalidContent("invalid image: %v", err)
+		}
+		// заголовок ещё не прочитан целиком
+		return len(p), nil
+	}
+	c.checked = true
+	c.buf = bytes.Buffer{}
+	err = c.checkConfig(config)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *imageCheck) Finish() error {
+	if c.checked {
+		return nil
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(c.buf.Bytes()))
+	if err != nil {
+		return invalidContent("invalid image: %v", err)
+	}
+	c.checked = true
+	return c.checkConfig(config)
+}
+
+func (c *imageCheck) Close() error {
+	return nil
+}
+
+func (c *imageCheck) checkConfig(config image.Config) error {
+	limits := make([]string, 0)
+	if c.cfg.MaxWidth > 0 && config.Width > c.cfg.MaxWidth {
+		limits = append(limits, "width")
+	}
+	if c.cfg.MaxHeight > 0 && config.Height > c.cfg.MaxHeight {
+		limits = append(limits, "height")
+	}
+	if c.cfg.MaxPixels > 0 && int64(config.Width)*int64(config.Height) > c.cfg.MaxPixels {
+		limits = append(limits, "pixel count")
+	}
+	if len(limits) != 0 {
+		return invalidContent(
+			"image %dx%d exceeds %s limit",
+			config.Width,
+			config.Height,
+			strings.Join(limits, ", "),
+		)
+	}
+	return nil
+}
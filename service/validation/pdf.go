@@ -0,0 +1,68 @@
+package validation
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+// pdfTailSize по спецификации маркер %%EOF находится в последних 1024 байтах файла
+const pdfTailSize = 1024
+
+var (
+	pdfHeader    = regexp.MustCompile(`^%PDF-[12]\.\d`)
+	pdfStartXref = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+)
+
+// Pdf проверяет структуру PDF: версию в заголовке, маркер конца файла и смещение таблицы ссылок,
+// чтобы отклонить обрезанные и подделанные под PDF файлы. Содержимое не разбирается
+type Pdf struct{}
+
+func NewPdf() Pdf {
+	return Pdf{}
+}
+
+func (v Pdf) Start(header []byte, contentType string) (Check, error) {
+	if contentType != "application/pdf" {
+		return nil, nil
+	}
+	if !pdfHeader.Match(header) {
+		return nil, invalidContent("invalid pdf: unsupported header")
+	}
+	return &pdfCheck{}, nil
+}
+
+type pdfCheck struct {
+	tail []byte
+	size int64
+}
+
+func (c *pdfCheck) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	c.tail = append(c.tail, p...)
+	if len(c.tail) > pdfTailSize {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-pdfTailSize:]...)
+	}
+	return len(p), nil
+}
+
+func (c *pdfCheck) Finish() error {
+	// после %%EOF допускаются только пробельные символы, обновления файла дописываются со своим %%EOF
+	tail := bytes.TrimRight(c.tail, " \t\r\n\x00")
+	if !bytes.HasSuffix(tail, []byte("%%EOF")) {
+		return invalidContent("invalid pdf: missing %%%%EOF marker")
+	}
+	matches := pdfStartXref.FindAllSubmatch(tail, -1)
+	if len(matches) == 0 {
+		return invalidContent("invalid pdf: missing startxref")
+	}
+	offset, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || offset <= 0 || offset >= c.size {
+		return invalidContent("invalid pdf: cross-reference offset out of file")
+	}
+	return nil
+}
+
+func (c *pdfCheck) Close() error {
+	return nil
+}
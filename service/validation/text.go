@@ -0,0 +1,76 @@
+package validation
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Text проверяет, что текстовые файлы (text/*, application/json) в кодировке UTF-8 и не содержат NUL байтов
+type Text struct{}
+
+func NewText() Text {
+	return Text{}
+}
+
+func (v Text) Start(_ []byte, contentType string) (Check, error) {
+	if !strings.HasPrefix(contentType, "text/") && contentType != "application/json" {
+		return nil, nil
+	}
+	return &textCheck{}, nil
+}
+
+type textCheck struct {
+	// partial начало символа, разделённого между блоками содержимого
+	partial []byte
+	offset  int64
+}
+
+func (c *textCheck) Write(p []byte) (int, error) {
+	data := p
+	if len(c.partial) != 0 {
+		data = append(c.partial, p...)
+	}
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+
+	err := c.check(data[:end])
+	if err != nil {
+		return 0, err
+	}
+	c.offset += int64(end)
+	c.partial = append([]byte{}, data[end:]...)
+	return len(p), nil
+}
+
+func (c *textCheck) Finish() error {
+	if len(c.partial) != 0 {
+		return invalidContent("invalid utf-8 text at offset %d", c.offset)
+	}
+	return nil
+}
+
+func (c *textCheck) Close() error {
+	return nil
+}
+
+func (c *textCheck) check(data []byte) error {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return invalidContent("text contains NUL byte at offset %d", c.offset+int64(i))
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return invalidContent("invalid utf-8 text at offset %d", c.offset+int64(i))
+		}
+		i += size
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package validation
+
+import (
+	"fmt"
+	"io"
+
+	"storage-service/domain"
+	"storage-service/entity"
+)
+
+const mb = 1 << 20
+
+// Validator проверка содержимого загружаемого файла
+type Validator interface {
+	// Start по первым байтам файла и content type решает, нужна ли проверка, nil - файл не проверяется этим валидатором.
+	// Ошибка отклоняет файл до записи в хранилище
+	Start(header []byte, contentType string) (Check, error)
+}
+
+// Check получает всё содержимое файла по мере загрузки, начиная с первых байт,
+// ошибка Write прерывает загрузку
+type Check interface {
+	io.Writer
+	// Finish возвращает результат проверки после чтения всего содержимого
+	Finish() error
+	// Close освобождает ресурсы проверки, вызывается и при прерванной загрузке
+	Close() error
+}
+
+// Pipelines общие валидаторы выполняются для всех категорий первыми, затем включённые в настройках категории
+type Pipelines struct {
+	common []Validator
+}
+
+func NewPipelines(common []Validator) Pipelines {
+	return Pipelines{
+		common: common,
+	}
+}
+
+// Start запускает проверки файла категории, возвращённый Run нужно закрыть
+func (p Pipelines) Start(cfg entity.CategoryValidation, header []byte, contentType string) (*Run, error) {
+	run := &Run{}
+	validators := append(append([]Validator{}, p.common...), categoryValidators(cfg)...)
+	for _, validator := range validators {
+		check, err := validator.Start(header, contentType)
+		if err != nil {
+			run.Close()
+			return nil, err
+		}
+		if check != nil {
+			run.checks = append(run.checks, check)
+		}
+	}
+	return run, nil
+}
+
+func categoryValidators(cfg entity.CategoryValidation) []Validator {
+	validators := make([]Validator, 0)
+	if cfg.Image.Enabled {
+		validators = append(validators, NewImage(ImageConfig{
+			MaxWidth:  cfg.Image.MaxWidth,
+			MaxHeight: cfg.Image.MaxHeight,
+			MaxPixels: cfg.Image.MaxPixels,
+		}))
+	}
+	if cfg.Zip.Enabled {
+		validators = append(validators, NewZip(ZipConfig{
+			MaxEntries:           cfg.Zip.MaxEntries,
+			MaxCompressionRatio:  cfg.Zip.MaxCompressionRatio,
+			MaxUncompressedBytes: cfg.Zip.MaxUncompressedMb * mb,
+		}))
+	}
+	if cfg.Pdf.Enabled {
+		validators = append(validators, NewPdf())
+	}
+	if cfg.Text.Enabled {
+		validators = append(validators, NewText())
+	}
+	return validators
+}
+
+// Run проверки одного загружаемого файла
+type Run struct {
+	checks []Check
+	err    error
+}
+
+// Reader передаёт прочитанное содержимое проверкам, первая ошибка проверки прерывает чтение и доступна через Err
+func (r *Run) Reader(reader io.Reader) io.Reader {
+	if len(r.checks) == 0 {
+		return reader
+	}
+	return io.TeeReader(reader, r)
+}
+
+func (r *Run) Write(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for _, check := range r.checks {
+		_, err := check.Write(p)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Err ошибка проверки, прервавшая чтение содержимого
+func (r *Run) Err() error {
+	return r.err
+}
+
+// Finish возвращает первую ошибку проверок после чтения всего содержимого
+func (r *Run) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	for _, check := range r.checks {
+		err := check.Finish()
+		if err != nil {
+			r.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Run) Close() {
+	for _, check := range r.checks {
+		_ = check.Close()
+	}
+}
+
+// invalidContent ошибка отклонённого содержимого файла
+func invalidContent(format string, args ...any) error {
+	return domain.NewInvalidArgumentError(fmt.Sprintf(format, args...), domain.ErrCodeInvalidFileContent)
+}
@@ -0,0 +1,170 @@
+package validation_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/validation"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/pkg/errors"
+)
+
+// upload проверяет содержимое так же, как загрузка файла: первые байты, затем поток маленькими блоками
+func upload(pipelines validation.Pipelines, cfg entity.CategoryValidation, content []byte) error {
+	header := content[:min(len(content), 512)]
+	run, err := pipelines.Start(cfg, header, mimetype.Detect(header).String())
+	if err != nil {
+		return err
+	}
+	defer run.Close()
+
+	_, err = io.Copy(io.Discard, run.Reader(iotest.OneByteReader(bytes.NewReader(content))))
+	if run.Err() != nil {
+		return run.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return run.Finish()
+}
+
+func requireRejected(t *testing.T, err error, errCode int) {
+	t.Helper()
+	invalidArgErr := domain.InvalidArgumentError{}
+	if !errors.As(err, &invalidArgErr) || invalidArgErr.ErrCode != errCode {
+		t.Fatalf("expected rejection with code %d, got %v", errCode, err)
+	}
+}
+
+func pngImage(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, entries int, entrySize int) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	writer := zip.NewWriter(&buf)
+	for i := range entries {
+		entry, err := writer.Create(strings.Repeat("a", i+1))
+		if err != nil {
+			t.Fatalf("create zip entry: %v", err)
+		}
+		_, err = entry.Write(make([]byte, entrySize))
+		if err != nil {
+			t.Fatalf("write zip entry: %v", err)
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestContentType(t *testing.T) {
+	t.Parallel()
+
+	pipelines := validation.NewPipelines([]validation.Validator{validation.NewContentType([]string{"image/png"})})
+	err := upload(pipelines, entity.CategoryValidation{}, pngImage(t, 1, 1))
+	if err != nil {
+		t.Fatalf("expected png to be allowed, got %v", err)
+	}
+	err = upload(pipelines, entity.CategoryValidation{}, []byte("plain text"))
+	requireRejected(t, err, domain.ErrCodeUnsupportedFileType)
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+
+	pipelines := validation.NewPipelines(nil)
+	avatars := entity.CategoryValidation{Image: entity.ImageValidation{Enabled: true, MaxWidth: 200, MaxPixels: 5000}}
+	err := upload(pipelines, avatars, pngImage(t, 50, 50))
+	if err != nil {
+		t.Fatalf("expected image within limits to be allowed, got %v", err)
+	}
+	err = upload(pipelines, avatars, pngImage(t, 100, 100))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, avatars, pngImage(t, 300, 1))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, avatars, pngImage(t, 1000, 1000)[:64])
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+
+	// категория без настроенных проверок
+	err = upload(pipelines, entity.CategoryValidation{}, pngImage(t, 100, 100))
+	if err != nil {
+		t.Fatalf("expected category without validators to allow image, got %v", err)
+	}
+}
+
+func TestZip(t *testing.T) {
+	t.Parallel()
+
+	pipelines := validation.NewPipelines(nil)
+	archives := entity.CategoryValidation{Zip: entity.ZipValidation{
+		Enabled:             true,
+		MaxEntries:          10,
+		MaxCompressionRatio: 20,
+		MaxUncompressedMb:   1,
+	}}
+	err := upload(pipelines, archives, zipArchive(t, 3, 100))
+	if err != nil {
+		t.Fatalf("expected small archive to be allowed, got %v", err)
+	}
+	err = upload(pipelines, archives, zipArchive(t, 11, 1))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, archives, zipArchive(t, 1, 512*1024))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, archives, zipArchive(t, 3, 100)[:100])
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+}
+
+func TestPdf(t *testing.T) {
+	t.Parallel()
+
+	pipelines := validation.NewPipelines(nil)
+	documents := entity.CategoryValidation{Pdf: entity.PdfValidation{Enabled: true}}
+	body := "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n"
+	pdf := body + "xref\n0 2\ntrailer\n<< /Root 1 0 R >>\nstartxref\n" + strconv.Itoa(len(body)) + "\n%%EOF\n"
+	err := upload(pipelines, documents, []byte(pdf))
+	if err != nil {
+		t.Fatalf("expected valid pdf to be allowed, got %v", err)
+	}
+	err = upload(pipelines, documents, []byte(pdf[:len(pdf)-20]))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, documents, []byte(strings.Replace(pdf, strconv.Itoa(len(body)), "999999", 1)))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+}
+
+func TestText(t *testing.T) {
+	t.Parallel()
+
+	pipelines := validation.NewPipelines(nil)
+	notes := entity.CategoryValidation{Text: entity.TextValidation{Enabled: true}}
+	// многобайтовые символы разделяются между блоками при чтении по одному байту
+	err := upload(pipelines, notes, []byte(strings.Repeat("заметка ✓ ", 100)))
+	if err != nil {
+		t.Fatalf("expected utf-8 text to be allowed, got %v", err)
+	}
+	err = upload(pipelines, notes, []byte(strings.Repeat("text ", 200)+"\xff"))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, notes, []byte(strings.Repeat("text ", 200)+"\xd0"))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+	err = upload(pipelines, notes, []byte(strings.Repeat("text ", 200)+"\x00"))
+	requireRejected(t, err, domain.ErrCodeInvalidFileContent)
+}
@@ -0,0 +1,152 @@
+package validation
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const zipEncryptedFlag = 0x1
+
+var (
+	zipLocalHeader = []byte("PK\x03\x04")
+	zipEmptyHeader = []byte("PK\x05\x06")
+)
+
+type ZipConfig struct {
+	// MaxEntries 0 - без ограничения
+	MaxEntries int
+	// MaxCompressionRatio отношение распакованного размера к размеру архива, 0 - без ограничения
+	MaxCompressionRatio int64
+	// MaxUncompressedBytes 0 - без ограничения
+	MaxUncompressedBytes int64
+}
+
+// Zip защищает от zip бомб, проверяя количество записей и степень сжатия архива,
+// включая форматы на основе zip (docx, xlsx, jar и т.п.). Архив сохраняется во временный файл,
+// так как оглавление находится в конце архива, затем записи распаковываются без сохранения,
+// чтобы заниженные в оглавлении размеры не обходили ограничения
+type Zip struct {
+	cfg ZipConfig
+}
+
+func NewZip(cfg ZipConfig) Zip {
+	return Zip{
+		cfg: cfg,
+	}
+}
+
+func (v Zip) Start(header []byte, _ string) (Check, error) {
+	if !bytes.HasPrefix(header, zipLocalHeader) && !bytes.HasPrefix(header, zipEmptyHeader) {
+		return nil, nil
+	}
+	file, err := os.CreateTemp("", "upload-*.zip")
+	if err != nil {
+		return nil, errors.WithMessage(err, "create temp file")
+	}
+	return &zipCheck{cfg: v.cfg, file: file}, nil
+}
+
+type zipCheck struct {
+	cfg  ZipConfig
+	file *os.File
+	size int64
+}
+
+func (c *zipCheck) Write(p []byte) (int, error) {
+	n, err := c.file.Write(p)
+	c.size += int64(n)
+	if err != nil {
+		return n, errors.WithMessage(err, "write temp file")
+	}
+	return n, nil
+}
+
+func (c *zipCheck) Finish() error {
+	reader, err := zip.NewReader(c.file, c.size)
+	if err != nil {
+		return invalidContent("invalid zip archive: %v", err)
+	}
+	if c.cfg.MaxEntries > 0 && len(reader.File) > c.cfg.MaxEntries {
+		return invalidContent("zip archive has %d entries, limit %d", len(reader.File), c.cfg.MaxEntries)
+	}
+
+	// размер каждой записи проверяется отдельно, чтобы сумма не переполнилась
+	declared := uint64(0)
+	for _, file := range reader.File {
+		err = c.checkUncompressed(file.UncompressedSize64)
+		if err != nil {
+			return err
+		}
+		declared += file.UncompressedSize64
+		err = c.checkUncompressed(declared)
+		if err != nil {
+			return err
+		}
+	}
+
+	limit := c.uncompressedLimit()
+	if limit <= 0 {
+		return nil
+	}
+	uncompressed := int64(0)
+	for _, file := range reader.File {
+		// зашифрованные записи не распаковать, для них учитывается размер из оглавления
+		if file.Flags&zipEncryptedFlag != 0 {
+			uncompressed += int64(min(file.UncompressedSize64, uint64(limit)+1)) // nolint:gosec
+			continue
+		}
+		n, err := c.inflate(file, limit-uncompressed+1)
+		if err != nil {
+			return invalidContent("invalid zip entry '%s': %v", file.Name, err)
+		}
+		uncompressed += n
+		if uncompressed > limit {
+			break
+		}
+	}
+	return c.checkUncompressed(uint64(uncompressed)) // nolint:gosec
+}
+
+func (c *zipCheck) Close() error {
+	_ = c.file.Close()
+	return os.Remove(c.file.Name())
+}
+
+// uncompressedLimit наименьшее из ограничений распакованного размера, 0 - без ограничения
+func (c *zipCheck) uncompressedLimit() int64 {
+	limit := c.cfg.MaxUncompressedBytes
+	if c.cfg.MaxCompressionRatio > 0 {
+		ratioLimit := c.cfg.MaxCompressionRatio * max(c.size, 1)
+		if limit <= 0 || ratioLimit < limit {
+			limit = ratioLimit
+		}
+	}
+	return limit
+}
+
+func (c *zipCheck) checkUncompressed(uncompressed uint64) error {
+	if c.cfg.MaxUncompressedBytes > 0 && uncompressed > uint64(c.cfg.MaxUncompressedBytes) {
+		return invalidContent("zip archive uncompressed size exceeds limit %d bytes", c.cfg.MaxUncompressedBytes)
+	}
+	if c.cfg.MaxCompressionRatio > 0 && uncompressed > uint64(c.cfg.MaxCompressionRatio*max(c.size, 1)) { // nolint:gosec
+		return invalidContent("zip archive compression ratio exceeds limit %d", c.cfg.MaxCompressionRatio)
+	}
+	return nil
+}
+
+func (c *zipCheck) inflate(file *zip.File, limit int64) (int64, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	n, err := io.CopyN(io.Discard, reader, limit)
+	if errors.Is(err, io.EOF) {
+		return n, nil
+	}
+	return n, err
+}
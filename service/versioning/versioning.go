@@ -0,0 +1,366 @@
+package versioning
+
+import (
+	"context"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Prefix предыдущие версии файла хранятся в бакете категории под ключом
+// Prefix + <имя файла> + "/" + <идентификатор версии>
+const Prefix = ".versions/"
+
+type VersionTxRunner interface {
+	VersionTx(ctx context.Context, tx func(ctx context.Context, tx VersionTx) error) error
+}
+
+type VersionTx interface {
+	InsertVersion(ctx context.Context, version entity.FileVersion) error
+	DeleteVersion(ctx context.Context, filename string, category string, versionId string) error
+	DeleteOldVersions(ctx context.Context, filename string, category string, keep int) ([]string, error)
+}
+
+type VersionRepo interface {
+	GetVersion(ctx context.Context, filename string, category string, versionId string) (*entity.FileVersion, error)
+	GetVersions(ctx context.Context, filename string, category string) ([]entity.FileVersion, error)
+}
+
+type FileRepo interface {
+	StatFile(ctx context.Context, filename string, category string) (*entity.Metadata, error)
+	CopyFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
+	MoveFile(ctx context.Context, category string, srcFilename string, dstFilename string) error
+	DeleteFile(ctx context.Context, filename string, category string) error
+}
+
+type CategorySettings interface {
+	Settings(ctx context.Context, category string) (entity.CategorySettings, error)
+}
+
+type Locks interface {
+	Check(ctx context.Context, filename string, category string) error
+}
+
+type Versions struct {
+	txRunner    VersionTxRunner
+	repo        FileRepo
+	versionRepo VersionRepo
+	categories  CategorySettings
+	locks       Locks
+}
+
+func NewVersions(
+	txRunner VersionTxRunner,
+	repo FileRepo,
+	versionRepo VersionRepo,
+	categories CategorySettings,
+	locks Locks,
+) Versions {
+	return Versions{
+		txRunner:    txRunner,
+		repo:        repo,
+		versionRepo: versionRepo,
+		categories:  categories,
+		locks:       locks,
+	}
+}
+
+func ObjectName(filename string, versionId string) string {
+	return Prefix + filename + "/" + versionId
+}
+
+// ArchiveCurrent сохраняет копию текущего содержимого файла как предыдущую версию перед перезаписью,
+// текущий файл остаётся доступным до замены. Возвращает идентификатор версии или пустую строку, если файла не было.
+// После замены вызывается Trim, при неудачной замене - Discard
+func (s Versions) ArchiveCurrent(ctx context.Context, filename string, category string) (string, error) {
+	versionId := ""
+	err := s.txRunner.VersionTx(ctx, func(ctx context.Context, tx VersionTx) error {
+		var err error
+		versionId, err = s.archive(ctx, tx, filename, category)
+		return err
+	})
+	if err != nil {
+		return "", errors.WithMessage(err, "version tx")
+	}
+	return versionId, nil
+}
+
+// Discard удаляет версию, сохранённую для незавершённой замены файла.
+// Если неудачная замена удалила текущий файл, версия становится текущим файлом
+func (s Versions) Discard(ctx context.Context, filename string, category string, versionId string) error {
+	err := s.txRunner.VersionTx(ctx, func(ctx context.Context, tx VersionTx) error {
+		err := tx.DeleteVersion(ctx, filename, category, versionId)
+		if err != nil {
+			return errors.WithMessage(err, "delete version")
+		}
+		return s.dropCopy(ctx, filename, category, versionId)
+	})
+	if err != nil {
+		return errors.WithMessage(err, "version tx")
+	}
+	return nil
+}
+
+func (s Versions) List(ctx context.Context, filename string, category string) ([]entity.FileVersion, error) {
+	versions := make([]entity.FileVersion, 0)
+	current, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+	case err != nil:
+		return nil, errors.WithMessage(err, "stat file")
+	default:
+		versions = append(versions, entity.FileVersion{
+			VersionId:   current.VersionId,
+			Filename:    filename,
+			Category:    category,
+			Size:        current.Size,
+			ContentType: current.ContentType,
+			CreatedAt:   current.CreatedAt,
+			Current:     true,
+		})
+	}
+
+	archived, err := s.versionRepo.GetVersions(ctx, filename, category)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get versions")
+	}
+	versions = append(versions, archived...)
+	if len(versions) == 0 {
+		return nil, domain.ErrFileNotFound
+	}
+	return versions, nil
+}
+
+// ObjectKey возвращает ключ объекта с содержимым указанной версии файла
+func (s Versions) ObjectKey(ctx context.Context, filename string, category string, versionId string) (string, error) {
+	_, err := s.versionRepo.GetVersion(ctx, filename, category, versionId)
+	switch {
+	case errors.Is(err, domain.ErrVersionNotFound):
+	case err != nil:
+		return "", errors.WithMessage(err, "get version")
+	default:
+		return ObjectName(filename, versionId), nil
+	}
+
+	current, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return "", domain.ErrVersionNotFound
+	case err != nil:
+		return "", errors.WithMessage(err, "stat file")
+	case current.VersionId != versionId:
+		return "", domain.ErrVersionNotFound
+	default:
+		return filename, nil
+	}
+}
+
+// Restore делает указанную предыдущую версию текущей, текущее содержимое сохраняется как версия.
+// Записи о версиях меняются в одной транзакции, при ошибке копия текущего содержимого удаляется.
+// Восстановить версию может только владелец текущего файла и восстанавливаемой версии
+func (s Versions) Restore(
+	ctx context.Context,
+	filename string,
+	category string,
+	versionId string,
+	accessor entity.Accessor,
+) error {
+	_, err := s.versionRepo.GetVersion(ctx, filename, category, versionId)
+	if err != nil {
+		return errors.WithMessage(err, "get version")
+	}
+
+	err = s.checkModify(ctx, category, accessor, filename, ObjectName(filename, versionId))
+	if err != nil {
+		return err
+	}
+
+	err = s.locks.Check(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "check lock")
+	}
+
+	err = s.txRunner.VersionTx(ctx, func(ctx context.Context, tx VersionTx) error {
+		err := tx.DeleteVersion(ctx, filename, category, versionId)
+		if err != nil {
+			return errors.WithMessage(err, "delete version")
+		}
+		archivedVersionId, err := s.archive(ctx, tx, filename, category)
+		if err != nil {
+			return errors.WithMessage(err, "archive current")
+		}
+		err = s.repo.MoveFile(ctx, category, ObjectName(filename, versionId), filename)
+		if err == nil {
+			return nil
+		}
+		if archivedVersionId != "" {
+			dropErr := s.dropCopy(ctx, filename, category, archivedVersionId)
+			if dropErr != nil {
+				return errors.WithMessagef(err, "move version to current, drop copy of current: %v", dropErr)
+			}
+		}
+		return errors.WithMessage(err, "move version to current")
+	})
+	if err != nil {
+		return errors.WithMessage(err, "version tx")
+	}
+
+	err = s.Trim(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "trim versions")
+	}
+	return nil
+}
+
+// Delete удаляет предыдущую версию файла, версии заблокированного файла не удаляются.
+// Удалить версию может только владелец текущего файла и удаляемой версии
+func (s Versions) Delete(
+	ctx context.Context,
+	filename string,
+	category string,
+	versionId string,
+	accessor entity.Accessor,
+) error {
+	err := s.checkModify(ctx, category, accessor, filename, ObjectName(filename, versionId))
+	if err != nil {
+		return err
+	}
+
+	err = s.locks.Check(ctx, filename, category)
+	if err != nil {
+		return errors.WithMessage(err, "check lock")
+	}
+
+	current, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+	case err != nil:
+		return errors.WithMessage(err, "stat file")
+	case current.VersionId == versionId:
+		return domain.ErrCannotDeleteCurrent
+	}
+
+	err = s.txRunner.VersionTx(ctx, func(ctx context.Context, tx VersionTx) error {
+		err := tx.DeleteVersion(ctx, filename, category, versionId)
+		if err != nil {
+			return errors.WithMessage(err, "delete version")
+		}
+		err = s.repo.DeleteFile(ctx, ObjectName(filename, versionId), category)
+		if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+			return errors.WithMessage(err, "delete version file")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "version tx")
+	}
+	return nil
+}
+
+// checkModify проверяет, что accessor владеет существующими объектами objectNames
+func (s Versions) checkModify(ctx context.Context, category string, accessor entity.Accessor, objectNames ...string) error {
+	if accessor.Unrestricted {
+		return nil
+	}
+	for _, objectName := range objectNames {
+		metadata, err := s.repo.StatFile(ctx, objectName, category)
+		switch {
+		case errors.Is(err, domain.ErrFileNotFound):
+		case err != nil:
+			return errors.WithMessage(err, "stat file")
+		case !metadata.CanModify(accessor):
+			return domain.AccessDenied(accessor.Anonymous())
+		}
+	}
+	return nil
+}
+
+// archive копирует текущий файл под ключ версии и добавляет запись о версии в транзакции tx
+func (s Versions) archive(ctx context.Context, tx VersionTx, filename string, category string) (string, error) {
+	current, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		return "", nil
+	case err != nil:
+		return "", errors.WithMessage(err, "stat file")
+	}
+
+	// файл мог быть загружен до включения версионирования
+	versionId := current.VersionId
+	if versionId == "" {
+		versionId = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	version := entity.FileVersion{
+		VersionId:   versionId,
+		Filename:    filename,
+		Category:    category,
+		Size:        current.Size,
+		ContentType: current.ContentType,
+		CreatedAt:   current.CreatedAt,
+		ArchivedAt:  &now,
+	}
+	err = tx.InsertVersion(ctx, version)
+	if err != nil {
+		return "", errors.WithMessage(err, "insert version")
+	}
+	err = s.repo.CopyFile(ctx, category, filename, ObjectName(filename, versionId))
+	if err != nil {
+		return "", errors.WithMessage(err, "copy current to version")
+	}
+	return versionId, nil
+}
+
+// dropCopy удаляет копию, сделанную archive, или возвращает её на место текущего файла,
+// если неудачная замена удалила текущий файл
+func (s Versions) dropCopy(ctx context.Context, filename string, category string, versionId string) error {
+	_, err := s.repo.StatFile(ctx, filename, category)
+	switch {
+	case errors.Is(err, domain.ErrFileNotFound):
+		err = s.repo.MoveFile(ctx, category, ObjectName(filename, versionId), filename)
+		if err != nil {
+			return errors.WithMessage(err, "move version to current")
+		}
+		return nil
+	case err != nil:
+		return errors.WithMessage(err, "stat file")
+	}
+	err = s.repo.DeleteFile(ctx, ObjectName(filename, versionId), category)
+	if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+		return errors.WithMessage(err, "delete version file")
+	}
+	return nil
+}
+
+// Trim удаляет самые старые версии сверх ограничения категории, 0 - без ограничения
+func (s Versions) Trim(ctx context.Context, filename string, category string) error {
+	settings, err := s.categories.Settings(ctx, category)
+	if err != nil {
+		return errors.WithMessage(err, "get category settings")
+	}
+	maxVersions := settings.MaxVersions
+	if maxVersions <= 0 {
+		return nil
+	}
+	err = s.txRunner.VersionTx(ctx, func(ctx context.Context, tx VersionTx) error {
+		versionIds, err := tx.DeleteOldVersions(ctx, filename, category, maxVersions)
+		if err != nil {
+			return errors.WithMessage(err, "delete old versions")
+		}
+		for _, versionId := range versionIds {
+			err = s.repo.DeleteFile(ctx, ObjectName(filename, versionId), category)
+			if err != nil && !errors.Is(err, domain.ErrFileNotFound) {
+				return errors.WithMessagef(err, "delete version file '%s'", versionId)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "version tx")
+	}
+	return nil
+}
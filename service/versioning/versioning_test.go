@@ -0,0 +1,331 @@
+package versioning_test
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"storage-service/domain"
+	"storage-service/entity"
+	"storage-service/service/versioning"
+
+	"github.com/pkg/errors"
+)
+
+// repo записи о версиях, транзакция откатывает изменения при ошибке
+type repo struct {
+	versions map[string]entity.FileVersion
+}
+
+func (r *repo) VersionTx(ctx context.Context, tx func(ctx context.Context, tx versioning.VersionTx) error) error {
+	versions := maps.Clone(r.versions)
+	err := tx(ctx, r)
+	if err != nil {
+		r.versions = versions
+	}
+	return err
+}
+
+func (r *repo) InsertVersion(_ context.Context, version entity.FileVersion) error {
+	r.versions[version.VersionId] = version
+	return nil
+}
+
+func (r *repo) DeleteVersion(_ context.Context, _ string, _ string, versionId string) error {
+	_, ok := r.versions[versionId]
+	if !ok {
+		return domain.ErrVersionNotFound
+	}
+	delete(r.versions, versionId)
+	return nil
+}
+
+func (r *repo) DeleteOldVersions(_ context.Context, _ string, _ string, keep int) ([]string, error) {
+	deleted := make([]string, 0)
+	for versionId, version := range r.versions {
+		newer := 0
+		for _, other := range r.versions {
+			if other.ArchivedAt.After(*version.ArchivedAt) {
+				newer++
+			}
+		}
+		if newer >= keep {
+			deleted = append(deleted, versionId)
+		}
+	}
+	for _, versionId := range deleted {
+		delete(r.versions, versionId)
+	}
+	return deleted, nil
+}
+
+func (r *repo) GetVersion(_ context.Context, _ string, _ string, versionId string) (*entity.FileVersion, error) {
+	version, ok := r.versions[versionId]
+	if !ok {
+		return nil, domain.ErrVersionNotFound
+	}
+	return &version, nil
+}
+
+func (r *repo) GetVersions(context.Context, string, string) ([]entity.FileVersion, error) {
+	return nil, nil
+}
+
+// storage объекты бакета: ключ - содержимое, moveErr имитирует однократный сбой переноса,
+// после которого копия под новым именем удалена, owner владелец всех объектов
+type storage struct {
+	objects map[string]string
+	owner   string
+	moveErr error
+	failed  bool
+}
+
+func (s *storage) StatFile(_ context.Context, filename string, _ string) (*entity.Metadata, error) {
+	content, ok := s.objects[filename]
+	if !ok {
+		return nil, domain.ErrFileNotFound
+	}
+	return &entity.Metadata{Filename: filename, VersionId: content, Owner: s.owner}, nil
+}
+
+func (s *storage) CopyFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	content, ok := s.objects[srcFilename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	s.objects[dstFilename] = content
+	return nil
+}
+
+func (s *storage) MoveFile(_ context.Context, _ string, srcFilename string, dstFilename string) error {
+	_, ok := s.objects[srcFilename]
+	if !ok {
+		return domain.ErrFileNotFound
+	}
+	if s.moveErr != nil && !s.failed {
+		s.failed = true
+		delete(s.objects, dstFilename)
+		return s.moveErr
+	}
+	s.objects[dstFilename] = s.objects[srcFilename]
+	delete(s.objects, srcFilename)
+	return nil
+}
+
+func (s *storage) DeleteFile(_ context.Context, filename string, _ string) error {
+	delete(s.objects, filename)
+	return nil
+}
+
+type settings int
+
+func (s settings) Settings(context.Context, string) (entity.CategorySettings, error) {
+	return entity.CategorySettings{Versioning: true, MaxVersions: int(s)}, nil
+}
+
+type locks bool
+
+func (l locks) Check(context.Context, string, string) error {
+	if l {
+		return domain.ErrFileLocked
+	}
+	return nil
+}
+
+var admin = entity.Accessor{Unrestricted: true}
+
+func newVersions(repo *repo, storage *storage, maxVersions int) versioning.Versions {
+	return versioning.NewVersions(repo, storage, repo, settings(maxVersions), locks(false))
+}
+
+func TestArchiveCurrentKeepsFile(t *testing.T) {
+	t.Parallel()
+
+	repo := &repo{versions: map[string]entity.FileVersion{}}
+	storage := &storage{objects: map[string]string{"a.txt": "v1"}}
+	service := newVersions(repo, storage, 0)
+
+	versionId, err := service.ArchiveCurrent(t.Context(), "a.txt", "docs")
+	if err != nil {
+		t.Fatalf("archive current: %v", err)
+	}
+	if versionId != "v1" {
+		t.Fatalf("expected version of current file, got %q", versionId)
+	}
+	if storage.objects["a.txt"] != "v1" || storage.objects[versioning.ObjectName("a.txt", "v1")] != "v1" {
+		t.Fatalf("current file must stay readable while archived, got %v", storage.objects)
+	}
+	if _, ok := repo.versions["v1"]; !ok {
+		t.Fatal("version record is not saved")
+	}
+
+	versionId, err = service.ArchiveCurrent(t.Context(), "missing.txt", "docs")
+	if err != nil || versionId != "" {
+		t.Fatalf("expected no version of missing file, got %q, %v", versionId, err)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		current bool
+	}{
+		{name: "current file is kept", current: true},
+		{name: "current file is removed by failed replace"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := &repo{versions: map[string]entity.FileVersion{}}
+			storage := &storage{objects: map[string]string{"a.txt": "v1"}}
+			service := newVersions(repo, storage, 0)
+
+			versionId, err := service.ArchiveCurrent(t.Context(), "a.txt", "docs")
+			if err != nil {
+				t.Fatalf("archive current: %v", err)
+			}
+			if !test.current {
+				delete(storage.objects, "a.txt")
+			}
+
+			err = service.Discard(t.Context(), "a.txt", "docs", versionId)
+			if err != nil {
+				t.Fatalf("discard: %v", err)
+			}
+			expected := map[string]string{"a.txt": "v1"}
+			if !maps.Equal(storage.objects, expected) {
+				t.Fatalf("expected %v, got %v", expected, storage.objects)
+			}
+			if len(repo.versions) != 0 {
+				t.Fatalf("version record must be deleted, got %v", repo.versions)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	t.Parallel()
+
+	archivedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	laterArchivedAt := archivedAt.Add(time.Minute)
+	repo := &repo{versions: map[string]entity.FileVersion{
+		"v0": {VersionId: "v0", ArchivedAt: &archivedAt},
+		"v1": {VersionId: "v1", ArchivedAt: &laterArchivedAt},
+	}}
+	storage := &storage{objects: map[string]string{
+		"a.txt":                              "v2",
+		versioning.ObjectName("a.txt", "v0"): "v0",
+		versioning.ObjectName("a.txt", "v1"): "v1",
+	}}
+	service := newVersions(repo, storage, 2)
+
+	err := service.Restore(t.Context(), "a.txt", "docs", "v1", admin)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if storage.objects["a.txt"] != "v1" || storage.objects[versioning.ObjectName("a.txt", "v2")] != "v2" {
+		t.Fatalf("expected restored version to become current, got %v", storage.objects)
+	}
+	if _, ok := repo.versions["v1"]; ok {
+		t.Fatal("restored version record must be deleted")
+	}
+	if _, ok := repo.versions["v2"]; !ok {
+		t.Fatal("replaced content must be archived")
+	}
+}
+
+func TestRestoreFailedMove(t *testing.T) {
+	t.Parallel()
+
+	archivedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	repo := &repo{versions: map[string]entity.FileVersion{
+		"v1": {VersionId: "v1", ArchivedAt: &archivedAt},
+	}}
+	storage := &storage{
+		objects: map[string]string{
+			"a.txt":                              "v2",
+			versioning.ObjectName("a.txt", "v1"): "v1",
+		},
+		moveErr: errors.New("remove object"),
+	}
+	service := newVersions(repo, storage, 0)
+
+	err := service.Restore(t.Context(), "a.txt", "docs", "v1", admin)
+	if !errors.Is(err, storage.moveErr) {
+		t.Fatalf("expected move error, got %v", err)
+	}
+	expected := map[string]string{
+		"a.txt":                              "v2",
+		versioning.ObjectName("a.txt", "v1"): "v1",
+	}
+	if !maps.Equal(storage.objects, expected) {
+		t.Fatalf("expected current file to be kept, got %v", storage.objects)
+	}
+	if len(repo.versions) != 1 || repo.versions["v1"].VersionId != "v1" {
+		t.Fatalf("version records must be rolled back, got %v", repo.versions)
+	}
+}
+
+func TestDeleteLockedFileVersion(t *testing.T) {
+	t.Parallel()
+
+	archivedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	repo := &repo{versions: map[string]entity.FileVersion{
+		"v1": {VersionId: "v1", ArchivedAt: &archivedAt},
+	}}
+	storage := &storage{objects: map[string]string{
+		"a.txt":                              "v2",
+		versioning.ObjectName("a.txt", "v1"): "v1",
+	}}
+	service := versioning.NewVersions(repo, storage, repo, settings(0), locks(true))
+
+	err := service.Delete(t.Context(), "a.txt", "docs", "v1", admin)
+	if !errors.Is(err, domain.ErrFileLocked) {
+		t.Fatalf("expected locked error, got %v", err)
+	}
+	if len(repo.versions) != 1 || len(storage.objects) != 2 {
+		t.Fatalf("version of locked file must be kept, got %v and %v", repo.versions, storage.objects)
+	}
+}
+
+func TestChangeVersionsOfOtherOwner(t *testing.T) {
+	t.Parallel()
+
+	archivedAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	repo := &repo{versions: map[string]entity.FileVersion{
+		"v1": {VersionId: "v1", ArchivedAt: &archivedAt},
+	}}
+	storage := &storage{
+		objects: map[string]string{
+			"a.txt":                              "v2",
+			versioning.ObjectName("a.txt", "v1"): "v1",
+		},
+		owner: "alice",
+	}
+	service := newVersions(repo, storage, 0)
+
+	bob := entity.Accessor{Subject: "bob"}
+	err := service.Restore(t.Context(), "a.txt", "docs", "v1", bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden error on restore, got %v", err)
+	}
+	err = service.Delete(t.Context(), "a.txt", "docs", "v1", bob)
+	if !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("expected forbidden error on delete, got %v", err)
+	}
+	if len(repo.versions) != 1 || storage.objects["a.txt"] != "v2" {
+		t.Fatalf("versions must be kept, got %v and %v", repo.versions, storage.objects)
+	}
+
+	err = service.Restore(t.Context(), "a.txt", "docs", "v1", entity.Accessor{Subject: "alice"})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if storage.objects["a.txt"] != "v1" {
+		t.Fatalf("expected restored version to become current, got %v", storage.objects)
+	}
+}
@@ -0,0 +1,313 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"storage-service/entity"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	EventIdHeader   = "X-Storage-Event-Id"
+	EventTypeHeader = "X-Storage-Event-Type"
+	// SignatureHeader подпись в формате t=<unix time>,v1=<hex HMAC-SHA256 секрета от "<unix time>.<тело запроса>">
+	SignatureHeader = "X-Storage-Signature"
+
+	defaultListLimit = 100
+	// maxErrorBodySize часть ответа получателя, сохраняемая в last_error
+	maxErrorBodySize = 512
+	// claimTimeout время, на которое доставка откладывается при захвате,
+	// доставка, не обновлённая после отправки, будет повторена по его истечении
+	claimTimeout = time.Hour
+)
+
+// payload тело запроса к получателю, подписывается целиком
+type payload struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Category  string    `json:"category"`
+	Filename  string    `json:"filename"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WebhookTxRunner interface {
+	WebhookTx(ctx context.Context, tx func(ctx context.Context, tx WebhookTx) error) error
+}
+
+type WebhookTx interface {
+	GetSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	DeleteSubscriptions(ctx context.Context, names []string) error
+	UpsertSubscription(ctx context.Context, subscription entity.WebhookSubscription) error
+}
+
+type WebhookRepo interface {
+	ClaimDueDeliveries(ctx context.Context, now time.Time, claimedUntil time.Time, limit int) ([]entity.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	ListDeadDeliveries(ctx context.Context, subscription string, limit int, offset int) ([]entity.WebhookDelivery, error)
+	RetryDeadDelivery(ctx context.Context, id int64, now time.Time) error
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) error
+}
+
+type Config struct {
+	BatchSize   int
+	Concurrency int
+	// MaxAttempts после этого числа неудачных попыток доставка переносится в dead letter
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	// EventRetention срок хранения событий, доставленных всем подпискам
+	EventRetention time.Duration
+	Subscriptions  []entity.WebhookSubscription
+}
+
+type Webhooks struct {
+	txRunner      WebhookTxRunner
+	repo          WebhookRepo
+	client        *http.Client
+	subscriptions map[string]entity.WebhookSubscription
+	cfg           Config
+}
+
+func NewWebhooks(
+	txRunner WebhookTxRunner,
+	repo WebhookRepo,
+	cfg Config,
+) Webhooks {
+	subscriptions := make(map[string]entity.WebhookSubscription, len(cfg.Subscriptions))
+	for _, subscription := range cfg.Subscriptions {
+		subscriptions[subscription.Name] = subscription
+	}
+	return Webhooks{
+		txRunner:      txRunner,
+		repo:          repo,
+		client:        &http.Client{Timeout: cfg.Timeout},
+		subscriptions: subscriptions,
+		cfg:           cfg,
+	}
+}
+
+// SyncSubscriptions сохраняет подписки из конфигурации, по ним создаются доставки новых событий.
+// Записываются только изменённые подписки, доставки удалённых подписок сохраняются
+// и переносятся в dead letter при следующей попытке
+func (s Webhooks) SyncSubscriptions(ctx context.Context) error {
+	err := s.txRunner.WebhookTx(ctx, func(ctx context.Context, tx WebhookTx) error {
+		stored, err := tx.GetSubscriptions(ctx)
+		if err != nil {
+			return errors.WithMessage(err, "get subscriptions")
+		}
+
+		current := make(map[string]entity.WebhookSubscription, len(stored))
+		for _, subscription := range stored {
+			current[subscription.Name] = subscription
+		}
+		for _, subscription := range s.cfg.Subscriptions {
+			existing, ok := current[subscription.Name]
+			delete(current, subscription.Name)
+			if ok && sameFilter(existing, subscription) {
+				continue
+			}
+			err = tx.UpsertSubscription(ctx, subscription)
+			if err != nil {
+				return errors.WithMessagef(err, "upsert subscription '%s'", subscription.Name)
+			}
+		}
+
+		if len(current) == 0 {
+			return nil
+		}
+		removed := make([]string, 0, len(current))
+		for name := range current {
+			removed = append(removed, name)
+		}
+		err = tx.DeleteSubscriptions(ctx, removed)
+		if err != nil {
+			return errors.WithMessage(err, "delete subscriptions")
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.WithMessage(err, "webhook tx")
+	}
+	return nil
+}
+
+// Deliver отправляет не более cfg.BatchSize событий, время доставки которых наступило,
+// ошибка доставки одного события не влияет на остальные.
+// Доставки захватываются отдельным запросом, поэтому отправка не удерживает транзакцию
+func (s Webhooks) Deliver(ctx context.Context) error {
+	now := time.Now().UTC()
+	deliveries, err := s.repo.ClaimDueDeliveries(ctx, now, now.Add(claimTimeout), s.cfg.BatchSize)
+	if err != nil {
+		return errors.WithMessage(err, "claim due deliveries")
+	}
+
+	results := s.sendAll(ctx, deliveries)
+	for _, delivery := range results {
+		err = s.repo.UpdateDelivery(ctx, delivery)
+		if err != nil {
+			return errors.WithMessagef(err, "update delivery %d", delivery.Id)
+		}
+	}
+
+	err = s.repo.DeleteDeliveredEvents(ctx, time.Now().UTC().Add(-s.cfg.EventRetention))
+	if err != nil {
+		return errors.WithMessage(err, "delete delivered events")
+	}
+	return nil
+}
+
+func (s Webhooks) ListDeadLetters(
+	ctx context.Context,
+	subscription string,
+	limit int,
+	offset int,
+) ([]entity.WebhookDelivery, error) {
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	deliveries, err := s.repo.ListDeadDeliveries(ctx, subscription, limit, offset)
+	if err != nil {
+		return nil, errors.WithMessage(err, "list dead deliveries")
+	}
+	return deliveries, nil
+}
+
+// RetryDeadLetter возвращает недоставленное событие в очередь с обнулённым счётчиком попыток
+func (s Webhooks) RetryDeadLetter(ctx context.Context, id int64) error {
+	err := s.repo.RetryDeadDelivery(ctx, id, time.Now().UTC())
+	if err != nil {
+		return errors.WithMessage(err, "retry dead delivery")
+	}
+	return nil
+}
+
+// sendAll отправляет события параллельно, не более cfg.Concurrency одновременно,
+// и возвращает доставки с обновлённым состоянием
+func (s Webhooks) sendAll(ctx context.Context, deliveries []entity.WebhookDelivery) []entity.WebhookDelivery {
+	var wg sync.WaitGroup
+	results := make([]entity.WebhookDelivery, len(deliveries))
+	sem := make(chan struct{}, max(s.cfg.Concurrency, 1))
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = s.deliver(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (s Webhooks) deliver(ctx context.Context, delivery entity.WebhookDelivery) entity.WebhookDelivery {
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	delivery.Attempts++
+
+	var err error
+	subscription, ok := s.subscriptions[delivery.Subscription]
+	if ok {
+		err = s.send(ctx, subscription, delivery, now)
+	} else {
+		err = errors.New("subscription is not configured")
+	}
+	switch {
+	case err == nil:
+		delivery.Status = entity.WebhookDeliveryDelivered
+		delivery.LastError = ""
+	case !ok || delivery.Attempts >= s.cfg.MaxAttempts:
+		delivery.Status = entity.WebhookDeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts))
+	}
+	return delivery
+}
+
+func (s Webhooks) send(
+	ctx context.Context,
+	subscription entity.WebhookSubscription,
+	delivery entity.WebhookDelivery,
+	now time.Time,
+) error {
+	body, err := json.Marshal(payload{
+		Id:        delivery.EventId,
+		Type:      delivery.EventType,
+		Category:  delivery.Category,
+		Filename:  delivery.Filename,
+		Actor:     delivery.Actor,
+		CreatedAt: delivery.EventCreatedAt,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "marshal event")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithMessage(err, "new request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIdHeader, strconv.FormatInt(delivery.EventId, 10))
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, now, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithMessage(err, "send request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return errors.Errorf("unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// backoff экспоненциальная задержка перед попыткой attempts+1, не более cfg.MaxBackoff
+func (s Webhooks) backoff(attempts int) time.Duration {
+	delay := s.cfg.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= s.cfg.MaxBackoff {
+			return s.cfg.MaxBackoff
+		}
+	}
+	return min(delay, s.cfg.MaxBackoff)
+}
+
+// sameFilter в базе хранятся только условия подписки, адрес и секрет берутся из конфигурации
+func sameFilter(stored entity.WebhookSubscription, configured entity.WebhookSubscription) bool {
+	return slices.Equal(stored.Categories, configured.Categories) &&
+		slices.Equal(stored.EventTypes, configured.EventTypes)
+}
+
+// Sign подпись тела запроса, получатель проверяет её тем же секретом
+func Sign(secret string, now time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
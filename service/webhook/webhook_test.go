@@ -0,0 +1,288 @@
+package webhook_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"storage-service/entity"
+	"storage-service/service/webhook"
+)
+
+// repo доставки по идентификатору и сохранённые подписки
+type repo struct {
+	deliveries    map[int64]entity.WebhookDelivery
+	subscriptions map[string]entity.WebhookSubscription
+	upserted      []string
+	deleted       []string
+}
+
+func newRepo(deliveries ...entity.WebhookDelivery) *repo {
+	r := &repo{
+		deliveries:    map[int64]entity.WebhookDelivery{},
+		subscriptions: map[string]entity.WebhookSubscription{},
+	}
+	for _, delivery := range deliveries {
+		r.deliveries[delivery.Id] = delivery
+	}
+	return r
+}
+
+func (r *repo) WebhookTx(ctx context.Context, tx func(ctx context.Context, tx webhook.WebhookTx) error) error {
+	subscriptions := maps.Clone(r.subscriptions)
+	err := tx(ctx, r)
+	if err != nil {
+		r.subscriptions = subscriptions
+	}
+	return err
+}
+
+func (r *repo) GetSubscriptions(context.Context) ([]entity.WebhookSubscription, error) {
+	return slices.Collect(maps.Values(r.subscriptions)), nil
+}
+
+func (r *repo) DeleteSubscriptions(_ context.Context, names []string) error {
+	for _, name := range names {
+		delete(r.subscriptions, name)
+		r.deleted = append(r.deleted, name)
+	}
+	return nil
+}
+
+func (r *repo) UpsertSubscription(_ context.Context, subscription entity.WebhookSubscription) error {
+	// в базе хранятся только условия подписки
+	r.subscriptions[subscription.Name] = entity.WebhookSubscription{
+		Name:       subscription.Name,
+		Categories: subscription.Categories,
+		EventTypes: subscription.EventTypes,
+	}
+	r.upserted = append(r.upserted, subscription.Name)
+	return nil
+}
+
+func (r *repo) ClaimDueDeliveries(
+	_ context.Context,
+	now time.Time,
+	claimedUntil time.Time,
+	limit int,
+) ([]entity.WebhookDelivery, error) {
+	claimed := make([]entity.WebhookDelivery, 0)
+	for _, id := range slices.Sorted(maps.Keys(r.deliveries)) {
+		delivery := r.deliveries[id]
+		if len(claimed) == limit || delivery.Status != entity.WebhookDeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = claimedUntil
+		r.deliveries[id] = delivery
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+func (r *repo) UpdateDelivery(_ context.Context, delivery entity.WebhookDelivery) error {
+	if r.deliveries[delivery.Id].Status == entity.WebhookDeliveryPending {
+		r.deliveries[delivery.Id] = delivery
+	}
+	return nil
+}
+
+func (r *repo) ListDeadDeliveries(context.Context, string, int, int) ([]entity.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (r *repo) RetryDeadDelivery(context.Context, int64, time.Time) error {
+	return nil
+}
+
+func (r *repo) DeleteDeliveredEvents(context.Context, time.Time) error {
+	return nil
+}
+
+func delivery(id int64, subscription string, attempts int) entity.WebhookDelivery {
+	return entity.WebhookDelivery{
+		Id:            id,
+		Subscription:  subscription,
+		Status:        entity.WebhookDeliveryPending,
+		Attempts:      attempts,
+		NextAttemptAt: time.Now().UTC().Add(-time.Minute),
+		EventId:       id,
+		EventType:     entity.EventUploaded,
+		Category:      "docs",
+		Filename:      "a.txt",
+	}
+}
+
+func config(url string) webhook.Config {
+	return webhook.Config{
+		BatchSize:      10,
+		Concurrency:    2,
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     4 * time.Second,
+		Timeout:        time.Second,
+		Subscriptions: []entity.WebhookSubscription{
+			{Name: "crm", Url: url, Secret: "secret", Categories: []string{"docs"}},
+		},
+	}
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":1}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	expected := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	signature := webhook.Sign("secret", now, body)
+	if signature != expected {
+		t.Fatalf("expected %s, got %s", expected, signature)
+	}
+	if webhook.Sign("other", now, body) == signature {
+		t.Fatalf("signature must depend on secret")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	t.Parallel()
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := r.Header.Get(webhook.SignatureHeader)
+		timestamp, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+		unix, _ := strconv.ParseInt(timestamp, 10, 64)
+		if signature != webhook.Sign("secret", time.Unix(unix, 0), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(webhook.EventIdHeader) != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	repo := newRepo(delivery(1, "crm", 0), delivery(2, "removed", 0))
+	service := webhook.NewWebhooks(repo, repo, config(server.URL))
+
+	err := service.Deliver(t.Context())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if received.Load() != 1 {
+		t.Fatalf("expected one signed request, got %d", received.Load())
+	}
+	delivered := repo.deliveries[1]
+	if delivered.Status != entity.WebhookDeliveryDelivered || delivered.Attempts != 1 {
+		t.Fatalf("expected delivered after one attempt, got %+v", delivered)
+	}
+	dead := repo.deliveries[2]
+	if dead.Status != entity.WebhookDeliveryDead || dead.LastError == "" {
+		t.Fatalf("delivery of removed subscription must be dead, got %+v", dead)
+	}
+}
+
+func TestDeliverBackoff(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("maintenance"))
+	}))
+	defer server.Close()
+
+	repo := newRepo(delivery(1, "crm", 0), delivery(2, "crm", 2), delivery(3, "crm", 3), delivery(4, "crm", 4))
+	service := webhook.NewWebhooks(repo, repo, config(server.URL))
+
+	err := service.Deliver(t.Context())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	expected := map[int64]time.Duration{1: time.Second, 2: 4 * time.Second, 3: 4 * time.Second}
+	for id, backoff := range expected {
+		delivery := repo.deliveries[id]
+		if delivery.Status != entity.WebhookDeliveryPending {
+			t.Fatalf("delivery %d must be retried, got %+v", id, delivery)
+		}
+		if delay := delivery.NextAttemptAt.Sub(delivery.UpdatedAt); delay != backoff {
+			t.Fatalf("delivery %d: expected backoff %s, got %s", id, backoff, delay)
+		}
+		if !strings.Contains(delivery.LastError, "maintenance") {
+			t.Fatalf("delivery %d: expected response body in last error, got %q", id, delivery.LastError)
+		}
+	}
+	if repo.deliveries[4].Status != entity.WebhookDeliveryDead {
+		t.Fatalf("delivery must be dead after max attempts, got %+v", repo.deliveries[4])
+	}
+}
+
+func TestClaimedDeliveryIsNotResent(t *testing.T) {
+	t.Parallel()
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	repo := newRepo(delivery(1, "crm", 0))
+	service := webhook.NewWebhooks(repo, repo, config(server.URL))
+
+	// захват другого экземпляра откладывает доставку
+	_, err := repo.ClaimDueDeliveries(t.Context(), time.Now().UTC(), time.Now().UTC().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	err = service.Deliver(t.Context())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if received.Load() != 0 {
+		t.Fatalf("claimed delivery must not be sent twice")
+	}
+}
+
+func TestSyncSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	repo := newRepo()
+	repo.subscriptions["crm"] = entity.WebhookSubscription{Name: "crm", Categories: []string{"docs"}, EventTypes: []string{}}
+	repo.subscriptions["old"] = entity.WebhookSubscription{Name: "old"}
+	cfg := config("http://localhost")
+	cfg.Subscriptions = append(cfg.Subscriptions, entity.WebhookSubscription{Name: "audit", EventTypes: []string{entity.EventDeleted}})
+	service := webhook.NewWebhooks(repo, repo, cfg)
+
+	err := service.SyncSubscriptions(t.Context())
+	if err != nil {
+		t.Fatalf("sync subscriptions: %v", err)
+	}
+	if !slices.Equal(repo.upserted, []string{"audit"}) {
+		t.Fatalf("only changed subscriptions must be written, got %v", repo.upserted)
+	}
+	if !slices.Equal(repo.deleted, []string{"old"}) {
+		t.Fatalf("expected removed subscription to be deleted, got %v", repo.deleted)
+	}
+
+	err = service.SyncSubscriptions(t.Context())
+	if err != nil {
+		t.Fatalf("sync subscriptions: %v", err)
+	}
+	if len(repo.upserted) != 1 || len(repo.deleted) != 1 {
+		t.Fatalf("unchanged config must not write subscriptions, got %v and %v", repo.upserted, repo.deleted)
+	}
+}
@@ -3,8 +3,17 @@ package transaction
 import (
 	"context"
 	"storage-service/repository"
+	"storage-service/service"
 
+	"storage-service/service/category"
+	"storage-service/service/expiration"
+	"storage-service/service/lock"
 	"storage-service/service/pending"
+	"storage-service/service/quota"
+	"storage-service/service/reference"
+	"storage-service/service/trash"
+	"storage-service/service/versioning"
+	"storage-service/service/webhook"
 
 	"github.com/Falokut/go-kit/db"
 )
@@ -19,6 +28,7 @@ func NewManager(db db.Transactional) *Manager {
 
 type pendingTransaction struct {
 	repository.Pending
+	repository.Event
 }
 
 func (m *Manager) DeletePendingFilesTx(ctx context.Context, txRequest func(ctx context.Context, tx pending.PendingFilesTx) error) error {
@@ -26,7 +36,123 @@ func (m *Manager) DeletePendingFilesTx(ctx context.Context, txRequest func(ctx c
 		ctx,
 		func(ctx context.Context, tx *db.Tx) error {
 			pending := repository.NewPending(tx)
-			return txRequest(ctx, pendingTransaction{pending})
+			return txRequest(ctx, pendingTransaction{pending, repository.NewEvent(tx)})
+		},
+	)
+}
+
+type uploadTransaction struct {
+	repository.Expiration
+	repository.Event
+}
+
+func (m *Manager) UploadTx(ctx context.Context, txRequest func(ctx context.Context, tx service.UploadTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			expiration := repository.NewExpiration(tx)
+			return txRequest(ctx, uploadTransaction{expiration, repository.NewEvent(tx)})
+		},
+	)
+}
+
+type trashTransaction struct {
+	repository.Trash
+	repository.Event
+	repository.Pending
+	repository.Expiration
+}
+
+func (m *Manager) TrashTx(ctx context.Context, txRequest func(ctx context.Context, tx trash.TrashFilesTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			trash := repository.NewTrash(tx)
+			return txRequest(ctx, trashTransaction{
+				trash,
+				repository.NewEvent(tx),
+				repository.NewPending(tx),
+				repository.NewExpiration(tx),
+			})
+		},
+	)
+}
+
+func (m *Manager) ExpirationTx(ctx context.Context, txRequest func(ctx context.Context, tx expiration.ExpiredFilesTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			return txRequest(ctx, repository.NewExpiration(tx))
+		},
+	)
+}
+
+func (m *Manager) LockTx(ctx context.Context, txRequest func(ctx context.Context, tx lock.LockTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			return txRequest(ctx, repository.NewLock(tx))
+		},
+	)
+}
+
+type categoryTransaction struct {
+	repository.Category
+	repository.Event
+}
+
+func (m *Manager) CategoryTx(ctx context.Context, txRequest func(ctx context.Context, tx category.CategoryTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			category := repository.NewCategory(tx)
+			return txRequest(ctx, categoryTransaction{category, repository.NewEvent(tx)})
+		},
+	)
+}
+
+type versionTransaction struct {
+	repository.Version
+}
+
+func (m *Manager) VersionTx(ctx context.Context, txRequest func(ctx context.Context, tx versioning.VersionTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			version := repository.NewVersion(tx)
+			return txRequest(ctx, versionTransaction{version})
+		},
+	)
+}
+
+func (m *Manager) ReferenceTx(ctx context.Context, txRequest func(ctx context.Context, tx reference.ReferenceTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			return txRequest(ctx, repository.NewReference(tx))
+		},
+	)
+}
+
+type webhookTransaction struct {
+	repository.Webhook
+}
+
+func (m *Manager) WebhookTx(ctx context.Context, txRequest func(ctx context.Context, tx webhook.WebhookTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			webhook := repository.NewWebhook(tx)
+			return txRequest(ctx, webhookTransaction{webhook})
+		},
+	)
+}
+
+func (m *Manager) QuotaTx(ctx context.Context, txRequest func(ctx context.Context, tx quota.QuotaTx) error) error {
+	return m.db.RunInTransaction(
+		ctx,
+		func(ctx context.Context, tx *db.Tx) error {
+			return txRequest(ctx, repository.NewUsage(tx))
 		},
 	)
 }